@@ -5,15 +5,20 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/kbuckham/mmcd/internal/gps"
 	"github.com/kbuckham/mmcd/internal/logger"
 	"github.com/kbuckham/mmcd/internal/protocol"
 	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/vehicle"
 	"github.com/kbuckham/mmcd/internal/version"
+	"github.com/kbuckham/mmcd/internal/wideband"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
@@ -22,23 +27,46 @@ type App struct {
 	ctx context.Context
 
 	mu            sync.Mutex
+	vehicle       *vehicle.Vehicle
 	defs          []sensor.Definition
-	conn          *protocol.SerialConn
+	sensorsFile   string                // user sensor profile applied to defs, if any
+	derived       []string              // built-in expression channels added to defs
+	fueling       sensor.FuelingOptions // upgraded injectors/MAF; zero is the vehicle's stock
+	unitOverrides map[string]string     // per-sensor display units applied to defs
+	wideband      WidebandSettings      // wideband O2 input; adds WBO2 to defs when set
+	wbSource      *wideband.Source      // open wideband input while monitoring a live ECU
+	gps           GPSSettings           // GPS receiver; adds the GPS channels to defs when set
+	gpsSource     *gps.Source           // open GPS input while monitoring a live ECU
+	conn          protocol.Transport
 	ecu           *protocol.ECU
 	sim           *protocol.Simulator
+	replay        *logger.ReplayPoller
+	liveDefs      []sensor.Definition // defs to restore when a replay, which runs with the log's, ends
 	lg            *logger.Logger
-	csvWriter     *logger.CSVWriter
+	sup           *logger.Supervisor // reconnect loop for a live ECU; nil in demo and replay
+	logWriter     logger.SampleWriter
+	stopLogSample func() // removes the log writer's sample callback
+	logOptions    logger.WriterOptions
+	logFormat     string // file format the frontend names new logs in, see SetLogFormat
 	units         sensor.UnitSystem
 	activeIndices []int
+	schedule      map[string]float64 // per-sensor poll rates; nil polls every sensor each cycle
 	connected     bool
 	demoMode      bool
+	demoFaults    protocol.FaultProfile
 	commLog       *CommLog
 }
 
 // NewApp creates a new App instance.
 func NewApp() *App {
+	v, _ := vehicle.Get("")
+	defs, err := v.Definitions()
+	if err != nil {
+		defs = sensor.DefaultDefinitions()
+	}
 	return &App{
-		defs:    sensor.DefaultDefinitions(),
+		vehicle: v,
+		defs:    defs,
 		units:   sensor.UnitMetric,
 		commLog: newCommLog(),
 	}
@@ -63,7 +91,8 @@ func (a *App) ListSerialPorts() ([]string, error) {
 	return protocol.ListPorts()
 }
 
-// Connect opens a serial connection to the ECU.
+// Connect opens a connection to the ECU. port is a serial device name or a
+// network bridge address (tcp://host:port or rfc2217://host:port).
 func (a *App) Connect(port string, baud int) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -76,12 +105,17 @@ func (a *App) Connect(port string, baud int) error {
 		baud = protocol.DefaultBaudRate
 	}
 
-	a.conn = protocol.NewSerialConn(port, baud)
-	if err := a.conn.Open(); err != nil {
+	conn, err := protocol.NewTransport(port, baud)
+	if err != nil {
 		return err
 	}
+	if err := conn.Open(); err != nil {
+		return err
+	}
+	a.conn = conn
 
 	a.ecu = protocol.NewECU(a.conn, a.defs)
+	a.ecu.SetDTCTable(a.vehicle.DTCs)
 	a.connected = true
 
 	// Probe the ECU to verify communication before declaring success
@@ -112,6 +146,10 @@ func (a *App) ConnectDemo() error {
 	}
 
 	a.sim = protocol.NewSimulator(a.defs)
+	if !a.demoFaults.IsZero() {
+		a.sim.SetFaults(a.demoFaults)
+		a.log("warn", "Demo fault injection active", a.demoFaults.String())
+	}
 	a.connected = true
 	a.demoMode = true
 
@@ -126,6 +164,103 @@ func (a *App) ConnectDemo() error {
 	return nil
 }
 
+// ConnectReplay opens a recorded log (.mmcd, .csv or .pdb) as the data source.
+// Once monitoring starts, its samples flow through the same sensor:sample
+// events and CSV logging as a live ECU. An empty path opens a file dialog.
+func (a *App) ConnectReplay(path string) error {
+	if path == "" {
+		selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "Replay Log File",
+			Filters: []runtime.FileFilter{
+				{DisplayName: "Log Files (*.csv, *.mmcd, *.pdb)", Pattern: "*.csv;*.mmcd;*.pdb;*.PDB"},
+				{DisplayName: "All Files (*.*)", Pattern: "*.*"},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if selection == "" {
+			return fmt.Errorf("cancelled")
+		}
+		path = selection
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.connected {
+		return fmt.Errorf("already connected")
+	}
+
+	rp, err := logger.OpenReplay(path, a.defs, 1)
+	if err != nil {
+		a.log("error", "Replay failed", err.Error())
+		return err
+	}
+	a.replay = rp
+	// The log's recorded channels and units win over the current
+	// definitions until Disconnect
+	a.liveDefs, a.defs = a.defs, rp.Log().Defs
+	a.activeIndices = sensor.WithComputed(a.defs, rp.Indices())
+	a.connected = true
+	runtime.EventsEmit(a.ctx, "sensors:changed", sensor.ForDisplay(a.defs, a.units))
+	if recorded := rp.Log().Vehicle; recorded != "" && a.vehicle != nil && recorded != a.vehicle.ID {
+		a.log("warn", "Log was recorded on another vehicle", recorded)
+	}
+
+	_, total := rp.Position()
+	runtime.EventsEmit(a.ctx, "connection:status", map[string]interface{}{
+		"connected": true,
+		"port":      path,
+		"baud":      0,
+		"replay":    true,
+	})
+
+	a.log("info", "Replaying log", fmt.Sprintf("%s (%d samples, %s)", path, total, rp.Duration().Round(time.Second)))
+	return nil
+}
+
+// SetReplaySpeed changes the playback speed of a running replay
+// (1 = real time, 2 = double speed, 0 = as fast as possible).
+func (a *App) SetReplaySpeed(speed float64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.replay == nil {
+		return fmt.Errorf("not replaying a log")
+	}
+	if speed < 0 {
+		return fmt.Errorf("invalid replay speed %g", speed)
+	}
+	a.replay.SetSpeed(speed)
+	return nil
+}
+
+// SetDemoFaults sets the fault profile injected by the demo simulator, using
+// protocol.ParseFaultProfile syntax (e.g. "flaky" or "drop=0.05,disconnect=30s").
+// It applies immediately if demo mode is running, otherwise on the next ConnectDemo.
+func (a *App) SetDemoFaults(spec string) error {
+	fp, err := protocol.ParseFaultProfile(spec)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.demoFaults = fp
+	if a.sim != nil {
+		a.sim.SetFaults(fp)
+		a.log("warn", "Demo fault injection changed", fp.String())
+	}
+	return nil
+}
+
+// GetDemoFaultPresets returns the named fault profiles for the settings UI.
+func (a *App) GetDemoFaultPresets() []string {
+	return protocol.FaultPresetNames()
+}
+
 // IsDemoMode returns whether the app is in demo/simulator mode.
 func (a *App) IsDemoMode() bool {
 	a.mu.Lock()
@@ -138,23 +273,34 @@ func (a *App) Disconnect() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	if a.sup != nil {
+		a.sup.Stop()
+		a.sup = nil
+	}
 	if a.lg != nil && a.lg.IsRunning() {
 		a.lg.Stop()
 	}
 
-	if a.csvWriter != nil {
-		a.csvWriter.Close()
-		a.csvWriter = nil
+	if a.logWriter != nil {
+		a.removeLogSample()
+		a.logWriter.Close()
+		a.logWriter = nil
 	}
 
 	if a.conn != nil {
 		a.conn.Close()
 	}
+	if a.replay != nil {
+		a.replay.Close()
+		a.restoreLiveDefs()
+	}
+	a.closeInputs()
 
 	a.connected = false
 	a.demoMode = false
 	a.ecu = nil
 	a.sim = nil
+	a.replay = nil
 	a.conn = nil
 	a.lg = nil
 
@@ -167,6 +313,22 @@ func (a *App) Disconnect() error {
 	return nil
 }
 
+// restoreLiveDefs switches back from a replayed log's definitions, keeping
+// the selected sensors the current definitions have.
+func (a *App) restoreLiveDefs() {
+	a.defs, a.liveDefs = a.liveDefs, nil
+	var indices []int
+	for _, idx := range a.activeIndices {
+		if idx < len(a.defs) && a.defs[idx].Exists {
+			indices = append(indices, idx)
+		}
+	}
+	a.activeIndices = indices
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "sensors:changed", sensor.ForDisplay(a.defs, a.units))
+	}
+}
+
 // IsConnected returns the connection status.
 func (a *App) IsConnected() bool {
 	a.mu.Lock()
@@ -174,9 +336,12 @@ func (a *App) IsConnected() bool {
 	return a.connected
 }
 
-// GetSensorDefinitions returns all sensor definitions for the UI.
+// GetSensorDefinitions returns all sensor definitions for the UI, with
+// limits in the units values are shown in.
 func (a *App) GetSensorDefinitions() []sensor.Definition {
-	return a.defs
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return sensor.ForDisplay(a.defs, a.units)
 }
 
 // SetActiveSensors sets which sensors to poll by their slugs.
@@ -194,21 +359,8 @@ func (a *App) SetActiveSensors(slugs []string) error {
 		slog.Warn("unknown sensors", "slugs", notFound)
 	}
 
-	// Add INJD if RPM and INJP are both selected
-	hasRPM, hasINJP := false, false
-	for _, idx := range indices {
-		if a.defs[idx].Slug == "RPM" {
-			hasRPM = true
-		}
-		if a.defs[idx].Slug == "INJP" {
-			hasINJP = true
-		}
-	}
-	if hasRPM && hasINJP {
-		if injdIdx, _ := sensor.FindBySlug(a.defs, "INJD"); injdIdx >= 0 {
-			indices = append(indices, injdIdx)
-		}
-	}
+	// Add computed sensors (INJD, expression channels) whose inputs are selected
+	indices = sensor.WithComputed(a.defs, indices)
 
 	a.activeIndices = indices
 
@@ -228,7 +380,7 @@ func (a *App) StartMonitoring() error {
 		return fmt.Errorf("not connected")
 	}
 
-	if a.lg != nil && a.lg.IsRunning() {
+	if a.sup != nil || (a.lg != nil && a.lg.IsRunning()) {
 		return nil // already running
 	}
 
@@ -240,55 +392,107 @@ func (a *App) StartMonitoring() error {
 
 	var poller logger.SamplePoller
 	var pollRate time.Duration
-	if a.demoMode {
+	switch {
+	case a.replay != nil:
+		poller = a.replay
+		pollRate = 1 * time.Millisecond // the replay paces itself
+	case a.demoMode:
 		poller = a.sim
 		pollRate = 50 * time.Millisecond // 20Hz for smooth UI updates
-	} else {
+	default:
 		poller = a.ecu
 		pollRate = 1 * time.Millisecond // as fast as possible for real ECU
 	}
+
+	// A wideband input merges WBO2 into each sample; a replay already has it
+	if a.wideband.Port != "" && a.replay == nil {
+		wbPoller, err := a.openWideband(poller)
+		if err != nil {
+			return err
+		}
+		poller = wbPoller
+		if idx, _ := sensor.FindBySlug(a.defs, sensor.WidebandSlug); !slices.Contains(indices, idx) {
+			indices = append(indices, idx)
+			a.activeIndices = indices
+		}
+	}
+	if a.gps.Port != "" && a.replay == nil {
+		gpsPoller, ch, err := a.openGPS(poller)
+		if err != nil {
+			a.closeInputs()
+			return err
+		}
+		poller = gpsPoller
+		for _, idx := range ch.Indices() {
+			if !slices.Contains(indices, idx) {
+				indices = append(indices, idx)
+			}
+		}
+		a.activeIndices = indices
+	}
 	a.lg = logger.NewWithRate(poller, a.defs, indices, a.units, pollRate)
+	if a.schedule != nil && a.replay == nil {
+		a.lg.SetScheduler(logger.NewScheduler(a.defs, a.schedule))
+	}
 
 	a.lg.OnError(func(err error) {
 		a.log("warn", "Poll error", err.Error())
 	})
 
-	a.lg.OnDisconnect(func() {
-		a.log("error", "ECU communication lost", "Too many consecutive errors — check cable")
+	// A live ECU is supervised: when it stops answering the port is reopened
+	// and polling resumes, into the same CSV log if one is open. Demo and
+	// replay sessions are torn down instead.
+	live := a.replay == nil && !a.demoMode
+	if live {
+		a.sup = logger.NewSupervisor(a.ecu, a.lg, logger.DefaultSupervisorConfig())
+		a.sup.OnStateChange(func(c logger.StateChange) {
+			switch c.State {
+			case logger.StateDegraded:
+				a.log("warn", "ECU link degraded", c.Error)
+			case logger.StateReconnecting:
+				a.log("warn", "Reconnecting to ECU", fmt.Sprintf("attempt %d: %s", c.Attempt, c.Error))
+			case logger.StatePolling:
+				a.log("info", "ECU link up", "polling")
+			}
+			if a.ctx != nil {
+				runtime.EventsEmit(a.ctx, "connection:state", c)
+			}
+		})
+	} else {
+		a.lg.OnDisconnect(a.lostConnection)
+	}
+
+	a.lg.OnDone(func() {
+		a.log("info", "Replay finished", "end of log")
 		if a.ctx != nil {
-			runtime.EventsEmit(a.ctx, "connection:status", map[string]interface{}{
-				"connected": false,
-				"reason":    "ECU communication lost — check cable",
-			})
+			runtime.EventsEmit(a.ctx, "replay:done", nil)
 		}
-		// Clean up in a goroutine to avoid deadlock (we're called from poll loop)
-		go func() {
-			a.mu.Lock()
-			defer a.mu.Unlock()
-			if a.conn != nil {
-				a.conn.Close()
-			}
-			a.connected = false
-			a.ecu = nil
-			a.conn = nil
-			a.lg = nil
-		}()
 	})
 
 	a.lg.OnSample(func(sample sensor.Sample) {
 		// Emit sample to frontend
 		values := sample.ConvertedValues(a.defs, a.units)
 		floats := sample.ConvertedFloats(a.defs, a.units)
+		offsets := make(map[string]float64, len(floats))
+		for i, def := range a.defs {
+			if def.Exists && sample.HasData(i) {
+				offsets[def.Slug] = float64(sample.Offset(i)) / float64(time.Millisecond)
+			}
+		}
 		runtime.EventsEmit(a.ctx, "sensor:sample", map[string]interface{}{
-			"time":        sample.Time.Format(time.RFC3339Nano),
-			"values":      values,
-			"floats":      floats,
-			"rawData":     sample.RawData,
-			"dataPresent": sample.DataPresent,
+			"time":      sample.Time.Format(time.RFC3339Nano),
+			"values":    values,
+			"floats":    floats,
+			"offsetsMs": offsets, // per-channel read time after "time"
 		})
 	})
 
-	err := a.lg.Start()
+	var err error
+	if live {
+		a.sup.Start()
+	} else {
+		err = a.lg.Start()
+	}
 	if err == nil {
 		a.log("info", "Monitoring started", fmt.Sprintf("%d sensors", len(indices)))
 		go a.emitStats()
@@ -296,23 +500,183 @@ func (a *App) StartMonitoring() error {
 	return err
 }
 
+// openWideband wraps poller so samples carry the wideband input's readings.
+// Demo sessions read a simulated controller. Caller must hold a.mu.
+func (a *App) openWideband(poller logger.SamplePoller) (logger.SamplePoller, error) {
+	format, err := wideband.ParseFormat(a.wideband.Format)
+	if err != nil {
+		return nil, err
+	}
+	idx, _ := sensor.FindBySlug(a.defs, sensor.WidebandSlug)
+	if a.demoMode {
+		a.log("info", "Wideband input", "simulated "+string(format))
+		return wideband.NewPoller(poller, wideband.NewSimulator(format), a.defs, idx), nil
+	}
+	src, err := wideband.Open(a.wideband.Port, 0, format)
+	if err != nil {
+		a.log("error", "Wideband input failed", err.Error())
+		return nil, err
+	}
+	a.wbSource = src
+	a.log("info", "Wideband input", fmt.Sprintf("port=%s format=%s", a.wideband.Port, format))
+	return wideband.NewPoller(poller, src, a.defs, idx), nil
+}
+
+// openGPS wraps poller so samples carry the GPS receiver's fixes. Demo
+// sessions drive a simulated receiver. Caller must hold a.mu.
+func (a *App) openGPS(poller logger.SamplePoller) (logger.SamplePoller, sensor.GPSChannels, error) {
+	ch, ok := sensor.FindGPS(a.defs)
+	if !ok {
+		return nil, ch, fmt.Errorf("no GPS channels in the sensor table")
+	}
+	if a.demoMode {
+		a.log("info", "GPS input", "simulated")
+		return gps.NewPoller(poller, gps.NewSimulator(), a.defs, ch), ch, nil
+	}
+	src, err := gps.Open(a.gps.Port, a.gps.Baud)
+	if err != nil {
+		a.log("error", "GPS input failed", err.Error())
+		return nil, ch, err
+	}
+	a.gpsSource = src
+	a.log("info", "GPS input", fmt.Sprintf("port=%s baud=%d", a.gps.Port, a.gps.Baud))
+	return gps.NewPoller(poller, src, a.defs, ch), ch, nil
+}
+
+// closeInputs closes the wideband and GPS inputs, if open. Caller must hold
+// a.mu.
+func (a *App) closeInputs() {
+	if a.wbSource != nil {
+		a.wbSource.Close()
+		a.wbSource = nil
+	}
+	if a.gpsSource != nil {
+		a.gpsSource.Close()
+		a.gpsSource = nil
+	}
+}
+
+// lostConnection tears down a demo session whose simulated link dropped out.
+// It is called from the poll loop.
+func (a *App) lostConnection() {
+	a.log("error", "ECU communication lost", "Too many consecutive errors — check cable")
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "connection:status", map[string]interface{}{
+			"connected": false,
+			"reason":    "ECU communication lost — check cable",
+		})
+	}
+	// Clean up in a goroutine to avoid deadlock (we're called from poll loop)
+	go func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.conn != nil {
+			a.conn.Close()
+		}
+		a.closeInputs()
+		a.connected = false
+		a.demoMode = false
+		a.ecu = nil
+		a.sim = nil
+		a.conn = nil
+		a.lg = nil
+	}()
+}
+
+// SetPollSchedule sets per-sensor poll rates using logger.ParseSchedule syntax
+// (e.g. "default" or "default,TIMA=fast,COOL=0.5"). An empty spec polls every
+// selected sensor each cycle. It applies immediately if monitoring is running.
+func (a *App) SetPollSchedule(spec string) error {
+	rates, err := logger.ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.schedule = rates
+	if a.lg != nil && a.replay == nil {
+		if rates != nil {
+			a.lg.SetScheduler(logger.NewScheduler(a.defs, rates))
+		} else {
+			a.lg.SetScheduler(nil)
+		}
+	}
+	if rates != nil {
+		a.log("info", "Poll schedule set", logger.FormatSchedule(rates))
+	} else {
+		a.log("info", "Poll schedule cleared", "polling every sensor each cycle")
+	}
+	return nil
+}
+
 // StopMonitoring stops the polling loop.
 func (a *App) StopMonitoring() {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.lg != nil {
+	if a.sup != nil {
+		a.sup.Stop()
+		a.sup = nil
+		a.log("info", "Monitoring stopped", "")
+	} else if a.lg != nil {
 		a.lg.Stop()
 		a.log("info", "Monitoring stopped", "")
 	}
+	a.closeInputs()
+}
+
+// SetChannelTimes enables the per-sensor read time columns (SLUG_ms) in CSV
+// logs started after this call.
+func (a *App) SetChannelTimes(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.logOptions.ChannelTimes = enabled
 }
 
-// StartLogging begins writing samples to a CSV file.
+// GetLogFormat returns the format new logs are written in: "csv", "mmcd",
+// "msl" or "mlg".
+func (a *App) GetLogFormat() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.logFormat == "" {
+		return "csv"
+	}
+	return a.logFormat
+}
+
+// SetLogFormat sets the format new logs are written in: "csv", "mmcd" for
+// the native binary format with the sensor definitions embedded, or "msl"
+// or "mlg" for the MegaLogViewer text and binary formats.
+func (a *App) SetLogFormat(format string) error {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "csv", "mmcd", "msl", "mlg":
+	default:
+		return fmt.Errorf("unknown log format %q (want csv, mmcd, msl or mlg)", format)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.logFormat = format
+	return nil
+}
+
+// SetLogNotes sets the notes recorded in .mmcd, .msl and .mlg logs started
+// after this call.
+func (a *App) SetLogNotes(notes string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.logOptions.Notes = notes
+}
+
+// StartLogging begins writing samples to a log file, in the format its
+// extension names (see logger.NewLogWriter): .mmcd, .msl, .mlg, else CSV.
 func (a *App) StartLogging(filename string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.csvWriter != nil {
+	if a.logWriter != nil {
 		return fmt.Errorf("already logging")
 	}
 
@@ -322,16 +686,17 @@ func (a *App) StartLogging(filename string) error {
 	}
 
 	var err error
-	a.csvWriter, err = logger.NewCSVWriter(filename, a.defs, indices, a.units)
+	opts := a.logOptions
+	opts.Vehicle = a.vehicle.ID
+	a.logWriter, err = logger.NewLogWriter(filename, a.defs, indices, a.units, opts)
 	if err != nil {
 		return err
 	}
 
 	if a.lg != nil {
-		a.lg.OnSample(func(sample sensor.Sample) {
-			if a.csvWriter != nil {
-				a.csvWriter.WriteSample(sample)
-			}
+		w := a.logWriter
+		a.stopLogSample = a.lg.OnSample(func(sample sensor.Sample) {
+			w.WriteSample(sample)
 		})
 	}
 
@@ -343,18 +708,19 @@ func (a *App) StartLogging(filename string) error {
 	return nil
 }
 
-// StopLogging stops CSV logging.
+// StopLogging stops logging and closes the log file.
 func (a *App) StopLogging() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if a.csvWriter == nil {
+	if a.logWriter == nil {
 		return nil
 	}
 
-	count := a.csvWriter.Count()
-	err := a.csvWriter.Close()
-	a.csvWriter = nil
+	a.removeLogSample()
+	count := a.logWriter.Count()
+	err := a.logWriter.Close()
+	a.logWriter = nil
 
 	runtime.EventsEmit(a.ctx, "logging:status", map[string]interface{}{
 		"logging": false,
@@ -364,6 +730,15 @@ func (a *App) StopLogging() error {
 	return err
 }
 
+// removeLogSample stops passing samples to the log writer, so none is
+// written after it is closed. The caller holds a.mu.
+func (a *App) removeLogSample() {
+	if a.stopLogSample != nil {
+		a.stopLogSample()
+		a.stopLogSample = nil
+	}
+}
+
 // ReadDTCs reads diagnostic trouble codes from the ECU.
 func (a *App) ReadDTCs() (*protocol.DTCResult, error) {
 	a.mu.Lock()
@@ -372,21 +747,17 @@ func (a *App) ReadDTCs() (*protocol.DTCResult, error) {
 	if !a.connected {
 		return nil, fmt.Errorf("not connected")
 	}
+	if a.replay != nil {
+		return nil, fmt.Errorf("not available while replaying a log")
+	}
 	if a.demoMode {
 		a.log("info", "Reading DTCs (DEMO)", "")
 		result := &protocol.DTCResult{
 			ActiveRaw: 0x0022, // bits 1 + 5
 			StoredRaw: 0x0406, // bits 1, 2, 10
-			Active: []protocol.DTCCode{
-				{Bit: 1, Code: "12", Description: "Intake air flow sensor"},
-				{Bit: 5, Code: "21", Description: "Engine coolant temperature sensor"},
-			},
-			Stored: []protocol.DTCCode{
-				{Bit: 1, Code: "12", Description: "Intake air flow sensor"},
-				{Bit: 2, Code: "13", Description: "Intake air temperature sensor"},
-				{Bit: 10, Code: "31", Description: "Knock sensor"},
-			},
 		}
+		result.Active = protocol.DecodeDTCs(a.vehicle.DTCs, result.ActiveRaw)
+		result.Stored = protocol.DecodeDTCs(a.vehicle.DTCs, result.StoredRaw)
 		a.log("info", "DTCs read (DEMO)", fmt.Sprintf("active=%d stored=%d", len(result.Active), len(result.Stored)))
 		return result, nil
 	}
@@ -420,6 +791,9 @@ func (a *App) EraseDTCs() error {
 	if !a.connected {
 		return fmt.Errorf("not connected")
 	}
+	if a.replay != nil {
+		return fmt.Errorf("not available while replaying a log")
+	}
 	if a.demoMode {
 		a.log("info", "Erasing DTCs (DEMO)", "")
 		time.Sleep(500 * time.Millisecond)
@@ -456,25 +830,14 @@ func (a *App) RunActuatorTest(command string) (string, error) {
 	if !a.connected {
 		return "", fmt.Errorf("not connected")
 	}
-	commands := map[string]byte{
-		"fuel-pump": 0xF6,
-		"purge":     0xF5,
-		"pressure":  0xF4,
-		"egr":       0xF3,
-		"mvic":      0xF2,
-		"boost":     0xF1,
-		"inj1":      0xFC,
-		"inj2":      0xFB,
-		"inj3":      0xFA,
-		"inj4":      0xF9,
-		"inj5":      0xF8,
-		"inj6":      0xF7,
-	}
-
-	addr, ok := commands[strings.ToLower(command)]
+	if a.replay != nil {
+		return "", fmt.Errorf("not available while replaying a log")
+	}
+	ac, ok := a.vehicle.Actuator(command)
 	if !ok {
-		return "", fmt.Errorf("unknown command: %s", command)
+		return "", fmt.Errorf("unknown command for %s: %s", a.vehicle.Name, command)
 	}
+	addr := ac.Addr
 
 	if a.demoMode {
 		a.log("info", "Running actuator test (DEMO)", fmt.Sprintf("%s (0x%02X)", command, addr))
@@ -540,15 +903,394 @@ func (a *App) SetUnits(units string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	a.units = sensor.ParseUnitSystem(units)
+	// Limits follow the unit system
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "sensors:changed", sensor.ForDisplay(a.defs, a.units))
+	}
+}
+
+// LoadSensorFile applies a YAML or JSON sensor profile (see
+// sensor.LoadProfile) on top of the built-in definitions. An empty path opens
+// a file dialog. It returns the file that was loaded. Definitions cannot
+// change while connected, since the ECU and logger hold them.
+func (a *App) LoadSensorFile(path string) (string, error) {
+	if path == "" {
+		selection, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+			Title: "Load Sensor Definitions",
+			Filters: []runtime.FileFilter{
+				{DisplayName: "Sensor Files (*.yaml, *.yml, *.json)", Pattern: "*.yaml;*.yml;*.json"},
+				{DisplayName: "All Files (*.*)", Pattern: "*.*"},
+			},
+		})
+		if err != nil {
+			return "", err
+		}
+		if selection == "" {
+			return "", fmt.Errorf("cancelled")
+		}
+		path = selection
+	}
+
+	s := a.defSettings()
+	s.sensorsFile = path
+	if err := a.applySettings(s, "Sensor file rejected"); err != nil {
+		return "", err
+	}
+	a.log("info", "Sensor definitions loaded", path)
+	return path, nil
+}
+
+// ResetSensorFile drops a loaded sensor profile and restores the built-in
+// definitions.
+func (a *App) ResetSensorFile() error {
+	s := a.defSettings()
+	s.sensorsFile = ""
+	if err := a.applySettings(s, ""); err != nil {
+		return err
+	}
+	a.log("info", "Sensor definitions reset", "built-in table")
+	return nil
+}
+
+// GetSensorFile returns the loaded sensor profile path, or "" for built-ins.
+func (a *App) GetSensorFile() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sensorsFile
+}
+
+// GetDerivedPresets returns the built-in expression channels that can be
+// added with SetDerivedChannels, worked out for the fueling hardware.
+func (a *App) GetDerivedPresets() []sensor.ProfileSensor {
+	s := a.defSettings()
+	f, err := s.vehicle.Fueling().Apply(s.fueling)
+	if err != nil {
+		return sensor.DerivedPresets()
+	}
+	return f.DerivedPresets()
+}
+
+// GetDerivedChannels returns the slugs of the enabled derived presets.
+func (a *App) GetDerivedChannels() []string {
+	return a.defSettings().derived
+}
+
+// SetDerivedChannels selects which built-in expression channels (see
+// sensor.DerivedPresets) are added on top of the sensor file.
+func (a *App) SetDerivedChannels(slugs []string) error {
+	s := a.defSettings()
+	s.derived = slugs
+	if err := a.applySettings(s, "Derived channels rejected"); err != nil {
+		return err
+	}
+	a.log("info", "Derived channels set", strings.Join(slugs, ", "))
+	return nil
+}
+
+// GetFueling returns the fueling hardware changes from stock.
+func (a *App) GetFueling() sensor.FuelingOptions {
+	return a.defSettings().fueling
+}
+
+// GetFuelingSetup describes the fueling hardware in use, e.g.
+// "660cc @ 2.55 bar, scaled MAF".
+func (a *App) GetFuelingSetup() string {
+	s := a.defSettings()
+	f, err := s.vehicle.Fueling().Apply(s.fueling)
+	if err != nil {
+		return s.vehicle.Fueling().String()
+	}
+	return f.String()
+}
+
+// SetFueling sets injector size, fuel pressure and MAF type (see
+// sensor.FuelingOptions; zero values keep stock). Any change from stock adds
+// the corrected airflow, injector duty, headroom and fuel flow channels.
+func (a *App) SetFueling(opts sensor.FuelingOptions) error {
+	s := a.defSettings()
+	s.fueling = opts
+	if err := a.applySettings(s, "Fueling setup rejected"); err != nil {
+		return err
+	}
+	a.log("info", "Fueling setup", a.GetFuelingSetup())
+	return nil
+}
+
+// UnitSetting is the display unit choice of one sensor.
+type UnitSetting struct {
+	Slug    string   `json:"slug"`
+	Unit    string   `json:"unit"`    // override; "" follows the unit system
+	Choices []string `json:"choices"` // units the sensor can be shown in
+}
+
+// GetUnitSettings returns the sensors that can be shown in other units.
+func (a *App) GetUnitSettings() []UnitSetting {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []UnitSetting
+	for _, d := range a.defs {
+		if d.Exists && len(d.UnitChoices()) > 0 {
+			out = append(out, UnitSetting{Slug: d.Slug, Unit: d.DisplayUnit(), Choices: d.UnitChoices()})
+		}
+	}
+	return out
+}
+
+// SetUnitOverrides sets per-sensor display units (slug -> unit, see
+// sensor.ApplyUnits), replacing earlier ones. They win over the unit system
+// and are recorded in CSV and .mmcd logs.
+func (a *App) SetUnitOverrides(overrides map[string]string) error {
+	s := a.defSettings()
+	s.units = make(map[string]string, len(overrides))
+	for slug, unit := range overrides {
+		if unit != "" {
+			s.units[slug] = unit
+		}
+	}
+	if err := a.applySettings(s, "Units rejected"); err != nil {
+		return err
+	}
+	a.log("info", "Sensor units set", fmt.Sprintf("%d overrides", len(s.units)))
+	return nil
+}
+
+// WidebandSettings select a wideband O2 controller on a second serial port.
+type WidebandSettings struct {
+	Port   string `json:"port"`   // serial device or tcp:// bridge; "" for none
+	Format string `json:"format"` // stream format, see wideband.ParseFormat
+}
+
+// GetWideband returns the wideband input settings.
+func (a *App) GetWideband() WidebandSettings {
+	return a.defSettings().wideband
+}
+
+// GetWidebandFormats lists the stream formats SetWideband accepts.
+func (a *App) GetWidebandFormats() []string {
+	return wideband.Formats
+}
+
+// SetWideband sets the wideband O2 input. A port adds the WBO2 channel,
+// which is logged with every sample while monitoring; demo sessions simulate
+// the controller. An empty port removes it.
+func (a *App) SetWideband(w WidebandSettings) error {
+	w.Port = strings.TrimSpace(w.Port)
+	if w.Port != "" {
+		f, err := wideband.ParseFormat(w.Format)
+		if err != nil {
+			return err
+		}
+		w.Format = string(f)
+	}
+	s := a.defSettings()
+	s.wideband = w
+	if err := a.applySettings(s, "Wideband input rejected"); err != nil {
+		return err
+	}
+	if w.Port == "" {
+		a.log("info", "Wideband input removed", "")
+	} else {
+		a.log("info", "Wideband input set", fmt.Sprintf("port=%s format=%s", w.Port, w.Format))
+	}
+	return nil
+}
+
+// GPSSettings select an NMEA GPS receiver on another serial port.
+type GPSSettings struct {
+	Port string `json:"port"` // serial device or tcp:// bridge; "" for none
+	Baud int    `json:"baud"` // 0 for gps.DefaultBaudRate
+}
+
+// GetGPS returns the GPS input settings.
+func (a *App) GetGPS() GPSSettings {
+	return a.defSettings().gps
+}
+
+// SetGPS sets the GPS input. A port adds the GPS speed, position, heading
+// and fix channels, which are logged with every sample while monitoring;
+// demo sessions simulate the receiver. An empty port removes them.
+func (a *App) SetGPS(g GPSSettings) error {
+	g.Port = strings.TrimSpace(g.Port)
+	if g.Baud < 0 {
+		return fmt.Errorf("invalid GPS baud rate %d", g.Baud)
+	}
+	if g.Baud == 0 {
+		g.Baud = gps.DefaultBaudRate
+	}
+	s := a.defSettings()
+	s.gps = g
+	if err := a.applySettings(s, "GPS input rejected"); err != nil {
+		return err
+	}
+	if g.Port == "" {
+		a.log("info", "GPS input removed", "")
+	} else {
+		a.log("info", "GPS input set", fmt.Sprintf("port=%s baud=%d", g.Port, g.Baud))
+	}
+	return nil
+}
+
+// GetVehicles returns the supported vehicle platforms.
+func (a *App) GetVehicles() []*vehicle.Vehicle {
+	return vehicle.All()
+}
+
+// GetVehicle returns the selected vehicle.
+func (a *App) GetVehicle() *vehicle.Vehicle {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.vehicle
+}
+
+// SetVehicle selects the vehicle platform, which sets the sensor table, DTC
+// meanings and actuator tests. The sensor file and derived channels are
+// applied on top again.
+func (a *App) SetVehicle(id string) error {
+	v, err := vehicle.Get(id)
+	if err != nil {
+		return err
+	}
+	s := a.defSettings()
+	s.vehicle = v
+	if err := a.applySettings(s, "Vehicle rejected"); err != nil {
+		return err
+	}
+	a.log("info", "Vehicle selected", v.Name)
+	return nil
+}
+
+// GetActuators returns the actuator tests of the selected vehicle.
+func (a *App) GetActuators() []vehicle.Actuator {
+	return a.GetVehicle().Actuators
+}
+
+// defSettings are the choices the definition table is built from.
+type defSettings struct {
+	vehicle     *vehicle.Vehicle
+	sensorsFile string                // sensor profile; "" for built-ins
+	derived     []string              // built-in expression channels
+	fueling     sensor.FuelingOptions // upgraded injectors/MAF; zero is stock
+	units       map[string]string     // per-sensor display units
+	wideband    WidebandSettings      // wideband O2 input
+	gps         GPSSettings           // GPS receiver
+}
+
+// defSettings returns a copy of the current definition settings.
+func (a *App) defSettings() defSettings {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	units := make(map[string]string, len(a.unitOverrides))
+	for slug, unit := range a.unitOverrides {
+		units[slug] = unit
+	}
+	return defSettings{
+		vehicle:     a.vehicle,
+		sensorsFile: a.sensorsFile,
+		derived:     append([]string(nil), a.derived...),
+		fueling:     a.fueling,
+		units:       units,
+		wideband:    a.wideband,
+		gps:         a.gps,
+	}
+}
+
+// applySettings builds the definition table for s and switches to it. A
+// rejected table is logged under errTitle, if given.
+func (a *App) applySettings(s defSettings, errTitle string) error {
+	defs, err := buildDefinitions(s)
+	if err != nil {
+		if errTitle != "" {
+			a.log("error", errTitle, err.Error())
+		}
+		return err
+	}
+	return a.setDefinitions(s, defs)
+}
+
+// buildDefinitions returns the vehicle's sensor table with a sensor file,
+// derived presets and unit overrides applied. Upgraded fueling hardware
+// adds the airflow and injector channels worked out for it. Wideband and
+// GPS inputs add their channels first, so sensor files can use them in
+// expressions.
+func buildDefinitions(s defSettings) ([]sensor.Definition, error) {
+	defs, err := s.vehicle.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	if s.wideband.Port != "" {
+		if defs, _, err = sensor.AddWideband(defs); err != nil {
+			return nil, err
+		}
+	}
+	if s.gps.Port != "" {
+		if defs, _, err = sensor.AddGPS(defs); err != nil {
+			return nil, err
+		}
+	}
+	defs, err = sensor.ApplyProfileFile(defs, s.sensorsFile)
+	if err != nil {
+		return nil, err
+	}
+	fueling, err := s.vehicle.Fueling().Apply(s.fueling)
+	if err != nil {
+		return nil, fmt.Errorf("fueling: %w", err)
+	}
+	derived := s.derived
+	if !s.fueling.IsZero() {
+		derived = append(append([]string(nil), derived...), sensor.FuelingChannels...)
+	}
+	if defs, err = sensor.AddDerivedWithFueling(defs, derived, fueling); err != nil {
+		return nil, err
+	}
+	return sensor.ApplyUnits(defs, s.units)
+}
+
+// setDefinitions swaps the definition table, keeping the sensor selection by
+// slug, and tells the frontend to reload it.
+func (a *App) setDefinitions(s defSettings, defs []sensor.Definition) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.connected {
+		return fmt.Errorf("disconnect before changing sensor definitions")
+	}
+
+	var slugs []string
+	for _, idx := range a.activeIndices {
+		slugs = append(slugs, a.defs[idx].Slug)
+	}
+	a.vehicle = s.vehicle
+	a.defs = defs
+	a.sensorsFile = s.sensorsFile
+	a.derived = s.derived
+	a.fueling = s.fueling
+	a.unitOverrides = s.units
+	a.wideband = s.wideband
+	a.gps = s.gps
+	indices, _ := sensor.SlugsToIndices(defs, slugs)
+	a.activeIndices = nil
+	for _, idx := range indices {
+		if defs[idx].Exists {
+			a.activeIndices = append(a.activeIndices, idx)
+		}
+	}
+
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, "sensors:changed", sensor.ForDisplay(defs, a.units))
+	}
+	return nil
 }
 
 // LogData is the structure returned to the frontend for graph display.
 type LogData struct {
 	Slugs     []string             `json:"slugs"`
 	Data      map[string][]float64 `json:"data"`
-	ElapsedMs []float64            `json:"elapsedMs"` // elapsed milliseconds from start per sample
+	ElapsedMs []float64            `json:"elapsedMs"`           // elapsed milliseconds from start per sample
+	ChannelMs map[string][]float64 `json:"channelMs,omitempty"` // per-channel read time in elapsed ms, when recorded
 	Count     int                  `json:"count"`
 	Name      string               `json:"name"`
+	Vehicle   string               `json:"vehicle,omitempty"` // vehicle ID recorded in the log, if any
+	Units     map[string]string    `json:"units,omitempty"`   // slug -> unit of the values, when known
 }
 
 // LoadLogFile opens a file dialog to pick a log file (CSV, .mmcd, or .PDB),
@@ -573,17 +1315,15 @@ func (a *App) LoadLogFile() (*LogData, error) {
 
 	slog.Info("loading log file", "path", selection)
 
-	lower := strings.ToLower(selection)
-	switch {
-	case strings.HasSuffix(lower, ".csv"):
+	l, err := logger.Open(selection, a.defs)
+	if err != nil {
+		return nil, err
+	}
+	if l.Format == logger.FormatCSV && len(l.Indices) == 0 {
+		// Without raw columns only the values the CSV shows can be read
 		return a.loadCSVLog(selection)
-	case strings.HasSuffix(lower, ".mmcd"):
-		return a.loadBinaryLog(selection)
-	case strings.HasSuffix(lower, ".pdb"):
-		return a.loadPDBLog(selection)
-	default:
-		return nil, fmt.Errorf("unsupported file type: %s", selection)
 	}
+	return a.loadLog(l)
 }
 
 func (a *App) loadCSVLog(path string) (*LogData, error) {
@@ -604,97 +1344,97 @@ func (a *App) loadCSVLog(path string) (*LogData, error) {
 		Slugs:     csvLog.Slugs,
 		Data:      csvLog.Data,
 		ElapsedMs: elapsed,
+		ChannelMs: csvLog.ChannelMs,
 		Count:     csvLog.Count,
 		Name:      path,
+		Vehicle:   csvLog.Vehicle,
+		Units:     csvLog.Units,
 	}, nil
 }
 
-func (a *App) loadBinaryLog(path string) (*LogData, error) {
-	binLog, err := logger.ReadBinaryLog(path)
+// loadLog reads the samples of a log into graph data. Values are shown in
+// the units the log was recorded in, with the definitions it recorded.
+func (a *App) loadLog(l *logger.Log) (*LogData, error) {
+	if l.Recovery != nil {
+		a.log("warn", "Log was not closed cleanly", l.Recovery.String())
+	}
+	r, err := l.Samples()
 	if err != nil {
 		return nil, err
 	}
-
-	// Convert samples to float data keyed by slug
-	data := make(map[string][]float64)
-	var slugs []string
-
-	for _, idx := range binLog.Indices {
-		if idx >= 0 && idx < len(a.defs) && a.defs[idx].Exists {
-			slug := a.defs[idx].Slug
-			slugs = append(slugs, slug)
-			data[slug] = make([]float64, 0, len(binLog.Samples))
-		}
+	defer r.Close()
+	count := 0
+	if br, ok := r.(*logger.BinaryReader); ok {
+		count = br.Len()
 	}
-
-	elapsed := make([]float64, 0, len(binLog.Samples))
-	var startTime time.Time
-	for i, sample := range binLog.Samples {
-		if i == 0 {
-			startTime = sample.Time
-		}
-		elapsed = append(elapsed, float64(sample.Time.Sub(startTime).Milliseconds()))
-		sample.ComputeDerivatives(a.defs)
-		for _, idx := range binLog.Indices {
-			if idx >= 0 && idx < len(a.defs) && a.defs[idx].Exists {
-				slug := a.defs[idx].Slug
-				if sample.HasData(idx) {
-					data[slug] = append(data[slug], a.defs[idx].Convert(sample.RawData[idx], binLog.Units))
-				} else {
-					data[slug] = append(data[slug], 0)
-				}
-			}
-		}
-	}
-
-	return &LogData{
-		Slugs:     slugs,
-		Data:      data,
-		ElapsedMs: elapsed,
-		Count:     len(binLog.Samples),
-		Name:      path,
-	}, nil
-}
-
-func (a *App) loadPDBLog(path string) (*LogData, error) {
-	pdbLog, err := logger.ParsePDB(path)
+	ld, err := streamLogData(r, l.Defs, l.Channels(), l.Units, count, l.ChannelTimes)
 	if err != nil {
 		return nil, err
 	}
-
-	// Determine which sensors are present across all samples
-	var presentMask uint32
-	for _, s := range pdbLog.Samples {
-		presentMask |= s.DataPresent
+	ld.Name = l.Path
+	if l.Format == logger.FormatPDB {
+		ld.Name = l.Name
 	}
+	ld.Vehicle = l.Vehicle
+	return ld, nil
+}
 
+// streamLogData reads the samples of r into graph data for chans and their
+// flag channels, holding only the converted values. count sizes the
+// columns; channelTimes adds the per-channel read times.
+func streamLogData(r logger.SampleReader, defs []sensor.Definition, chans []logger.LogChannel, units sensor.UnitSystem, count int, channelTimes bool) (*LogData, error) {
 	data := make(map[string][]float64)
 	var slugs []string
-	var indices []int
-
-	for i, def := range a.defs {
-		if def.Exists && presentMask&(1<<uint(i)) != 0 {
-			slugs = append(slugs, def.Slug)
-			indices = append(indices, i)
-			data[def.Slug] = make([]float64, 0, len(pdbLog.Samples))
-		}
+	unitLabels := make(map[string]string)
+	indices := make([]int, len(chans))
+	for i, ch := range chans {
+		indices[i] = ch.Index
+		slugs = append(slugs, ch.Slug)
+		data[ch.Slug] = make([]float64, 0, count)
+		unitLabels[ch.Slug] = ch.Unit
+	}
+	flags := sensor.FlagChannelsOf(defs, indices)
+	for _, ch := range flags {
+		slugs = append(slugs, ch.Name)
+		data[ch.Name] = make([]float64, 0, count)
 	}
 
-	elapsed := make([]float64, 0, len(pdbLog.Samples))
+	elapsed := make([]float64, 0, count)
+	var channelMs map[string][]float64
+	if channelTimes {
+		channelMs = make(map[string][]float64, len(slugs))
+	}
 	var startTime time.Time
-	for i, sample := range pdbLog.Samples {
-		if i == 0 {
+	n := 0
+	for ; ; n++ {
+		sample, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
 			startTime = sample.Time
 		}
 		elapsed = append(elapsed, float64(sample.Time.Sub(startTime).Milliseconds()))
-		sample.ComputeDerivatives(a.defs)
-		for _, idx := range indices {
-			slug := a.defs[idx].Slug
+		sample.ComputeDerivatives(defs)
+		for _, ch := range chans {
+			idx, slug := ch.Index, ch.Slug
 			if sample.HasData(idx) {
-				data[slug] = append(data[slug], a.defs[idx].Convert(sample.RawData[idx], sensor.UnitMetric))
+				data[slug] = append(data[slug], sample.Value(defs, idx, units))
 			} else {
 				data[slug] = append(data[slug], 0)
 			}
+			if channelMs != nil {
+				channelMs[slug] = append(channelMs[slug], float64(sample.ChannelTime(idx).Sub(startTime))/float64(time.Millisecond))
+			}
+		}
+		for _, ch := range flags {
+			data[ch.Name] = append(data[ch.Name], sample.FlagValue(ch))
+			if channelMs != nil {
+				channelMs[ch.Name] = append(channelMs[ch.Name], float64(sample.ChannelTime(ch.Index).Sub(startTime))/float64(time.Millisecond))
+			}
 		}
 	}
 
@@ -702,7 +1442,8 @@ func (a *App) loadPDBLog(path string) (*LogData, error) {
 		Slugs:     slugs,
 		Data:      data,
 		ElapsedMs: elapsed,
-		Count:     len(pdbLog.Samples),
-		Name:      pdbLog.Name,
+		ChannelMs: channelMs,
+		Count:     n,
+		Units:     unitLabels,
 	}, nil
 }
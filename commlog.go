@@ -26,6 +26,9 @@ type CommStats struct {
 	ErrorsTotal   uint64  `json:"errorsTotal"`
 	CurrentHz     float64 `json:"currentHz"`
 	UptimeSeconds float64 `json:"uptimeSeconds"`
+
+	SensorHz  map[string]float64 `json:"sensorHz,omitempty"`  // achieved rate per slug when scheduling
+	LinkState string             `json:"linkState,omitempty"` // supervisor state for a live ECU
 }
 
 // CommLog is a ring-buffer based communication log that emits events to the frontend.
@@ -107,6 +110,10 @@ func (a *App) GetCommStats() *CommStats {
 		stats.ErrorsTotal = ls.ErrorCount
 		stats.CurrentHz = ls.CurrentHz
 		stats.UptimeSeconds = ls.UptimeSeconds
+		stats.SensorHz = ls.SensorHz
+	}
+	if a.sup != nil {
+		stats.LinkState = string(a.sup.State())
 	}
 	return stats
 }
@@ -118,11 +125,16 @@ func (a *App) emitStats() {
 	for {
 		<-ticker.C
 		a.mu.Lock()
-		if a.lg == nil || !a.lg.IsRunning() {
+		// A supervised logger is stopped while reconnecting; keep reporting
+		if a.lg == nil || (a.sup == nil && !a.lg.IsRunning()) {
 			a.mu.Unlock()
 			return
 		}
 		ls := a.lg.Stats()
+		var linkState string
+		if a.sup != nil {
+			linkState = string(a.sup.State())
+		}
 		a.mu.Unlock()
 
 		if a.ctx != nil {
@@ -131,6 +143,8 @@ func (a *App) emitStats() {
 				ErrorsTotal:   ls.ErrorCount,
 				CurrentHz:     ls.CurrentHz,
 				UptimeSeconds: ls.UptimeSeconds,
+				SensorHz:      ls.SensorHz,
+				LinkState:     linkState,
 			})
 		}
 	}
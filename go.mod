@@ -6,6 +6,8 @@ require (
 	github.com/spf13/cobra v1.8.0
 	github.com/wailsapp/wails/v2 v2.11.0
 	go.bug.st/serial v1.6.2
+	golang.org/x/sys v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -37,6 +39,5 @@ require (
 	github.com/wailsapp/mimetype v1.4.1 // indirect
 	golang.org/x/crypto v0.33.0 // indirect
 	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
 )
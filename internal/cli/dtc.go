@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/kbuckham/mmcd/internal/protocol"
-	"github.com/kbuckham/mmcd/internal/sensor"
 	"github.com/spf13/cobra"
 )
 
@@ -18,14 +17,22 @@ var dtcCmd = &cobra.Command{
 			return fmt.Errorf("--port is required")
 		}
 
-		defs := sensor.DefaultDefinitions()
-		conn := protocol.NewSerialConn(cfgPort, cfgBaud)
-		if err := conn.Open(); err != nil {
-			return fmt.Errorf("failed to open serial port: %w", err)
+		v, err := loadVehicle()
+		if err != nil {
+			return err
+		}
+		defs, err := v.Definitions()
+		if err != nil {
+			return err
+		}
+		conn, err := openPort()
+		if err != nil {
+			return err
 		}
 		defer conn.Close()
 
 		ecu := protocol.NewECU(conn, defs)
+		ecu.SetDTCTable(v.DTCs)
 
 		result, err := ecu.ReadDTCs()
 		if err != nil {
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/gps"
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/wideband"
+	"github.com/spf13/cobra"
+)
+
+var (
+	emuListen        string
+	emuLatency       time.Duration
+	emuActuatorDelay time.Duration
+	emuEngineRunning bool
+	emuActiveDTCs    uint16
+	emuStoredDTCs    uint16
+	emuFaults        string
+	emuWideband      string
+	emuWidebandAddr  string
+	emuGPS           bool
+	emuGPSAddr       string
+)
+
+var emulateCmd = &cobra.Command{
+	Use:   "emulate",
+	Short: "Run a byte-accurate ECU emulator on a pseudo-terminal or TCP port",
+	Long: `Starts an emulated ECU that answers the MMCD byte protocol (sensor echo + data,
+command echo + result, DTC reads at 0x38/0x39/0x3B/0x3C, DTC erase at 0xCA).
+
+On Linux the emulator opens a pseudo-terminal and prints its path, so the full
+real stack can be exercised end to end:
+
+  mmcd emulate
+  mmcd log -p /dev/pts/N
+
+With --listen it serves raw TCP instead, for use with -p tcp://host:port.
+
+--faults injects communication faults, either a preset (flaky, noisy, slow,
+dropout) or key=value settings, e.g. --faults flaky,disconnect=30s
+
+--wideband-sim also streams a simulated wideband O2 controller (isp2, aem or
+volts) on a second pseudo-terminal, or on --wideband-listen:
+
+  mmcd emulate --wideband-sim isp2
+  mmcd log -p /dev/pts/N --wideband /dev/pts/M --wideband-format isp2
+
+--gps-sim likewise streams a simulated NMEA GPS receiver driving laps of a
+loop in step with the emulated engine, on --gps-listen or a pseudo-terminal:
+
+  mmcd emulate --gps-sim
+  mmcd log -p /dev/pts/N --gps /dev/pts/M`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		defs, err := loadDefinitions()
+		if err != nil {
+			return err
+		}
+		cfg := protocol.DefaultEmulatorConfig()
+		cfg.Latency = emuLatency
+		cfg.ActuatorDelay = emuActuatorDelay
+		cfg.EngineRunning = emuEngineRunning
+		cfg.ActiveDTCs = emuActiveDTCs
+		cfg.StoredDTCs = emuStoredDTCs
+		faults, err := protocol.ParseFaultProfile(emuFaults)
+		if err != nil {
+			return err
+		}
+		cfg.Faults = faults
+
+		em := protocol.NewEmulator(defs, cfg)
+		errCh := make(chan error, 3)
+
+		if emuListen != "" {
+			ln, err := net.Listen("tcp", emuListen)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", emuListen, err)
+			}
+			defer ln.Close()
+			go func() { errCh <- em.ServeListener(ln) }()
+			fmt.Printf("ECU emulator listening on tcp://%s\n", ln.Addr())
+			fmt.Printf("Connect with: mmcd log -p tcp://%s\n", ln.Addr())
+		} else {
+			pty, err := protocol.OpenPTY()
+			if err != nil {
+				return err
+			}
+			defer pty.Close()
+			go func() { errCh <- em.ServePTY(pty) }()
+			fmt.Printf("ECU emulator listening on %s\n", pty.Name())
+			fmt.Printf("Connect with: mmcd log -p %s\n", pty.Name())
+		}
+		if emuWideband != "" {
+			format, err := wideband.ParseFormat(emuWideband)
+			if err != nil {
+				return fmt.Errorf("--wideband-sim: %w", err)
+			}
+			sim := wideband.NewSimulator(format)
+			addr, stop, err := startSimulator(sim, emuWidebandAddr, errCh)
+			if err != nil {
+				return err
+			}
+			defer stop()
+			fmt.Printf("Wideband simulator (%s) on %s\n", sim, addr)
+			fmt.Printf("Connect with: --wideband %s --wideband-format %s\n", addr, format)
+		}
+		if emuGPS {
+			sim := gps.NewSimulator()
+			addr, stop, err := startSimulator(sim, emuGPSAddr, errCh)
+			if err != nil {
+				return err
+			}
+			defer stop()
+			fmt.Printf("GPS simulator (%s) on %s\n", sim, addr)
+			fmt.Printf("Connect with: --gps %s\n", addr)
+		}
+		fmt.Printf("Latency %s per byte, actuator tests take %s\n", cfg.Latency, cfg.ActuatorDelay)
+		if !faults.IsZero() {
+			fmt.Printf("Injecting faults: %s\n", faults)
+		}
+		fmt.Println("Press Ctrl+C to stop")
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case <-sigCh:
+			fmt.Println("\nStopping emulator...")
+			return nil
+		case err := <-errCh:
+			return err
+		}
+	},
+}
+
+func init() {
+	emulateCmd.Flags().StringVar(&emuListen, "listen", "", "Serve raw TCP on host:port instead of a pseudo-terminal")
+	emulateCmd.Flags().DurationVar(&emuLatency, "latency", 5*time.Millisecond, "Delay before each response byte")
+	emulateCmd.Flags().DurationVar(&emuActuatorDelay, "actuator-delay", 6*time.Second, "Time an actuator test runs before the ECU answers")
+	emulateCmd.Flags().BoolVar(&emuEngineRunning, "engine-running", false, "Refuse solenoid tests (0xF1-0xF6) as a running engine would")
+	emulateCmd.Flags().Uint16Var(&emuActiveDTCs, "dtc-active", 0, "Active DTC bitmap served at 0x38/0x39")
+	emulateCmd.Flags().Uint16Var(&emuStoredDTCs, "dtc-stored", 0, "Stored DTC bitmap served at 0x3B/0x3C")
+	emulateCmd.Flags().StringVar(&emuWideband, "wideband-sim", "", "Also simulate a wideband O2 controller: "+strings.Join(wideband.Formats, ", "))
+	emulateCmd.Flags().StringVar(&emuWidebandAddr, "wideband-listen", "", "Serve the wideband simulator on TCP host:port instead of a pseudo-terminal")
+	emulateCmd.Flags().BoolVar(&emuGPS, "gps-sim", false, "Also simulate an NMEA GPS receiver")
+	emulateCmd.Flags().StringVar(&emuGPSAddr, "gps-listen", "", "Serve the GPS simulator on TCP host:port instead of a pseudo-terminal")
+	emulateCmd.Flags().StringVar(&emuFaults, "faults", "", "Fault profile: flaky, noisy, slow, dropout, or key=value list (drop, echo, stale, slow, slow-delay, disconnect)")
+	rootCmd.AddCommand(emulateCmd)
+}
+
+// simulator is an input device simulator served next to the ECU emulator.
+type simulator interface {
+	ServeListener(ln net.Listener) error
+	ServePTY(pty *protocol.PTY) error
+}
+
+// startSimulator serves sim on TCP address listen, or on a new
+// pseudo-terminal if listen is empty. It returns the address to connect to
+// and a function that stops serving; serve errors go to errCh.
+func startSimulator(sim simulator, listen string, errCh chan<- error) (string, func(), error) {
+	if listen != "" {
+		ln, err := net.Listen("tcp", listen)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to listen on %s: %w", listen, err)
+		}
+		go func() { errCh <- sim.ServeListener(ln) }()
+		return "tcp://" + ln.Addr().String(), func() { ln.Close() }, nil
+	}
+	pty, err := protocol.OpenPTY()
+	if err != nil {
+		return "", nil, err
+	}
+	go func() { errCh <- sim.ServePTY(pty) }()
+	return pty.Name(), func() { pty.Close() }, nil
+}
@@ -17,49 +17,75 @@ var (
 )
 
 var importCmd = &cobra.Command{
-	Use:   "import",
-	Short: "Import an old MMCd PalmOS PDB log file and convert to CSV or .mmcd",
+	Use:     "import",
+	Aliases: []string{"convert"},
+	Short:   "Import an old MMCd PalmOS PDB log file and convert to CSV, .mmcd or MegaLogViewer",
 	Long: `Reads a PalmOS PDB file from the original MMCd datalogger and converts
-it to CSV (human-readable) or .mmcd (native binary, for replay).`,
+it to CSV (human-readable), .mmcd (native binary, for replay), or the
+MegaLogViewer .msl (text) or .mlg (binary) formats. Logs are recognized by
+their content, so a .mmcd or CSV log converts the same way.
+
+  mmcd import -f DRIVE.pdb
+  mmcd convert -f drive.mmcd --format mlg`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if importFile == "" {
 			return fmt.Errorf("--file is required")
 		}
+		importFormat = strings.ToLower(importFormat)
+		switch importFormat {
+		case "csv", "mmcd", "msl", "mlg":
+		default:
+			return fmt.Errorf("unknown --format %q (want csv, mmcd, msl or mlg)", importFormat)
+		}
 
-		units := sensor.ParseUnitSystem(cfgUnits)
-		defs := sensor.DefaultDefinitions()
+		units, err := loadUnits()
+		if err != nil {
+			return err
+		}
+		defs, err := loadDefinitions()
+		if err != nil {
+			return err
+		}
 
-		fmt.Printf("Parsing PDB file: %s\n", importFile)
-		pdbLog, err := logger.ParsePDB(importFile)
+		// The log is read twice, once for its summary and once to convert
+		// it, rather than held in memory
+		fmt.Printf("Parsing log file: %s\n", importFile)
+		l, err := logger.Open(importFile, defs)
+		if err != nil {
+			return fmt.Errorf("failed to parse log: %w", err)
+		}
+		r, err := l.Samples()
 		if err != nil {
-			return fmt.Errorf("failed to parse PDB: %w", err)
+			return err
+		}
+		sum, err := logger.Summarize(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse log: %w", err)
 		}
 
-		fmt.Printf("Log name: %s\n", pdbLog.Name)
-		fmt.Printf("Samples:  %d\n", len(pdbLog.Samples))
+		fmt.Printf("Format:   %s\n", strings.ToUpper(l.Format.String()))
+		fmt.Printf("Log name: %s\n", l.Name)
+		fmt.Printf("Samples:  %d\n", sum.Count)
 
-		if len(pdbLog.Samples) == 0 {
-			fmt.Println("No samples found in PDB file.")
+		if sum.Count == 0 {
+			fmt.Println("No samples found in log file.")
 			return nil
 		}
 
 		// Show time range
-		first := pdbLog.Samples[0].Time
-		last := pdbLog.Samples[len(pdbLog.Samples)-1].Time
 		fmt.Printf("Time range: %s to %s (%.1fs)\n",
-			first.Format("2006-01-02 15:04:05"),
-			last.Format("2006-01-02 15:04:05"),
-			last.Sub(first).Seconds())
+			sum.First.Format("2006-01-02 15:04:05"),
+			sum.Last.Format("2006-01-02 15:04:05"),
+			sum.Duration().Seconds())
 
 		// Show which sensors have data
-		var presentMask uint32
-		for _, s := range pdbLog.Samples {
-			presentMask |= s.DataPresent
-		}
+		var present []int
 		fmt.Printf("Sensors present: ")
-		for i := 0; i < sensor.MaxSensors; i++ {
-			if presentMask&(1<<uint(i)) != 0 && defs[i].Exists {
-				fmt.Printf("%s ", defs[i].Slug)
+		for _, i := range sum.Indices {
+			if i < len(l.Defs) && l.Defs[i].Exists {
+				present = append(present, i)
+				fmt.Printf("%s ", l.Defs[i].Slug)
 			}
 		}
 		fmt.Println()
@@ -67,50 +93,72 @@ it to CSV (human-readable) or .mmcd (native binary, for replay).`,
 		// Auto-generate output filename if not specified
 		if importOutput == "" {
 			base := strings.TrimSuffix(filepath.Base(importFile), filepath.Ext(importFile))
-			if importFormat == "mmcd" {
-				importOutput = base + ".mmcd"
-			} else {
-				importOutput = base + ".csv"
-			}
+			importOutput = base + "." + importFormat
+		}
+		if filepath.Clean(importOutput) == filepath.Clean(importFile) {
+			return fmt.Errorf("output %s would overwrite the log being imported", importOutput)
 		}
 
-		if importFormat == "mmcd" {
-			// Convert to native binary format
-			var indices []int
-			for i := 0; i < sensor.MaxSensors; i++ {
-				if presentMask&(1<<uint(i)) != 0 {
-					indices = append(indices, i)
-				}
-			}
-
-			writer, err := logger.NewBinaryWriter(importOutput, indices, units)
+		// The vehicle recorded in the log wins over --vehicle
+		vehicleID := l.Vehicle
+		if vehicleID == "" {
+			v, err := loadVehicle()
 			if err != nil {
 				return err
 			}
-			for _, s := range pdbLog.Samples {
-				s.ComputeDerivatives(defs)
-				if err := writer.WriteSample(s); err != nil {
-					writer.Close()
-					return err
-				}
+			vehicleID = v.ID
+		}
+
+		var writer logger.SampleWriter
+		format := strings.ToUpper(importFormat)
+		switch importFormat {
+		case "mmcd":
+			// Convert to native binary format
+			writer, err = logger.NewBinaryWriterWithOptions(importOutput, present, units, logger.BinaryOptions{Vehicle: vehicleID, Defs: l.Defs})
+			format = "binary"
+		case "msl", "mlg":
+			// MegaLogViewer computes nothing itself, so the computed sensors
+			// are written as for CSV
+			opts := logger.MLVOptions{Vehicle: vehicleID}
+			if l.Meta != nil {
+				opts.Notes = l.Meta.Notes
 			}
-			writer.Close()
-			fmt.Printf("Written %d samples to: %s (binary)\n", writer.Count(), importOutput)
-		} else {
-			// Convert to CSV
-			if err := logger.PDBToCSV(pdbLog, importOutput, defs, units); err != nil {
-				return err
+			if importFormat == "msl" {
+				writer, err = logger.NewMSLWriter(importOutput, l.Defs, sensor.WithComputed(l.Defs, present), units, opts)
+			} else {
+				writer, err = logger.NewMLGWriter(importOutput, l.Defs, sensor.WithComputed(l.Defs, present), units, opts)
 			}
-			fmt.Printf("Written %d samples to: %s (CSV)\n", len(pdbLog.Samples), importOutput)
+			format = "MegaLogViewer " + format
+		default:
+			// Convert to CSV, with the computed sensors (INJD, expression
+			// channels) whose inputs are present
+			writer, err = logger.NewCSVWriterWithOptions(importOutput, l.Defs, sensor.WithComputed(l.Defs, present), units, logger.CSVOptions{Vehicle: vehicleID, Comments: cfgCSVComments})
+		}
+		if err != nil {
+			return err
+		}
+
+		if r, err = l.Samples(); err != nil {
+			writer.Close()
+			return err
+		}
+		_, err = logger.CopySamples(writer, r, l.Defs)
+		r.Close()
+		if cerr := writer.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
 		}
+		fmt.Printf("Written %d samples to: %s (%s)\n", writer.Count(), importOutput, format)
 
 		return nil
 	},
 }
 
 func init() {
-	importCmd.Flags().StringVarP(&importFile, "file", "f", "", "PDB file to import")
+	importCmd.Flags().StringVarP(&importFile, "file", "f", "", "Log file to import (.pdb, .csv or .mmcd)")
 	importCmd.Flags().StringVarP(&importOutput, "output", "o", "", "Output file (auto-generated if empty)")
-	importCmd.Flags().StringVar(&importFormat, "format", "csv", "Output format: csv or mmcd")
+	importCmd.Flags().StringVar(&importFormat, "format", "csv", "Output format: csv, mmcd, msl or mlg")
 	rootCmd.AddCommand(importCmd)
 }
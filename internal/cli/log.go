@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"text/tabwriter"
@@ -17,23 +18,62 @@ import (
 )
 
 var (
-	logSensors string
-	logOutput  string
-	logDisplay bool
+	logSensors      string
+	logOutput       string
+	logChannelTimes bool
+	logDisplay      bool
+	logSchedule     string
+	logReconnect    bool
+	logNotes        string
 )
 
 var logCmd = &cobra.Command{
 	Use:   "log",
-	Short: "Start datalogging to CSV with optional terminal display",
+	Short: "Start datalogging to CSV, .mmcd or MegaLogViewer with optional terminal display",
 	Long: `Connects to the ECU via serial port and continuously polls selected sensors.
-Data is written to a CSV file and optionally displayed in the terminal.`,
+Data is written to a CSV file and optionally displayed in the terminal, where
+values past a sensor's warning or critical limits (see mmcd sensors) are shown
+in yellow or red.
+
+An --output ending in .mmcd writes the native binary format instead, which
+records the sensor definitions, vehicle, software version and start time with
+the data, so the log reads back the same after the sensor file changes.
+--notes adds free-form notes to it. An --output ending in .msl or .mlg writes
+the MegaLogViewer text or binary format, where a sensor not read in a cycle
+repeats its last value.
+
+--schedule polls each sensor at its own rate instead of every sensor every
+cycle: "default" polls RPM, TPS, KNCK and O2 every cycle, COOL, BARO, BATT and
+AIRT at 1 Hz and the rest at 5 Hz. Entries like TIMA=fast or COOL=0.5 override
+single sensors. Each CSV row then only holds the values read in that cycle.
+
+With --reconnect (the default) the port is reopened and the ECU re-probed
+whenever it stops answering, e.g. after an ignition cycle or a loose
+connector, and logging resumes into the same CSV file. The logger can be
+started before the key is turned on.
+
+--wideband reads a wideband O2 controller on a second port and logs it as
+the WBO2 channel with every sample, taking the reading closest to each poll
+sweep. --wideband-format selects the stream: isp2 (Innovate LC-1/LC-2),
+aem (AEM serial AFR lines) or volts (a 0-5V output sent as ASCII volts).
+
+--gps reads an NMEA GPS receiver (GGA, RMC and VTG sentences) on another
+port and logs GSPD (speed), GLAT/GLON (position), GHDG (heading) and GFIX
+(fix quality, 0 = none) with every sample. Export the track with
+'mmcd track'.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if cfgPort == "" {
 			return fmt.Errorf("--port is required (e.g. /dev/ttyUSB0, COM3)")
 		}
 
-		units := sensor.ParseUnitSystem(cfgUnits)
-		defs := sensor.DefaultDefinitions()
+		units, err := loadUnits()
+		if err != nil {
+			return err
+		}
+		defs, err := loadDefinitions()
+		if err != nil {
+			return err
+		}
 
 		// Determine which sensors to poll
 		var indices []int
@@ -52,50 +92,104 @@ Data is written to a CSV file and optionally displayed in the terminal.`,
 			return fmt.Errorf("no valid sensors selected")
 		}
 
-		// Also include computed sensors (INJD) if their dependencies are present
-		hasRPM := false
-		hasINJP := false
-		for _, idx := range indices {
-			if defs[idx].Slug == "RPM" {
-				hasRPM = true
-			}
-			if defs[idx].Slug == "INJP" {
-				hasINJP = true
-			}
-		}
-		if hasRPM && hasINJP {
-			injdIdx, _ := sensor.FindBySlug(defs, "INJD")
-			if injdIdx >= 0 {
-				indices = append(indices, injdIdx)
-			}
-		}
+		// Also include computed sensors (INJD, expression channels) whose
+		// inputs are selected, and the inputs of selected computed sensors
+		indices = sensor.WithComputed(defs, indices)
 
 		fmt.Printf("MMCD Datalogger\n")
 		fmt.Printf("Port: %s @ %d baud\n", cfgPort, cfgBaud)
+		if v, err := loadVehicle(); err == nil {
+			fmt.Printf("Vehicle: %s\n", v.Name)
+		}
 		fmt.Printf("Sensors: %d selected\n", len(indices))
 		for _, idx := range indices {
 			fmt.Printf("  [%d] %s - %s\n", idx, defs[idx].Slug, defs[idx].Description)
 		}
 
-		// Open serial connection
-		conn := protocol.NewSerialConn(cfgPort, cfgBaud)
-		if err := conn.Open(); err != nil {
-			return fmt.Errorf("failed to open serial port: %w", err)
+		// Open serial or network connection. Under the supervisor the port
+		// is opened (and reopened) by the reconnect loop.
+		var conn protocol.Transport
+		if logReconnect {
+			conn, err = protocol.NewTransport(cfgPort, cfgBaud)
+		} else {
+			conn, err = openPort()
+		}
+		if err != nil {
+			return err
 		}
 		defer conn.Close()
 
 		ecu := protocol.NewECU(conn, defs)
-		lg := logger.New(ecu, defs, indices, units)
+		var poller logger.SamplePoller = ecu
+		if cfgWideband != "" {
+			wbPoller, wbIdx, src, err := openWideband(ecu, defs)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			poller = wbPoller
+			if !slices.Contains(indices, wbIdx) {
+				indices = append(indices, wbIdx)
+			}
+			fmt.Printf("Wideband: %s (%s)\n", cfgWideband, src.Format())
+		}
+		if cfgGPS != "" {
+			gpsPoller, ch, src, err := openGPS(poller, defs)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			poller = gpsPoller
+			for _, idx := range ch.Indices() {
+				if !slices.Contains(indices, idx) {
+					indices = append(indices, idx)
+				}
+			}
+			fmt.Printf("GPS: %s (%d baud)\n", cfgGPS, cfgGPSBaud)
+		}
+		lg := logger.New(poller, defs, indices, units)
 
-		// Set up CSV writer if output file specified
-		var csvWriter *logger.CSVWriter
+		var sup *logger.Supervisor
+		if logReconnect {
+			sup = logger.NewSupervisor(ecu, lg, logger.DefaultSupervisorConfig())
+			sup.OnStateChange(func(c logger.StateChange) {
+				if logDisplay && c.State == logger.StatePolling {
+					return
+				}
+				msg := fmt.Sprintf("[%s] link %s", c.Time.Format("15:04:05"), c.State)
+				if c.Attempt > 0 {
+					msg += fmt.Sprintf(" (attempt %d)", c.Attempt)
+				}
+				if c.Error != "" {
+					msg += ": " + c.Error
+				}
+				fmt.Println(msg)
+			})
+		}
+
+		rates, err := logger.ParseSchedule(logSchedule)
+		if err != nil {
+			return err
+		}
+		if rates != nil {
+			lg.SetScheduler(logger.NewScheduler(defs, rates))
+			fmt.Printf("Schedule: %s\n", logger.FormatSchedule(rates))
+		}
+
+		// Set up the log writer if output file specified
+		var logWriter logger.SampleWriter
 		if logOutput != "" {
 			var err error
-			csvWriter, err = logger.NewCSVWriter(logOutput, defs, indices, units)
+			logWriter, err = logger.NewLogWriter(logOutput, defs, indices, units, logger.WriterOptions{
+				Vehicle:      csvVehicle(),
+				ChannelTimes: logChannelTimes,
+				CSVComments:  cfgCSVComments,
+				Notes:        logNotes,
+			})
 			if err != nil {
-				return fmt.Errorf("failed to create CSV file: %w", err)
+				return fmt.Errorf("failed to create log file: %w", err)
 			}
-			defer csvWriter.Close()
+			defer logWriter.Close()
 			fmt.Printf("Logging to: %s\n", logOutput)
 		}
 
@@ -109,13 +203,17 @@ Data is written to a CSV file and optionally displayed in the terminal.`,
 			slog.Warn("poll error", "error", err, "total_errors", errorCount)
 		})
 
+		var shown sensor.Sample // latest value of each sensor, for display
 		lg.OnSample(func(sample sensor.Sample) {
 			sampleCount++
+			for _, idx := range indices {
+				shown.CopyChannel(&sample, idx)
+			}
 
-			// Write to CSV
-			if csvWriter != nil {
-				if err := csvWriter.WriteSample(sample); err != nil {
-					slog.Error("CSV write error", "error", err)
+			// Write to the log file
+			if logWriter != nil {
+				if err := logWriter.WriteSample(sample); err != nil {
+					slog.Error("log write error", "error", err)
 				}
 			}
 
@@ -124,31 +222,21 @@ Data is written to a CSV file and optionally displayed in the terminal.`,
 				elapsed := time.Since(startTime).Seconds()
 				hz := float64(sampleCount) / elapsed
 
-				// Clear screen and print values
-				fmt.Print("\033[H\033[2J")
-				fmt.Printf("MMCD Datalogger — %.1f Hz — %d samples — %d errors", hz, sampleCount, errorCount)
-				if csvWriter != nil {
-					fmt.Printf(" — logging to %s", logOutput)
+				title := fmt.Sprintf("MMCD Datalogger — %.1f Hz — %d samples — %d errors", hz, sampleCount, errorCount)
+				if sup != nil {
+					title += " — " + string(sup.State())
 				}
-				fmt.Println()
-				fmt.Println(strings.Repeat("─", 60))
-
-				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-				for _, idx := range indices {
-					if !defs[idx].Exists || !sample.HasData(idx) {
-						continue
-					}
-					formatted := defs[idx].Format(sample.RawData[idx], units)
-					fmt.Fprintf(w, "%s\t%s\t(raw: %d)\n", defs[idx].Slug, formatted, sample.RawData[idx])
+				if logWriter != nil {
+					title += " — logging to " + logOutput
 				}
-				w.Flush()
-				fmt.Println(strings.Repeat("─", 60))
-				fmt.Println("Press Ctrl+C to stop")
+				printLiveValues(title, defs, indices, shown, units, lg.Stats().SensorHz)
 			}
 		})
 
 		// Start logging
-		if err := lg.Start(); err != nil {
+		if sup != nil {
+			sup.Start()
+		} else if err := lg.Start(); err != nil {
 			return fmt.Errorf("failed to start logger: %w", err)
 		}
 
@@ -158,14 +246,31 @@ Data is written to a CSV file and optionally displayed in the terminal.`,
 		<-sigCh
 
 		fmt.Println("\nStopping...")
-		lg.Stop()
+		if sup != nil {
+			sup.Stop()
+		} else {
+			lg.Stop()
+		}
 
 		elapsed := time.Since(startTime)
 		fmt.Printf("Collected %d samples in %s (%.1f Hz)\n",
 			sampleCount, elapsed.Round(time.Millisecond), float64(sampleCount)/elapsed.Seconds())
 
-		if csvWriter != nil {
-			fmt.Printf("Saved to: %s (%d rows)\n", logOutput, csvWriter.Count())
+		if sensorHz := lg.Stats().SensorHz; sensorHz != nil {
+			fmt.Println("Achieved rates:")
+			for _, idx := range indices {
+				if hz, ok := sensorHz[defs[idx].Slug]; ok {
+					fmt.Printf("  %-5s %5.1f Hz\n", defs[idx].Slug, hz)
+				}
+			}
+		}
+
+		if sup != nil && sup.Reconnects() > 0 {
+			fmt.Printf("Reconnected %d time(s)\n", sup.Reconnects())
+		}
+
+		if logWriter != nil {
+			fmt.Printf("Saved to: %s (%d samples)\n", logOutput, logWriter.Count())
 		}
 
 		return nil
@@ -174,7 +279,53 @@ Data is written to a CSV file and optionally displayed in the terminal.`,
 
 func init() {
 	logCmd.Flags().StringVarP(&logSensors, "sensors", "s", "", "Sensor slugs to poll (comma-separated, or 'all')")
-	logCmd.Flags().StringVarP(&logOutput, "output", "o", "", "Output CSV file path")
+	logCmd.Flags().StringVarP(&logOutput, "output", "o", "", "Output file path: .mmcd for the native binary format, .msl or .mlg for MegaLogViewer, otherwise CSV")
+	logCmd.Flags().StringVar(&logNotes, "notes", "", "Notes to record in a .mmcd, .msl or .mlg log")
 	logCmd.Flags().BoolVarP(&logDisplay, "display", "d", true, "Show live values in terminal")
+	logCmd.Flags().StringVar(&logSchedule, "schedule", "", "Per-sensor poll rates: 'default' and/or SLUG=fast|normal|slow|hz (comma-separated)")
+	logCmd.Flags().BoolVar(&logChannelTimes, "channel-times", false, "Add a SLUG_ms column with the time each sensor was read")
+	logCmd.Flags().BoolVar(&logReconnect, "reconnect", true, "Reopen the port and resume logging when the ECU stops answering")
 	rootCmd.AddCommand(logCmd)
 }
+
+// levelColors color live values by sensor.Level. The codes have the same
+// length so tabwriter still lines the columns up.
+var levelColors = map[sensor.Level]string{
+	sensor.LevelNormal:   "\033[39m",
+	sensor.LevelWarn:     "\033[33m",
+	sensor.LevelCritical: "\033[31m",
+}
+
+// printLiveValues redraws the terminal with the current value of each
+// sensor, in yellow or red when past its warning or critical threshold.
+func printLiveValues(title string, defs []sensor.Definition, indices []int, sample sensor.Sample, units sensor.UnitSystem, sensorHz map[string]float64) {
+	// Clear screen and print values
+	fmt.Print("\033[H\033[2J")
+	fmt.Println(title)
+	fmt.Println(strings.Repeat("─", 60))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, idx := range indices {
+		if !defs[idx].Exists || !sample.HasData(idx) {
+			continue
+		}
+		formatted := sample.Formatted(defs, idx, units)
+		raw := fmt.Sprintf("(raw: %d)", sample.RawValue(defs, idx))
+		if sample.IsFloat(idx) {
+			raw = "(expr)"
+		}
+		level := sample.Level(defs, idx)
+		mark := ""
+		if level != sensor.LevelNormal {
+			mark = strings.ToUpper(level.String())
+		}
+		if sensorHz != nil {
+			fmt.Fprintf(w, "%s%s\t%s\t%s\t%.1f Hz\t%s\033[0m\n", levelColors[level], defs[idx].Slug, formatted, raw, sensorHz[defs[idx].Slug], mark)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\033[0m\n", levelColors[level], defs[idx].Slug, formatted, raw, mark)
+	}
+	w.Flush()
+	fmt.Println(strings.Repeat("─", 60))
+	fmt.Println("Press Ctrl+C to stop")
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/kbuckham/mmcd/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	repairFile   string
+	repairOutput string
+	repairCheck  bool
+)
+
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Recover the samples of a .mmcd log that was not closed cleanly",
+	Long: `A .mmcd log cut short, for example by a power loss with the logger running,
+ends in a header that does not count all samples and possibly a torn last
+sample. The logger syncs the file every second, so such a log loses at most
+about the last second of data.
+
+repair keeps every complete sample, drops the incomplete data after the last
+one and fixes the sample count in the header, then reports what was lost. The
+log is repaired in place unless --output is given.
+
+  mmcd repair -f drive.mmcd
+  mmcd repair -f drive.mmcd -o drive-fixed.mmcd
+  mmcd repair -f drive.mmcd --check`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if repairFile == "" {
+			return fmt.Errorf("--file is required")
+		}
+		if format, err := logger.DetectFormat(repairFile); err != nil {
+			return err
+		} else if format != logger.FormatMMCD {
+			return fmt.Errorf("%s: only .mmcd logs can be repaired", repairFile)
+		}
+
+		if repairCheck {
+			log, err := logger.OpenBinaryLog(repairFile)
+			if err != nil {
+				return err
+			}
+			log.Close()
+			if log.Recovery == nil {
+				fmt.Printf("%s: OK, %d samples\n", repairFile, log.Len())
+				return nil
+			}
+			fmt.Printf("%s: needs repair: %s\n", repairFile, log.Recovery)
+			return nil
+		}
+
+		rec, err := logger.RepairBinaryLog(repairFile, repairOutput)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			fmt.Printf("%s was closed cleanly; nothing to repair\n", repairFile)
+			if repairOutput != "" {
+				fmt.Printf("Copied to: %s\n", repairOutput)
+			}
+			return nil
+		}
+		out := repairOutput
+		if out == "" {
+			out = repairFile
+		}
+		fmt.Printf("Repaired %s: %s\n", out, rec)
+		return nil
+	},
+}
+
+func init() {
+	repairCmd.Flags().StringVarP(&repairFile, "file", "f", "", "Path to the .mmcd log")
+	repairCmd.Flags().StringVarP(&repairOutput, "output", "o", "", "Write the repaired log here instead of over --file")
+	repairCmd.Flags().BoolVar(&repairCheck, "check", false, "Only report what repair would recover, without writing")
+	rootCmd.AddCommand(repairCmd)
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/logger"
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayFile         string
+	replaySpeed        string
+	replaySensors      string
+	replayOutput       string
+	replayChannelTimes bool
+	replayDisplay      bool
+)
+
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay a recorded log through the live logging pipeline",
+	Long: `Plays back a .mmcd, CSV or PalmOS PDB log at its original timing, as if the
+ECU were connected. Samples go through the same display and CSV writer as
+'mmcd log', so a recorded drive can be re-exported or checked against changes.
+
+  mmcd replay -f drive.mmcd
+  mmcd replay -f drive.mmcd --speed 10x -o drive.csv
+  mmcd replay -f 2003-02-01_YEMELYA.PDB --speed max`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if replayFile == "" {
+			return fmt.Errorf("--file is required")
+		}
+		speed, err := logger.ParseReplaySpeed(replaySpeed)
+		if err != nil {
+			return err
+		}
+
+		units, err := loadUnits()
+		if err != nil {
+			return err
+		}
+		defs, err := loadDefinitions()
+		if err != nil {
+			return err
+		}
+		if defs, err = withInputChannels(defs); err != nil {
+			return err
+		}
+
+		rp, err := logger.OpenReplay(replayFile, defs, speed)
+		if err != nil {
+			return err
+		}
+		defer rp.Close()
+		// The log's recorded channels and units win over the current
+		// definitions
+		defs = rp.Log().Defs
+
+		// Default to every sensor recorded in the log
+		var indices []int
+		if replaySensors == "" || strings.ToLower(replaySensors) == "all" {
+			indices = rp.Indices()
+		} else {
+			slugs := strings.Split(strings.ToUpper(replaySensors), ",")
+			var notFound []string
+			indices, notFound = sensor.SlugsToIndices(defs, slugs)
+			if len(notFound) > 0 {
+				fmt.Fprintf(os.Stderr, "Warning: unknown sensors: %s\n", strings.Join(notFound, ", "))
+			}
+		}
+		if len(indices) == 0 {
+			return fmt.Errorf("no valid sensors selected")
+		}
+		// Computed channels are re-evaluated from the current definitions
+		indices = sensor.WithComputed(defs, indices)
+
+		_, total := rp.Position()
+		speedLabel := "max"
+		if speed > 0 {
+			speedLabel = fmt.Sprintf("%gx", speed)
+		}
+		fmt.Printf("MMCD Replay\n")
+		fmt.Printf("File: %s (%d samples, %s)\n", replayFile, total, rp.Duration().Round(time.Millisecond))
+		fmt.Printf("Speed: %s\n", speedLabel)
+		if recorded := rp.Log().Vehicle; recorded != "" {
+			fmt.Printf("Vehicle: %s\n", recorded)
+			if v, _ := loadVehicle(); cfgVehicle != "" && v != nil && v.ID != recorded {
+				fmt.Fprintf(os.Stderr, "Warning: log was recorded on %s, replaying with --vehicle %s\n", recorded, v.ID)
+			}
+		}
+
+		lg := logger.New(rp, defs, indices, units)
+
+		var csvWriter *logger.CSVWriter
+		if replayOutput != "" {
+			csvWriter, err = logger.NewCSVWriterWithOptions(replayOutput, defs, indices, units, logger.CSVOptions{ChannelTimes: replayChannelTimes, Vehicle: csvVehicle(), Comments: cfgCSVComments})
+			if err != nil {
+				return fmt.Errorf("failed to create CSV file: %w", err)
+			}
+			defer csvWriter.Close()
+			fmt.Printf("Logging to: %s\n", replayOutput)
+		}
+
+		sampleCount := 0
+		lg.OnSample(func(sample sensor.Sample) {
+			sampleCount++
+
+			if csvWriter != nil {
+				if err := csvWriter.WriteSample(sample); err != nil {
+					slog.Error("CSV write error", "error", err)
+				}
+			}
+
+			if replayDisplay && sampleCount%5 == 0 {
+				pos, total := rp.Position()
+				title := fmt.Sprintf("MMCD Replay — %s — %d/%d samples — %s",
+					speedLabel, pos, total, sample.Time.Format("15:04:05.000"))
+				printLiveValues(title, defs, indices, sample, units, nil)
+			}
+		})
+
+		done := make(chan struct{})
+		lg.OnDone(func() { close(done) })
+
+		startTime := time.Now()
+		if err := lg.Start(); err != nil {
+			return fmt.Errorf("failed to start replay: %w", err)
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case <-sigCh:
+			fmt.Println("\nStopping...")
+			rp.Close()
+			lg.Stop()
+		case <-done:
+			fmt.Println("\nEnd of log")
+		}
+
+		fmt.Printf("Replayed %d samples in %s\n", sampleCount, time.Since(startTime).Round(time.Millisecond))
+		if csvWriter != nil {
+			fmt.Printf("Saved to: %s (%d rows)\n", replayOutput, csvWriter.Count())
+		}
+		return nil
+	},
+}
+
+func init() {
+	replayCmd.Flags().StringVarP(&replayFile, "file", "f", "", "Log file to replay (.mmcd, .csv, .pdb)")
+	replayCmd.Flags().StringVar(&replaySpeed, "speed", "1", "Replay speed: 1, 2x, 10x, or max")
+	replayCmd.Flags().StringVarP(&replaySensors, "sensors", "s", "", "Sensor slugs to replay (comma-separated, or 'all')")
+	replayCmd.Flags().StringVarP(&replayOutput, "output", "o", "", "Write replayed samples to a CSV file")
+	replayCmd.Flags().BoolVarP(&replayDisplay, "display", "d", true, "Show live values in terminal")
+	replayCmd.Flags().BoolVar(&replayChannelTimes, "channel-times", false, "Add a SLUG_ms column with the time each sensor was read")
+	rootCmd.AddCommand(replayCmd)
+}
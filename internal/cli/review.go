@@ -1,91 +1,115 @@
 package cli
 
 import (
-	"encoding/csv"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"text/tabwriter"
 
+	"github.com/kbuckham/mmcd/internal/logger"
 	"github.com/spf13/cobra"
 )
 
-var reviewFile string
+var (
+	reviewFile string
+	reviewRows int
+)
 
 var reviewCmd = &cobra.Command{
 	Use:   "review",
-	Short: "Review a saved CSV log file in the terminal",
+	Short: "Review a saved log file in the terminal",
+	Long: `Prints the channels and first samples of a log of any format: .mmcd, CSV
+or PalmOS PDB, recognized by its content. Values are shown in the units the
+log was recorded in.
+
+  mmcd review -f drive.mmcd
+  mmcd review -f drive.csv -n 200`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if reviewFile == "" {
 			return fmt.Errorf("--file is required")
 		}
 
-		f, err := os.Open(reviewFile)
+		defs, err := loadDefinitions()
 		if err != nil {
-			return fmt.Errorf("failed to open file: %w", err)
+			return err
 		}
-		defer f.Close()
+		l, err := logger.Open(reviewFile, defs)
+		if err != nil {
+			return err
+		}
+		chans := l.Channels()
 
-		reader := csv.NewReader(f)
+		fmt.Printf("Log file: %s (%s)\n", reviewFile, l.Format)
+		if l.Format == logger.FormatPDB {
+			fmt.Printf("Log name: %s\n", l.Name)
+		}
+		if l.Vehicle != "" {
+			fmt.Printf("Vehicle:  %s\n", l.Vehicle)
+		}
+		if l.Meta != nil && l.Meta.Notes != "" {
+			fmt.Printf("Notes:    %s\n", l.Meta.Notes)
+		}
+		if l.Recovery != nil {
+			fmt.Printf("Warning:  not closed cleanly: %s\n", l.Recovery)
+		}
+		fmt.Printf("Units:    %s\n", l.Units)
+		fmt.Printf("Channels: %d\n\n", len(chans))
 
-		// Read header
-		header, err := reader.Read()
+		r, err := l.Samples()
 		if err != nil {
-			return fmt.Errorf("failed to read CSV header: %w", err)
+			return err
 		}
-
-		fmt.Printf("Log file: %s\n", reviewFile)
-		fmt.Printf("Columns: %d\n\n", len(header))
+		defer r.Close()
 
 		// Print header
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		for i, h := range header {
-			if i > 0 {
-				fmt.Fprint(w, "\t")
-			}
-			fmt.Fprint(w, h)
+		fmt.Fprint(w, "Time")
+		for _, ch := range chans {
+			fmt.Fprint(w, "\t", ch.Slug)
 		}
 		fmt.Fprintln(w)
-
-		// Print separator
-		for i := range header {
-			if i > 0 {
-				fmt.Fprint(w, "\t")
-			}
-			fmt.Fprint(w, "---")
-		}
+		fmt.Fprint(w, "---")
+		fmt.Fprint(w, strings.Repeat("\t---", len(chans)))
 		fmt.Fprintln(w)
 
-		// Print rows (limit to first 50 for terminal display)
-		rowCount := 0
+		// Print rows up to --rows; the rest are only counted
+		count := 0
+		first, last := "", ""
 		for {
-			row, err := reader.Read()
+			s, err := r.Next()
 			if err == io.EOF {
 				break
 			}
 			if err != nil {
-				return fmt.Errorf("CSV read error at row %d: %w", rowCount+1, err)
+				return fmt.Errorf("read error at sample %d: %w", count+1, err)
 			}
-
-			rowCount++
-			if rowCount > 50 {
-				continue // count but don't print
+			count++
+			stamp := s.Time.Format("15:04:05.000")
+			if first == "" {
+				first = stamp
+			}
+			last = stamp
+			if count > reviewRows {
+				continue
 			}
 
-			for i, val := range row {
-				if i > 0 {
-					fmt.Fprint(w, "\t")
+			s.ComputeDerivatives(l.Defs)
+			fmt.Fprint(w, stamp)
+			for _, ch := range chans {
+				fmt.Fprint(w, "\t")
+				if s.HasData(ch.Index) {
+					fmt.Fprint(w, s.Formatted(l.Defs, ch.Index, l.Units))
 				}
-				fmt.Fprint(w, val)
 			}
 			fmt.Fprintln(w)
 		}
 		w.Flush()
 
-		if rowCount > 50 {
-			fmt.Printf("\n... showing first 50 of %d rows\n", rowCount)
+		if count > reviewRows {
+			fmt.Printf("\n... showing first %d of %d samples (%s to %s)\n", reviewRows, count, first, last)
 		} else {
-			fmt.Printf("\n%d rows total\n", rowCount)
+			fmt.Printf("\n%d samples total\n", count)
 		}
 
 		return nil
@@ -93,6 +117,7 @@ var reviewCmd = &cobra.Command{
 }
 
 func init() {
-	reviewCmd.Flags().StringVarP(&reviewFile, "file", "f", "", "CSV log file to review")
+	reviewCmd.Flags().StringVarP(&reviewFile, "file", "f", "", "Log file to review (.mmcd, .csv or .pdb)")
+	reviewCmd.Flags().IntVarP(&reviewRows, "rows", "n", 50, "Number of samples to print")
 	rootCmd.AddCommand(reviewCmd)
 }
@@ -8,7 +8,13 @@ import (
 	"os"
 	"strings"
 
+	"github.com/kbuckham/mmcd/internal/gps"
+	"github.com/kbuckham/mmcd/internal/logger"
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/vehicle"
 	"github.com/kbuckham/mmcd/internal/version"
+	"github.com/kbuckham/mmcd/internal/wideband"
 	"github.com/spf13/cobra"
 )
 
@@ -19,6 +25,21 @@ var (
 	cfgVerbose bool
 	cfgLogFile string
 	cfgYes     bool
+
+	cfgSensorsFile string
+	cfgDerived     string
+	cfgVehicle     string
+	cfgCSVComments bool
+
+	cfgInjectorCC   float64
+	cfgFuelPressure string
+	cfgMAF          string
+
+	cfgWideband       string
+	cfgWidebandFormat string
+
+	cfgGPS     string
+	cfgGPSBaud int
 )
 
 // rootCmd is the base command when called without subcommands.
@@ -57,12 +78,23 @@ var aboutCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVarP(&cfgPort, "port", "p", "", "Serial port (e.g. /dev/ttyUSB0, COM3)")
+	rootCmd.PersistentFlags().StringVarP(&cfgPort, "port", "p", "", "Serial port (e.g. /dev/ttyUSB0, COM3) or network bridge (tcp://host:port, rfc2217://host:port)")
 	rootCmd.PersistentFlags().IntVarP(&cfgBaud, "baud", "b", 1920, "Serial baud rate")
-	rootCmd.PersistentFlags().StringVarP(&cfgUnits, "units", "u", "metric", "Unit system: metric, imperial, raw")
+	rootCmd.PersistentFlags().StringVarP(&cfgUnits, "units", "u", "metric", "Unit system (metric, imperial, raw), then per-sensor units, e.g. imperial,BARO=kPa,AIRF=lb/min")
 	rootCmd.PersistentFlags().BoolVarP(&cfgVerbose, "verbose", "v", false, "Enable debug logging")
 	rootCmd.PersistentFlags().StringVar(&cfgLogFile, "log-file", "", "Write log output to file")
 	rootCmd.PersistentFlags().BoolVar(&cfgYes, "yes", false, "Skip confirmation prompts")
+	rootCmd.PersistentFlags().StringVar(&cfgSensorsFile, "sensors-file", "", "YAML or JSON file that adds or overrides sensor definitions")
+	rootCmd.PersistentFlags().StringVar(&cfgVehicle, "vehicle", "", "ECU platform: "+strings.Join(vehicle.IDs(), ", ")+" (default "+vehicle.DefaultID+")")
+	rootCmd.PersistentFlags().BoolVar(&cfgCSVComments, "csv-comments", false, "Record the vehicle in a '# mmcd' comment line before the header of CSV logs")
+	rootCmd.PersistentFlags().StringVar(&cfgDerived, "derived", "", "Built-in computed channels to add (comma-separated: "+strings.Join(sensor.DerivedPresetSlugs(), ",")+")")
+	rootCmd.PersistentFlags().Float64Var(&cfgInjectorCC, "injectors", 0, "Installed injector size in cc/min at 3 bar (default: the vehicle's stock size)")
+	rootCmd.PersistentFlags().StringVar(&cfgFuelPressure, "fuel-pressure", "", "Fuel pressure over manifold, bar or with a psi/kPa suffix (default 2.55 bar)")
+	rootCmd.PersistentFlags().StringVar(&cfgMAF, "maf", "", "MAF setup: "+strings.Join(sensor.MAFTypes, ", ")+" (default stock)")
+	rootCmd.PersistentFlags().StringVar(&cfgWideband, "wideband", "", "Wideband O2 controller port (serial device or tcp://host:port); adds the WBO2 channel")
+	rootCmd.PersistentFlags().StringVar(&cfgWidebandFormat, "wideband-format", "isp2", "Wideband stream format: "+strings.Join(wideband.Formats, ", "))
+	rootCmd.PersistentFlags().StringVar(&cfgGPS, "gps", "", "NMEA GPS receiver port (serial device or tcp://host:port); adds the GPS speed, position, heading and fix channels")
+	rootCmd.PersistentFlags().IntVar(&cfgGPSBaud, "gps-baud", gps.DefaultBaudRate, "GPS receiver baud rate")
 	rootCmd.AddCommand(aboutCmd)
 
 	cobra.OnInitialize(initLogging)
@@ -88,6 +120,155 @@ func initLogging() {
 	slog.SetDefault(slog.New(handler))
 }
 
+// openPort creates and opens the transport selected by --port and --baud.
+func openPort() (protocol.Transport, error) {
+	conn, err := protocol.NewTransport(cfgPort, cfgBaud)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Open(); err != nil {
+		return nil, fmt.Errorf("failed to open port: %w", err)
+	}
+	return conn, nil
+}
+
+// loadVehicle returns the platform selected with --vehicle.
+func loadVehicle() (*vehicle.Vehicle, error) {
+	v, err := vehicle.Get(cfgVehicle)
+	if err != nil {
+		return nil, fmt.Errorf("--vehicle: %w", err)
+	}
+	return v, nil
+}
+
+// csvVehicle is the vehicle recorded in CSV logs: the --vehicle platform, or
+// "" when none was chosen so CSV files keep their plain format.
+func csvVehicle() string {
+	if cfgVehicle == "" {
+		return ""
+	}
+	if v, err := vehicle.Get(cfgVehicle); err == nil {
+		return v.ID
+	}
+	return ""
+}
+
+// loadUnits returns the unit system of --units. The per-sensor units in it
+// are applied by loadDefinitions.
+func loadUnits() (sensor.UnitSystem, error) {
+	system, _, err := sensor.ParseUnits(cfgUnits)
+	if err != nil {
+		return system, fmt.Errorf("--units: %w", err)
+	}
+	return system, nil
+}
+
+// loadFueling returns the vehicle's stock fueling hardware with --injectors,
+// --fuel-pressure and --maf applied. modified reports whether any was given.
+func loadFueling(v *vehicle.Vehicle) (f sensor.Fueling, modified bool, err error) {
+	opts := sensor.FuelingOptions{InjectorCC: cfgInjectorCC, FuelPressure: cfgFuelPressure, MAF: cfgMAF}
+	if f, err = v.Fueling().Apply(opts); err != nil {
+		return f, false, fmt.Errorf("fueling: %w", err)
+	}
+	return f, !opts.IsZero(), nil
+}
+
+// loadDefinitions returns the sensor table of the --vehicle platform, with
+// --sensors-file, --derived and the per-sensor units of --units applied.
+// When the fueling hardware is changed from stock the airflow, injector
+// duty, headroom and fuel flow channels are added too. --wideband adds WBO2
+// and --gps the GPS channels before the sensor file, so its expressions can
+// use them.
+func loadDefinitions() ([]sensor.Definition, error) {
+	v, err := loadVehicle()
+	if err != nil {
+		return nil, err
+	}
+	defs, err := v.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	if cfgWideband != "" {
+		if defs, _, err = sensor.AddWideband(defs); err != nil {
+			return nil, fmt.Errorf("--wideband: %w", err)
+		}
+	}
+	if cfgGPS != "" {
+		if defs, _, err = sensor.AddGPS(defs); err != nil {
+			return nil, fmt.Errorf("--gps: %w", err)
+		}
+	}
+	if defs, err = sensor.ApplyProfileFile(defs, cfgSensorsFile); err != nil {
+		return nil, err
+	}
+	if cfgSensorsFile != "" {
+		slog.Info("sensor definitions loaded", "file", cfgSensorsFile)
+	}
+	fueling, modified, err := loadFueling(v)
+	if err != nil {
+		return nil, err
+	}
+	var derived []string
+	if cfgDerived != "" {
+		derived = strings.Split(cfgDerived, ",")
+	}
+	if modified {
+		derived = append(derived, sensor.FuelingChannels...)
+		slog.Info("fueling hardware", "setup", fueling.String())
+	}
+	if defs, err = sensor.AddDerivedWithFueling(defs, derived, fueling); err != nil {
+		return nil, fmt.Errorf("--derived: %w", err)
+	}
+	_, overrides, err := sensor.ParseUnits(cfgUnits)
+	if err != nil {
+		return nil, fmt.Errorf("--units: %w", err)
+	}
+	if defs, err = sensor.ApplyUnits(defs, overrides); err != nil {
+		return nil, fmt.Errorf("--units: %w", err)
+	}
+	return defs, nil
+}
+
+// openWideband starts reading the --wideband controller and wraps poller so
+// its samples carry WBO2. It returns the WBO2 index and the source to close.
+func openWideband(poller logger.SamplePoller, defs []sensor.Definition) (logger.SamplePoller, int, *wideband.Source, error) {
+	format, err := wideband.ParseFormat(cfgWidebandFormat)
+	if err != nil {
+		return nil, -1, nil, fmt.Errorf("--wideband-format: %w", err)
+	}
+	idx, _ := sensor.FindBySlug(defs, sensor.WidebandSlug)
+	src, err := wideband.Open(cfgWideband, 0, format)
+	if err != nil {
+		return nil, -1, nil, err
+	}
+	return wideband.NewPoller(poller, src, defs, idx), idx, src, nil
+}
+
+// openGPS starts reading the --gps receiver and wraps poller so its samples
+// carry the GPS channels. It returns the channels and the source to close.
+func openGPS(poller logger.SamplePoller, defs []sensor.Definition) (logger.SamplePoller, sensor.GPSChannels, *gps.Source, error) {
+	ch, ok := sensor.FindGPS(defs)
+	if !ok {
+		return nil, ch, nil, fmt.Errorf("--gps: no GPS channels in the sensor table")
+	}
+	src, err := gps.Open(cfgGPS, cfgGPSBaud)
+	if err != nil {
+		return nil, ch, nil, err
+	}
+	return gps.NewPoller(poller, src, defs, ch), ch, src, nil
+}
+
+// withInputChannels returns defs with the wideband and GPS channels added,
+// so logs recorded with those inputs read back in full.
+func withInputChannels(defs []sensor.Definition) ([]sensor.Definition, error) {
+	defs, _, err := sensor.AddWideband(defs)
+	if err != nil {
+		return nil, err
+	}
+	defs, _, err = sensor.AddGPS(defs)
+	return defs, err
+}
+
 // confirmPrompt asks the user for y/N confirmation. Returns true if confirmed.
 // If cfgYes is set, returns true without prompting.
 func confirmPrompt(msg string) bool {
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/spf13/cobra"
+)
+
+var (
+	scanFrom     string
+	scanTo       string
+	scanSweeps   int
+	scanStates   string
+	scanInterval time.Duration
+	scanOutput   string
+	scanAll      bool
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Sweep ECU memory below 0xC0 to find ROM-specific variables",
+	Long: `Reads every address in the sensor range (0x00-0xBF by default) with the
+normal sensor query and reports which addresses answer and which change. Use
+it to find what a custom ROM exposes before assigning the custom sensor slots.
+
+Each engine state given with --states gets --sweeps passes. Between states
+the scan pauses so the engine can be brought to the next state. Addresses are
+classified as live (changes within a state), state (steady within a state but
+different between states), constant or silent.
+
+  mmcd scan -p /dev/ttyUSB0 --states key-on,idle,2500rpm -o scan.txt
+  mmcd scan -p /dev/ttyUSB0 --from 0x40 --to 0x7F --sweeps 10 -o scan.json
+
+Addresses from 0xC0 up are commands (actuator tests, DTC erase) and are never
+sent.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cfgPort == "" {
+			return fmt.Errorf("--port is required")
+		}
+		from, err := parseAddr(scanFrom)
+		if err != nil {
+			return fmt.Errorf("--from: %w", err)
+		}
+		to, err := parseAddr(scanTo)
+		if err != nil {
+			return fmt.Errorf("--to: %w", err)
+		}
+		if to > protocol.MaxScanAddr {
+			return fmt.Errorf("--to 0x%02X is in the command range; the highest scannable address is 0x%02X", to, protocol.MaxScanAddr)
+		}
+		if from > to {
+			return fmt.Errorf("--from 0x%02X is above --to 0x%02X", from, to)
+		}
+		if scanSweeps < 1 {
+			return fmt.Errorf("--sweeps must be at least 1")
+		}
+
+		states := []string{"default"}
+		if scanStates != "" {
+			states = nil
+			for _, s := range strings.Split(scanStates, ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					states = append(states, s)
+				}
+			}
+		}
+
+		defs, err := loadDefinitions()
+		if err != nil {
+			return err
+		}
+		conn, err := openPort()
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		ecu := protocol.NewECU(conn, defs)
+		if err := ecu.Probe(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Scanning 0x%02X-0x%02X: %d sweep(s) x %d state(s)\n", from, to, scanSweeps, len(states))
+
+		var sweeps []protocol.Sweep
+		total := int(to) - int(from) + 1
+		for si, state := range states {
+			if len(states) > 1 {
+				waitForEnter(fmt.Sprintf("\nBring the engine to state %q (%d/%d) and press Enter...", state, si+1, len(states)))
+			}
+			for n := 1; n <= scanSweeps; n++ {
+				sw, err := ecu.Sweep(from, to, state, func(addr byte) {
+					done := int(addr) - int(from) + 1
+					fmt.Printf("\r  %s sweep %d/%d: 0x%02X (%d/%d)", state, n, scanSweeps, addr, done, total)
+				})
+				fmt.Println()
+				if err != nil {
+					return fmt.Errorf("sweep failed: %w", err)
+				}
+				sweeps = append(sweeps, sw)
+				if n < scanSweeps {
+					time.Sleep(scanInterval)
+				}
+			}
+		}
+
+		report := protocol.NewScanReport(sweeps, from, to, defs)
+		fmt.Println()
+		if err := report.WriteText(os.Stdout, scanAll); err != nil {
+			return err
+		}
+
+		if scanOutput != "" {
+			if err := saveScanReport(report, scanOutput); err != nil {
+				return err
+			}
+			fmt.Printf("\nReport saved to: %s\n", scanOutput)
+		}
+		return nil
+	},
+}
+
+func init() {
+	scanCmd.Flags().StringVar(&scanFrom, "from", "0x00", "First address to read")
+	scanCmd.Flags().StringVar(&scanTo, "to", "0xBF", "Last address to read (at most 0xBF)")
+	scanCmd.Flags().IntVar(&scanSweeps, "sweeps", 3, "Sweeps per engine state")
+	scanCmd.Flags().StringVar(&scanStates, "states", "", "Engine state labels to sweep in turn (comma-separated), e.g. key-on,idle,2500rpm")
+	scanCmd.Flags().DurationVar(&scanInterval, "interval", time.Second, "Pause between sweeps in the same state")
+	scanCmd.Flags().StringVarP(&scanOutput, "output", "o", "", "Save the report: .json for the full sweeps, anything else as text")
+	scanCmd.Flags().BoolVar(&scanAll, "all", false, "List constant and silent addresses too")
+	rootCmd.AddCommand(scanCmd)
+}
+
+// parseAddr parses a byte address in hex (0x21) or decimal.
+func parseAddr(s string) (byte, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return byte(v), nil
+}
+
+// waitForEnter prints msg and blocks until Enter. It returns at once with --yes.
+func waitForEnter(msg string) {
+	if cfgYes {
+		return
+	}
+	fmt.Print(msg)
+	bufio.NewReader(os.Stdin).ReadString('\n')
+}
+
+// saveScanReport writes report as JSON or text depending on the extension.
+func saveScanReport(report *protocol.ScanReport, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return nil
+	}
+	if err := report.WriteText(f, true); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
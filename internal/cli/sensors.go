@@ -2,7 +2,10 @@ package cli
 
 import (
 	"fmt"
+	"math"
 	"os"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/kbuckham/mmcd/internal/sensor"
@@ -12,12 +15,26 @@ import (
 var sensorsCmd = &cobra.Command{
 	Use:   "sensors",
 	Short: "List all known ECU sensors with addresses and conversions",
-	Run: func(cmd *cobra.Command, args []string) {
-		defs := sensor.DefaultDefinitions()
+	Long: `Lists the sensor table, including any sensors added or overridden with
+--sensors-file. The UNIT column is the unit values are shown in under
+--units, and LIMITS the display range and the warning and critical
+thresholds (yellow and red in the mmcd log display) in that unit. The named bits of flags sensors follow their sensor as 0/1
+channels, with ADDR showing address/bit. Two-byte sensors show both
+addresses and their raw type (u16, s16, with le for little-endian), signed
+one-byte sensors s8.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		units, err := loadUnits()
+		if err != nil {
+			return err
+		}
+		defs, err := loadDefinitions()
+		if err != nil {
+			return err
+		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-		fmt.Fprintln(w, "IDX\tSLUG\tADDR\tDESCRIPTION\tUNIT\tCOMPUTED")
-		fmt.Fprintln(w, "---\t----\t----\t-----------\t----\t--------")
+		fmt.Fprintln(w, "IDX\tSLUG\tADDR\tDESCRIPTION\tUNIT\tLIMITS\tCOMPUTED")
+		fmt.Fprintln(w, "---\t----\t----\t-----------\t----\t------\t--------")
 
 		for i, d := range defs {
 			if !d.Exists {
@@ -27,17 +44,67 @@ var sensorsCmd = &cobra.Command{
 			if d.Computed {
 				computed = "yes"
 			}
+			if d.IsExpr() {
+				computed = d.Expr
+			}
 			addrStr := fmt.Sprintf("0x%02X", d.Addr)
-			if d.Addr == 0xFF {
+			switch {
+			case d.Addr == 0xFF:
 				addrStr = "n/a"
+			case d.IsWord():
+				addrStr = fmt.Sprintf("0x%02X:0x%02X %s", d.Addr, d.Addr2, rawType(d))
+			case d.Signed:
+				addrStr += " " + rawType(d)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				i, d.Slug, addrStr, d.Description, d.UnitLabel(units), limitsText(d.LimitsIn(units)), computed)
+			for _, b := range d.Bits {
+				fmt.Fprintf(w, "\t%s\t0x%02X/%d\t%s\ton/off\t\t\n", b.Name, d.Addr, b.Bit, b.Description)
 			}
-			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
-				i, d.Slug, addrStr, d.Description, d.Unit, computed)
 		}
-		w.Flush()
+		return w.Flush()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(sensorsCmd)
 }
+
+// rawType names the raw value type of a two-byte or signed sensor.
+func rawType(d sensor.Definition) string {
+	t := "u"
+	if d.Signed {
+		t = "s"
+	}
+	if !d.IsWord() {
+		return t + "8"
+	}
+	t += "16"
+	if d.LittleEndian {
+		t += "le"
+	}
+	return t
+}
+
+// limitsText formats limits as "MIN..MAX warn>W crit>C".
+func limitsText(l *sensor.Limits) string {
+	if l == nil {
+		return ""
+	}
+	scale := math.Pow(10, float64(l.Decimals))
+	num := func(v float64) string { return strconv.FormatFloat(math.Round(v*scale)/scale, 'f', -1, 64) }
+	parts := []string{num(l.Min) + ".." + num(l.Max)}
+	for _, t := range []struct {
+		name string
+		low  *float64
+		high *float64
+	}{{"warn", l.WarnLow, l.WarnHigh}, {"crit", l.CritLow, l.CritHigh}} {
+		if t.low != nil {
+			parts = append(parts, t.name+"<"+num(*t.low))
+		}
+		if t.high != nil {
+			parts = append(parts, t.name+">"+num(*t.high))
+		}
+	}
+	return strings.Join(parts, " ")
+}
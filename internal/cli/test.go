@@ -2,33 +2,12 @@ package cli
 
 import (
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/kbuckham/mmcd/internal/protocol"
-	"github.com/kbuckham/mmcd/internal/sensor"
 	"github.com/spf13/cobra"
 )
 
-// Actuator command mapping
-var actuatorCommands = map[string]struct {
-	addr byte
-	desc string
-}{
-	"fuel-pump": {0xF6, "Fuel pump relay"},
-	"purge":     {0xF5, "Canister purge solenoid"},
-	"pressure":  {0xF4, "Pressure solenoid"},
-	"egr":       {0xF3, "EGR solenoid"},
-	"mvic":      {0xF2, "MVIC motor"},
-	"boost":     {0xF1, "Boost solenoid"},
-	"inj1":      {0xFC, "Disable injector #1"},
-	"inj2":      {0xFB, "Disable injector #2"},
-	"inj3":      {0xFA, "Disable injector #3"},
-	"inj4":      {0xF9, "Disable injector #4"},
-	"inj5":      {0xF8, "Disable injector #5"},
-	"inj6":      {0xF7, "Disable injector #6"},
-}
-
 var testCommand string
 
 var testCmd = &cobra.Command{
@@ -38,55 +17,67 @@ var testCmd = &cobra.Command{
 Solenoid/relay commands (fuel-pump, purge, etc.) only work with engine OFF.
 Injector disable commands work with engine running.
 
-The ECU activates the component for ~6 seconds then responds.`,
+The ECU activates the component for ~6 seconds then responds. Which commands
+exist depends on --vehicle: injectors 5 and 6 and the MVIC motor are only
+offered on the 3000GT/Stealth.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if cfgPort == "" {
 			return fmt.Errorf("--port is required")
 		}
 
+		v, err := loadVehicle()
+		if err != nil {
+			return err
+		}
+
 		if testCommand == "" {
 			// List available commands
-			fmt.Println("Available actuator test commands:")
+			fmt.Printf("Available actuator test commands (%s):\n", v.Name)
 			fmt.Println()
 			fmt.Println("  Solenoids/Relays (engine OFF only):")
-			for _, name := range []string{"fuel-pump", "purge", "pressure", "egr", "mvic", "boost"} {
-				c := actuatorCommands[name]
-				fmt.Printf("    %-12s  0x%02X  %s\n", name, c.addr, c.desc)
+			for _, c := range v.Actuators {
+				if !c.Injector {
+					fmt.Printf("    %-12s  0x%02X  %s\n", c.Name, c.Addr, c.Description)
+				}
 			}
 			fmt.Println()
 			fmt.Println("  Injector Disable (engine running):")
-			for _, name := range []string{"inj1", "inj2", "inj3", "inj4", "inj5", "inj6"} {
-				c := actuatorCommands[name]
-				fmt.Printf("    %-12s  0x%02X  %s\n", name, c.addr, c.desc)
+			for _, c := range v.Actuators {
+				if c.Injector {
+					fmt.Printf("    %-12s  0x%02X  %s\n", c.Name, c.Addr, c.Description)
+				}
 			}
 			fmt.Println()
 			fmt.Println("Usage: mmcd test --command <name>")
 			return nil
 		}
 
-		ac, ok := actuatorCommands[strings.ToLower(testCommand)]
+		ac, ok := v.Actuator(testCommand)
 		if !ok {
-			return fmt.Errorf("unknown test command: %s", testCommand)
+			return fmt.Errorf("unknown test command for %s: %s", v.Name, testCommand)
 		}
 
-		defs := sensor.DefaultDefinitions()
-		conn := protocol.NewSerialConn(cfgPort, cfgBaud)
-		if err := conn.Open(); err != nil {
-			return fmt.Errorf("failed to open serial port: %w", err)
+		defs, err := v.Definitions()
+		if err != nil {
+			return err
+		}
+		conn, err := openPort()
+		if err != nil {
+			return err
 		}
 		defer conn.Close()
 
 		ecu := protocol.NewECU(conn, defs)
 
-		if !confirmPrompt(fmt.Sprintf("Send %s (0x%02X — %s)?", testCommand, ac.addr, ac.desc)) {
+		if !confirmPrompt(fmt.Sprintf("Send %s (0x%02X — %s)?", testCommand, ac.Addr, ac.Description)) {
 			fmt.Println("Cancelled.")
 			return nil
 		}
 
-		fmt.Printf("Sending: %s (0x%02X) — %s\n", testCommand, ac.addr, ac.desc)
+		fmt.Printf("Sending: %s (0x%02X) — %s\n", testCommand, ac.Addr, ac.Description)
 		fmt.Println("Waiting for ECU response (~6 seconds)...")
 
-		result, err := ecu.SendCommand(ac.addr, 10*time.Second)
+		result, err := ecu.SendCommand(ac.Addr, 10*time.Second)
 		if err != nil {
 			return fmt.Errorf("test command failed: %w", err)
 		}
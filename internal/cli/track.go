@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/gps"
+	"github.com/kbuckham/mmcd/internal/logger"
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/spf13/cobra"
+)
+
+var (
+	trackFile   string
+	trackOutput string
+	trackFormat string
+)
+
+var trackCmd = &cobra.Command{
+	Use:   "track",
+	Short: "Export the GPS track of a log as GPX or KML",
+	Long: `Writes the positions of a log recorded with --gps as a GPX track or a KML
+path, for mapping a drive in a GPS viewer or Google Earth.
+
+  mmcd track -f drive.csv
+  mmcd track -f drive.csv -o drive.kml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if trackFile == "" {
+			return fmt.Errorf("--file is required")
+		}
+		base := strings.TrimSuffix(trackFile, filepath.Ext(trackFile))
+		format := strings.ToLower(trackFormat)
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(trackOutput)), ".")
+		}
+		if format == "" {
+			format = "gpx"
+		}
+		if format != "gpx" && format != "kml" {
+			return fmt.Errorf("unknown track format %q (want gpx or kml)", format)
+		}
+		if trackOutput == "" {
+			trackOutput = base + "." + format
+		}
+
+		defs, err := loadDefinitions()
+		if err != nil {
+			return err
+		}
+		defs, _, err = sensor.AddGPS(defs)
+		if err != nil {
+			return err
+		}
+		l, err := logger.Open(trackFile, defs)
+		if err != nil {
+			return err
+		}
+		ch, ok := sensor.FindGPS(l.Defs)
+		if !ok {
+			return fmt.Errorf("no GPS channels in %s", trackFile)
+		}
+		r, err := l.Samples()
+		if err != nil {
+			return err
+		}
+		tracker := gps.NewTracker(ch)
+		for {
+			s, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				r.Close()
+				return err
+			}
+			tracker.Add(&s)
+		}
+		r.Close()
+		pts := tracker.Points()
+		if len(pts) == 0 {
+			return fmt.Errorf("no GPS positions in %s (was it logged with --gps?)", trackFile)
+		}
+
+		f, err := os.Create(trackOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", trackOutput, err)
+		}
+		name := filepath.Base(base)
+		if format == "kml" {
+			err = gps.WriteKML(f, name, pts)
+		} else {
+			err = gps.WriteGPX(f, name, pts)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Written %d positions (%s) to: %s\n", len(pts), pts[len(pts)-1].Time.Sub(pts[0].Time).Round(time.Second), trackOutput)
+		return nil
+	},
+}
+
+func init() {
+	trackCmd.Flags().StringVarP(&trackFile, "file", "f", "", "Log file with GPS channels (.csv, .mmcd)")
+	trackCmd.Flags().StringVarP(&trackOutput, "output", "o", "", "Output file (default: the log name with .gpx or .kml)")
+	trackCmd.Flags().StringVar(&trackFormat, "format", "", "Output format: gpx or kml (default: from --output, else gpx)")
+	rootCmd.AddCommand(trackCmd)
+}
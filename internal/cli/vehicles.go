@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/kbuckham/mmcd/internal/vehicle"
+	"github.com/spf13/cobra"
+)
+
+var vehiclesCmd = &cobra.Command{
+	Use:   "vehicles",
+	Short: "List the supported vehicle platforms for --vehicle",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tENGINE\tCYL\tACTUATORS")
+		fmt.Fprintln(w, "--\t----\t------\t---\t---------")
+
+		for _, v := range vehicle.All() {
+			names := make([]string, len(v.Actuators))
+			for i, a := range v.Actuators {
+				names[i] = a.Name
+			}
+			id := v.ID
+			if id == vehicle.DefaultID {
+				id += " (default)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n",
+				id, v.Name, v.Engine, v.Cylinders, strings.Join(names, ","))
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(vehiclesCmd)
+}
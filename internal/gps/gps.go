@@ -0,0 +1,70 @@
+// Package gps reads a GPS receiver's NMEA 0183 stream on a second serial
+// port and merges its fixes into ECU samples as the GPS channels (GSPD,
+// GLAT, GLON, GHDG and GFIX, see sensor.AddGPS), and exports the position
+// track of a log as GPX or KML.
+//
+// The GGA, RMC and VTG sentences of any talker (GP, GN, GL, ...) are read;
+// others are ignored.
+package gps
+
+import "time"
+
+// DefaultBaudRate is the NMEA 0183 speed most receivers ship with.
+const DefaultBaudRate = 9600
+
+// knotsToKmh converts the knots of RMC and VTG sentences to km/h.
+const knotsToKmh = 1.852
+
+// Quality is the GGA fix quality indicator.
+type Quality int
+
+const (
+	QualityNone      Quality = 0 // no fix; position and speed are not valid
+	QualityGPS       Quality = 1 // autonomous fix
+	QualityDGPS      Quality = 2 // differential (SBAS, DGPS)
+	QualityRTK       Quality = 4
+	QualityFloatRTK  Quality = 5
+	QualityEstimated Quality = 6 // dead reckoning
+)
+
+// String returns a short lower-case name for q.
+func (q Quality) String() string {
+	switch q {
+	case QualityNone:
+		return "none"
+	case QualityGPS:
+		return "gps"
+	case QualityDGPS:
+		return "dgps"
+	case QualityRTK:
+		return "rtk"
+	case QualityFloatRTK:
+		return "float-rtk"
+	case QualityEstimated:
+		return "estimated"
+	default:
+		return "other"
+	}
+}
+
+// Fix is the receiver's state after a sentence: the latest position, speed
+// and heading it reported, and when the sentence arrived.
+type Fix struct {
+	Time       time.Time // when the sentence was received
+	Quality    Quality
+	Satellites int     // satellites used, from GGA; 0 if not reported
+	Lat, Lon   float64 // degrees, north and east positive
+	Speed      float64 // ground speed, km/h
+	Heading    float64 // course over ground, degrees true
+	HasCourse  bool    // Speed and Heading have been reported
+}
+
+// Received returns when the sentence arrived.
+func (f Fix) Received() time.Time {
+	return f.Time
+}
+
+// Valid reports whether f has a position.
+func (f Fix) Valid() bool {
+	return f.Quality != QualityNone
+}
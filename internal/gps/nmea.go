@@ -0,0 +1,240 @@
+package gps
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSentenceLen bounds a sentence; NMEA 0183 allows 82 characters, longer
+// lines are noise and dropped.
+const maxSentenceLen = 82
+
+// Decoder turns an NMEA byte stream into fixes. It keeps the receiver state
+// across sentences: GGA brings the fix quality, RMC and VTG the speed and
+// heading, and each sentence read returns the updated Fix.
+type Decoder struct {
+	line     []byte
+	overflow bool // line ran past maxSentenceLen; skip to its end
+	fix      Fix
+	hasGGA   bool // a GGA has been seen; RMC no longer sets the quality
+}
+
+// NewDecoder returns a decoder with no fix.
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Decode consumes p, received at time at, and returns a Fix for each
+// sentence it completes. Sentences with a bad checksum are dropped.
+func (d *Decoder) Decode(p []byte, at time.Time) []Fix {
+	var out []Fix
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			if len(d.line) < maxSentenceLen {
+				d.line = append(d.line, b)
+			} else {
+				d.overflow = true
+			}
+			continue
+		}
+		if !d.overflow && d.sentence(string(d.line)) {
+			d.fix.Time = at
+			out = append(out, d.fix)
+		}
+		d.line, d.overflow = d.line[:0], false
+	}
+	return out
+}
+
+// sentence applies one line to the receiver state and reports whether it
+// was a sentence Decoder reads.
+func (d *Decoder) sentence(line string) bool {
+	body, ok := checkSentence(line)
+	if !ok {
+		return false
+	}
+	f := strings.Split(body, ",")
+	if len(f[0]) != 5 || f[0][0] == 'P' {
+		return false // proprietary or malformed address
+	}
+	switch f[0][2:] {
+	case "GGA":
+		return d.gga(f)
+	case "RMC":
+		return d.rmc(f)
+	case "VTG":
+		return d.vtg(f)
+	}
+	return false
+}
+
+// checkSentence returns the body of "$BODY*CS" with the checksum verified.
+// A sentence without a checksum is accepted, as some receivers omit it.
+func checkSentence(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if i := strings.IndexByte(line, '$'); i > 0 {
+		line = line[i:] // noise before the start of the sentence
+	}
+	if !strings.HasPrefix(line, "$") {
+		return "", false
+	}
+	body, cs, hasCS := strings.Cut(line[1:], "*")
+	if hasCS {
+		want, err := strconv.ParseUint(cs, 16, 8)
+		if err != nil || byte(want) != checksum(body) {
+			return "", false
+		}
+	}
+	return body, true
+}
+
+// checksum is the XOR of the bytes between '$' and '*'.
+func checksum(body string) byte {
+	var cs byte
+	for i := 0; i < len(body); i++ {
+		cs ^= body[i]
+	}
+	return cs
+}
+
+// field returns f[i], or "" past the end.
+func field(f []string, i int) string {
+	if i < len(f) {
+		return f[i]
+	}
+	return ""
+}
+
+// gga reads $--GGA,time,lat,N,lon,E,quality,sats,hdop,alt,M,...
+func (d *Decoder) gga(f []string) bool {
+	q, err := strconv.Atoi(field(f, 6))
+	if err != nil {
+		return false
+	}
+	d.hasGGA = true
+	d.fix.Quality = Quality(q)
+	d.fix.Satellites, _ = strconv.Atoi(field(f, 7))
+	if q != 0 {
+		d.position(field(f, 2), field(f, 3), field(f, 4), field(f, 5))
+	}
+	return true
+}
+
+// rmc reads $--RMC,time,status,lat,N,lon,E,knots,course,date,...
+func (d *Decoder) rmc(f []string) bool {
+	switch field(f, 2) {
+	case "A":
+		if !d.hasGGA || d.fix.Quality == QualityNone {
+			d.fix.Quality = QualityGPS
+		}
+	case "V":
+		d.fix.Quality = QualityNone
+		return true
+	default:
+		return false
+	}
+	d.position(field(f, 3), field(f, 4), field(f, 5), field(f, 6))
+	if knots, err := strconv.ParseFloat(field(f, 7), 64); err == nil {
+		d.fix.Speed = knots * knotsToKmh
+		d.fix.HasCourse = true
+	}
+	if course, err := strconv.ParseFloat(field(f, 8), 64); err == nil {
+		d.fix.Heading = course
+	}
+	return true
+}
+
+// vtg reads $--VTG,course,T,course,M,knots,N,kmh,K,mode or the older
+// $--VTG,course,course,knots,kmh without unit letters.
+func (d *Decoder) vtg(f []string) bool {
+	course, kmh := field(f, 1), field(f, 7)
+	if field(f, 2) != "T" {
+		kmh = field(f, 4)
+	}
+	if field(f, 9) == "N" {
+		return true // mode: data not valid
+	}
+	v, err := strconv.ParseFloat(kmh, 64)
+	if err != nil {
+		return false
+	}
+	d.fix.Speed, d.fix.HasCourse = v, true
+	if c, err := strconv.ParseFloat(course, 64); err == nil {
+		d.fix.Heading = c
+	}
+	return true
+}
+
+// position sets the fix position from NMEA ddmm.mmmm/dddmm.mmmm fields.
+func (d *Decoder) position(lat, ns, lon, ew string) {
+	la, ok1 := parseCoord(lat, ns, "S")
+	lo, ok2 := parseCoord(lon, ew, "W")
+	if ok1 && ok2 {
+		d.fix.Lat, d.fix.Lon = la, lo
+	}
+}
+
+// parseCoord converts an NMEA degrees-and-minutes value to degrees,
+// negative in hemisphere neg.
+func parseCoord(v, hemi, neg string) (float64, bool) {
+	dot := strings.IndexByte(v, '.')
+	if dot < 0 {
+		dot = len(v)
+	}
+	if dot < 3 {
+		return 0, false
+	}
+	deg, err1 := strconv.Atoi(v[:dot-2])
+	min, err2 := strconv.ParseFloat(v[dot-2:], 64)
+	if err1 != nil || err2 != nil || min >= 60 {
+		return 0, false
+	}
+	out := float64(deg) + min/60
+	if hemi == neg {
+		out = -out
+	}
+	return out, true
+}
+
+// formatCoord formats degrees as NMEA ddmm.mmmm (digits = 2) or dddmm.mmmm
+// (digits = 3) and its hemisphere letter.
+func formatCoord(v float64, digits int, pos, neg string) (string, string) {
+	hemi := pos
+	if v < 0 {
+		hemi, v = neg, -v
+	}
+	deg := math.Floor(v)
+	min := (v - deg) * 60
+	if min >= 59.99995 { // would round up to 60.0000
+		deg, min = deg+1, 0
+	}
+	return fmt.Sprintf("%0*d%07.4f", digits, int(deg), min), hemi
+}
+
+// sentence frames body as "$BODY*CS\r\n".
+func sentence(body string) []byte {
+	return []byte(fmt.Sprintf("$%s*%02X\r\n", body, checksum(body)))
+}
+
+// encode returns the GGA, RMC and VTG sentences a receiver sends for f,
+// with UTC time stamps from f.Time.
+func encode(f Fix) []byte {
+	utc := f.Time.UTC()
+	hms := utc.Format("150405.00")
+	if !f.Valid() {
+		var out []byte
+		out = append(out, sentence("GPGGA,"+hms+",,,,,0,00,99.9,,,,,,")...)
+		out = append(out, sentence("GPRMC,"+hms+",V,,,,,,,"+utc.Format("020106")+",,,N")...)
+		return append(out, sentence("GPVTG,,T,,M,,N,,K,N")...)
+	}
+	lat, ns := formatCoord(f.Lat, 2, "N", "S")
+	lon, ew := formatCoord(f.Lon, 3, "E", "W")
+	knots := f.Speed / knotsToKmh
+	var out []byte
+	out = append(out, sentence(fmt.Sprintf("GPGGA,%s,%s,%s,%s,%s,%d,%02d,0.9,120.0,M,-17.0,M,,", hms, lat, ns, lon, ew, f.Quality, f.Satellites))...)
+	out = append(out, sentence(fmt.Sprintf("GPRMC,%s,A,%s,%s,%s,%s,%.2f,%.1f,%s,,,A", hms, lat, ns, lon, ew, knots, f.Heading, utc.Format("020106")))...)
+	return append(out, sentence(fmt.Sprintf("GPVTG,%.1f,T,,M,%.2f,N,%.1f,K,A", f.Heading, knots, f.Speed))...)
+}
@@ -0,0 +1,91 @@
+package gps
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDecoder_Sentences(t *testing.T) {
+	dec := NewDecoder()
+	now := time.Now()
+	stream := "\x00\x13$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47\r\n" +
+		"$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A\r\n" +
+		"$GPGSV,2,1,08,01,40,083,46,02,17,308,41,12,07,344,39,14,22,228,45*75\r\n" + // not read
+		"$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K*48\r\n"
+
+	// Fed a byte at a time, fixes complete with their line end
+	var got []Fix
+	for _, b := range []byte(stream) {
+		got = append(got, dec.Decode([]byte{b}, now)...)
+	}
+	if len(got) != 3 {
+		t.Fatalf("decoded %d fixes, want 3 (GGA, RMC, VTG): %+v", len(got), got)
+	}
+	gga, rmc, vtg := got[0], got[1], got[2]
+	if gga.Quality != QualityGPS || gga.Satellites != 8 || math.Abs(gga.Lat-48.1173) > 1e-6 || math.Abs(gga.Lon-11.516667) > 1e-6 || gga.HasCourse {
+		t.Errorf("GGA fix = %+v", gga)
+	}
+	if math.Abs(rmc.Speed-22.4*1.852) > 1e-9 || rmc.Heading != 84.4 || !rmc.HasCourse {
+		t.Errorf("RMC fix = %+v", rmc)
+	}
+	if vtg.Speed != 10.2 || vtg.Heading != 54.7 || vtg.Lat != gga.Lat || !vtg.Time.Equal(now) {
+		t.Errorf("VTG fix = %+v", vtg)
+	}
+}
+
+func TestDecoder_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int // fixes
+	}{
+		{"bad checksum", "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*48\r\n", 0},
+		{"no checksum", "$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K\r\n", 1},
+		{"old VTG", "$GPVTG,054.7,034.4,005.5,010.2\r\n", 1},
+		{"proprietary", "$PUBX,00,123519*00\r\n", 0},
+		{"too long", "$GPVTG," + string(make([]byte, 100)) + "\r\n", 0},
+		{"garbage", "hello\r\n\r\n", 0},
+	}
+	for _, tt := range tests {
+		if got := NewDecoder().Decode([]byte(tt.input), time.Now()); len(got) != tt.want {
+			t.Errorf("%s: %d fixes %+v, want %d", tt.name, len(got), got, tt.want)
+		}
+	}
+
+	// Losing the fix keeps the last position but marks it invalid
+	dec := NewDecoder()
+	dec.Decode([]byte("$GPRMC,123519,A,4807.038,S,01131.000,W,022.4,084.4,230394,003.1,W\r\n"), time.Now())
+	got := dec.Decode([]byte("$GPRMC,123520,V,,,,,,,230394,,,N\r\n"), time.Now())
+	if len(got) != 1 || got[0].Valid() || got[0].Lat > -48 || got[0].Lon > -11 {
+		t.Errorf("after RMC V: %+v", got)
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	want := Fix{
+		Time:       time.Date(2026, 5, 1, 12, 30, 15, 0, time.UTC),
+		Quality:    QualityDGPS,
+		Satellites: 11,
+		Lat:        -33.8688197,
+		Lon:        151.2092955,
+		Speed:      87.5,
+		Heading:    271.3,
+		HasCourse:  true,
+	}
+	got := NewDecoder().Decode(encode(want), want.Time)
+	if len(got) != 3 {
+		t.Fatalf("decoded %d fixes", len(got))
+	}
+	f := got[2]
+	if f.Quality != want.Quality || f.Satellites != want.Satellites ||
+		math.Abs(f.Lat-want.Lat) > 1e-6 || math.Abs(f.Lon-want.Lon) > 1e-6 ||
+		math.Abs(f.Speed-want.Speed) > 0.05 || math.Abs(f.Heading-want.Heading) > 0.05 {
+		t.Errorf("round trip = %+v, want %+v", f, want)
+	}
+
+	none := NewDecoder().Decode(encode(Fix{Time: want.Time}), want.Time)
+	if len(none) != 3 || none[2].Valid() {
+		t.Errorf("no-fix sentences decoded as %+v", none)
+	}
+}
@@ -0,0 +1,84 @@
+package gps
+
+import (
+	"slices"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/logger"
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/stream"
+)
+
+// FixSource is where a Poller gets fixes; Source implements it.
+type FixSource interface {
+	At(t time.Time) (Fix, bool)
+}
+
+// Poller merges GPS fixes into the samples of another poller (the ECU, the
+// simulator or a replay), so the logger and its callbacks see the GPS
+// channels like any other.
+type Poller struct {
+	inner logger.SamplePoller
+	src   FixSource
+	defs  []sensor.Definition
+	ch    sensor.GPSChannels
+}
+
+var _ logger.SamplePoller = (*Poller)(nil)
+
+// NewPoller wraps inner. ch are the GPS channels in defs, see
+// sensor.AddGPS.
+func NewPoller(inner logger.SamplePoller, src FixSource, defs []sensor.Definition, ch sensor.GPSChannels) *Poller {
+	return &Poller{inner: inner, src: src, defs: defs, ch: ch}
+}
+
+// PollSensors polls inner, then sets the GPS channels among indices from
+// the fix closest to the middle of the poll sweep. Expression channels are
+// computed again so they can use them.
+func (p *Poller) PollSensors(indices []int) (sensor.Sample, error) {
+	sample, err := p.inner.PollSensors(indices)
+	if err != nil {
+		return sample, err
+	}
+	selected := false
+	for _, idx := range p.ch.Indices() {
+		selected = selected || slices.Contains(indices, idx)
+	}
+	if !selected || !Merge(&sample, p.src, p.ch) {
+		return sample, nil
+	}
+	for _, idx := range p.ch.Indices() {
+		if !slices.Contains(indices, idx) {
+			sample.Clear(idx)
+		}
+	}
+	sample.ComputeDerivatives(p.defs)
+	return sample, nil
+}
+
+// Merge sets the GPS channels of s from the fix closest to the middle of its
+// poll sweep and reports whether the receiver had sent one. Without a
+// position only GFIX is set, to 0. The channel time is the fix's, or the
+// sweep start for a fix received just before it.
+func Merge(s *sensor.Sample, src FixSource, ch sensor.GPSChannels) bool {
+	f, ok := src.At(stream.SweepMiddle(s))
+	if !ok {
+		return false
+	}
+	offset := max(0, f.Time.Sub(s.Time))
+	set := func(idx int, v float64) {
+		s.SetValue(idx, v)
+		s.SetOffset(idx, offset)
+	}
+	set(ch.Fix, float64(f.Quality))
+	if !f.Valid() {
+		return true
+	}
+	set(ch.Lat, f.Lat)
+	set(ch.Lon, f.Lon)
+	if f.HasCourse {
+		set(ch.Speed, f.Speed)
+		set(ch.Heading, f.Heading)
+	}
+	return true
+}
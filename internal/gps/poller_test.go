@@ -0,0 +1,109 @@
+package gps
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/stream"
+	"github.com/kbuckham/mmcd/internal/stream/streamtest"
+)
+
+// fixedSource returns fixes from a fixed list.
+func fixedSource(fs ...Fix) stream.List[Fix] {
+	return stream.List[Fix]{Items: fs, MaxSkew: MaxSkew}
+}
+
+func TestMerge_TimeAligned(t *testing.T) {
+	_, ch := streamtest.Defs(t, sensor.AddGPS)
+	streamtest.MergeTest[Fix]{
+		Merge: func(s *sensor.Sample, src stream.List[Fix]) bool { return Merge(s, src, ch) },
+		Items: func(start time.Time) []Fix {
+			return []Fix{
+				{Time: start.Add(-900 * time.Millisecond), Quality: QualityGPS, Lat: 47.1, Lon: -122.1, Speed: 50, Heading: 90, HasCourse: true},
+				{Time: start.Add(100 * time.Millisecond), Quality: QualityGPS, Lat: 47.2, Lon: -122.2, Speed: 60, Heading: 95, HasCourse: true},
+			}
+		},
+		Want:    1,
+		MaxSkew: MaxSkew,
+		Check: func(t *testing.T, s *sensor.Sample, f Fix) {
+			for idx, want := range map[int]float64{ch.Lat: f.Lat, ch.Lon: f.Lon, ch.Speed: f.Speed, ch.Heading: f.Heading, ch.Fix: 1} {
+				if !s.HasData(idx) || s.Float(idx) != want {
+					t.Errorf("channel %d = %g, want %g", idx, s.Float(idx), want)
+				}
+			}
+		},
+	}.Run(t)
+
+	// Without a fix only GFIX is set
+	var lost sensor.Sample
+	lost.Time = time.Now()
+	if !Merge(&lost, fixedSource(Fix{Time: lost.Time, Lat: 47.2}), ch) || !lost.HasData(ch.Fix) || lost.Float(ch.Fix) != 0 || lost.HasData(ch.Lat) {
+		t.Errorf("no-fix merge: channels %v", lost.Indices())
+	}
+}
+
+func TestPoller_Selection(t *testing.T) {
+	defs, ch := streamtest.Defs(t, sensor.AddGPS)
+	defs, err := sensor.AddDerived(defs, []string{"GEAR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gear, _ := sensor.FindBySlug(defs, "GEAR")
+	src := fixedSource(Fix{Time: time.Now(), Quality: QualityGPS, Lat: 1, Lon: 2, Speed: 100, HasCourse: true})
+	p := NewPoller(protocol.NewSimulator(defs), src, defs, ch)
+
+	s, err := p.PollSensors(sensor.WithComputed(defs, []int{gear}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.HasData(ch.Speed) || s.HasData(ch.Lat) || !s.HasData(gear) {
+		t.Errorf("GEAR selection: GSPD %v, GLAT %v, GEAR %v", s.HasData(ch.Speed), s.HasData(ch.Lat), s.HasData(gear))
+	}
+	if s, _ = p.PollSensors([]int{17}); len(s.Indices()) != 1 {
+		t.Errorf("GPS merged although not selected: %v", s.Indices())
+	}
+}
+
+func TestSource_Simulator(t *testing.T) {
+	ln, port := streamtest.Listen(t)
+	sim := NewSimulator()
+	sim.warmup = 0
+	sim.interval = 10 * time.Millisecond
+	sim.start = time.Now().Add(-25 * time.Second) // cruising
+	go sim.ServeListener(ln)
+
+	src, err := Open(port, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	streamtest.WaitCount(src, 6)
+	f, ok := src.At(time.Now())
+	if !ok || !f.Valid() || math.Abs(f.Speed-simKmh) > 0.1 {
+		t.Fatalf("At(now) = %+v, %v after %d fixes; want cruising at %g km/h", f, ok, src.Count(), simKmh)
+	}
+	if d := math.Hypot(f.Lat-simCenterLat, f.Lon-simCenterLon); d > 0.01 {
+		t.Errorf("position %g,%g is %g° from the loop center", f.Lat, f.Lon, d)
+	}
+}
+
+func TestSimulator_Loop(t *testing.T) {
+	sim := NewSimulator()
+	sim.warmup = 0
+	at := func(sec float64) Fix { return sim.FixAt(sim.start.Add(time.Duration(sec * float64(time.Second)))) }
+	if f := at(5); f.Speed != 0 || f.Heading != 90 {
+		t.Errorf("idle fix = %+v, want standing at the start heading east", f)
+	}
+	// A lap ends where it started
+	a, b := at(0), at(60)
+	if math.Abs(a.Lat-b.Lat) > 1e-9 || math.Abs(a.Lon-b.Lon) > 1e-9 {
+		t.Errorf("lap start %g,%g end %g,%g", a.Lat, a.Lon, b.Lat, b.Lon)
+	}
+	if f := (&Simulator{warmup: time.Second, start: sim.start}).FixAt(sim.start); f.Valid() {
+		t.Error("fix during warmup")
+	}
+}
@@ -0,0 +1,134 @@
+package gps
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/stream"
+)
+
+// Simulated drive: the speed follows the 60-second cycle of
+// protocol.Simulator (standing at idle, accelerating to simKmh, cruising,
+// slowing down) around a circular loop one cycle long, so every lap starts
+// at the same spot.
+const (
+	simKmh       = 110.0
+	simCenterLat = 47.2545
+	simCenterLon = -122.1930
+	metersPerDeg = 111320.0 // per degree of latitude
+)
+
+// Simulator streams fake NMEA output, for testing the GPS input without a
+// receiver. The first updates report no fix, as a receiver does before it
+// has acquired satellites.
+type Simulator struct {
+	interval time.Duration // time between updates
+	warmup   time.Duration
+	start    time.Time
+}
+
+// NewSimulator returns a simulator sending GGA, RMC and VTG once a second,
+// the default rate of most receivers.
+func NewSimulator() *Simulator {
+	return &Simulator{
+		interval: time.Second,
+		warmup:   3 * time.Second,
+		start:    time.Now(),
+	}
+}
+
+// FixAt returns the simulated fix at time t.
+func (s *Simulator) FixAt(t time.Time) Fix {
+	elapsed := t.Sub(s.start)
+	if elapsed < s.warmup {
+		return Fix{Time: t}
+	}
+	c := math.Mod(elapsed.Seconds(), 60)
+	lap := simDistance(60)
+	theta := 2 * math.Pi * simDistance(c) / lap
+	r := lap / (2 * math.Pi)
+	// counterclockwise from the south point of the loop
+	east, north := r*math.Sin(theta), -r*math.Cos(theta)
+	heading := math.Mod(90-theta*180/math.Pi+720, 360)
+	return Fix{
+		Time:       t,
+		Quality:    QualityGPS,
+		Satellites: 9,
+		Lat:        simCenterLat + north/metersPerDeg,
+		Lon:        simCenterLon + east/(metersPerDeg*math.Cos(simCenterLat*math.Pi/180)),
+		Speed:      simSpeed(c),
+		Heading:    heading,
+		HasCourse:  true,
+	}
+}
+
+// At implements FixSource, so the simulator can feed a Poller directly in
+// demo mode without a byte stream.
+func (s *Simulator) At(t time.Time) (Fix, bool) {
+	return s.FixAt(t), true
+}
+
+// simSpeed returns the speed in km/h at cycle position c (seconds).
+func simSpeed(c float64) float64 {
+	switch {
+	case c < 10 || c >= 50: // idle
+		return 0
+	case c < 20: // acceleration
+		return simKmh * (c - 10) / 10
+	case c < 40: // cruise
+		return simKmh
+	default: // deceleration
+		return simKmh * (1 - (c-40)/10)
+	}
+}
+
+// simDistance returns the meters covered by cycle position c (seconds), the
+// integral of simSpeed.
+func simDistance(c float64) float64 {
+	v := simKmh / 3.6 // m/s
+	switch {
+	case c < 10:
+		return 0
+	case c < 20:
+		return v * (c - 10) * (c - 10) / 20
+	case c < 40:
+		return v*5 + v*(c-20)
+	case c < 50:
+		return v*25 + v*((c-40)-(c-40)*(c-40)/20)
+	default:
+		return v * 30
+	}
+}
+
+// Serve writes updates to w at the receiver's rate until a write fails.
+func (s *Simulator) Serve(w io.Writer) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if _, err := w.Write(encode(s.FixAt(now))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServePTY streams on the master side of a pseudo-terminal until the PTY
+// is closed.
+func (s *Simulator) ServePTY(pty *protocol.PTY) error {
+	return stream.ServePTY(pty, s.Serve)
+}
+
+// ServeListener streams to each connection on ln in turn. It returns when
+// the listener is closed.
+func (s *Simulator) ServeListener(ln net.Listener) error {
+	return stream.ServeListener(ln, "gps", s.Serve)
+}
+
+// String describes the simulated receiver.
+func (s *Simulator) String() string {
+	return fmt.Sprintf("NMEA at %d baud, %.0f updates/s", DefaultBaudRate, float64(time.Second)/float64(s.interval))
+}
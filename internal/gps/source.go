@@ -0,0 +1,50 @@
+package gps
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/stream"
+)
+
+// history is how long a Source keeps fixes for At.
+const history = 5 * time.Second
+
+// MaxSkew is how far a fix may be from the time asked for in At. Receivers
+// update 1-10 times a second, so an older one means the stream has stopped.
+const MaxSkew = 1500 * time.Millisecond
+
+// Source reads a receiver's stream in the background and keeps its recent
+// fixes.
+type Source struct {
+	*stream.Source[Fix]
+}
+
+// Open connects to a receiver on port, a serial device or a network bridge
+// address as accepted by protocol.NewTransport, and starts reading. baud 0
+// uses DefaultBaudRate.
+func Open(port string, baud int) (*Source, error) {
+	if baud <= 0 {
+		baud = DefaultBaudRate
+	}
+	conn, err := stream.Dial(port, baud, baud)
+	if err != nil {
+		return nil, fmt.Errorf("gps: %w", err)
+	}
+	return NewSource(conn), nil
+}
+
+// NewSource starts reading NMEA from an open transport. Close closes the
+// transport.
+func NewSource(conn protocol.Transport) *Source {
+	s := &Source{stream.NewSource(conn, NewDecoder(), stream.Options{
+		Name:    "gps",
+		History: history,
+		MaxSkew: MaxSkew,
+		BufSize: 512,
+	})}
+	slog.Info("gps input started")
+	return s
+}
@@ -0,0 +1,172 @@
+package gps
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// Point is one position of a drive's track.
+type Point struct {
+	Time     time.Time
+	Lat, Lon float64
+}
+
+// Tracker collects the track of a drive one sample at a time, so the track
+// of a log can be built while streaming it.
+type Tracker struct {
+	ch  sensor.GPSChannels
+	pts []Point
+}
+
+// NewTracker returns a Tracker reading the GPS channels ch.
+func NewTracker(ch sensor.GPSChannels) *Tracker {
+	return &Tracker{ch: ch}
+}
+
+// Add records the position of s. Samples without a fix are skipped, as are
+// repeats of the previous position: a receiver updates a few times a
+// second, slower than the ECU is polled, and logs without channel times do
+// not tell one fix from the next.
+func (t *Tracker) Add(s *sensor.Sample) {
+	ch := t.ch
+	if s.Float(ch.Fix) < 1 || !s.HasData(ch.Lat) || !s.HasData(ch.Lon) {
+		return
+	}
+	p := Point{Time: s.ChannelTime(ch.Lat), Lat: s.Float(ch.Lat), Lon: s.Float(ch.Lon)}
+	if n := len(t.pts); n > 0 && t.pts[n-1].Lat == p.Lat && t.pts[n-1].Lon == p.Lon {
+		return
+	}
+	t.pts = append(t.pts, p)
+}
+
+// Points returns the positions added so far, in order.
+func (t *Tracker) Points() []Point {
+	return t.pts
+}
+
+// Track returns the positions recorded in samples, in order, as a Tracker
+// collects them.
+func Track(samples []sensor.Sample, ch sensor.GPSChannels) []Point {
+	t := NewTracker(ch)
+	for i := range samples {
+		t.Add(&samples[i])
+	}
+	return t.Points()
+}
+
+// coord formats a latitude or longitude for GPX and KML, which want plain
+// decimals; 7 places is about 1 cm.
+func coord(v float64) string {
+	return strconv.FormatFloat(v, 'f', 7, 64)
+}
+
+type gpxDoc struct {
+	XMLName xml.Name `xml:"gpx"`
+	Version string   `xml:"version,attr"`
+	Creator string   `xml:"creator,attr"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Track   gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name,omitempty"`
+	Segment []gpxPoint `xml:"trkseg>trkpt"`
+}
+
+type gpxPoint struct {
+	Lat  string `xml:"lat,attr"`
+	Lon  string `xml:"lon,attr"`
+	Time string `xml:"time"`
+}
+
+// WriteGPX writes pts as a GPX 1.1 track called name.
+func WriteGPX(w io.Writer, name string, pts []Point) error {
+	doc := gpxDoc{
+		Version: "1.1",
+		Creator: "mmcd",
+		Xmlns:   "http://www.topografix.com/GPX/1/1",
+		Track:   gpxTrack{Name: name},
+	}
+	for _, p := range pts {
+		doc.Track.Segment = append(doc.Track.Segment, gpxPoint{
+			Lat:  coord(p.Lat),
+			Lon:  coord(p.Lon),
+			Time: p.Time.UTC().Format(time.RFC3339Nano),
+		})
+	}
+	return writeXML(w, doc)
+}
+
+type kmlDoc struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name      string       `xml:"name,omitempty"`
+	Placemark kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name     string       `xml:"name,omitempty"`
+	TimeSpan *kmlTimeSpan `xml:"TimeSpan,omitempty"`
+	Line     kmlLine      `xml:"LineString"`
+}
+
+type kmlTimeSpan struct {
+	Begin string `xml:"begin"`
+	End   string `xml:"end"`
+}
+
+type kmlLine struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// WriteKML writes pts as a KML path called name, for Google Earth and
+// similar viewers.
+func WriteKML(w io.Writer, name string, pts []Point) error {
+	doc := kmlDoc{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{
+			Name:      name,
+			Placemark: kmlPlacemark{Name: name, Line: kmlLine{Tessellate: 1}},
+		},
+	}
+	if len(pts) > 0 {
+		doc.Document.Placemark.TimeSpan = &kmlTimeSpan{
+			Begin: pts[0].Time.UTC().Format(time.RFC3339),
+			End:   pts[len(pts)-1].Time.UTC().Format(time.RFC3339),
+		}
+	}
+	buf := make([]byte, 0, len(pts)*26)
+	for i, p := range pts {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, coord(p.Lon)...)
+		buf = append(buf, ',')
+		buf = append(buf, coord(p.Lat)...)
+	}
+	doc.Document.Placemark.Line.Coordinates = string(buf)
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to write track: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,54 @@
+package gps
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/stream/streamtest"
+)
+
+func TestTrack_Export(t *testing.T) {
+	_, ch := streamtest.Defs(t, sensor.AddGPS)
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	var samples []sensor.Sample
+	for i, lat := range []float64{47.1, 47.1, 47.2, 0} { // repeat, new fix, no fix
+		s := sensor.Sample{Time: start.Add(time.Duration(i) * 100 * time.Millisecond)}
+		fixTime := start.Add(time.Duration(i/2) * time.Second)
+		for idx, v := range map[int]float64{ch.Lat: lat, ch.Lon: -0.00001, ch.Fix: 1} {
+			s.SetValue(idx, v)
+			s.SetOffset(idx, fixTime.Sub(s.Time))
+		}
+		if lat == 0 {
+			s.SetValue(ch.Fix, 0)
+		}
+		samples = append(samples, s)
+	}
+	pts := Track(samples, ch)
+	if len(pts) != 2 || pts[1].Lat != 47.2 || !pts[1].Time.Equal(start.Add(time.Second)) {
+		t.Fatalf("Track = %+v", pts)
+	}
+
+	var gpx bytes.Buffer
+	if err := WriteGPX(&gpx, "drive <1>", pts); err != nil {
+		t.Fatal(err)
+	}
+	var doc gpxDoc
+	if err := xml.Unmarshal(gpx.Bytes(), &doc); err != nil {
+		t.Fatalf("GPX does not parse: %v\n%s", err, gpx.String())
+	}
+	if doc.Track.Name != "drive <1>" || len(doc.Track.Segment) != 2 || doc.Track.Segment[0].Lon != "-0.0000100" || doc.Track.Segment[1].Time != "2026-05-01T12:00:01Z" {
+		t.Errorf("GPX = %s", gpx.String())
+	}
+
+	var kml bytes.Buffer
+	if err := WriteKML(&kml, "drive", pts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(kml.String(), "<coordinates>-0.0000100,47.1000000 -0.0000100,47.2000000</coordinates>") {
+		t.Errorf("KML = %s", kml.String())
+	}
+}
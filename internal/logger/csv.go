@@ -4,12 +4,28 @@ import (
 	"encoding/csv"
 	"fmt"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/kbuckham/mmcd/internal/sensor"
 )
 
+// CSVOptions selects optional CSV column sets.
+type CSVOptions struct {
+	// ChannelTimes adds a SLUG_ms column after each sensor with the elapsed
+	// milliseconds (same origin as Elapsed_ms) at which that sensor was read.
+	ChannelTimes bool
+
+	// Vehicle is the vehicle ID recorded with Comments.
+	Vehicle string
+
+	// Comments writes a "# mmcd vehicle=ID" line before the header row.
+	// Spreadsheets and CSV readers with a fixed field count do not skip
+	// comment lines, so it is off by default.
+	Comments bool
+}
+
 // CSVWriter writes sensor samples to a CSV file.
 type CSVWriter struct {
 	mu        sync.Mutex
@@ -18,12 +34,18 @@ type CSVWriter struct {
 	defs      []sensor.Definition
 	indices   []int
 	units     sensor.UnitSystem
+	opts      CSVOptions
 	count     int
 	startTime time.Time
 }
 
 // NewCSVWriter creates a new CSV writer. It writes the header row immediately.
 func NewCSVWriter(filename string, defs []sensor.Definition, indices []int, units sensor.UnitSystem) (*CSVWriter, error) {
+	return NewCSVWriterWithOptions(filename, defs, indices, units, CSVOptions{})
+}
+
+// NewCSVWriterWithOptions creates a CSV writer with optional column sets.
+func NewCSVWriterWithOptions(filename string, defs []sensor.Definition, indices []int, units sensor.UnitSystem, opts CSVOptions) (*CSVWriter, error) {
 	f, err := os.Create(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CSV file %s: %w", filename, err)
@@ -31,12 +53,26 @@ func NewCSVWriter(filename string, defs []sensor.Definition, indices []int, unit
 
 	w := csv.NewWriter(f)
 
+	if opts.Comments && opts.Vehicle != "" {
+		if _, err := fmt.Fprintf(f, "%s vehicle=%s\n", csvMetaPrefix, opts.Vehicle); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to write CSV header: %w", err)
+		}
+	}
+
 	// Write header row
 	header := []string{"Timestamp", "Elapsed_ms"}
 	for _, idx := range indices {
 		if idx >= 0 && idx < len(defs) && defs[idx].Exists {
-			header = append(header, defs[idx].Slug)
+			header = append(header, csvValueColumn(&defs[idx], units))
 			header = append(header, defs[idx].Slug+"_raw")
+			if opts.ChannelTimes {
+				header = append(header, defs[idx].Slug+"_ms")
+			}
+			// Flags sensors get a 0/1 column per named bit
+			for _, b := range defs[idx].Bits {
+				header = append(header, b.Name)
+			}
 		}
 	}
 	if err := w.Write(header); err != nil {
@@ -51,9 +87,20 @@ func NewCSVWriter(filename string, defs []sensor.Definition, indices []int, unit
 		defs:    defs,
 		indices: indices,
 		units:   units,
+		opts:    opts,
 	}, nil
 }
 
+// csvValueColumn returns the header of a sensor's value column: its slug,
+// followed by the unit of its values in brackets when it has one, e.g.
+// "COOL [°C]". Flags sensors have their bit columns instead.
+func csvValueColumn(d *sensor.Definition, units sensor.UnitSystem) string {
+	if label := d.UnitLabel(units); label != "" && len(d.Bits) == 0 {
+		return d.Slug + " [" + label + "]"
+	}
+	return d.Slug
+}
+
 // WriteSample writes a single sensor sample as a CSV row.
 func (cw *CSVWriter) WriteSample(sample sensor.Sample) error {
 	cw.mu.Lock()
@@ -73,11 +120,36 @@ func (cw *CSVWriter) WriteSample(sample sensor.Sample) error {
 	for _, idx := range cw.indices {
 		if idx >= 0 && idx < len(cw.defs) && cw.defs[idx].Exists {
 			if sample.HasData(idx) {
-				row = append(row, cw.defs[idx].Format(sample.RawData[idx], cw.units))
-				row = append(row, fmt.Sprintf("%d", sample.RawData[idx]))
+				row = append(row, sample.Formatted(cw.defs, idx, cw.units))
+				switch {
+				case cw.defs[idx].IsInput():
+					// an input's value cannot be recomputed; keep it exact
+					row = append(row, strconv.FormatFloat(sample.Float(idx), 'f', -1, 64))
+				case sample.IsFloat(idx):
+					row = append(row, "") // no raw byte; recomputed when the log is read back
+				default:
+					row = append(row, strconv.Itoa(sample.RawValue(cw.defs, idx)))
+				}
+				if cw.opts.ChannelTimes {
+					ms := float64(sample.ChannelTime(idx).Sub(cw.startTime)) / float64(time.Millisecond)
+					row = append(row, strconv.FormatFloat(ms, 'f', 1, 64))
+				}
+				for _, b := range cw.defs[idx].Bits {
+					bit := "0"
+					if b.Active(sample.Raw(idx)) {
+						bit = "1"
+					}
+					row = append(row, bit)
+				}
 			} else {
 				row = append(row, "")
 				row = append(row, "")
+				if cw.opts.ChannelTimes {
+					row = append(row, "")
+				}
+				for range cw.defs[idx].Bits {
+					row = append(row, "")
+				}
 			}
 		}
 	}
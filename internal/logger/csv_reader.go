@@ -1,11 +1,16 @@
 package logger
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
 )
 
 // CSVLog represents a parsed CSV log file for graph display.
@@ -13,7 +18,101 @@ type CSVLog struct {
 	Slugs     []string             // sensor slugs found in the header
 	Data      map[string][]float64 // slug -> array of converted float values
 	ElapsedMs []float64            // elapsed milliseconds per row (from Elapsed_ms column)
+	ChannelMs map[string][]float64 // slug -> per-channel read time in elapsed ms (from SLUG_ms columns, if present)
 	Count     int                  // number of data rows
+	Vehicle   string               // vehicle ID from the "# mmcd" line, if any
+	Units     map[string]string    // slug -> unit of its column, from the "# mmcd units" line; nil in older logs
+}
+
+// csvMetaPrefix starts the comment lines CSVWriter may put before the header.
+const csvMetaPrefix = "# mmcd"
+
+// csvHeaderColumn splits a value column header such as "COOL [°C]" into
+// the sensor slug and the unit of its values, "" if it names none.
+func csvHeaderColumn(h string) (slug, unit string) {
+	if s, u, ok := strings.Cut(h, " ["); ok && strings.HasSuffix(u, "]") {
+		return s, strings.TrimSuffix(u, "]")
+	}
+	return h, ""
+}
+
+// csvUnitSystem returns the unit system a CSV log was written in: the first
+// in which defs give every value column the header it has. Older logs,
+// without units in the header, are taken as metric, as are logs whose
+// columns read the same in every system.
+func csvUnitSystem(header []string, defs []sensor.Definition) sensor.UnitSystem {
+	for _, system := range []sensor.UnitSystem{sensor.UnitMetric, sensor.UnitEnglish, sensor.UnitRaw} {
+		match, found := true, false
+		for _, h := range header {
+			slug, _ := csvHeaderColumn(h)
+			idx, _ := sensor.FindBySlug(defs, slug)
+			if idx < 0 {
+				continue
+			}
+			found = true
+			if csvValueColumn(&defs[idx], system) != h {
+				match = false
+				break
+			}
+		}
+		if match && found {
+			return system
+		}
+	}
+	return sensor.UnitMetric
+}
+
+// readCSV starts reading a CSV log: it returns a reader positioned after
+// the header row, the header and the "# mmcd key=value" lines before it as
+// meta. Other comment lines are skipped.
+func readCSV(r io.Reader) (reader *csv.Reader, header []string, meta map[string]string, err error) {
+	br := bufio.NewReader(r)
+	meta = readCSVMeta(br)
+	reader = csv.NewReader(br)
+	reader.Comment = '#'
+	header, err = reader.Read()
+	if err == io.EOF {
+		err = fmt.Errorf("CSV has no data rows")
+	}
+	return reader, header, meta, err
+}
+
+// readCSVMeta consumes the comment lines at the start of a CSV log and
+// returns the key=value pairs of the "# mmcd" ones.
+func readCSVMeta(br *bufio.Reader) map[string]string {
+	meta := make(map[string]string)
+	for {
+		b, err := br.Peek(1)
+		if err != nil || b[0] != '#' {
+			break
+		}
+		line, _ := br.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, csvMetaPrefix) {
+			continue
+		}
+		for _, field := range strings.Fields(strings.TrimPrefix(line, csvMetaPrefix)) {
+			if k, v, ok := strings.Cut(field, "="); ok {
+				meta[k] = v
+			}
+		}
+	}
+	return meta
+}
+
+// parseCSVValue parses a formatted value such as "1.011bar". The unit
+// named in the column header is stripped; without one, trailing
+// non-numeric characters are.
+func parseCSVValue(cell, unit string) (float64, bool) {
+	if unit != "" {
+		cell = strings.TrimSpace(strings.TrimSuffix(cell, unit))
+	} else {
+		cell = strings.TrimRightFunc(cell, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		})
+	}
+	v, err := strconv.ParseFloat(cell, 64)
+	return v, err == nil
 }
 
 // ReadCSVLog reads a CSV log file produced by mmcd and returns the converted
@@ -25,17 +124,12 @@ func ReadCSVLog(filename string) (*CSVLog, error) {
 	}
 	defer f.Close()
 
-	reader := csv.NewReader(f)
-	records, err := reader.ReadAll()
+	reader, header, meta, err := readCSV(f)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse CSV: %w", err)
 	}
-
-	if len(records) < 2 {
-		return nil, fmt.Errorf("CSV has no data rows")
-	}
-
-	header := records[0]
+	reader.ReuseRecord = true
+	var units map[string]string
 
 	// Identify converted value columns (not Timestamp, Elapsed_ms, or *_raw)
 	type colInfo struct {
@@ -43,6 +137,7 @@ func ReadCSVLog(filename string) (*CSVLog, error) {
 		col  int
 	}
 	var cols []colInfo
+	var timeCols []colInfo
 	elapsedCol := -1
 	for i, h := range header {
 		if h == "Elapsed_ms" {
@@ -55,7 +150,18 @@ func ReadCSVLog(filename string) (*CSVLog, error) {
 		if strings.HasSuffix(h, "_raw") {
 			continue
 		}
-		cols = append(cols, colInfo{slug: h, col: i})
+		if strings.HasSuffix(h, "_ms") {
+			timeCols = append(timeCols, colInfo{slug: strings.TrimSuffix(h, "_ms"), col: i})
+			continue
+		}
+		slug, unit := csvHeaderColumn(h)
+		if unit != "" {
+			if units == nil {
+				units = make(map[string]string)
+			}
+			units[slug] = unit
+		}
+		cols = append(cols, colInfo{slug: slug, col: i})
 	}
 
 	if len(cols) == 0 {
@@ -66,16 +172,25 @@ func ReadCSVLog(filename string) (*CSVLog, error) {
 	data := make(map[string][]float64, len(cols))
 	for i, c := range cols {
 		slugs[i] = c.slug
-		data[c.slug] = make([]float64, 0, len(records)-1)
 	}
 
 	var elapsedMs []float64
-	if elapsedCol >= 0 {
-		elapsedMs = make([]float64, 0, len(records)-1)
+	var channelMs map[string][]float64
+	if len(timeCols) > 0 {
+		channelMs = make(map[string][]float64, len(timeCols))
 	}
 
+	// Rows are parsed as they are read, so only the values are held
 	rowCount := 0
-	for _, row := range records[1:] {
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
 		// Parse elapsed time
 		if elapsedCol >= 0 && elapsedCol < len(row) {
 			ms, _ := strconv.ParseFloat(row[elapsedCol], 64)
@@ -87,20 +202,199 @@ func ReadCSVLog(filename string) (*CSVLog, error) {
 				data[c.slug] = append(data[c.slug], 0)
 				continue
 			}
-			val, err := strconv.ParseFloat(row[c.col], 64)
-			if err != nil {
+			val, ok := parseCSVValue(row[c.col], units[c.slug])
+			if !ok {
 				data[c.slug] = append(data[c.slug], 0)
 				continue
 			}
 			data[c.slug] = append(data[c.slug], val)
 		}
+
+		// Channel read times fall back to the row's elapsed time when empty
+		for _, c := range timeCols {
+			var ms float64
+			if len(elapsedMs) > 0 {
+				ms = elapsedMs[len(elapsedMs)-1]
+			}
+			if c.col < len(row) && row[c.col] != "" {
+				if v, err := strconv.ParseFloat(row[c.col], 64); err == nil {
+					ms = v
+				}
+			}
+			channelMs[c.slug] = append(channelMs[c.slug], ms)
+		}
 		rowCount++
 	}
+	if rowCount == 0 {
+		return nil, fmt.Errorf("CSV has no data rows")
+	}
 
 	return &CSVLog{
 		Slugs:     slugs,
 		Data:      data,
 		ElapsedMs: elapsedMs,
+		ChannelMs: channelMs,
 		Count:     rowCount,
+		Vehicle:   meta["vehicle"],
+		Units:     units,
 	}, nil
 }
+
+// CSVReader rebuilds raw samples from the SLUG_raw columns of a CSV log
+// written by CSVWriter, one row at a time. Sample times come from the first
+// Timestamp plus each row's Elapsed_ms, and per-channel times from SLUG_ms
+// columns if present. Input channels such as GPS keep their value in the
+// raw column.
+type CSVReader struct {
+	Vehicle string            // vehicle ID from the "# mmcd" line, if any
+	Units   sensor.UnitSystem // unit system of the value columns; metric in older logs
+
+	f          *os.File
+	r          *csv.Reader
+	defs       []sensor.Definition
+	rawCols    []csvRawCol
+	timeCol    int
+	elapsedCol int
+	first      []string // first data row, read at open
+	start      time.Time
+	row        int // data rows returned
+}
+
+// csvRawCol maps a SLUG_raw column and its SLUG_ms column (-1 if none) to
+// a sensor index.
+type csvRawCol struct {
+	col, msCol, idx int
+}
+
+// OpenCSVReader opens a CSV log for reading raw samples. Columns are
+// mapped back to sensor indices by slug in defs.
+func OpenCSVReader(filename string, defs []sensor.Definition) (*CSVReader, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV: %w", err)
+	}
+	cr, err := newCSVReader(f, defs)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return cr, nil
+}
+
+func newCSVReader(f *os.File, defs []sensor.Definition) (*CSVReader, error) {
+	reader, header, meta, err := readCSV(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+
+	cr := &CSVReader{Vehicle: meta["vehicle"], Units: csvUnitSystem(header, defs), f: f, r: reader, defs: defs}
+	cr.rawCols, cr.timeCol, cr.elapsedCol = csvColumns(header, defs)
+	if len(cr.rawCols) == 0 {
+		return nil, fmt.Errorf("no raw sensor columns found in CSV header")
+	}
+
+	cr.first, err = reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV has no data rows")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV: %w", err)
+	}
+	if cr.timeCol >= 0 && cr.timeCol < len(cr.first) {
+		cr.start, _ = time.ParseInLocation("2006-01-02T15:04:05.000", cr.first[cr.timeCol], time.Local)
+	}
+	reader.ReuseRecord = true
+	return cr, nil
+}
+
+// csvColumns maps the raw and channel-time columns of header back to
+// indices in defs, and finds the Timestamp and Elapsed_ms columns (-1 if
+// missing).
+func csvColumns(header []string, defs []sensor.Definition) (rawCols []csvRawCol, timeCol, elapsedCol int) {
+	timeCol, elapsedCol = -1, -1
+	msCols := make(map[int]int) // sensor index -> SLUG_ms column
+	for i, h := range header {
+		switch {
+		case h == "Timestamp":
+			timeCol = i
+		case h == "Elapsed_ms":
+			elapsedCol = i
+		case strings.HasSuffix(h, "_raw"):
+			if idx, _ := sensor.FindBySlug(defs, strings.TrimSuffix(h, "_raw")); idx >= 0 {
+				rawCols = append(rawCols, csvRawCol{col: i, msCol: -1, idx: idx})
+			}
+		case strings.HasSuffix(h, "_ms"):
+			if idx, _ := sensor.FindBySlug(defs, strings.TrimSuffix(h, "_ms")); idx >= 0 {
+				msCols[idx] = i
+			}
+		}
+	}
+	for i := range rawCols {
+		if mc, ok := msCols[rawCols[i].idx]; ok && elapsedCol >= 0 {
+			rawCols[i].msCol = mc
+		}
+	}
+	return rawCols, timeCol, elapsedCol
+}
+
+// Next returns the sample of the next row, or io.EOF after the last one.
+func (cr *CSVReader) Next() (sensor.Sample, error) {
+	row := cr.first
+	if row != nil {
+		cr.first = nil
+	} else {
+		var err error
+		if row, err = cr.r.Read(); err == io.EOF {
+			return sensor.Sample{}, io.EOF
+		} else if err != nil {
+			return sensor.Sample{}, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+	}
+	i := cr.row
+	cr.row++
+
+	var s sensor.Sample
+	switch {
+	case cr.elapsedCol >= 0 && cr.elapsedCol < len(row):
+		ms, _ := strconv.ParseFloat(row[cr.elapsedCol], 64)
+		s.Time = cr.start.Add(time.Duration(ms * float64(time.Millisecond)))
+	case cr.timeCol >= 0 && cr.timeCol < len(row):
+		s.Time, _ = time.ParseInLocation("2006-01-02T15:04:05.000", row[cr.timeCol], time.Local)
+	default:
+		s.Time = cr.start.Add(time.Duration(i) * 50 * time.Millisecond)
+	}
+
+	for _, rc := range cr.rawCols {
+		if rc.col >= len(row) || row[rc.col] == "" {
+			continue
+		}
+		if cr.defs[rc.idx].IsInput() {
+			v, err := strconv.ParseFloat(row[rc.col], 64)
+			if err != nil {
+				continue
+			}
+			s.SetValue(rc.idx, v)
+		} else {
+			v, err := strconv.Atoi(row[rc.col])
+			if err != nil {
+				continue
+			}
+			w, ok := cr.defs[rc.idx].RawWord(v)
+			if !ok {
+				continue
+			}
+			s.SetWord(rc.idx, w)
+		}
+		if rc.msCol >= 0 && rc.msCol < len(row) {
+			if ms, err := strconv.ParseFloat(row[rc.msCol], 64); err == nil {
+				s.SetOffset(rc.idx, cr.start.Add(time.Duration(ms*float64(time.Millisecond))).Sub(s.Time))
+			}
+		}
+	}
+	return s, nil
+}
+
+// Close closes the CSV file.
+func (cr *CSVReader) Close() error {
+	return cr.f.Close()
+}
@@ -3,6 +3,8 @@ package logger
 import (
 	"encoding/csv"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -58,6 +60,7 @@ func TestCSVWriter(t *testing.T) {
 	}
 	defer f.Close()
 
+	// A plain reader: nothing comes before the header row
 	reader := csv.NewReader(f)
 	records, err := reader.ReadAll()
 	if err != nil {
@@ -76,14 +79,14 @@ func TestCSVWriter(t *testing.T) {
 	}
 
 	// TPS and RPM columns should be present (slug + raw for each)
-	if header[2] != "TPS" {
-		t.Errorf("Header[2] = %s, want TPS", header[2])
+	if header[2] != "TPS [%]" {
+		t.Errorf("Header[2] = %s, want TPS [%%]", header[2])
 	}
 	if header[3] != "TPS_raw" {
 		t.Errorf("Header[3] = %s, want TPS_raw", header[3])
 	}
-	if header[4] != "RPM" {
-		t.Errorf("Header[4] = %s, want RPM", header[4])
+	if header[4] != "RPM [rpm]" {
+		t.Errorf("Header[4] = %s, want RPM [rpm]", header[4])
 	}
 
 	// Check data row 1 elapsed time is 0
@@ -104,3 +107,235 @@ func TestCSVWriter(t *testing.T) {
 		t.Errorf("Row1 RPM_raw = %s, want '64'", records[1][5])
 	}
 }
+
+func TestCSVWriter_ChannelTimes(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	path := filepath.Join(t.TempDir(), "times.csv")
+
+	w, err := NewCSVWriterWithOptions(path, defs, []int{14, 17}, sensor.UnitMetric, CSVOptions{ChannelTimes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		st := start.Add(time.Duration(i) * 100 * time.Millisecond)
+		s := sensor.Sample{Time: st}
+		s.SetDataAt(14, 128, st.Add(10*time.Millisecond))
+		s.SetDataAt(17, 64, st.Add(25*time.Millisecond))
+		w.WriteSample(s)
+	}
+	w.Close()
+
+	log, err := ReadCSVLog(path)
+	if err != nil {
+		t.Fatalf("ReadCSVLog failed: %v", err)
+	}
+	if len(log.Slugs) != 2 {
+		t.Errorf("Slugs = %v, want TPS and RPM only", log.Slugs)
+	}
+	if got := log.ChannelMs["RPM"]; len(got) != 2 || got[0] != 25 || got[1] != 125 {
+		t.Errorf("RPM channel ms = %v, want [25 125]", got)
+	}
+
+	if l, err := Open(path, defs); err != nil || !l.ChannelTimes {
+		t.Errorf("Open: log %+v, error %v, want channel times", l, err)
+	}
+	samples, err := loadSamples(path, defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := samples[1].Offset(14); got != 10*time.Millisecond {
+		t.Errorf("TPS offset from CSV = %s, want 10ms", got)
+	}
+}
+
+func TestCSVWriter_ExprChannel(t *testing.T) {
+	defs, err := sensor.AddDerived(sensor.DefaultDefinitions(), []string{"AIRF"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "expr.csv")
+	indices := sensor.WithComputed(defs, []int{12, 15, 21}) // BARO, MAFS, AIRT
+	airf, _ := sensor.FindBySlug(defs, "AIRF")
+
+	w, err := NewCSVWriter(path, defs, indices, sensor.UnitMetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sensor.Sample{Time: time.Now()}
+	s.SetData(12, 208)
+	s.SetData(15, 80)
+	s.SetData(21, 75)
+	s.ComputeDerivatives(defs)
+	w.WriteSample(s)
+	w.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(f).ReadAll()
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := make(map[string]string)
+	for i, h := range records[0] {
+		slug, _ := csvHeaderColumn(h)
+		row[slug] = records[1][i]
+	}
+	if want := defs[airf].FormatValue(s.Float(airf), sensor.UnitMetric); row["AIRF"] != want || row["AIRF_raw"] != "" {
+		t.Errorf("AIRF = %q, AIRF_raw = %q; want %q and empty", row["AIRF"], row["AIRF_raw"], want)
+	}
+
+	// The raw column is empty; replaying recomputes the channel
+	samples, err := loadSamples(path, defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples[0].HasData(airf) {
+		t.Error("AIRF should not be read back from an empty raw column")
+	}
+	samples[0].ComputeDerivatives(defs)
+	if samples[0].Float(airf) != s.Float(airf) {
+		t.Errorf("recomputed AIRF = %g, want %g", samples[0].Float(airf), s.Float(airf))
+	}
+}
+
+func TestCSVWriter_Vehicle(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	path := filepath.Join(t.TempDir(), "vehicle.csv")
+
+	// Without Comments the vehicle is not recorded
+	w, err := NewCSVWriterWithOptions(path, defs, []int{17}, sensor.UnitMetric, CSVOptions{Vehicle: "2g-dsm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if data, _ := os.ReadFile(path); !strings.HasPrefix(string(data), "Timestamp,") {
+		t.Errorf("CSV without comments starts with %q", strings.SplitN(string(data), "\n", 2)[0])
+	}
+
+	w, err = NewCSVWriterWithOptions(path, defs, []int{17}, sensor.UnitMetric, CSVOptions{Vehicle: "2g-dsm", Comments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sensor.Sample{Time: time.Now()}
+	s.SetData(17, 64)
+	w.WriteSample(s)
+	w.Close()
+
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "# mmcd vehicle=2g-dsm\n") {
+		t.Errorf("CSV starts with %q", strings.SplitN(string(data), "\n", 2)[0])
+	}
+	if l, err := Open(path, defs); err != nil || l.Vehicle != "2g-dsm" {
+		t.Errorf("Open: log %+v, error %v, want vehicle 2g-dsm", l, err)
+	}
+
+	// Both readers skip the comment line
+	log, err := ReadCSVLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Vehicle != "2g-dsm" || log.Count != 1 {
+		t.Errorf("ReadCSVLog: vehicle %q, %d rows", log.Vehicle, log.Count)
+	}
+	samples, err := loadSamples(path, defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].Raw(17) != 64 {
+		t.Errorf("loadSamples = %+v", samples)
+	}
+}
+
+func TestCSVWriter_Units(t *testing.T) {
+	defs, err := sensor.ApplyUnits(sensor.DefaultDefinitions(), map[string]string{"BARO": "kPa", "COOL": "K"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "units.csv")
+	w, err := NewCSVWriter(path, defs, []int{4, 12, 17}, sensor.UnitEnglish)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sensor.Sample{Time: time.Now()}
+	s.SetData(4, 0x80)
+	s.SetData(12, 208)
+	s.SetData(17, 96)
+	w.WriteSample(s)
+	w.Close()
+
+	data, _ := os.ReadFile(path)
+	if want := "Timestamp,Elapsed_ms,COOL [K],COOL_raw,BARO [kPa],BARO_raw,RPM [rpm],RPM_raw\n"; !strings.HasPrefix(string(data), want) {
+		t.Errorf("CSV starts with %q, want %q", strings.SplitN(string(data), "\n", 2)[0], want)
+	}
+
+	log, err := ReadCSVLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Units["BARO"] != "kPa" || log.Units["COOL"] != "K" {
+		t.Errorf("Units = %v", log.Units)
+	}
+	wantBARO := 0.00486 * 208 * 100
+	if got := log.Data["BARO"][0]; got < wantBARO-0.05 || got > wantBARO+0.05 {
+		t.Errorf("BARO = %g kPa, want %g", got, wantBARO)
+	}
+	if got := log.Data["RPM"][0]; got != 3000 {
+		t.Errorf("RPM = %g, want 3000", got)
+	}
+}
+
+func TestCSVUnitSystem(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	for _, units := range []sensor.UnitSystem{sensor.UnitMetric, sensor.UnitEnglish, sensor.UnitRaw} {
+		path := filepath.Join(t.TempDir(), "units.csv")
+		w, err := NewCSVWriter(path, defs, []int{4, 17}, units)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		if l, err := Open(path, defs); err != nil || l.Units != units {
+			t.Errorf("%s log opened as %v, error %v", units, l.Units, err)
+		}
+	}
+}
+
+func TestCSVWriter_FlagBits(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	path := filepath.Join(t.TempDir(), "flags.csv")
+
+	w, err := NewCSVWriter(path, defs, []int{2, 17}, sensor.UnitMetric) // FLG2, RPM
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sensor.Sample{Time: time.Now()}
+	s.SetData(2, 0x80) // idle switch on, TDC/A/C/P/N active
+	s.SetData(17, 40)
+	w.WriteSample(s)
+	w.Close()
+
+	log, err := ReadCSVLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(log.Slugs, ","); got != "FLG2,TDC,PS,ACSW,PN,IDLE,RPM" {
+		t.Errorf("Slugs = %s", got)
+	}
+	for name, want := range map[string]float64{"TDC": 1, "PS": 0, "ACSW": 1, "PN": 1, "IDLE": 1} {
+		if got := log.Data[name][0]; got != want {
+			t.Errorf("%s = %g, want %g", name, got, want)
+		}
+	}
+
+	// Bit columns are not raw columns; replay still reads FLG2_raw
+	samples, err := loadSamples(path, defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples[0].Raw(2) != 0x80 {
+		t.Errorf("FLG2 raw = %#x, want 0x80", samples[0].Raw(2))
+	}
+}
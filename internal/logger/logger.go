@@ -2,6 +2,7 @@ package logger
 
 import (
 	"context"
+	"io"
 	"log/slog"
 	"sync"
 	"time"
@@ -10,12 +11,14 @@ import (
 )
 
 // SamplePoller is the interface for anything that can poll sensor data.
-// Both the real ECU and the Simulator implement this.
+// Both the real ECU and the Simulator implement this. A poller that runs out
+// of samples (such as ReplayPoller) returns io.EOF, which ends the loop.
 type SamplePoller interface {
 	PollSensors(indices []int) (sensor.Sample, error)
 }
 
 // SampleCallback is called each time a complete sensor sample is collected.
+// Each callback gets its own copy of the sample, which it may change.
 type SampleCallback func(sample sensor.Sample)
 
 // ErrorCallback is called when a poll cycle encounters an error.
@@ -24,12 +27,18 @@ type ErrorCallback func(err error)
 // DisconnectCallback is called when the watchdog detects persistent failures.
 type DisconnectCallback func()
 
+// DoneCallback is called when the poller reports io.EOF (end of a replayed log).
+type DoneCallback func()
+
 // LoggerStats holds runtime statistics for the polling loop.
 type LoggerStats struct {
 	SampleCount   uint64  `json:"sampleCount"`
 	ErrorCount    uint64  `json:"errorCount"`
 	CurrentHz     float64 `json:"currentHz"`
 	UptimeSeconds float64 `json:"uptimeSeconds"`
+
+	// SensorHz is the achieved rate per slug when a Scheduler is set.
+	SensorHz map[string]float64 `json:"sensorHz,omitempty"`
 }
 
 // Logger manages the ECU polling loop and data collection.
@@ -38,10 +47,12 @@ type Logger struct {
 	defs      []sensor.Definition
 	indices   []int // sensor indices to poll
 	units     sensor.UnitSystem
-	callbacks []SampleCallback
+	callbacks []*SampleCallback // pointers, so a callback can be removed
 	errCbs    []ErrorCallback
 	disconnCb DisconnectCallback
+	doneCbs   []DoneCallback
 	pollRate  time.Duration // interval between polls
+	sched     *Scheduler    // optional per-sensor rates; nil polls every index each cycle
 
 	mu              sync.Mutex
 	running         bool
@@ -72,10 +83,22 @@ func NewWithRate(poller SamplePoller, defs []sensor.Definition, indices []int, u
 }
 
 // OnSample registers a callback that fires each time a sample is collected.
-func (l *Logger) OnSample(cb SampleCallback) {
+// The returned function removes it again.
+func (l *Logger) OnSample(cb SampleCallback) (remove func()) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.callbacks = append(l.callbacks, cb)
+	p := &cb
+	l.callbacks = append(l.callbacks, p)
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, c := range l.callbacks {
+			if c == p {
+				l.callbacks = append(l.callbacks[:i:i], l.callbacks[i+1:]...)
+				return
+			}
+		}
+	}
 }
 
 // OnError registers a callback that fires on each poll error.
@@ -92,6 +115,13 @@ func (l *Logger) OnDisconnect(cb DisconnectCallback) {
 	l.disconnCb = cb
 }
 
+// OnDone registers a callback for when the poller has no more samples.
+func (l *Logger) OnDone(cb DoneCallback) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.doneCbs = append(l.doneCbs, cb)
+}
+
 // Stats returns current polling statistics.
 func (l *Logger) Stats() LoggerStats {
 	l.mu.Lock()
@@ -103,12 +133,24 @@ func (l *Logger) Stats() LoggerStats {
 			hz = float64(l.sampleCount) / elapsed
 		}
 	}
-	return LoggerStats{
+	stats := LoggerStats{
 		SampleCount:   l.sampleCount,
 		ErrorCount:    l.errorCount,
 		CurrentHz:     hz,
 		UptimeSeconds: time.Since(l.startTime).Seconds(),
 	}
+	if l.sched != nil {
+		stats.SensorHz = l.sched.AchievedRates()
+	}
+	return stats
+}
+
+// SetScheduler enables per-sensor poll scheduling (can be called while
+// running). Passing nil polls every selected sensor each cycle.
+func (l *Logger) SetScheduler(s *Scheduler) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sched = s
 }
 
 // Start begins the polling loop in a goroutine.
@@ -150,11 +192,11 @@ func (l *Logger) IsRunning() bool {
 	return l.running
 }
 
-// LastSample returns the most recently collected sample.
+// LastSample returns a copy of the most recently collected sample.
 func (l *Logger) LastSample() sensor.Sample {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return l.lastSample
+	return l.lastSample.Clone()
 }
 
 // SetIndices updates which sensors are polled (can be called while running).
@@ -176,6 +218,9 @@ func (l *Logger) pollLoop(ctx context.Context) {
 	l.sampleCount = 0
 	l.errorCount = 0
 	l.consecutiveErrs = 0
+	if l.sched != nil {
+		l.sched.Reset()
+	}
 	l.mu.Unlock()
 
 	for {
@@ -186,14 +231,41 @@ func (l *Logger) pollLoop(ctx context.Context) {
 			l.mu.Lock()
 			indices := make([]int, len(l.indices))
 			copy(indices, l.indices)
+			sched := l.sched
 			l.mu.Unlock()
 
 			if len(indices) == 0 {
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
+			if sched != nil {
+				if indices = sched.Due(indices, time.Now()); indices == nil {
+					continue // nothing due yet
+				}
+			}
 
 			sample, err := l.poller.PollSensors(indices)
+			if ctx.Err() != nil {
+				return // stopped while the poll was in flight
+			}
+			// Only a bare io.EOF ends the log; a wrapped one is a transport
+			// that hit EOF (e.g. a dropped TCP bridge) and counts as an error.
+			if err == io.EOF {
+				l.mu.Lock()
+				if l.running {
+					l.cancel()
+					l.running = false
+				}
+				doneCbs := make([]DoneCallback, len(l.doneCbs))
+				copy(doneCbs, l.doneCbs)
+				l.mu.Unlock()
+
+				slog.Info("logger: poller exhausted", "samples", l.Stats().SampleCount)
+				for _, cb := range doneCbs {
+					cb()
+				}
+				return
+			}
 			if err != nil {
 				l.mu.Lock()
 				l.errorCount++
@@ -221,16 +293,22 @@ func (l *Logger) pollLoop(ctx context.Context) {
 				continue
 			}
 
+			if sched != nil {
+				sched.Record(sample)
+			}
+
 			l.mu.Lock()
 			l.sampleCount++
 			l.consecutiveErrs = 0
-			l.lastSample = sample
-			callbacks := make([]SampleCallback, len(l.callbacks))
+			l.lastSample = sample.Clone()
+			callbacks := make([]*SampleCallback, len(l.callbacks))
 			copy(callbacks, l.callbacks)
 			l.mu.Unlock()
 
+			// Copies of a sample share its channels, so each callback gets a
+			// clone: one changing its sample cannot change another's
 			for _, cb := range callbacks {
-				cb(sample)
+				(*cb)(sample.Clone())
 			}
 		}
 	}
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/kbuckham/mmcd/internal/protocol"
 	"github.com/kbuckham/mmcd/internal/sensor"
 )
 
@@ -122,6 +123,34 @@ func TestLogger_WatchdogDisconnect(t *testing.T) {
 	}
 }
 
+func TestLogger_SimulatorDropoutTriggersWatchdog(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	sim := protocol.NewSimulator(defs)
+	sim.SetFaults(protocol.FaultProfile{DisconnectAfter: 30 * time.Millisecond})
+
+	lg := NewWithRate(sim, defs, []int{17}, sensor.UnitMetric, 1*time.Millisecond)
+	var samples, errs atomic.Int64
+	disconnected := make(chan struct{})
+	lg.OnSample(func(sensor.Sample) { samples.Add(1) })
+	lg.OnError(func(error) { errs.Add(1) })
+	lg.OnDisconnect(func() { close(disconnected) })
+
+	lg.Start()
+	defer lg.Stop()
+
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called after simulated cable dropout")
+	}
+	if samples.Load() == 0 {
+		t.Error("expected samples before the dropout")
+	}
+	if errs.Load() < int64(watchdogThreshold) {
+		t.Errorf("OnError called %d times, want >= %d", errs.Load(), watchdogThreshold)
+	}
+}
+
 func TestLogger_IsRunning(t *testing.T) {
 	poller := &mockPoller{}
 	defs := sensor.DefaultDefinitions()
@@ -182,3 +211,70 @@ func TestLogger_ConsecutiveErrorsResetOnSuccess(t *testing.T) {
 		t.Error("OnDisconnect should NOT have been called — errors resolved before threshold")
 	}
 }
+
+// tpsPoller returns samples with TPS set.
+type tpsPoller struct{}
+
+func (tpsPoller) PollSensors(indices []int) (sensor.Sample, error) {
+	s := sensor.Sample{Time: time.Now()}
+	s.SetData(14, 100)
+	return s, nil
+}
+
+func TestLogger_CallbacksGetTheirOwnSample(t *testing.T) {
+	lg := NewWithRate(tpsPoller{}, sensor.DefaultDefinitions(), []int{14}, sensor.UnitMetric, 5*time.Millisecond)
+
+	var mu sync.Mutex
+	var seen []byte
+	lg.OnSample(func(s sensor.Sample) {
+		s.SetData(14, 1) // must not reach the next callback or LastSample
+		s.SetValue(40, 2.5)
+	})
+	lg.OnSample(func(s sensor.Sample) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, s.Raw(14))
+		if s.HasData(40) {
+			t.Error("second callback sees a channel the first one set")
+		}
+	})
+
+	lg.Start()
+	time.Sleep(50 * time.Millisecond)
+	lg.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) == 0 {
+		t.Fatal("no samples collected")
+	}
+	for _, v := range seen {
+		if v != 100 {
+			t.Fatalf("second callback saw TPS %d, want 100", v)
+		}
+	}
+	if last := lg.LastSample(); last.Raw(14) != 100 || last.HasData(40) {
+		t.Errorf("LastSample TPS = %d, channel 40 present %v", last.Raw(14), last.HasData(40))
+	}
+}
+
+func TestLogger_RemoveSampleCallback(t *testing.T) {
+	lg := NewWithRate(&mockPoller{}, sensor.DefaultDefinitions(), []int{14}, sensor.UnitMetric, 5*time.Millisecond)
+
+	var removed, kept atomic.Int64
+	remove := lg.OnSample(func(sensor.Sample) { removed.Add(1) })
+	lg.OnSample(func(sensor.Sample) { kept.Add(1) })
+	remove()
+	remove() // a second call does nothing
+
+	lg.Start()
+	time.Sleep(50 * time.Millisecond)
+	lg.Stop()
+
+	if n := removed.Load(); n != 0 {
+		t.Errorf("removed callback called %d times", n)
+	}
+	if kept.Load() == 0 {
+		t.Error("remaining callback was not called")
+	}
+}
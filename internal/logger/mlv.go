@@ -0,0 +1,328 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/version"
+)
+
+// MegaLogViewer (EFI Analytics) reads two log formats: tab-separated .msl
+// text with a row of units under the column names, and binary .mlg. Both
+// start with a Time column in seconds, followed by the converted value of
+// each logged sensor and a 0/1 column per named bit of flags sensors, as in
+// CSV logs. Neither has a way to leave a value out, so a channel not read
+// in a sample repeats its last value.
+
+// MLVOptions holds the options of NewMSLWriter and NewMLGWriter.
+type MLVOptions struct {
+	Vehicle string // vehicle ID recorded in the header; empty records none
+	Notes   string // free-form notes recorded in the header
+}
+
+// mlvColumn is a value column of a MegaLogViewer log.
+type mlvColumn struct {
+	name, unit string
+	digits     int                 // decimals shown
+	idx        int                 // sensor index
+	bit        *sensor.FlagChannel // set for the column of a flags bit
+}
+
+// mlvColumns returns the columns of the sensors at indices, without Time.
+func mlvColumns(defs []sensor.Definition, indices []int, units sensor.UnitSystem) []mlvColumn {
+	var cols []mlvColumn
+	for _, idx := range indices {
+		if idx < 0 || idx >= len(defs) || !defs[idx].Exists {
+			continue
+		}
+		d := &defs[idx]
+		cols = append(cols, mlvColumn{name: d.Slug, unit: d.UnitLabel(units), digits: d.Decimals(units), idx: idx})
+		for _, ch := range sensor.FlagChannelsOf(defs, []int{idx}) {
+			cols = append(cols, mlvColumn{name: ch.Name, idx: idx, bit: &ch})
+		}
+	}
+	return cols
+}
+
+// mlvWriter holds what MSLWriter and MLGWriter share.
+type mlvWriter struct {
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	defs  []sensor.Definition
+	units sensor.UnitSystem
+	cols  []mlvColumn
+	last  []float64 // last value of each column
+	count int
+	start time.Time
+}
+
+func newMLVWriter(filename string, defs []sensor.Definition, indices []int, units sensor.UnitSystem) (*mlvWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filename, err)
+	}
+	cols := mlvColumns(defs, indices, units)
+	return &mlvWriter{
+		file:  f,
+		w:     bufio.NewWriter(f),
+		defs:  defs,
+		units: units,
+		cols:  cols,
+		last:  make([]float64, len(cols)),
+	}, nil
+}
+
+// header returns the header comment lines: software, vehicle, capture
+// date and notes.
+func (m *mlvWriter) header(opts MLVOptions) []string {
+	lines := []string{"mmcd " + version.Version}
+	if opts.Vehicle != "" {
+		lines = append(lines, "Vehicle: "+opts.Vehicle)
+	}
+	lines = append(lines, "Capture Date: "+time.Now().Format(time.RFC1123))
+	if opts.Notes != "" {
+		lines = append(lines, "Notes: "+strings.Join(strings.Fields(opts.Notes), " "))
+	}
+	return lines
+}
+
+// update records the values sample has and returns the seconds since the
+// first sample.
+func (m *mlvWriter) update(sample *sensor.Sample) float64 {
+	if m.count == 0 {
+		m.start = sample.Time
+	}
+	for i, c := range m.cols {
+		switch {
+		case c.bit != nil:
+			if active, ok := sample.Flag(*c.bit); ok {
+				m.last[i] = 0
+				if active {
+					m.last[i] = 1
+				}
+			}
+		case sample.HasData(c.idx):
+			m.last[i] = sample.Value(m.defs, c.idx, m.units)
+		}
+	}
+	return sample.Time.Sub(m.start).Seconds()
+}
+
+// flush writes out the buffered sample, flushing every write for crash
+// safety as CSVWriter does.
+func (m *mlvWriter) flush() error {
+	if err := m.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write sample: %w", err)
+	}
+	m.count++
+	return nil
+}
+
+// Count returns the number of samples written.
+func (m *mlvWriter) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.count
+}
+
+// Close flushes and closes the file.
+func (m *mlvWriter) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	err := m.w.Flush()
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// MSLWriter writes samples as a MegaLogViewer .msl text log.
+type MSLWriter struct {
+	*mlvWriter
+}
+
+// NewMSLWriter creates a .msl log for the sensors at indices. It writes the
+// header, column names and units immediately.
+func NewMSLWriter(filename string, defs []sensor.Definition, indices []int, units sensor.UnitSystem, opts MLVOptions) (*MSLWriter, error) {
+	m, err := newMLVWriter(filename, defs, indices, units)
+	if err != nil {
+		return nil, err
+	}
+	// Quoted lines before the column names are header comments
+	for _, line := range m.header(opts) {
+		fmt.Fprintf(m.w, "%q\n", strings.ReplaceAll(line, `"`, "'"))
+	}
+	names, unitRow := []string{"Time"}, []string{"s"}
+	for _, c := range m.cols {
+		names, unitRow = append(names, c.name), append(unitRow, c.unit)
+	}
+	fmt.Fprintln(m.w, strings.Join(names, "\t"))
+	fmt.Fprintln(m.w, strings.Join(unitRow, "\t"))
+	if err := m.w.Flush(); err != nil {
+		m.file.Close()
+		return nil, fmt.Errorf("failed to write MSL header: %w", err)
+	}
+	return &MSLWriter{m}, nil
+}
+
+// WriteSample writes a sample as a row.
+func (mw *MSLWriter) WriteSample(sample sensor.Sample) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	m := mw.mlvWriter
+	m.w.WriteString(strconv.FormatFloat(m.update(&sample), 'f', 3, 64))
+	for i, c := range m.cols {
+		m.w.WriteByte('\t')
+		m.w.WriteString(strconv.FormatFloat(m.last[i], 'f', c.digits, 64))
+	}
+	m.w.WriteByte('\n')
+	return m.flush()
+}
+
+// .mlg version 1 layout, big-endian:
+//
+//	header:  [6] "MLVLG\0", [2] version 1, [4] Unix time, [2] info offset,
+//	         [4] data offset, [2] record length, [2] field count
+//	fields:  55 bytes each: [1] type, [34] name, [10] units, [1] display
+//	         style, [4] float32 scale, [4] float32 transform, [1] digits
+//	info:    NUL-terminated text
+//	records: [1] block type 0, [1] rolling counter, [2] rolling time in
+//	         10 µs units, the field values, [1] sum of the value bytes
+//
+// A field shows (value + transform) * scale.
+const (
+	mlgMagic       = "MLVLG\x00"
+	mlgVersion     = 1
+	mlgHeaderSize  = 22
+	mlgFieldSize   = 55
+	mlgNameSize    = 34
+	mlgUnitsSize   = 10
+	mlgTypeU08     = 0
+	mlgTypeU32     = 4
+	mlgTypeS32     = 5
+	mlgStyleFloat  = 0
+	mlgBlockFields = 0
+)
+
+// MLGWriter writes samples as a MegaLogViewer binary .mlg log (version 1).
+// Time is stored in milliseconds and each value as a 32-bit integer in
+// steps of its last shown decimal, scaled back by the field definition;
+// flag bits take a byte.
+type MLGWriter struct {
+	*mlvWriter
+	scales []float64 // value of one step of each column
+	rec    []byte
+}
+
+// NewMLGWriter creates a .mlg log for the sensors at indices. It writes the
+// header and field definitions immediately.
+func NewMLGWriter(filename string, defs []sensor.Definition, indices []int, units sensor.UnitSystem, opts MLVOptions) (*MLGWriter, error) {
+	m, err := newMLVWriter(filename, defs, indices, units)
+	if err != nil {
+		return nil, err
+	}
+	mw := &MLGWriter{mlvWriter: m, scales: make([]float64, len(m.cols))}
+
+	var fields []byte
+	fields = mlgField(fields, mlgTypeU32, "Time", "s", 0.001, 3)
+	recLen := 4
+	for i, c := range m.cols {
+		if c.bit != nil {
+			fields = mlgField(fields, mlgTypeU08, c.name, "", 1, 0)
+			recLen++
+			continue
+		}
+		mw.scales[i] = math.Pow10(-c.digits)
+		fields = mlgField(fields, mlgTypeS32, c.name, c.unit, mw.scales[i], c.digits)
+		recLen += 4
+	}
+	info := append([]byte(latin1(strings.Join(m.header(opts), "\n"))), 0)
+
+	nFields := len(m.cols) + 1
+	infoStart := mlgHeaderSize + len(fields)
+	if infoStart > math.MaxUint16 || recLen > math.MaxUint16 {
+		m.file.Close()
+		return nil, fmt.Errorf("too many channels for .mlg: %d", nFields)
+	}
+	hdr := make([]byte, mlgHeaderSize)
+	copy(hdr, mlgMagic)
+	binary.BigEndian.PutUint16(hdr[6:], mlgVersion)
+	binary.BigEndian.PutUint32(hdr[8:], uint32(time.Now().Unix()))
+	binary.BigEndian.PutUint16(hdr[12:], uint16(infoStart))
+	binary.BigEndian.PutUint32(hdr[14:], uint32(infoStart+len(info)))
+	binary.BigEndian.PutUint16(hdr[18:], uint16(recLen))
+	binary.BigEndian.PutUint16(hdr[20:], uint16(nFields))
+	m.w.Write(hdr)
+	m.w.Write(fields)
+	m.w.Write(info)
+	if err := m.w.Flush(); err != nil {
+		m.file.Close()
+		return nil, fmt.Errorf("failed to write MLG header: %w", err)
+	}
+	mw.rec = make([]byte, 0, 4+recLen+1)
+	return mw, nil
+}
+
+// mlgField appends a field definition to b.
+func mlgField(b []byte, typ byte, name, unit string, scale float64, digits int) []byte {
+	f := make([]byte, mlgFieldSize)
+	f[0] = typ
+	copy(f[1:1+mlgNameSize-1], latin1(name))
+	copy(f[1+mlgNameSize:1+mlgNameSize+mlgUnitsSize-1], latin1(unit))
+	f[45] = mlgStyleFloat
+	binary.BigEndian.PutUint32(f[46:], math.Float32bits(float32(scale)))
+	binary.BigEndian.PutUint32(f[50:], 0) // transform
+	f[54] = byte(int8(digits))
+	return append(b, f...)
+}
+
+// latin1 encodes s as ISO 8859-1, which MegaLogViewer reads names and units
+// in; other characters become '?'.
+func latin1(s string) string {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+// WriteSample writes a sample as a data record.
+func (mw *MLGWriter) WriteSample(sample sensor.Sample) error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	m := mw.mlvWriter
+	secs := m.update(&sample)
+	stamp := uint16(int64(secs*1e5) & 0xFFFF) // 10 µs units
+	rec := append(mw.rec[:0], mlgBlockFields, byte(m.count), byte(stamp>>8), byte(stamp))
+	rec = binary.BigEndian.AppendUint32(rec, uint32(math.Round(secs*1000)))
+	for i, c := range m.cols {
+		if c.bit != nil {
+			rec = append(rec, byte(m.last[i]))
+			continue
+		}
+		v := math.Round(m.last[i] / mw.scales[i])
+		v = math.Max(math.MinInt32, math.Min(math.MaxInt32, v))
+		rec = binary.BigEndian.AppendUint32(rec, uint32(int32(v)))
+	}
+	var sum byte
+	for _, b := range rec[4:] {
+		sum += b
+	}
+	mw.rec = append(rec, sum)
+	m.w.Write(mw.rec)
+	return m.flush()
+}
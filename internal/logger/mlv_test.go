@@ -0,0 +1,191 @@
+package logger
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// mlvSamples returns three samples 100ms apart with COOL, RPM and FLG2;
+// the second sample has no COOL, which MegaLogViewer logs repeat.
+func mlvSamples() []sensor.Sample {
+	start := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	samples := make([]sensor.Sample, 3)
+	for i := range samples {
+		s := sensor.Sample{Time: start.Add(time.Duration(i) * 100 * time.Millisecond)}
+		if i != 1 {
+			s.SetData(4, 0x80) // COOL
+		}
+		s.SetData(17, byte(0x40+i)) // RPM
+		s.SetData(2, 0x10)          // FLG2
+		samples[i] = s
+	}
+	return samples
+}
+
+func TestMSLWriter(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	path := filepath.Join(t.TempDir(), "drive.msl")
+	w, err := NewLogWriter(path, defs, []int{2, 4, 17}, sensor.UnitMetric, WriterOptions{Vehicle: "2g-dsm", Notes: "3rd gear\npull"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.(*MSLWriter); !ok {
+		t.Fatalf("NewLogWriter(.msl) = %T", w)
+	}
+	samples := mlvSamples()
+	if n, err := CopySamples(w, &sliceReader{samples: samples}, defs); err != nil || n != 3 {
+		t.Fatalf("CopySamples = %d, %v", n, err)
+	}
+	w.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	var header []string
+	for len(lines) > 0 && strings.HasPrefix(lines[0], `"`) {
+		header, lines = append(header, lines[0]), lines[1:]
+	}
+	if len(header) != 4 || header[1] != `"Vehicle: 2g-dsm"` || header[3] != `"Notes: 3rd gear pull"` {
+		t.Errorf("header = %q", header)
+	}
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines after the header, want names, units and 3 rows:\n%s", len(lines), b)
+	}
+	names := strings.Split(lines[0], "\t")
+	units := strings.Split(lines[1], "\t")
+	if len(names) != len(units) || names[0] != "Time" || units[0] != "s" || names[1] != "FLG2" {
+		t.Errorf("names %q, units %q", names, units)
+	}
+	cool := -1
+	for i, n := range names {
+		if n == "COOL" {
+			cool = i
+		}
+	}
+	if cool < 0 || units[cool] != defs[4].UnitLabel(sensor.UnitMetric) {
+		t.Fatalf("COOL column %d, units %q", cool, units)
+	}
+	want := samples[0].Formatted(defs, 4, sensor.UnitMetric)
+	for i, row := range lines[2:] {
+		cells := strings.Split(row, "\t")
+		if len(cells) != len(names) {
+			t.Fatalf("row %d has %d cells, want %d", i, len(cells), len(names))
+		}
+		if !strings.HasPrefix(want, cells[cool]) {
+			t.Errorf("row %d: COOL %q, want %q", i, cells[cool], want)
+		}
+	}
+	if got := strings.Split(lines[4], "\t")[0]; got != "0.200" {
+		t.Errorf("last row time = %q, want 0.200", got)
+	}
+}
+
+func TestMLGWriter(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	path := filepath.Join(t.TempDir(), "drive.mlg")
+	w, err := NewLogWriter(path, defs, []int{2, 4, 17}, sensor.UnitMetric, WriterOptions{Vehicle: "2g-dsm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := mlvSamples()
+	if _, err := CopySamples(w, &sliceReader{samples: samples}, defs); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:6]) != mlgMagic || binary.BigEndian.Uint16(b[6:]) != 1 {
+		t.Fatalf("bad header % x", b[:8])
+	}
+	infoStart := int(binary.BigEndian.Uint16(b[12:]))
+	dataStart := int(binary.BigEndian.Uint32(b[14:]))
+	recLen := int(binary.BigEndian.Uint16(b[18:]))
+	nFields := int(binary.BigEndian.Uint16(b[20:]))
+	if infoStart != mlgHeaderSize+nFields*mlgFieldSize {
+		t.Fatalf("info at %d with %d fields", infoStart, nFields)
+	}
+	if info := string(b[infoStart : dataStart-1]); !strings.Contains(info, "Vehicle: 2g-dsm") || b[dataStart-1] != 0 {
+		t.Errorf("info = %q", info)
+	}
+
+	// Decode the field definitions, then each record with them
+	type field struct {
+		typ         byte
+		name, unit  string
+		scale       float64
+		size, start int
+	}
+	var fields []field
+	off := 0
+	for i := 0; i < nFields; i++ {
+		f := b[mlgHeaderSize+i*mlgFieldSize:]
+		fd := field{
+			typ:   f[0],
+			name:  strings.TrimRight(string(f[1:35]), "\x00"),
+			unit:  strings.TrimRight(string(f[35:45]), "\x00"),
+			scale: float64(math.Float32frombits(binary.BigEndian.Uint32(f[46:]))),
+			size:  4,
+			start: off,
+		}
+		if fd.typ == mlgTypeU08 {
+			fd.size = 1
+		}
+		off += fd.size
+		fields = append(fields, fd)
+	}
+	if off != recLen || fields[0].name != "Time" || fields[0].typ != mlgTypeU32 {
+		t.Fatalf("fields %+v, record length %d", fields, recLen)
+	}
+
+	data := b[dataStart:]
+	if len(data) != 3*(4+recLen+1) {
+		t.Fatalf("%d data bytes, want 3 records of %d", len(data), 4+recLen+1)
+	}
+	for r := 0; r < 3; r++ {
+		rec := data[r*(4+recLen+1):]
+		if rec[0] != mlgBlockFields || rec[1] != byte(r) {
+			t.Errorf("record %d: block type %d, counter %d", r, rec[0], rec[1])
+		}
+		var sum byte
+		for _, c := range rec[4 : 4+recLen] {
+			sum += c
+		}
+		if rec[4+recLen] != sum {
+			t.Errorf("record %d: checksum %d, want %d", r, rec[4+recLen], sum)
+		}
+		values := make(map[string]float64)
+		for _, f := range fields {
+			v := rec[4+f.start:]
+			switch f.typ {
+			case mlgTypeU08:
+				values[f.name] = float64(v[0]) * f.scale
+			case mlgTypeU32:
+				values[f.name] = float64(binary.BigEndian.Uint32(v)) * f.scale
+			default:
+				values[f.name] = float64(int32(binary.BigEndian.Uint32(v))) * f.scale
+			}
+		}
+		if math.Abs(values["Time"]-0.1*float64(r)) > 1e-6 {
+			t.Errorf("record %d: Time %v", r, values["Time"])
+		}
+		if want := samples[r].Value(defs, 17, sensor.UnitMetric); math.Abs(values["RPM"]-want) > 0.5 {
+			t.Errorf("record %d: RPM %v, want %v", r, values["RPM"], want)
+		}
+		// COOL is held over the sample that did not read it
+		if want := samples[0].Value(defs, 4, sensor.UnitMetric); math.Abs(values["COOL"]-want) > 0.05 {
+			t.Errorf("record %d: COOL %v, want %v", r, values["COOL"], want)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// Format is the file format of a log.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatMMCD           // native binary .mmcd
+	FormatPDB            // PalmOS PDB from the original MMCd
+	FormatCSV            // CSV written by CSVWriter
+)
+
+// String returns the usual file extension of f, without the dot.
+func (f Format) String() string {
+	switch f {
+	case FormatMMCD:
+		return "mmcd"
+	case FormatPDB:
+		return "pdb"
+	case FormatCSV:
+		return "csv"
+	default:
+		return "unknown"
+	}
+}
+
+// csvSniffLines bounds the comment lines DetectFormat skips looking for a
+// CSV header.
+const csvSniffLines = 16
+
+// DetectFormat returns the format of a log from its content rather than
+// its name: the .mmcd magic, the PDB type and creator, or a CSV header row.
+func DetectFormat(filename string) (Format, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return FormatUnknown, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	head, _ := br.Peek(binary.Size(pdbHeader{}))
+	if bytes.HasPrefix(head, []byte(mmcdMagic)) {
+		return FormatMMCD, nil
+	}
+	var hdr pdbHeader
+	if binary.Read(bytes.NewReader(head), binary.BigEndian, &hdr) == nil && string(hdr.Type[:]) == "strm" && string(hdr.Creator[:]) == "MMCd" {
+		return FormatPDB, nil
+	}
+
+	// A CSV log is text: comment lines, then a header row of column names
+	for i := 0; i < csvSniffLines; i++ {
+		line, err := br.ReadString('\n')
+		if !utf8.ValidString(line) || strings.ContainsRune(line, 0) {
+			break
+		}
+		if strings.HasPrefix(line, "#") {
+			if err != nil {
+				break
+			}
+			continue
+		}
+		if strings.Contains(line, "Timestamp") || strings.Contains(line, "Elapsed_ms") || strings.Contains(line, "_raw") {
+			return FormatCSV, nil
+		}
+		break
+	}
+	return FormatUnknown, nil
+}
+
+// Log is a log file of any format opened with Open: what it records about
+// its channels, and its samples, which are read on demand.
+type Log struct {
+	Path         string
+	Format       Format
+	Name         string              // log name from a PDB header; else the file name without extension
+	Vehicle      string              // vehicle ID recorded in the log; "" if not recorded
+	Units        sensor.UnitSystem   // unit system the log was recorded in; metric if it does not say
+	Defs         []sensor.Definition // definitions the channels are read with
+	Indices      []int               // sensor indices with data in the log, without computed channels
+	ChannelTimes bool                // samples carry per-channel read times (.mmcd, CSV with SLUG_ms columns)
+	Meta         *LogMeta            // .mmcd metadata; nil for other formats and older logs
+	Recovery     *Recovery           // set for a .mmcd log that was not closed cleanly
+}
+
+// LogChannel is a channel of a log as it is shown.
+type LogChannel struct {
+	Index int
+	Slug  string
+	Unit  string // unit label of the channel's values in the log's units
+}
+
+// Open opens a log of any format, detected from its content, and reads
+// what it records about its channels. Channels are read with the
+// definitions the log records where it does (.mmcd), over defs. A PDB log
+// records neither, so it is read once to find the sensors it has data for.
+func Open(path string, defs []sensor.Definition) (*Log, error) {
+	format, err := DetectFormat(path)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{
+		Path:   path,
+		Format: format,
+		Name:   strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		Defs:   defs,
+	}
+	switch format {
+	case FormatMMCD:
+		br, err := OpenBinaryLog(path)
+		if err != nil {
+			return nil, err
+		}
+		br.Close()
+		l.Vehicle, l.Units, l.Meta, l.Recovery = br.Vehicle, br.Units, br.Meta, br.Recovery
+		l.Defs = br.Definitions(defs)
+		l.Indices = br.Indices
+		l.ChannelTimes = true
+	case FormatPDB:
+		pr, err := OpenPDB(path)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := Summarize(pr)
+		pr.Close()
+		if err != nil {
+			return nil, err
+		}
+		l.Name = pr.Name
+		for _, idx := range sum.Indices {
+			if idx < len(defs) && defs[idx].Exists {
+				l.Indices = append(l.Indices, idx)
+			}
+		}
+	case FormatCSV:
+		// Logs without raw columns have no samples, but still open: their
+		// values can be read with ReadCSVLog
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open CSV: %w", err)
+		}
+		_, header, meta, err := readCSV(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+		l.Vehicle, l.Units = meta["vehicle"], csvUnitSystem(header, defs)
+		rawCols, _, _ := csvColumns(header, defs)
+		for _, rc := range rawCols {
+			l.Indices = append(l.Indices, rc.idx)
+			l.ChannelTimes = l.ChannelTimes || rc.msCol >= 0
+		}
+	default:
+		return nil, fmt.Errorf("%s: not a .mmcd, PDB or CSV log", path)
+	}
+	return l, nil
+}
+
+// Samples opens a reader over the samples of the log, from the first. The
+// caller closes it.
+func (l *Log) Samples() (SampleReader, error) {
+	switch l.Format {
+	case FormatMMCD:
+		return OpenBinaryLog(l.Path)
+	case FormatPDB:
+		return OpenPDB(l.Path)
+	case FormatCSV:
+		return OpenCSVReader(l.Path, l.Defs)
+	}
+	return nil, fmt.Errorf("%s: not a .mmcd, PDB or CSV log", l.Path)
+}
+
+// Channels returns the channels of the log, with the computed channels
+// (INJD, expression channels) whose inputs it has.
+func (l *Log) Channels() []LogChannel {
+	var out []LogChannel
+	for _, idx := range sensor.WithComputed(l.Defs, l.Indices) {
+		if idx >= 0 && idx < len(l.Defs) && l.Defs[idx].Exists {
+			d := &l.Defs[idx]
+			out = append(out, LogChannel{Index: idx, Slug: d.Slug, Unit: d.UnitLabel(l.Units)})
+		}
+	}
+	return out
+}
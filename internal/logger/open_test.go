@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+func TestOpen_DetectsFormatByContent(t *testing.T) {
+	dir := t.TempDir()
+	defs := sensor.DefaultDefinitions()
+	samples := replaySamples(5)
+
+	// Names that say nothing about the format
+	mmcd, csvLog, pdb := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log"), filepath.Join(dir, "c.dat")
+	w, err := NewBinaryWriterWithOptions(mmcd, []int{14, 17}, sensor.UnitEnglish, BinaryOptions{Vehicle: "2g-dsm", Defs: defs, Notes: "pull"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	CopySamples(w, &sliceReader{samples: samples}, defs)
+	w.Close()
+	cw, err := NewCSVWriterWithOptions(csvLog, defs, []int{14, 17}, sensor.UnitEnglish, CSVOptions{Vehicle: "1g-dsm", Comments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	CopySamples(cw, &sliceReader{samples: samples}, defs)
+	cw.Close()
+	writeTestPDB(t, pdb, time.Date(2003, 1, 17, 12, 0, 0, 0, time.UTC))
+
+	for _, tc := range []struct {
+		path    string
+		format  Format
+		name    string
+		vehicle string
+		units   sensor.UnitSystem
+		count   int
+		times   bool
+	}{
+		{mmcd, FormatMMCD, "a", "2g-dsm", sensor.UnitEnglish, 5, true},
+		{csvLog, FormatCSV, "b", "1g-dsm", sensor.UnitMetric, 5, false}, // TPS and RPM read the same in either system
+		{pdb, FormatPDB, "Test run", "", sensor.UnitMetric, 3, false},
+	} {
+		l, err := Open(tc.path, defs)
+		if err != nil {
+			t.Fatalf("Open(%s): %v", filepath.Base(tc.path), err)
+		}
+		if l.Format != tc.format || l.Name != tc.name || l.Vehicle != tc.vehicle || l.Units != tc.units || l.ChannelTimes != tc.times {
+			t.Errorf("%s: format %s, name %q, vehicle %q, units %s, channel times %v", filepath.Base(tc.path), l.Format, l.Name, l.Vehicle, l.Units, l.ChannelTimes)
+		}
+
+		// TPS and RPM, and INJD computed from RPM and INJP where INJP is logged
+		var slugs []string
+		for _, ch := range l.Channels() {
+			slugs = append(slugs, ch.Slug)
+		}
+		if len(slugs) < 2 || slugs[0] != "TPS" || slugs[1] != "RPM" {
+			t.Errorf("%s: channels %v", filepath.Base(tc.path), slugs)
+		}
+		if ch := l.Channels()[1]; ch.Unit != "rpm" {
+			t.Errorf("%s: RPM unit %q", filepath.Base(tc.path), ch.Unit)
+		}
+
+		r, err := l.Samples()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, err := Summarize(r)
+		r.Close()
+		if err != nil || sum.Count != tc.count {
+			t.Errorf("%s: %d samples, %v; want %d", filepath.Base(tc.path), sum.Count, err, tc.count)
+		}
+	}
+
+	if l, _ := Open(mmcd, defs); l.Meta == nil || l.Meta.Notes != "pull" {
+		t.Errorf(".mmcd metadata = %+v", l.Meta)
+	}
+
+	text := filepath.Join(dir, "notes.csv")
+	os.WriteFile(text, []byte("just,some\ntext,here\n"), 0o644)
+	if _, err := Open(text, defs); err == nil {
+		t.Error("Open should reject a file that is not a log")
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"bufio"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -56,23 +57,60 @@ type PDBLog struct {
 }
 
 // ParsePDB reads a PalmOS PDB file from the old MMCd logger and returns
-// the log name and all sensor samples contained in it.
+// the log name and all sensor samples contained in it; see OpenPDB to
+// stream them instead.
+func ParsePDB(filename string) (*PDBLog, error) {
+	pr, err := OpenPDB(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+
+	samples, err := ReadAllSamples(pr)
+	if err != nil {
+		return nil, err
+	}
+	return &PDBLog{Name: pr.Name, Samples: samples}, nil
+}
+
+// PDBReader reads the samples of a PalmOS PDB log one at a time.
+type PDBReader struct {
+	Name string // log name from the PDB header
+
+	f       *os.File
+	r       *bufio.Reader
+	size    int64
+	records []pdbRecordEntry
+	rec     int // next record to read
+	left    int // GraphSamples left in the current record
+}
+
+// OpenPDB opens a PalmOS PDB file from the old MMCd logger for reading.
 //
 // PDB format:
 //   - 78-byte header (name, type="strm", creator="MMCd")
 //   - N × 8-byte record index entries
 //   - Record data: each record starts with 8-byte DBLK header,
 //     followed by packed 40-byte GraphSample structs (big-endian)
-func ParsePDB(filename string) (*PDBLog, error) {
+func OpenPDB(filename string) (*PDBReader, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open PDB file: %w", err)
 	}
-	defer f.Close()
+	pr, err := newPDBReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return pr, nil
+}
+
+func newPDBReader(f *os.File) (*PDBReader, error) {
+	r := bufio.NewReader(f)
 
 	// Read header
 	var hdr pdbHeader
-	if err := binary.Read(f, binary.BigEndian, &hdr); err != nil {
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
 		return nil, fmt.Errorf("failed to read PDB header: %w", err)
 	}
 
@@ -96,144 +134,120 @@ func ParsePDB(filename string) (*PDBLog, error) {
 		nameEnd = len(nameBytes)
 	}
 
-	log := &PDBLog{
+	pr := &PDBReader{
 		Name: string(nameBytes[:nameEnd]),
+		f:    f,
+		r:    r,
 	}
 
 	// Read record index entries
-	records := make([]pdbRecordEntry, hdr.NumRecords)
+	pr.records = make([]pdbRecordEntry, hdr.NumRecords)
 	for i := 0; i < int(hdr.NumRecords); i++ {
-		if err := binary.Read(f, binary.BigEndian, &records[i]); err != nil {
+		if err := binary.Read(r, binary.BigEndian, &pr.records[i]); err != nil {
 			return nil, fmt.Errorf("failed to read record index entry %d: %w", i, err)
 		}
 	}
 
-	if len(records) == 0 {
-		return log, nil
-	}
-
-	// Read each record and extract GraphSamples
 	fileInfo, err := f.Stat()
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
-	fileSize := fileInfo.Size()
+	pr.size = fileInfo.Size()
+	return pr, nil
+}
 
-	for i, rec := range records {
-		// Calculate record data size
-		var recordEnd int64
-		if i+1 < len(records) {
-			recordEnd = int64(records[i+1].DataOffset)
-		} else {
-			recordEnd = fileSize
+// Next returns the next sample, or io.EOF after the last one.
+func (pr *PDBReader) Next() (sensor.Sample, error) {
+	for {
+		if pr.left == 0 {
+			if pr.rec >= len(pr.records) {
+				return sensor.Sample{}, io.EOF
+			}
+			if err := pr.nextRecord(); err != nil {
+				return sensor.Sample{}, err
+			}
+			continue
 		}
 
-		recordStart := int64(rec.DataOffset)
-		if recordStart >= fileSize || recordStart >= recordEnd {
+		pr.left--
+		var raw graphSampleRaw
+		if err := binary.Read(pr.r, binary.BigEndian, &raw); err != nil {
+			pr.left = 0 // end of record or read error
 			continue
 		}
 
-		// Seek to record data
-		if _, err := f.Seek(recordStart, io.SeekStart); err != nil {
-			return nil, fmt.Errorf("failed to seek to record %d: %w", i, err)
+		// Skip empty samples (time == 0 or no data present)
+		if raw.Time == 0 || raw.DataPresent == 0 {
+			continue
 		}
 
-		// Read DBLK header (8 bytes: 4 magic + 4 size)
-		var magic [4]byte
-		var blockSize uint32
-		if err := binary.Read(f, binary.BigEndian, &magic); err != nil {
-			continue // skip malformed records
-		}
-		if err := binary.Read(f, binary.BigEndian, &blockSize); err != nil {
+		// Skip garbage samples: all bits set in dataPresent is impossible
+		// (sensor slots 23-31 don't exist in the original app)
+		if raw.DataPresent == 0xFFFFFFFF {
 			continue
 		}
 
-		if string(magic[:]) != "DBLK" {
-			continue // not a data block
+		// Convert PalmOS time to Go time and validate range.
+		// These vehicles and PalmOS devices were used ~2000-2010.
+		unixSec := int64(raw.Time) - palmOSEpochOffset
+		sampleTime := time.Unix(unixSec, 0)
+		year := sampleTime.Year()
+		if year < 1995 || year > 2030 {
+			continue // garbage timestamp from uninitialized PDB memory
 		}
 
-		// Read GraphSamples from the remaining record data
-		dataLen := recordEnd - recordStart - 8 // subtract DBLK header
-		numSamples := int(dataLen) / graphSampleSize
-
-		for j := 0; j < numSamples; j++ {
-			var raw graphSampleRaw
-			if err := binary.Read(f, binary.BigEndian, &raw); err != nil {
-				break // end of record or read error
-			}
-
-			// Skip empty samples (time == 0 or no data present)
-			if raw.Time == 0 || raw.DataPresent == 0 {
-				continue
-			}
-
-			// Skip garbage samples: all bits set in dataPresent is impossible
-			// (sensor slots 23-31 don't exist in the original app)
-			if raw.DataPresent == 0xFFFFFFFF {
-				continue
-			}
-
-			// Convert PalmOS time to Go time and validate range.
-			// These vehicles and PalmOS devices were used ~2000-2010.
-			unixSec := int64(raw.Time) - palmOSEpochOffset
-			sampleTime := time.Unix(unixSec, 0)
-			year := sampleTime.Year()
-			if year < 1995 || year > 2030 {
-				continue // garbage timestamp from uninitialized PDB memory
-			}
-
-			sample := sensor.Sample{
-				Time:        sampleTime,
-				DataPresent: raw.DataPresent,
-				RawData:     raw.Data,
-			}
-
-			log.Samples = append(log.Samples, sample)
-		}
+		sample := sensor.Sample{Time: sampleTime}
+		sample.SetSlots(raw.DataPresent, raw.Data)
+		return sample, nil
 	}
-
-	return log, nil
 }
 
-// PDBToCSV converts a parsed PDB log to CSV format.
-func PDBToCSV(pdbLog *PDBLog, outputFile string, defs []sensor.Definition, units sensor.UnitSystem) error {
-	if len(pdbLog.Samples) == 0 {
-		return fmt.Errorf("no samples in PDB log")
-	}
+// nextRecord positions the reader at the GraphSamples of the next record,
+// leaving left at 0 for records without any.
+func (pr *PDBReader) nextRecord() error {
+	i := pr.rec
+	pr.rec++
 
-	// Determine which sensor indices have any data across all samples
-	var presentMask uint32
-	for _, s := range pdbLog.Samples {
-		presentMask |= s.DataPresent
+	// Calculate record data size
+	var recordEnd int64
+	if i+1 < len(pr.records) {
+		recordEnd = int64(pr.records[i+1].DataOffset)
+	} else {
+		recordEnd = pr.size
 	}
 
-	var indices []int
-	for i := 0; i < sensor.MaxSensors; i++ {
-		if presentMask&(1<<uint(i)) != 0 {
-			indices = append(indices, i)
-		}
+	recordStart := int64(pr.records[i].DataOffset)
+	if recordStart >= pr.size || recordStart >= recordEnd {
+		return nil
 	}
 
-	// Also add INJD if RPM and INJP are present
-	hasRPM := presentMask&(1<<17) != 0
-	hasINJP := presentMask&(1<<19) != 0
-	if hasRPM && hasINJP {
-		indices = append(indices, 20) // INJD
+	// Seek to record data
+	if _, err := pr.f.Seek(recordStart, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to record %d: %w", i, err)
 	}
+	pr.r.Reset(pr.f)
 
-	writer, err := NewCSVWriter(outputFile, defs, indices, units)
-	if err != nil {
-		return err
+	// Read DBLK header (8 bytes: 4 magic + 4 size)
+	var magic [4]byte
+	var blockSize uint32
+	if err := binary.Read(pr.r, binary.BigEndian, &magic); err != nil {
+		return nil // skip malformed records
+	}
+	if err := binary.Read(pr.r, binary.BigEndian, &blockSize); err != nil {
+		return nil
 	}
-	defer writer.Close()
 
-	for i := range pdbLog.Samples {
-		// Compute derivatives (INJD) for each sample
-		pdbLog.Samples[i].ComputeDerivatives(defs)
-		if err := writer.WriteSample(pdbLog.Samples[i]); err != nil {
-			return fmt.Errorf("failed to write sample %d: %w", i, err)
-		}
+	if string(magic[:]) != "DBLK" {
+		return nil // not a data block
 	}
 
+	// Read GraphSamples from the remaining record data
+	dataLen := recordEnd - recordStart - 8 // subtract DBLK header
+	pr.left = int(dataLen) / graphSampleSize
 	return nil
 }
+
+// Close closes the PDB file.
+func (pr *PDBReader) Close() error {
+	return pr.f.Close()
+}
@@ -1,9 +1,14 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/binary"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
 )
 
 func findPDBFiles(t *testing.T) (string, string) {
@@ -47,10 +52,11 @@ func TestParsePDB_FirstRun(t *testing.T) {
 	t.Logf("First sample time: %s", first.Time.Format("2006-01-02 15:04:05"))
 
 	// Should have some data present
-	if first.DataPresent == 0 {
+	present := first.Indices()
+	if len(present) == 0 {
 		t.Error("First sample has no data present")
 	}
-	t.Logf("First sample dataPresent: 0x%08X", first.DataPresent)
+	t.Logf("First sample channels: %v", present)
 }
 
 func TestParsePDB_YEMELYA(t *testing.T) {
@@ -73,18 +79,9 @@ func TestParsePDB_YEMELYA(t *testing.T) {
 	}
 
 	// YEMELYA should have more sensors than First_run
-	var presentMask uint32
-	for _, s := range log.Samples {
-		presentMask |= s.DataPresent
-	}
-
-	sensorCount := 0
-	for i := 0; i < 32; i++ {
-		if presentMask&(1<<uint(i)) != 0 {
-			sensorCount++
-		}
-	}
-	t.Logf("Unique sensors across all samples: %d (mask: 0x%08X)", sensorCount, presentMask)
+	present := sensor.PresentIndices(log.Samples)
+	sensorCount := len(present)
+	t.Logf("Unique sensors across all samples: %d (%v)", sensorCount, present)
 
 	// YEMELYA data should have many sensors (we saw 16 in the hex dump)
 	if sensorCount < 5 {
@@ -127,3 +124,64 @@ func TestParsePDB_NonExistentFile(t *testing.T) {
 		t.Error("Expected error for non-existent file")
 	}
 }
+
+// writeTestPDB writes an MMCd PDB log with three samples a second apart
+// from start, with TPS counting up and RPM, in two records. The first
+// record also has an empty and a garbage sample, which are skipped.
+func writeTestPDB(t *testing.T, path string, start time.Time) {
+	t.Helper()
+	palm := func(i int) uint32 { return uint32(start.Unix()+palmOSEpochOffset) + uint32(i) }
+	sample := func(i int) graphSampleRaw {
+		raw := graphSampleRaw{Time: palm(i), DataPresent: 1<<14 | 1<<17}
+		raw.Data[14], raw.Data[17] = byte(i), 0x40
+		return raw
+	}
+	recs := [][]graphSampleRaw{
+		{sample(0), {}, {Time: palm(1), DataPresent: 0xFFFFFFFF}, sample(1)},
+		{sample(2)},
+	}
+
+	var body bytes.Buffer
+	hdr := pdbHeader{NumRecords: uint16(len(recs))}
+	copy(hdr.Name[:], "Test run")
+	copy(hdr.Type[:], "strm")
+	copy(hdr.Creator[:], "MMCd")
+	binary.Write(&body, binary.BigEndian, hdr)
+	offset := uint32(body.Len() + 8*len(recs))
+	for _, rec := range recs {
+		binary.Write(&body, binary.BigEndian, pdbRecordEntry{DataOffset: offset})
+		offset += uint32(8 + graphSampleSize*len(rec))
+	}
+	for _, rec := range recs {
+		body.WriteString("DBLK")
+		binary.Write(&body, binary.BigEndian, uint32(graphSampleSize*len(rec)))
+		binary.Write(&body, binary.BigEndian, rec)
+	}
+	if err := os.WriteFile(path, body.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenPDB_Records(t *testing.T) {
+	start := time.Date(2003, 1, 17, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "test.pdb")
+	writeTestPDB(t, path, start)
+
+	pr, err := OpenPDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	samples, err := ReadAllSamples(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Name != "Test run" || len(samples) != 3 {
+		t.Fatalf("%q: %d samples, want 3", pr.Name, len(samples))
+	}
+	for i, s := range samples {
+		if !s.Time.Equal(start.Add(time.Duration(i)*time.Second)) || s.Raw(14) != byte(i) || s.Raw(17) != 0x40 {
+			t.Errorf("sample %d = TPS %d RPM %d at %s", i, s.Raw(14), s.Raw(17), s.Time.UTC())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"io"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// SampleReader reads the raw samples of a log one at a time, in the order
+// they were recorded, so a log of any length can be reviewed or converted
+// without holding it in memory. BinaryReader, CSVReader and PDBReader
+// implement it.
+type SampleReader interface {
+	// Next returns the next sample, or io.EOF after the last one.
+	Next() (sensor.Sample, error)
+	Close() error
+}
+
+// SampleSeeker is a SampleReader that can jump to a time, as BinaryReader
+// can.
+type SampleSeeker interface {
+	SampleReader
+	// Seek positions the reader at the first sample taken at or after t.
+	Seek(t time.Time) error
+}
+
+// ReadAllSamples reads the remaining samples of r into memory.
+func ReadAllSamples(r SampleReader) ([]sensor.Sample, error) {
+	var samples []sensor.Sample
+	for {
+		s, err := r.Next()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, s)
+	}
+}
+
+// LogSummary describes the samples of a log, gathered in one pass over it.
+type LogSummary struct {
+	Count       int
+	First, Last time.Time // times of the first and last sample
+	Indices     []int     // every sensor index that has data somewhere in the log
+}
+
+// Duration returns the recorded length of the log.
+func (s LogSummary) Duration() time.Duration {
+	return s.Last.Sub(s.First)
+}
+
+// Summarize reads the remaining samples of r and returns their summary.
+func Summarize(r SampleReader) (LogSummary, error) {
+	var sum LogSummary
+	var seen [sensor.MaxChannels]bool
+	for {
+		s, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return LogSummary{}, err
+		}
+		if sum.Count == 0 {
+			sum.First = s.Time
+		}
+		sum.Last = s.Time
+		sum.Count++
+		for _, idx := range s.Indices() {
+			if idx < len(seen) {
+				seen[idx] = true
+			}
+		}
+	}
+	for idx, ok := range seen {
+		if ok {
+			sum.Indices = append(sum.Indices, idx)
+		}
+	}
+	return sum, nil
+}
+
+// sliceReader is a SampleReader over samples already in memory.
+type sliceReader struct {
+	samples []sensor.Sample
+	pos     int
+}
+
+func (r *sliceReader) Next() (sensor.Sample, error) {
+	if r.pos >= len(r.samples) {
+		return sensor.Sample{}, io.EOF
+	}
+	r.pos++
+	return r.samples[r.pos-1], nil
+}
+
+func (r *sliceReader) Close() error {
+	return nil
+}
@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+func TestBinaryReader_Seek(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seek.mmcd")
+	samples := replaySamples(100) // 20ms apart
+	defs := sensor.DefaultDefinitions()
+	w, err := NewLogWriter(path, defs, []int{14, 17}, sensor.UnitMetric, WriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := CopySamples(w, &sliceReader{samples: samples}, defs); err != nil || n != 100 {
+		t.Fatalf("CopySamples = %d, %v", n, err)
+	}
+	w.Close()
+
+	br, err := OpenBinaryLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer br.Close()
+	if br.Len() != 100 || br.Recovery != nil {
+		t.Fatalf("Len = %d, recovery %+v", br.Len(), br.Recovery)
+	}
+
+	// Read a little, then jump; the reader continues from the seek target
+	if _, err := br.Next(); err != nil {
+		t.Fatal(err)
+	}
+	start := samples[0].Time
+	for _, tc := range []struct {
+		at   time.Duration
+		want int // sample Next returns; -1 for io.EOF
+	}{
+		{1010 * time.Millisecond, 51},
+		{1000 * time.Millisecond, 50},
+		{-time.Second, 0},
+		{1980 * time.Millisecond, 99},
+		{time.Hour, -1},
+	} {
+		if err := br.Seek(start.Add(tc.at)); err != nil {
+			t.Fatal(err)
+		}
+		s, err := br.Next()
+		if tc.want < 0 {
+			if err != io.EOF {
+				t.Errorf("Seek(+%s): Next = %v, want io.EOF", tc.at, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !s.Time.Equal(samples[tc.want].Time) || int(s.Raw(14)) != tc.want {
+			t.Errorf("Seek(+%s): got TPS %d at %s, want sample %d", tc.at, s.Raw(14), s.Time.Sub(start), tc.want)
+		}
+	}
+
+	if err := br.SeekSample(90); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := Summarize(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Count != 10 || !sum.First.Equal(samples[90].Time) || !slices.Equal(sum.Indices, []int{14, 17}) {
+		t.Errorf("summary after SeekSample(90) = %+v", sum)
+	}
+	if err := br.SeekSample(101); err == nil {
+		t.Error("SeekSample past the end should fail")
+	}
+}
+
+// loadSamples opens a log with Open and reads its samples into memory.
+func loadSamples(path string, defs []sensor.Definition) ([]sensor.Sample, error) {
+	l, err := Open(path, defs)
+	if err != nil {
+		return nil, err
+	}
+	r, err := l.Samples()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ReadAllSamples(r)
+}
+
+func TestLogSamples_Formats(t *testing.T) {
+	dir := t.TempDir()
+	samples := replaySamples(50)
+	defs := sensor.DefaultDefinitions()
+	for _, name := range []string{"drive.csv", "drive.mmcd"} {
+		path := filepath.Join(dir, name)
+		w, err := NewLogWriter(path, defs, []int{14, 17}, sensor.UnitMetric, WriterOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := CopySamples(w, &sliceReader{samples: samples}, defs); err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		l, err := Open(path, defs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := l.Samples()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum, err := Summarize(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum.Count != 50 || sum.Duration() != 980*time.Millisecond || !slices.Equal(sum.Indices, []int{14, 17}) {
+			t.Errorf("%s: summary = %+v", name, sum)
+		}
+
+		// Streaming and reading into memory agree
+		got, err := loadSamples(path, defs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 50 || got[49].Raw(14) != 49 || got[49].Raw(17) != 0x40 {
+			t.Errorf("%s: loadSamples = %d samples", name, len(got))
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// ReplayPoller is a SamplePoller that plays back a recorded log, so a drive
+// can be fed through the live pipeline (dashboard, CSV writer, GUI events)
+// exactly like a connected ECU.
+//
+// Samples are released at their original spacing divided by the replay
+// speed, and keep their recorded timestamps. Only the requested sensors are
+// marked present, as with a real poll. When the log is exhausted PollSensors
+// returns io.EOF, which stops the Logger and fires its OnDone callbacks.
+type ReplayPoller struct {
+	log  *Log // nil for a replay of samples in memory
+	defs []sensor.Definition
+	sum  LogSummary
+
+	mu         sync.Mutex
+	src        SampleReader  // samples are read as they are replayed
+	next       sensor.Sample // sample read from src and not yet emitted
+	hasNext    bool
+	speed      float64       // 1 = real time, 0 = as fast as possible
+	pos        int           // next sample to emit
+	base       time.Time     // wall-clock time baseOffset was emitted
+	baseOffset time.Duration // log offset of the sample emitted at base
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewReplayPoller creates a replay over samples, which must be in time order.
+// A speed of 1 replays in real time, 2 twice as fast, and 0 as fast as the
+// consumer can take samples.
+func NewReplayPoller(samples []sensor.Sample, defs []sensor.Definition, speed float64) *ReplayPoller {
+	sum, _ := Summarize(&sliceReader{samples: samples})
+	return newReplayPoller(&sliceReader{samples: samples}, sum, defs, speed)
+}
+
+func newReplayPoller(src SampleReader, sum LogSummary, defs []sensor.Definition, speed float64) *ReplayPoller {
+	return &ReplayPoller{
+		defs:  defs,
+		sum:   sum,
+		src:   src,
+		speed: speed,
+		done:  make(chan struct{}),
+	}
+}
+
+// OpenReplay opens a .mmcd, CSV or PalmOS PDB log with Open and returns a
+// replay of it, with the definitions the log records. The log is read once
+// for its length and sensors, then streamed as it is replayed.
+func OpenReplay(filename string, defs []sensor.Definition, speed float64) (*ReplayPoller, error) {
+	l, err := Open(filename, defs)
+	if err != nil {
+		return nil, err
+	}
+	if l.Recovery != nil {
+		slog.Warn("log was not closed cleanly; run mmcd repair to fix it", "file", filename, "recovery", l.Recovery.String())
+	}
+	src, err := l.Samples()
+	if err != nil {
+		return nil, err
+	}
+	sum, err := Summarize(src)
+	src.Close()
+	if err != nil {
+		return nil, err
+	}
+	if sum.Count == 0 {
+		return nil, fmt.Errorf("no samples in %s", filename)
+	}
+	if src, err = l.Samples(); err != nil {
+		return nil, err
+	}
+	rp := newReplayPoller(src, sum, l.Defs, speed)
+	rp.log = l
+	return rp, nil
+}
+
+// PollSensors waits until the next recorded sample is due and returns it,
+// restricted to the requested sensor indices.
+func (r *ReplayPoller) PollSensors(indices []int) (sensor.Sample, error) {
+	r.mu.Lock()
+	if r.pos >= r.sum.Count {
+		r.mu.Unlock()
+		return sensor.Sample{}, io.EOF
+	}
+	if !r.hasNext {
+		rec, err := r.src.Next()
+		if err != nil {
+			if err != io.EOF {
+				slog.Warn("replay stopped at an unreadable sample", "sample", r.pos, "error", err)
+			}
+			r.pos = r.sum.Count
+			r.mu.Unlock()
+			return sensor.Sample{}, io.EOF
+		}
+		r.next, r.hasNext = rec, true
+	}
+	rec := r.next
+	offset := rec.Time.Sub(r.sum.First)
+	now := time.Now()
+	if r.base.IsZero() {
+		r.base = now
+		r.baseOffset = offset
+	}
+	var wait time.Duration
+	if r.speed > 0 {
+		due := r.base.Add(time.Duration(float64(offset-r.baseOffset) / r.speed))
+		wait = due.Sub(now)
+	}
+	r.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-r.done:
+			timer.Stop()
+			return sensor.Sample{}, io.EOF
+		}
+	}
+
+	r.mu.Lock()
+	r.pos++
+	r.hasNext = false
+	r.mu.Unlock()
+
+	out := sensor.Sample{Time: rec.Time}
+	for _, idx := range indices {
+		out.CopyChannel(&rec, idx)
+	}
+	out.ComputeDerivatives(r.defs)
+	return out, nil
+}
+
+// SetSpeed changes the replay speed from the current position onward.
+func (r *ReplayPoller) SetSpeed(speed float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.speed = speed
+	r.base = time.Time{} // re-anchor on the next poll
+}
+
+// Speed returns the current replay speed (0 = as fast as possible).
+func (r *ReplayPoller) Speed() float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.speed
+}
+
+// Position returns the number of samples emitted and the total in the log.
+func (r *ReplayPoller) Position() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pos, r.sum.Count
+}
+
+// Duration returns the recorded length of the log.
+func (r *ReplayPoller) Duration() time.Duration {
+	return r.sum.Duration()
+}
+
+// Log returns the log being replayed, or nil for a replay of samples in
+// memory. Its Defs are the definitions the samples are read with.
+func (r *ReplayPoller) Log() *Log {
+	return r.log
+}
+
+// Indices returns every sensor index that has data somewhere in the log.
+func (r *ReplayPoller) Indices() []int {
+	return r.sum.Indices
+}
+
+// Close aborts a pending wait and closes the log; subsequent polls return
+// io.EOF.
+func (r *ReplayPoller) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.mu.Lock()
+		r.pos = r.sum.Count
+		r.src.Close()
+		r.mu.Unlock()
+	})
+}
+
+// ParseReplaySpeed parses a replay speed such as "1", "2x", "0.5" or "max".
+// "max" (or 0) means as fast as possible.
+func ParseReplaySpeed(s string) (float64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "max" || s == "" {
+		return 0, nil
+	}
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed < 0 {
+		return 0, fmt.Errorf("invalid replay speed %q (want e.g. 1, 2x, 10x or max)", s)
+	}
+	return speed, nil
+}
@@ -0,0 +1,260 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// replaySamples returns n samples 20ms apart with RPM, INJP and TPS present.
+func replaySamples(n int) []sensor.Sample {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	samples := make([]sensor.Sample, n)
+	for i := range samples {
+		s := sensor.Sample{Time: start.Add(time.Duration(i) * 20 * time.Millisecond)}
+		s.SetData(14, byte(i))    // TPS
+		s.SetData(17, 0x40)       // RPM
+		s.SetData(19, byte(0x20)) // INJP
+		samples[i] = s
+	}
+	return samples
+}
+
+func TestReplayPoller_MaxSpeedThenEOF(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	rp := NewReplayPoller(replaySamples(3), defs, 0)
+
+	for i := 0; i < 3; i++ {
+		s, err := rp.PollSensors([]int{17, 19, 20})
+		if err != nil {
+			t.Fatalf("poll %d failed: %v", i, err)
+		}
+		if s.HasData(14) {
+			t.Errorf("poll %d: TPS present but not requested", i)
+		}
+		if !s.HasData(20) {
+			t.Errorf("poll %d: INJD should be computed from RPM and INJP", i)
+		}
+	}
+	if _, err := rp.PollSensors([]int{17}); !errors.Is(err, io.EOF) {
+		t.Errorf("poll past end = %v, want io.EOF", err)
+	}
+	if pos, total := rp.Position(); pos != 3 || total != 3 {
+		t.Errorf("Position = %d/%d, want 3/3", pos, total)
+	}
+}
+
+func TestReplayPoller_KeepsOriginalTiming(t *testing.T) {
+	samples := replaySamples(6) // 100ms of log
+	rp := NewReplayPoller(samples, sensor.DefaultDefinitions(), 2)
+
+	start := time.Now()
+	for range samples {
+		if _, err := rp.PollSensors([]int{17}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+	if elapsed < 40*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("100ms log at 2x took %s, want ~50ms", elapsed)
+	}
+}
+
+func TestReplayPoller_CloseUnblocks(t *testing.T) {
+	samples := replaySamples(1)
+	samples = append(samples, sensor.Sample{Time: samples[0].Time.Add(time.Hour)})
+	rp := NewReplayPoller(samples, sensor.DefaultDefinitions(), 1)
+	rp.PollSensors([]int{17})
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		rp.Close()
+	}()
+	if _, err := rp.PollSensors([]int{17}); !errors.Is(err, io.EOF) {
+		t.Errorf("poll after Close = %v, want io.EOF", err)
+	}
+}
+
+func TestLogger_ReplayFiresOnDone(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	rp := NewReplayPoller(replaySamples(5), defs, 0)
+	lg := New(rp, defs, []int{14, 17}, sensor.UnitMetric)
+
+	var got []byte
+	lg.OnSample(func(s sensor.Sample) { got = append(got, s.Raw(14)) })
+	done := make(chan struct{})
+	lg.OnDone(func() { close(done) })
+
+	lg.Start()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDone not called at end of replay")
+	}
+	if lg.IsRunning() {
+		t.Error("logger should stop at end of replay")
+	}
+	if len(got) != 5 || got[4] != 4 {
+		t.Errorf("replayed TPS values = %v, want 0..4", got)
+	}
+}
+
+// eofLinkPoller fails like a TCP bridge whose peer went away.
+type eofLinkPoller struct{}
+
+func (eofLinkPoller) PollSensors(indices []int) (sensor.Sample, error) {
+	return sensor.Sample{}, fmt.Errorf("failed to read response for 0x21: %w", io.EOF)
+}
+
+func TestLogger_WrappedEOFIsLinkFailure(t *testing.T) {
+	lg := NewWithRate(eofLinkPoller{}, sensor.DefaultDefinitions(), []int{17}, sensor.UnitMetric, time.Millisecond)
+	var done, lost atomic.Bool
+	lg.OnDone(func() { done.Store(true) })
+	lg.OnDisconnect(func() { lost.Store(true) })
+
+	lg.Start()
+	time.Sleep(200 * time.Millisecond)
+	lg.Stop()
+
+	if done.Load() {
+		t.Error("a wrapped io.EOF ended the log like a finished replay")
+	}
+	if !lost.Load() {
+		t.Error("a wrapped io.EOF should count towards the watchdog")
+	}
+}
+
+func TestOpenReplay_RecordedDefinitions(t *testing.T) {
+	defs, gps, err := sensor.AddGPS(sensor.DefaultDefinitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "drive.mmcd")
+	w, err := NewBinaryWriterWithOptions(path, []int{17, gps.Speed}, sensor.UnitMetric, BinaryOptions{Vehicle: "3000gt", Defs: defs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range replaySamples(3) {
+		s.SetValue(gps.Speed, float64(40+i))
+		if err := w.WriteSample(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	// Replayed without a GPS input, the log still defines GSPD
+	rp, err := OpenReplay(path, sensor.DefaultDefinitions(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rp.Close()
+	l := rp.Log()
+	if l.Vehicle != "3000gt" || gps.Speed >= len(l.Defs) || l.Defs[gps.Speed].Slug != "GSPD" {
+		t.Fatalf("replay log: vehicle %q, %d definitions", l.Vehicle, len(l.Defs))
+	}
+	s, err := rp.PollSensors([]int{17, gps.Speed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Value(l.Defs, gps.Speed, sensor.UnitMetric); got != 40 {
+		t.Errorf("GSPD = %g, want 40", got)
+	}
+}
+
+func TestCSVSamples_RoundTrip(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	path := filepath.Join(t.TempDir(), "drive.csv")
+	w, err := NewCSVWriter(path, defs, []int{14, 17}, sensor.UnitMetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range replaySamples(3) {
+		if err := w.WriteSample(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	samples, err := loadSamples(path, defs)
+	if err != nil {
+		t.Fatalf("loadSamples failed: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("got %d samples, want 3", len(samples))
+	}
+	if samples[2].Raw(14) != 2 || samples[2].Raw(17) != 0x40 {
+		t.Errorf("sample 2 raw TPS/RPM = %d/%d, want 2/64", samples[2].Raw(14), samples[2].Raw(17))
+	}
+	if samples[2].HasData(19) {
+		t.Error("INJP was not logged and should not be present")
+	}
+	if d := samples[2].Time.Sub(samples[0].Time); d != 40*time.Millisecond {
+		t.Errorf("sample spacing = %s, want 40ms", d)
+	}
+}
+
+func TestCSVSamples_TwoByteAndSigned(t *testing.T) {
+	two, kret := sensor.Addr(0x4A), sensor.Addr(0x4C)
+	defs, err := sensor.ApplyProfile(sensor.DefaultDefinitions(), &sensor.Profile{Sensors: []sensor.ProfileSensor{
+		{Slug: "AFCNT", Addr: &two, Size: 2, Signed: true},
+		{Slug: "KRET", Addr: &kret, Signed: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	af, _ := sensor.FindBySlug(defs, "AFCNT")
+	kr, _ := sensor.FindBySlug(defs, "KRET")
+	path := filepath.Join(t.TempDir(), "wide.csv")
+	w, err := NewCSVWriter(path, defs, []int{af, kr}, sensor.UnitMetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var in sensor.Sample
+	in.Time = time.Now()
+	in.SetWord(af, 0x8001)
+	in.SetData(kr, 0x80)
+	if err := w.WriteSample(in); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	samples, err := loadSamples(path, defs)
+	if err != nil {
+		t.Fatalf("loadSamples failed: %v", err)
+	}
+	if len(samples) != 1 || samples[0].RawValue(defs, af) != -32767 || samples[0].RawValue(defs, kr) != -128 {
+		t.Errorf("read back %+v, want AFCNT -32767 and KRET -128", samples)
+	}
+}
+
+func TestParseReplaySpeed(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "1", want: 1},
+		{in: "2x", want: 2},
+		{in: "10X", want: 10},
+		{in: "0.5", want: 0.5},
+		{in: "max", want: 0},
+		{in: "fast", wantErr: true},
+		{in: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseReplaySpeed(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseReplaySpeed(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseReplaySpeed(%q) = %g, want %g", tt.in, got, tt.want)
+		}
+	}
+}
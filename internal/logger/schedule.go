@@ -0,0 +1,228 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// Priority classes for poll scheduling, expressed as target rates in Hz.
+// At 1920 baud a full sweep of every sensor takes ~250ms, so polling the slow
+// movers less often leaves more of the bus for RPM, TPS, knock and O2.
+const (
+	RateFast   = 0.0 // every poll cycle
+	RateNormal = 5.0
+	RateSlow   = 1.0
+)
+
+// priorityRates maps priority class names to target rates.
+var priorityRates = map[string]float64{
+	"fast":   RateFast,
+	"normal": RateNormal,
+	"slow":   RateSlow,
+}
+
+// DefaultSchedule returns the built-in target rate per slug. Sensors not
+// listed are polled at RateNormal.
+func DefaultSchedule() map[string]float64 {
+	return map[string]float64{
+		"RPM":  RateFast,
+		"TPS":  RateFast,
+		"KNCK": RateFast,
+		"O2-R": RateFast,
+		"O2-F": RateFast,
+		"COOL": RateSlow,
+		"BARO": RateSlow,
+		"BATT": RateSlow,
+		"AIRT": RateSlow,
+	}
+}
+
+// ParseSchedule parses a comma-separated schedule spec. "default" selects
+// DefaultSchedule; SLUG=class or SLUG=hz entries override single sensors,
+// where class is fast, normal or slow. For example:
+//
+//	default,TIMA=fast,COOL=0.2
+//
+// An empty spec returns nil, meaning every sensor is polled every cycle.
+func ParseSchedule(spec string) (map[string]float64, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	rates := make(map[string]float64)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if strings.EqualFold(part, "default") {
+			for slug, hz := range DefaultSchedule() {
+				rates[slug] = hz
+			}
+			continue
+		}
+		slug, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("schedule entry %q: want SLUG=fast|normal|slow|hz or 'default'", part)
+		}
+		slug = strings.ToUpper(strings.TrimSpace(slug))
+		value = strings.ToLower(strings.TrimSpace(value))
+		if hz, ok := priorityRates[value]; ok {
+			rates[slug] = hz
+			continue
+		}
+		hz, err := strconv.ParseFloat(strings.TrimSuffix(value, "hz"), 64)
+		if err != nil || hz < 0 {
+			return nil, fmt.Errorf("schedule entry %q: invalid rate %q", part, value)
+		}
+		rates[slug] = hz
+	}
+	return rates, nil
+}
+
+// FormatSchedule returns rates in ParseSchedule syntax, sorted by slug.
+func FormatSchedule(rates map[string]float64) string {
+	slugs := make([]string, 0, len(rates))
+	for slug := range rates {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	parts := make([]string, len(slugs))
+	for i, slug := range slugs {
+		switch hz := rates[slug]; hz {
+		case RateFast:
+			parts[i] = slug + "=fast"
+		default:
+			parts[i] = slug + "=" + strconv.FormatFloat(hz, 'g', -1, 64)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// schedEntry is the scheduling state of one sensor index.
+type schedEntry struct {
+	interval   time.Duration // 0 = every cycle
+	lastPolled time.Time
+	fresh      uint64 // samples that carried a fresh value
+}
+
+// Scheduler decides which sensors are due each poll cycle so that each one
+// is read at roughly its target rate, and measures the rate it achieved.
+// Samples only carry the sensors that were polled in that cycle.
+type Scheduler struct {
+	defs  []sensor.Definition
+	rates map[string]float64
+
+	mu      sync.Mutex
+	entries map[int]*schedEntry
+	start   time.Time
+}
+
+// NewScheduler creates a scheduler from target rates keyed by slug. Sensors
+// without an entry are polled at RateNormal.
+func NewScheduler(defs []sensor.Definition, rates map[string]float64) *Scheduler {
+	return &Scheduler{
+		defs:    defs,
+		rates:   rates,
+		entries: make(map[int]*schedEntry),
+	}
+}
+
+// Rates returns the configured target rates.
+func (s *Scheduler) Rates() map[string]float64 {
+	return s.rates
+}
+
+func (s *Scheduler) entry(idx int) *schedEntry {
+	e, ok := s.entries[idx]
+	if !ok {
+		hz := RateNormal
+		if idx >= 0 && idx < len(s.defs) {
+			if r, ok := s.rates[s.defs[idx].Slug]; ok {
+				hz = r
+			}
+		}
+		e = &schedEntry{}
+		if hz > 0 {
+			e.interval = time.Duration(float64(time.Second) / hz)
+		}
+		s.entries[idx] = e
+	}
+	return e
+}
+
+// Due returns the subset of indices to poll now and marks them as polled.
+// Computed sensors are passed through so derivatives can still be produced.
+// It returns nil when no polled sensor is due yet.
+func (s *Scheduler) Due(indices []int, now time.Time) []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.start.IsZero() {
+		s.start = now
+	}
+	due := make([]int, 0, len(indices))
+	polled := 0
+	for _, idx := range indices {
+		if idx >= 0 && idx < len(s.defs) && s.defs[idx].Computed {
+			due = append(due, idx)
+			continue
+		}
+		e := s.entry(idx)
+		if e.interval == 0 || now.Sub(e.lastPolled) >= e.interval {
+			e.lastPolled = now
+			due = append(due, idx)
+			polled++
+		}
+	}
+	if polled == 0 {
+		return nil
+	}
+	return due
+}
+
+// Record counts the fresh values carried by a successful sample.
+func (s *Scheduler) Record(sample sensor.Sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for idx, e := range s.entries {
+		if sample.HasData(idx) {
+			e.fresh++
+		}
+	}
+}
+
+// AchievedRates returns the measured rate in Hz of each scheduled sensor.
+func (s *Scheduler) AchievedRates() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]float64, len(s.entries))
+	if s.start.IsZero() {
+		return out
+	}
+	elapsed := time.Since(s.start).Seconds()
+	if elapsed <= 0 {
+		return out
+	}
+	for idx, e := range s.entries {
+		if idx >= 0 && idx < len(s.defs) {
+			out[s.defs[idx].Slug] = float64(e.fresh) / elapsed
+		}
+	}
+	return out
+}
+
+// Reset clears timing and counters, e.g. when polling restarts.
+func (s *Scheduler) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[int]*schedEntry)
+	s.start = time.Time{}
+}
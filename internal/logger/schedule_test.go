@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+func TestParseSchedule(t *testing.T) {
+	rates, err := ParseSchedule("default, TIMA=fast, cool=0.5, BATT=normal")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+	want := map[string]float64{"RPM": RateFast, "TIMA": RateFast, "COOL": 0.5, "BATT": RateNormal, "BARO": RateSlow}
+	for slug, hz := range want {
+		if rates[slug] != hz {
+			t.Errorf("rate[%s] = %g, want %g", slug, rates[slug], hz)
+		}
+	}
+
+	if rates, err := ParseSchedule(""); err != nil || rates != nil {
+		t.Errorf("empty schedule = (%v, %v), want (nil, nil)", rates, err)
+	}
+	for _, bad := range []string{"RPM", "RPM=warp", "COOL=-1"} {
+		if _, err := ParseSchedule(bad); err == nil {
+			t.Errorf("ParseSchedule(%q) should fail", bad)
+		}
+	}
+
+	back, err := ParseSchedule(FormatSchedule(rates))
+	if err != nil || len(back) != len(rates) {
+		t.Fatalf("FormatSchedule round trip = (%v, %v)", back, err)
+	}
+	for slug, hz := range rates {
+		if back[slug] != hz {
+			t.Errorf("round trip rate[%s] = %g, want %g", slug, back[slug], hz)
+		}
+	}
+}
+
+func TestScheduler_Due(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	s := NewScheduler(defs, map[string]float64{"RPM": RateFast, "COOL": 1})
+	indices := []int{17, 4, 20} // RPM, COOL, INJD (computed)
+
+	t0 := time.Now()
+	if due := s.Due(indices, t0); len(due) != 3 {
+		t.Fatalf("first cycle due = %v, want all", due)
+	}
+	due := s.Due(indices, t0.Add(100*time.Millisecond))
+	if len(due) != 2 || due[0] != 17 || due[1] != 20 {
+		t.Errorf("due after 100ms = %v, want [17 20] (COOL not due)", due)
+	}
+	due = s.Due(indices, t0.Add(time.Second))
+	if len(due) != 3 {
+		t.Errorf("due after 1s = %v, want COOL due again", due)
+	}
+
+	// Only computed sensors selected and nothing polled is due
+	s = NewScheduler(defs, map[string]float64{"COOL": 1})
+	s.Due([]int{4}, t0)
+	if due := s.Due([]int{4, 20}, t0.Add(time.Millisecond)); due != nil {
+		t.Errorf("due with nothing pollable = %v, want nil", due)
+	}
+}
+
+// recordingPoller records which indices each poll asked for.
+type recordingPoller struct {
+	mu     sync.Mutex
+	counts map[int]int
+}
+
+func (p *recordingPoller) PollSensors(indices []int) (sensor.Sample, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := sensor.Sample{Time: time.Now()}
+	for _, idx := range indices {
+		p.counts[idx]++
+		s.SetData(idx, 1)
+	}
+	return s, nil
+}
+
+func TestLogger_SchedulerRates(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	poller := &recordingPoller{counts: make(map[int]int)}
+	lg := NewWithRate(poller, defs, []int{17, 4}, sensor.UnitMetric, 2*time.Millisecond)
+	lg.SetScheduler(NewScheduler(defs, map[string]float64{"RPM": RateFast, "COOL": 5}))
+
+	var mu sync.Mutex
+	coolInSamples := 0
+	samples := 0
+	lg.OnSample(func(s sensor.Sample) {
+		mu.Lock()
+		defer mu.Unlock()
+		samples++
+		if s.HasData(4) {
+			coolInSamples++
+		}
+	})
+
+	lg.Start()
+	time.Sleep(450 * time.Millisecond)
+	lg.Stop()
+
+	poller.mu.Lock()
+	rpm, cool := poller.counts[17], poller.counts[4]
+	poller.mu.Unlock()
+	if cool < 2 || cool > 4 {
+		t.Errorf("COOL polled %d times in 450ms at 5 Hz, want 2-4", cool)
+	}
+	if rpm < 5*cool {
+		t.Errorf("RPM polled %d times, want far more than COOL (%d)", rpm, cool)
+	}
+
+	mu.Lock()
+	if coolInSamples == samples {
+		t.Error("every sample carried COOL; stale values should be left out")
+	}
+	mu.Unlock()
+
+	hz := lg.Stats().SensorHz
+	if hz["RPM"] <= hz["COOL"] {
+		t.Errorf("achieved RPM %.1f Hz should exceed COOL %.1f Hz", hz["RPM"], hz["COOL"])
+	}
+}
@@ -1,27 +1,38 @@
 package logger
 
 import (
+	"bufio"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"math"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/vehicle"
+	"github.com/kbuckham/mmcd/internal/version"
 )
 
 // Native MMCD binary log format (.mmcd)
 //
 // Header (16 bytes):
 //   [4] Magic: "MMCD"
-//   [1] Version: 1
+//   [1] Version: 1 to 4
 //   [1] UnitSystem: 0=metric, 1=english, 2=raw
 //   [2] SensorCount: number of sensor indices stored
 //   [4] SampleCount: total number of samples (updated on close)
-//   [4] Reserved
+//   [1] Vehicle: vehicle.Vehicle.Code, 0 = not recorded
+//   [3] Reserved
 //
 // Sensor Index Table (SensorCount bytes):
-//   Each byte is the sensor definition index (0-31) that is being logged
+//   Each byte is the sensor definition index that is being logged. Before
+//   version 4 samples use the 32-slot layout read back by decodeSlots with
+//   sensor.Sample.SetSlots, so only indices 0-31 can be stored.
 //
 // Samples (40 bytes each, little-endian):
 //   [8] UnixNano: int64 nanoseconds since Unix epoch
@@ -35,22 +46,198 @@ import (
 //   [4] DataPresent: uint32
 //   [4] Padding
 //   [32] RawData
+//
+// Version 2 appends per-channel timestamps to each sample:
+//   [4 × SensorCount] uint32 microseconds from UnixNano to when each sensor
+//                     in the index table was answered (table order)
+//
+// Version 3 adds a unit table after the sensor index table:
+//   [SensorCount] sensor.DisplayUnit code each sensor was shown in (table
+//                 order); 0 = no unit family, follow UnitSystem
+//
+// Version 4 records what the log was written with and stores each channel
+// in a cell of its own, so any channel index, two-byte sensors and float
+// channels fit. After the unit table:
+//   [SensorCount] cell type per sensor (table order): 1 = raw byte or word,
+//                 2 = float value
+//   [4]           MetaLength: uint32
+//   [MetaLength]  LogMeta as JSON: software version, vehicle, notes, start
+//                 time and zone, and the channel schema (see sensor.Channel)
+// and each sample is:
+//   [8]                    UnixNano: int64
+//   [(SensorCount+7)/8]    presence bitmap, bit i = table entry i
+//   cells in table order:  [2] uint16 raw value, or [8] float64 bits
+//   [4 × SensorCount]      channel timestamps as in version 2
+//
+// New metadata goes into the JSON, which readers ignore if they do not
+// know it, rather than into a new version.
+//
+// Samples are only ever appended, so a log cut short by a power loss is
+// its header and metadata followed by complete samples and at most a torn
+// last one. The writer syncs the file and updates SampleCount every
+// mmcdSyncInterval; ReadBinaryLog reads every complete sample whatever
+// SampleCount says and reports the difference (see Recovery).
 
 const (
 	mmcdMagic      = "MMCD"
-	mmcdVersion    = 1
+	mmcdVersion    = 4 // version written by BinaryWriter
+	mmcdVersionV1  = 1 // single timestamp per sample
+	mmcdVersionV2  = 2 // per-channel timestamps, no unit table
+	mmcdVersionV3  = 3 // unit table, 32-slot samples
 	mmcdHeaderSize = 16
-	mmcdSampleSize = 48
+	mmcdSampleSize = 48 // v1 sample; v2 adds 4 bytes per logged sensor
+
+	mmcdVehicleOffset = 12 // header byte holding the vehicle code
+
+	mmcdMaxMeta = 16 << 20 // sanity limit on the version 4 metadata block
+
+	mmcdSyncInterval = time.Second // how often BinaryWriter checkpoints to disk
+)
+
+// Version 4 cell types.
+const (
+	cellWord  byte = 1 // uint16 raw byte or word
+	cellFloat byte = 2 // float64 value of an expression or input channel
 )
 
+// cellSize returns the bytes a cell type takes in a sample, or 0 if the
+// type is unknown.
+func cellSize(cell byte) int {
+	switch cell {
+	case cellWord:
+		return 2
+	case cellFloat:
+		return 8
+	}
+	return 0
+}
+
+// LogMeta is the metadata block of a version 4 .mmcd log.
+type LogMeta struct {
+	Software string           `json:"software,omitempty"` // mmcd version that wrote the log
+	Vehicle  string           `json:"vehicle,omitempty"`  // vehicle ID
+	Notes    string           `json:"notes,omitempty"`
+	Started  time.Time        `json:"started"`            // when logging started, local time
+	TimeZone string           `json:"timeZone,omitempty"` // IANA zone of Started, if known
+	Channels []sensor.Channel `json:"channels,omitempty"` // definitions of the logged sensors
+
+	// Extra holds free-form key/value pairs, such as a track or a tune name.
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// BinaryOptions holds optional .mmcd header fields.
+type BinaryOptions struct {
+	Vehicle string // vehicle ID recorded in the header; empty records none
+
+	// Defs is the sensor table the indices refer to. When set, the unit each
+	// sensor is shown in (see sensor.Definition.UnitCode) and the channel
+	// schema are recorded, and expression and input channels are stored as
+	// floats; otherwise every channel is stored as a raw value.
+	Defs []sensor.Definition
+
+	Notes string            // free-form notes recorded in the metadata
+	Extra map[string]string // extra metadata key/value pairs
+}
+
+// vehicleCode returns the header code of a vehicle ID, or 0.
+func vehicleCode(id string) byte {
+	if id == "" {
+		return 0
+	}
+	if v, err := vehicle.Get(id); err == nil {
+		return v.Code
+	}
+	return 0
+}
+
+// vehicleID returns the vehicle ID of a header code, or "".
+func vehicleID(code byte) string {
+	if v := vehicle.ByCode(code); v != nil && code != 0 {
+		return v.ID
+	}
+	return ""
+}
+
+// mmcdSampleLen returns the on-disk sample size for a version and sensor
+// count; cells are the version 4 cell types.
+func mmcdSampleLen(version byte, sensorCount int, cells []byte) (int, error) {
+	switch version {
+	case mmcdVersionV1:
+		return mmcdSampleSize, nil
+	case mmcdVersionV2, mmcdVersionV3:
+		return mmcdSampleSize + 4*sensorCount, nil
+	case mmcdVersion:
+		n := 8 + (sensorCount+7)/8 + 4*sensorCount
+		for i, cell := range cells {
+			size := cellSize(cell)
+			if size == 0 {
+				return 0, fmt.Errorf("unknown cell type %d for sensor %d", cell, i)
+			}
+			n += size
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unsupported .mmcd version %d", version)
+	}
+}
+
+// timeZone returns the IANA name of the local zone, or "" if it is not known.
+func timeZone() string {
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	return ""
+}
+
 // BinaryWriter writes sensor samples to our native .mmcd binary format.
 type BinaryWriter struct {
+	mu          sync.Mutex
 	file        *os.File
+	indices     []int
+	cells       []byte // cell type per index
+	sampleLen   int
 	sampleCount uint32
+	syncEvery   time.Duration // checkpoint interval
+	synced      time.Time     // last checkpoint
 }
 
 // NewBinaryWriter creates a new .mmcd binary log file.
 func NewBinaryWriter(filename string, indices []int, units sensor.UnitSystem) (*BinaryWriter, error) {
+	return NewBinaryWriterWithOptions(filename, indices, units, BinaryOptions{})
+}
+
+// NewBinaryWriterWithOptions creates a .mmcd binary log with optional header fields.
+func NewBinaryWriterWithOptions(filename string, indices []int, units sensor.UnitSystem, opts BinaryOptions) (*BinaryWriter, error) {
+	for _, idx := range indices {
+		if idx < 0 || idx >= sensor.MaxChannels {
+			return nil, fmt.Errorf("sensor index %d out of range 0-%d", idx, sensor.MaxChannels-1)
+		}
+	}
+
+	cells := make([]byte, len(indices))
+	for i, idx := range indices {
+		cells[i] = cellWord
+		if idx < len(opts.Defs) && (opts.Defs[idx].IsExpr() || opts.Defs[idx].IsInput()) {
+			cells[i] = cellFloat
+		}
+	}
+	meta, err := json.Marshal(LogMeta{
+		Software: version.Version,
+		Vehicle:  opts.Vehicle,
+		Notes:    opts.Notes,
+		Started:  time.Now(),
+		TimeZone: timeZone(),
+		Channels: sensor.SchemaOf(opts.Defs, indices),
+		Extra:    opts.Extra,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode log metadata: %w", err)
+	}
+	sampleLen, err := mmcdSampleLen(mmcdVersion, len(indices), cells)
+	if err != nil {
+		return nil, err
+	}
+
 	f, err := os.Create(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create binary log %s: %w", filename, err)
@@ -63,7 +250,8 @@ func NewBinaryWriter(filename string, indices []int, units sensor.UnitSystem) (*
 	header[5] = byte(units)
 	binary.LittleEndian.PutUint16(header[6:8], uint16(len(indices)))
 	binary.LittleEndian.PutUint32(header[8:12], 0) // sample count placeholder
-	// header[12:16] reserved
+	header[mmcdVehicleOffset] = vehicleCode(opts.Vehicle)
+	// header[13:16] reserved
 
 	if _, err := f.Write(header); err != nil {
 		f.Close()
@@ -80,57 +268,213 @@ func NewBinaryWriter(filename string, indices []int, units sensor.UnitSystem) (*
 		return nil, fmt.Errorf("failed to write index table: %w", err)
 	}
 
-	return &BinaryWriter{file: f}, nil
+	unitTable := make([]byte, len(indices))
+	for i, idx := range indices {
+		if idx < len(opts.Defs) {
+			unitTable[i] = opts.Defs[idx].UnitCode(units)
+		}
+	}
+	if _, err := f.Write(unitTable); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write unit table: %w", err)
+	}
+
+	metaBlock := make([]byte, 4, 4+len(meta))
+	binary.LittleEndian.PutUint32(metaBlock, uint32(len(meta)))
+	metaBlock = append(metaBlock, meta...)
+	if _, err := f.Write(append(cells, metaBlock...)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to sync binary log: %w", err)
+	}
+
+	return &BinaryWriter{
+		file:      f,
+		indices:   indices,
+		cells:     cells,
+		sampleLen: sampleLen,
+		syncEvery: mmcdSyncInterval,
+		synced:    time.Now(),
+	}, nil
 }
 
 // WriteSample appends a sample to the binary log.
 func (bw *BinaryWriter) WriteSample(sample sensor.Sample) error {
-	buf := make([]byte, mmcdSampleSize)
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	buf := make([]byte, bw.sampleLen)
 	binary.LittleEndian.PutUint64(buf[0:8], uint64(sample.Time.UnixNano()))
-	binary.LittleEndian.PutUint32(buf[8:12], sample.DataPresent)
-	// buf[12:16] padding
-	copy(buf[16:48], sample.RawData[:])
+	present := buf[8 : 8+(len(bw.indices)+7)/8]
+	pos := 8 + len(present)
+	for i, idx := range bw.indices {
+		has := sample.HasData(idx)
+		if has {
+			present[i/8] |= 1 << (i % 8)
+		}
+		switch bw.cells[i] {
+		case cellFloat:
+			if has {
+				binary.LittleEndian.PutUint64(buf[pos:], math.Float64bits(sample.Float(idx)))
+			}
+		default:
+			if has && sample.IsFloat(idx) {
+				// A raw cell would silently hold 0; the log needs the
+				// channel's definition (BinaryOptions.Defs) to store it
+				return fmt.Errorf("channel %d holds a float value, which this log stores as a raw word", idx)
+			}
+			binary.LittleEndian.PutUint16(buf[pos:], sample.Word(idx))
+		}
+		pos += cellSize(bw.cells[i])
+	}
+	for _, idx := range bw.indices {
+		us := sample.Offset(idx).Microseconds()
+		if us < 0 {
+			us = 0
+		}
+		binary.LittleEndian.PutUint32(buf[pos:], uint32(us))
+		pos += 4
+	}
 
 	if _, err := bw.file.Write(buf); err != nil {
 		return fmt.Errorf("failed to write sample: %w", err)
 	}
 	bw.sampleCount++
+	if time.Since(bw.synced) >= bw.syncEvery {
+		return bw.checkpoint()
+	}
+	return nil
+}
+
+// checkpoint syncs the samples written so far to disk, then records their
+// count in the header. Should power fail, the log is then readable up to
+// the last checkpoint at least.
+func (bw *BinaryWriter) checkpoint() error {
+	if err := bw.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync binary log: %w", err)
+	}
+	countBuf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(countBuf, bw.sampleCount)
+	if _, err := bw.file.WriteAt(countBuf, 8); err != nil {
+		return fmt.Errorf("failed to update sample count: %w", err)
+	}
+	bw.synced = time.Now()
 	return nil
 }
 
 // Close finalizes the binary log, updating the sample count in the header.
 func (bw *BinaryWriter) Close() error {
-	// Update sample count in header
-	if _, err := bw.file.Seek(8, io.SeekStart); err == nil {
-		countBuf := make([]byte, 4)
-		binary.LittleEndian.PutUint32(countBuf, bw.sampleCount)
-		bw.file.Write(countBuf)
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+
+	err := bw.checkpoint()
+	if err == nil {
+		err = bw.file.Sync()
 	}
-	return bw.file.Close()
+	if cerr := bw.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
 
 // Count returns the number of samples written.
-func (bw *BinaryWriter) Count() uint32 {
-	return bw.sampleCount
+func (bw *BinaryWriter) Count() int {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return int(bw.sampleCount)
 }
 
-// BinaryLog represents a parsed .mmcd binary log.
-type BinaryLog struct {
+// BinaryHeader holds what a .mmcd log records before its samples.
+type BinaryHeader struct {
 	Version     byte
 	Units       sensor.UnitSystem
+	Vehicle     string // vehicle ID from the header; "" if not recorded
 	Indices     []int
-	SampleCount uint32
-	Samples     []sensor.Sample
+	UnitCodes   []byte   // display unit code per entry of Indices; nil before version 3
+	Meta        *LogMeta // metadata block; nil before version 4
+	SampleCount uint32   // sample count from the header, see Recovery
+
+	// Recovery reports what was wrong with a log that was not closed
+	// cleanly; nil if it was.
+	Recovery *Recovery
 }
 
-// ReadBinaryLog reads a .mmcd binary log file.
-func ReadBinaryLog(filename string) (*BinaryLog, error) {
+// BinaryLog represents a parsed .mmcd binary log.
+type BinaryLog struct {
+	BinaryHeader
+	Samples []sensor.Sample
+}
+
+// Recovery describes a .mmcd log that was not closed cleanly, such as one
+// cut short by a power loss.
+type Recovery struct {
+	HeaderCount  uint32 // samples the header records as of the last checkpoint
+	Samples      int    // complete samples recovered
+	DroppedBytes int64  // bytes after the last complete sample: a torn sample or zero-filled blocks
+}
+
+// Unclosed reports whether the writer did not get to Close the log.
+func (r *Recovery) Unclosed() bool {
+	return int(r.HeaderCount) < r.Samples
+}
+
+// Missing returns the number of samples the header records that are not
+// in the file, lost after the writer's last checkpoint reached the disk.
+func (r *Recovery) Missing() int {
+	return max(int(r.HeaderCount)-r.Samples, 0)
+}
+
+// String summarizes what was recovered and what was lost.
+func (r *Recovery) String() string {
+	msg := fmt.Sprintf("recovered %d samples", r.Samples)
+	if r.Unclosed() {
+		msg += fmt.Sprintf("; the log was not closed (header records %d)", r.HeaderCount)
+	}
+	if n := r.Missing(); n > 0 {
+		msg += fmt.Sprintf("; %d samples recorded in the header are missing", n)
+	}
+	if r.DroppedBytes > 0 {
+		msg += fmt.Sprintf("; dropped %d bytes of incomplete data after the last complete sample", r.DroppedBytes)
+	}
+	return msg
+}
+
+// BinaryReader reads the samples of a .mmcd log one at a time, and can
+// seek to a time, so long logs need not be held in memory.
+type BinaryReader struct {
+	BinaryHeader
+
+	file       *os.File
+	r          *bufio.Reader
+	buf        []byte
+	cells      []byte // version 4 cell type per index
+	dataOffset int64  // file offset of the first sample
+	sampleLen  int
+	n          int // complete samples in the file
+	pos        int // next sample Next returns
+}
+
+// OpenBinaryLog opens a .mmcd binary log of any version for reading. A log
+// that was not closed cleanly is read up to its last complete sample and
+// described by the header's Recovery.
+func OpenBinaryLog(filename string) (*BinaryReader, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open binary log: %w", err)
 	}
-	defer f.Close()
+	br, err := newBinaryReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return br, nil
+}
 
+func newBinaryReader(f *os.File) (*BinaryReader, error) {
 	// Read header
 	header := make([]byte, mmcdHeaderSize)
 	if _, err := io.ReadFull(f, header); err != nil {
@@ -141,10 +485,13 @@ func ReadBinaryLog(filename string) (*BinaryLog, error) {
 		return nil, fmt.Errorf("not an MMCD binary log (bad magic)")
 	}
 
-	log := &BinaryLog{
-		Version:     header[4],
-		Units:       sensor.UnitSystem(header[5]),
-		SampleCount: binary.LittleEndian.Uint32(header[8:12]),
+	br := &BinaryReader{file: f}
+	br.Version = header[4]
+	br.Units = sensor.UnitSystem(header[5])
+	br.Vehicle = vehicleID(header[mmcdVehicleOffset])
+	br.SampleCount = binary.LittleEndian.Uint32(header[8:12])
+	if br.Version < mmcdVersionV1 || br.Version > mmcdVersion {
+		return nil, fmt.Errorf("unsupported .mmcd version %d", br.Version)
 	}
 
 	sensorCount := binary.LittleEndian.Uint16(header[6:8])
@@ -154,31 +501,291 @@ func ReadBinaryLog(filename string) (*BinaryLog, error) {
 	if _, err := io.ReadFull(f, indexTable); err != nil {
 		return nil, fmt.Errorf("failed to read index table: %w", err)
 	}
-	log.Indices = make([]int, sensorCount)
+	br.Indices = make([]int, sensorCount)
 	for i, b := range indexTable {
-		log.Indices[i] = int(b)
+		br.Indices[i] = int(b)
+	}
+	if br.Version >= mmcdVersionV3 {
+		br.UnitCodes = make([]byte, sensorCount)
+		if _, err := io.ReadFull(f, br.UnitCodes); err != nil {
+			return nil, fmt.Errorf("failed to read unit table: %w", err)
+		}
+	}
+	var err error
+	if br.Version >= mmcdVersion {
+		if br.cells, br.Meta, err = readMeta(f, int(sensorCount)); err != nil {
+			return nil, err
+		}
+	}
+	if br.sampleLen, err = mmcdSampleLen(br.Version, int(sensorCount), br.cells); err != nil {
+		return nil, err
+	}
+	if br.dataOffset, err = f.Seek(0, io.SeekCurrent); err != nil {
+		return nil, fmt.Errorf("failed to read samples: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read samples: %w", err)
 	}
 
-	// Read samples
-	log.Samples = make([]sensor.Sample, 0, log.SampleCount)
-	buf := make([]byte, mmcdSampleSize)
-	for {
-		_, err := io.ReadFull(f, buf)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
+	// Samples end at a torn last one or at zero-filled blocks, which a
+	// power loss can leave at the end of the file
+	br.buf = make([]byte, br.sampleLen)
+	br.n = int((info.Size() - br.dataOffset) / int64(br.sampleLen))
+	for br.n > 0 {
+		if _, err := f.ReadAt(br.buf, br.offset(br.n-1)); err != nil {
+			return nil, fmt.Errorf("failed to read sample: %w", err)
+		}
+		if !allZero(br.buf) {
 			break
 		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to read sample: %w", err)
+		br.n--
+	}
+	dropped := info.Size() - br.offset(br.n)
+	if int(br.SampleCount) != br.n || dropped != 0 {
+		br.Recovery = &Recovery{HeaderCount: br.SampleCount, Samples: br.n, DroppedBytes: dropped}
+	}
+	br.r = bufio.NewReader(f)
+	return br, nil
+}
+
+// offset returns the file offset of sample i.
+func (br *BinaryReader) offset(i int) int64 {
+	return br.dataOffset + int64(i)*int64(br.sampleLen)
+}
+
+// Len returns the number of complete samples in the log.
+func (br *BinaryReader) Len() int {
+	return br.n
+}
+
+// Next returns the next sample, or io.EOF after the last one.
+func (br *BinaryReader) Next() (sensor.Sample, error) {
+	for br.pos < br.n {
+		if _, err := io.ReadFull(br.r, br.buf); err != nil {
+			return sensor.Sample{}, fmt.Errorf("failed to read sample: %w", err)
 		}
+		br.pos++
+		if allZero(br.buf) {
+			continue // a block lost mid-file
+		}
+		if br.Version >= mmcdVersion {
+			return decodeCells(br.buf, br.Indices, br.cells), nil
+		}
+		return decodeSlots(br.buf, br.Version, br.Indices), nil
+	}
+	return sensor.Sample{}, io.EOF
+}
+
+// SeekSample positions the reader so that Next returns sample i.
+func (br *BinaryReader) SeekSample(i int) error {
+	if i < 0 || i > br.n {
+		return fmt.Errorf("sample %d out of range 0-%d", i, br.n)
+	}
+	if _, err := br.file.Seek(br.offset(i), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek: %w", err)
+	}
+	br.r.Reset(br.file)
+	br.pos = i
+	return nil
+}
 
-		unixNano := int64(binary.LittleEndian.Uint64(buf[0:8]))
-		sample := sensor.Sample{
-			Time:        time.Unix(0, unixNano),
-			DataPresent: binary.LittleEndian.Uint32(buf[8:12]),
+// Seek positions the reader at the first sample taken at or after t, by a
+// binary search over the sample times. Seeking past the end makes Next
+// return io.EOF.
+func (br *BinaryReader) Seek(t time.Time) error {
+	want := t.UnixNano()
+	var stamp [8]byte
+	var err error
+	i := sort.Search(br.n, func(i int) bool {
+		if _, rerr := br.file.ReadAt(stamp[:], br.offset(i)); rerr != nil {
+			err = rerr
+			return true
 		}
-		copy(sample.RawData[:], buf[16:48])
-		log.Samples = append(log.Samples, sample)
+		return int64(binary.LittleEndian.Uint64(stamp[:])) >= want
+	})
+	if err != nil {
+		return fmt.Errorf("failed to seek: %w", err)
 	}
+	return br.SeekSample(i)
+}
+
+// Close closes the log file.
+func (br *BinaryReader) Close() error {
+	return br.file.Close()
+}
 
-	return log, nil
+// ReadBinaryLog reads a .mmcd binary log file of any version into memory;
+// see OpenBinaryLog to stream it instead.
+func ReadBinaryLog(filename string) (*BinaryLog, error) {
+	br, err := OpenBinaryLog(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer br.Close()
+
+	samples, err := ReadAllSamples(br)
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryLog{BinaryHeader: br.BinaryHeader, Samples: samples}, nil
+}
+
+// allZero reports whether b holds only zero bytes.
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RepairBinaryLog rewrites a .mmcd log that was not closed cleanly so that
+// it ends after its last complete sample and its header records the
+// samples it holds. The repaired log is written to output, or over
+// filename if output is empty. It returns what was recovered and lost; nil
+// if the log was closed cleanly, in which case filename is left as is.
+func RepairBinaryLog(filename, output string) (*Recovery, error) {
+	br, err := OpenBinaryLog(filename)
+	if err != nil {
+		return nil, err
+	}
+	br.Close()
+	if output == "" {
+		output = filename
+	}
+	if br.Recovery == nil && output == filename {
+		return nil, nil
+	}
+
+	end := br.offset(br.n)
+	var f *os.File
+	if output == filename {
+		if f, err = os.OpenFile(filename, os.O_RDWR, 0); err != nil {
+			return nil, fmt.Errorf("failed to open binary log: %w", err)
+		}
+		err = f.Truncate(end)
+	} else {
+		if f, err = os.Create(output); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		err = copyPrefix(f, filename, end)
+	}
+	if err == nil {
+		countBuf := make([]byte, 4)
+		binary.LittleEndian.PutUint32(countBuf, uint32(br.n))
+		_, err = f.WriteAt(countBuf, 8)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to repair %s: %w", output, err)
+	}
+	return br.Recovery, nil
+}
+
+// copyPrefix copies the first n bytes of the file src to w.
+func copyPrefix(w io.Writer, src string, n int64) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(w, f, n)
+	return err
+}
+
+// readMeta reads the version 4 cell table and metadata block.
+func readMeta(r io.Reader, sensorCount int) ([]byte, *LogMeta, error) {
+	cells := make([]byte, sensorCount+4)
+	if _, err := io.ReadFull(r, cells); err != nil {
+		return nil, nil, fmt.Errorf("failed to read cell table: %w", err)
+	}
+	n := binary.LittleEndian.Uint32(cells[sensorCount:])
+	if n > mmcdMaxMeta {
+		return nil, nil, fmt.Errorf("metadata block of %d bytes is too large", n)
+	}
+	raw := make([]byte, n)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	meta := new(LogMeta)
+	if err := json.Unmarshal(raw, meta); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse metadata: %w", err)
+	}
+	return cells[:sensorCount], meta, nil
+}
+
+// decodeSlots decodes a version 1-3 sample.
+func decodeSlots(buf []byte, version byte, indices []int) sensor.Sample {
+	unixNano := int64(binary.LittleEndian.Uint64(buf[0:8]))
+	sample := sensor.Sample{Time: time.Unix(0, unixNano)}
+	var raw [sensor.MaxSensors]byte
+	copy(raw[:], buf[16:48])
+	sample.SetSlots(binary.LittleEndian.Uint32(buf[8:12]), raw)
+	if version >= mmcdVersionV2 {
+		for i, idx := range indices {
+			if sample.HasData(idx) {
+				us := binary.LittleEndian.Uint32(buf[mmcdSampleSize+4*i:])
+				sample.SetOffset(idx, time.Duration(us)*time.Microsecond)
+			}
+		}
+	}
+	return sample
+}
+
+// decodeCells decodes a version 4 sample.
+func decodeCells(buf []byte, indices []int, cells []byte) sensor.Sample {
+	unixNano := int64(binary.LittleEndian.Uint64(buf[0:8]))
+	sample := sensor.Sample{Time: time.Unix(0, unixNano)}
+	present := buf[8 : 8+(len(indices)+7)/8]
+	pos := 8 + len(present)
+	offsets := len(buf) - 4*len(indices)
+	for i, idx := range indices {
+		if present[i/8]&(1<<(i%8)) != 0 {
+			switch cells[i] {
+			case cellFloat:
+				sample.SetValue(idx, math.Float64frombits(binary.LittleEndian.Uint64(buf[pos:])))
+			default:
+				sample.SetWord(idx, binary.LittleEndian.Uint16(buf[pos:]))
+			}
+			us := binary.LittleEndian.Uint32(buf[offsets+4*i:])
+			sample.SetOffset(idx, time.Duration(us)*time.Microsecond)
+		}
+		pos += cellSize(cells[i])
+	}
+	return sample
+}
+
+// Definitions returns defs with each logged sensor defined as it was when
+// the log was written (version 4 logs record the channel schema) and shown
+// in the unit it was recorded in, so values read back match what was
+// displayed. Sensors without a recorded unit keep their current display
+// unit.
+func (l *BinaryHeader) Definitions(defs []sensor.Definition) []sensor.Definition {
+	out := make([]sensor.Definition, len(defs))
+	copy(out, defs)
+	if l.Meta != nil && len(l.Meta.Channels) > 0 {
+		if recorded, err := sensor.ApplySchema(out, l.Meta.Channels); err == nil {
+			out = recorded
+		} else {
+			slog.Warn("log channel schema does not apply; using current sensor definitions", "error", err)
+		}
+	}
+	for i, code := range l.UnitCodes {
+		idx := l.Indices[i]
+		if code == 0 || idx >= len(out) {
+			continue
+		}
+		if u, ok := sensor.UnitByCode(code); ok {
+			// A sensor redefined since with another quantity keeps its unit
+			_ = out[idx].SetDisplayUnit(u.Name)
+		}
+	}
+	return out
 }
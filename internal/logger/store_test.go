@@ -1,7 +1,11 @@
 package logger
 
 import (
+	"encoding/binary"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,23 +32,14 @@ func TestBinaryLogRoundTrip(t *testing.T) {
 	}
 
 	now := time.Now()
-	samples := []sensor.Sample{
-		{Time: now, DataPresent: 0x00060010, RawData: func() [32]byte {
-			var d [32]byte
-			d[4] = 0x80  // COOL raw
-			d[17] = 0x40 // RPM raw = 64 → 2000rpm
-			d[19] = 0x20 // INJP raw
-			return d
-		}()},
-		{Time: now.Add(100 * time.Millisecond), DataPresent: 0x00064010, RawData: func() [32]byte {
-			var d [32]byte
-			d[4] = 0x82
-			d[14] = 0x80 // TPS raw
-			d[17] = 0x42
-			d[19] = 0x22
-			return d
-		}()},
-	}
+	samples := []sensor.Sample{{Time: now}, {Time: now.Add(100 * time.Millisecond)}}
+	samples[0].SetData(4, 0x80)  // COOL raw
+	samples[0].SetData(17, 0x40) // RPM raw = 64 → 2000rpm
+	samples[0].SetData(19, 0x20) // INJP raw
+	samples[1].SetData(4, 0x82)
+	samples[1].SetData(14, 0x80) // TPS raw
+	samples[1].SetData(17, 0x42)
+	samples[1].SetData(19, 0x22)
 
 	for _, s := range samples {
 		s.ComputeDerivatives(defs)
@@ -86,11 +81,11 @@ func TestBinaryLogRoundTrip(t *testing.T) {
 
 	// Verify first sample data
 	s := log.Samples[0]
-	if s.RawData[17] != 0x40 {
-		t.Errorf("Sample[0].RawData[17] = 0x%02X, want 0x40", s.RawData[17])
+	if s.Raw(17) != 0x40 {
+		t.Errorf("Sample[0].Raw(17) = 0x%02X, want 0x40", s.Raw(17))
 	}
-	if s.RawData[4] != 0x80 {
-		t.Errorf("Sample[0].RawData[4] = 0x%02X, want 0x80", s.RawData[4])
+	if s.Raw(4) != 0x80 {
+		t.Errorf("Sample[0].Raw(4) = 0x%02X, want 0x80", s.Raw(4))
 	}
 
 	// Verify time is preserved (within 1ms due to nanosecond truncation)
@@ -114,3 +109,396 @@ func TestBinaryLogInvalidFile(t *testing.T) {
 		t.Error("Expected error reading invalid binary log")
 	}
 }
+
+func TestBinaryLogVersion4(t *testing.T) {
+	addr, scale := sensor.Addr(0x4A), 0.1
+	defs, err := sensor.ApplyProfile(sensor.DefaultDefinitions(), &sensor.Profile{Sensors: []sensor.ProfileSensor{
+		{Slug: "AFCNT", Addr: &addr, Size: 2, Unit: "g", Convert: &sensor.Conversion{Kind: sensor.KindLinear, Scale: &scale}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fill the custom slots so the GPS channels land past the 32-slot layout
+	af, _ := sensor.FindBySlug(defs, "AFCNT")
+	for i := af + 1; i < sensor.MaxSensors; i++ {
+		defs[i] = sensor.Definition{Slug: fmt.Sprintf("PAD%d", i), Exists: true, Computed: true}
+	}
+	defs, gps, err := sensor.AddGPS(defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indices := append([]int{17, af}, gps.Indices()...)
+	if gps.Fix < sensor.MaxSensors {
+		t.Fatalf("GFIX at %d, want an index past %d", gps.Fix, sensor.MaxSensors-1)
+	}
+
+	path := filepath.Join(t.TempDir(), "v4.mmcd")
+	w, err := NewLogWriter(path, defs, indices, sensor.UnitMetric, WriterOptions{Vehicle: "3000gt", Notes: "dyno pull 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.(*BinaryWriter); !ok {
+		t.Fatalf("NewLogWriter(.mmcd) = %T, want a BinaryWriter", w)
+	}
+	start := time.Now()
+	s := sensor.Sample{Time: start}
+	s.SetDataAt(17, 0x40, start.Add(5*time.Millisecond))
+	s.SetWordAt(af, 0x1234, start.Add(9*time.Millisecond))
+	s.SetValue(gps.Lat, 47.2545123)
+	s.SetValue(gps.Fix, 1)
+	if err := w.WriteSample(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSample(sensor.Sample{Time: start.Add(100 * time.Millisecond)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != 4 || len(log.Samples) != 2 || log.SampleCount != 2 {
+		t.Fatalf("version %d, %d samples (header %d)", log.Version, len(log.Samples), log.SampleCount)
+	}
+	got := log.Samples[0]
+	if got.Word(af) != 0x1234 || got.Raw(17) != 0x40 || got.Float(gps.Lat) != 47.2545123 || !got.IsFloat(gps.Fix) {
+		t.Errorf("sample 0: AFCNT 0x%04X, RPM 0x%02X, GLAT %v", got.Word(af), got.Raw(17), got.Float(gps.Lat))
+	}
+	if got.Offset(af) != 9*time.Millisecond || got.HasData(gps.Speed) {
+		t.Errorf("AFCNT offset %v, GSPD present %v", got.Offset(af), got.HasData(gps.Speed))
+	}
+	if next := log.Samples[1]; len(next.Indices()) != 0 {
+		t.Errorf("empty sample read back with channels %v", next.Indices())
+	}
+
+	m := log.Meta
+	if m == nil {
+		t.Fatal("no metadata")
+	}
+	if m.Vehicle != "3000gt" || m.Notes != "dyno pull 3" || m.Software == "" || m.Started.Before(start.Add(-time.Minute)) {
+		t.Errorf("metadata = %+v", m)
+	}
+	if len(m.Channels) != len(indices) || m.Channels[1].Slug != "AFCNT" || m.Channels[1].Convert == nil {
+		t.Fatalf("channels = %+v", m.Channels)
+	}
+
+	// Read back with a table that no longer has AFCNT: the recorded schema
+	// still converts it
+	read := log.Definitions(sensor.DefaultDefinitions())
+	if got := got.Formatted(read, af, log.Units); got != "466.0g" {
+		t.Errorf("AFCNT read back = %q, want 466.0g", got)
+	}
+	if got := got.Formatted(read, gps.Lat, log.Units); got != "47.254512°" {
+		t.Errorf("GLAT read back = %q", got)
+	}
+}
+
+func TestBinaryLogReadsVersion2(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v2.mmcd")
+
+	// Hand-built v2 file: header, index table (no unit table), one sample
+	// with channel times
+	buf := make([]byte, mmcdHeaderSize)
+	copy(buf[0:4], mmcdMagic)
+	buf[4] = mmcdVersionV2
+	binary.LittleEndian.PutUint16(buf[6:8], 2)
+	binary.LittleEndian.PutUint32(buf[8:12], 1)
+	buf = append(buf, 14, 17) // index table
+	sample := make([]byte, mmcdSampleSize+8)
+	binary.LittleEndian.PutUint64(sample[0:8], uint64(time.Unix(1000, 0).UnixNano()))
+	binary.LittleEndian.PutUint32(sample[8:12], 1<<14|1<<17)
+	sample[16+14] = 0x80
+	sample[16+17] = 0x40
+	binary.LittleEndian.PutUint32(sample[mmcdSampleSize:], 12000)
+	binary.LittleEndian.PutUint32(sample[mmcdSampleSize+4:], 27000)
+	buf = append(buf, sample...)
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatalf("ReadBinaryLog(v2) failed: %v", err)
+	}
+	if log.Meta != nil || len(log.Samples) != 1 || log.Samples[0].Raw(17) != 0x40 {
+		t.Fatalf("v2 log = %+v", log)
+	}
+	if got := log.Samples[0].Offset(14); got != 12*time.Millisecond {
+		t.Errorf("TPS offset = %v, want 12ms", got)
+	}
+}
+
+func TestBinaryLogReadsVersion3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v3.mmcd")
+
+	// Hand-built v3 file: header, index and unit tables, one sample with
+	// channel times
+	buf := make([]byte, mmcdHeaderSize)
+	copy(buf[0:4], mmcdMagic)
+	buf[4] = mmcdVersionV3
+	binary.LittleEndian.PutUint16(buf[6:8], 2)
+	binary.LittleEndian.PutUint32(buf[8:12], 1)
+	buf = append(buf, 14, 17) // index table
+	buf = append(buf, 0, 0)   // unit table
+	sample := make([]byte, mmcdSampleSize+8)
+	binary.LittleEndian.PutUint64(sample[0:8], uint64(time.Unix(1000, 0).UnixNano()))
+	binary.LittleEndian.PutUint32(sample[8:12], 1<<14|1<<17)
+	sample[16+14] = 0x80
+	sample[16+17] = 0x40
+	binary.LittleEndian.PutUint32(sample[mmcdSampleSize+4:], 27000)
+	buf = append(buf, sample...)
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatalf("ReadBinaryLog(v3) failed: %v", err)
+	}
+	if log.Meta != nil || len(log.Samples) != 1 || log.Samples[0].Raw(14) != 0x80 {
+		t.Fatalf("v3 log = %+v", log)
+	}
+	if got := log.Samples[0].Offset(17); got != 27*time.Millisecond {
+		t.Errorf("RPM offset = %v, want 27ms", got)
+	}
+}
+
+func TestBinaryLogChannelTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "times.mmcd")
+	indices := []int{14, 17}
+
+	w, err := NewBinaryWriter(path, indices, sensor.UnitMetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	s := sensor.Sample{Time: start}
+	s.SetDataAt(14, 0x80, start.Add(12*time.Millisecond))
+	s.SetDataAt(17, 0x40, start.Add(27*time.Millisecond))
+	if err := w.WriteSample(s); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatalf("ReadBinaryLog failed: %v", err)
+	}
+	if log.Version < 2 {
+		t.Errorf("Version = %d, want per-channel times (2+)", log.Version)
+	}
+	got := log.Samples[0]
+	if got.Offset(14) != 12*time.Millisecond || got.Offset(17) != 27*time.Millisecond {
+		t.Errorf("offsets TPS=%s RPM=%s, want 12ms/27ms", got.Offset(14), got.Offset(17))
+	}
+}
+
+func TestBinaryLogReadsVersion1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "v1.mmcd")
+
+	// Hand-built v1 file: header, 2-entry index table, one 48-byte sample
+	buf := make([]byte, mmcdHeaderSize)
+	copy(buf[0:4], mmcdMagic)
+	buf[4] = mmcdVersionV1
+	binary.LittleEndian.PutUint16(buf[6:8], 2)
+	binary.LittleEndian.PutUint32(buf[8:12], 1)
+	buf = append(buf, 14, 17)
+	sample := make([]byte, mmcdSampleSize)
+	binary.LittleEndian.PutUint64(sample[0:8], uint64(time.Unix(1000, 0).UnixNano()))
+	binary.LittleEndian.PutUint32(sample[8:12], 1<<14|1<<17)
+	sample[16+14] = 0x80
+	sample[16+17] = 0x40
+	buf = append(buf, sample...)
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatalf("ReadBinaryLog(v1) failed: %v", err)
+	}
+	if len(log.Samples) != 1 || log.Samples[0].Raw(17) != 0x40 {
+		t.Fatalf("v1 samples = %+v", log.Samples)
+	}
+	if log.Samples[0].HasOffsets() {
+		t.Error("v1 samples should have no channel offsets")
+	}
+}
+
+func TestBinaryLogVehicle(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"3000gt", ""} {
+		path := filepath.Join(dir, "v"+id+".mmcd")
+		w, err := NewBinaryWriterWithOptions(path, []int{17}, sensor.UnitMetric, BinaryOptions{Vehicle: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+
+		log, err := ReadBinaryLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if log.Vehicle != id {
+			t.Errorf("Vehicle = %q, want %q", log.Vehicle, id)
+		}
+		if l, err := Open(path, sensor.DefaultDefinitions()); err != nil || l.Vehicle != id {
+			t.Errorf("Open: log %+v, error %v, want vehicle %q", l, err, id)
+		}
+	}
+}
+
+func TestBinaryLogRefusesFloatInRawCell(t *testing.T) {
+	defs, gps, err := sensor.AddGPS(sensor.DefaultDefinitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s sensor.Sample
+	s.Time = time.Now()
+	s.SetValue(gps.Speed, 88.5)
+
+	// Without definitions GSPD gets a raw cell, which cannot hold it
+	path := filepath.Join(t.TempDir(), "nodefs.mmcd")
+	w, err := NewBinaryWriter(path, []int{gps.Speed}, sensor.UnitMetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSample(s); err == nil {
+		t.Error("WriteSample stored a float channel in a raw cell")
+	}
+	w.Close()
+
+	path = filepath.Join(t.TempDir(), "defs.mmcd")
+	w, err = NewBinaryWriterWithOptions(path, []int{gps.Speed}, sensor.UnitMetric, BinaryOptions{Defs: defs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSample(s); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := log.Samples[0].Float(gps.Speed); got != 88.5 {
+		t.Errorf("GSPD read back = %g, want 88.5", got)
+	}
+}
+
+func TestBinaryLogUnits(t *testing.T) {
+	defs, err := sensor.ApplyUnits(sensor.DefaultDefinitions(), map[string]string{"BARO": "inHg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "units.mmcd")
+	w, err := NewBinaryWriterWithOptions(path, []int{4, 12, 17}, sensor.UnitEnglish, BinaryOptions{Defs: defs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sensor.Sample{Time: time.Now()}
+	s.SetData(12, 208)
+	w.WriteSample(s)
+	w.Close()
+
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	degF, _ := sensor.LookupUnit("F")
+	inHg, _ := sensor.LookupUnit("inHg")
+	if want := []byte{degF.Code, inHg.Code, 0}; string(log.UnitCodes) != string(want) {
+		t.Errorf("UnitCodes = %v, want %v", log.UnitCodes, want)
+	}
+
+	// Read back with the default table: BARO shows in the recorded inHg
+	read := log.Definitions(sensor.DefaultDefinitions())
+	if got := log.Samples[0].Formatted(read, 12, log.Units); got != "29.85inHg" {
+		t.Errorf("BARO = %q, want 29.85inHg", got)
+	}
+}
+
+func TestBinaryLogRecovery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cut.mmcd")
+	w, err := NewBinaryWriter(path, []int{14, 17}, sensor.UnitMetric)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	written := 0
+	write := func(n int) {
+		for ; n > 0; n-- {
+			written++
+			s := sensor.Sample{Time: start.Add(time.Duration(written) * 100 * time.Millisecond)}
+			s.SetData(17, byte(written))
+			if err := w.WriteSample(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	w.syncEvery = 0 // checkpoint every sample
+	write(3)
+	w.syncEvery = time.Hour
+	write(2)
+
+	// Power lost: the file ends in zero-filled blocks and a torn sample
+	w.file.Write(make([]byte, 2*w.sampleLen))
+	w.file.Write([]byte{1, 2, 3})
+	w.file.Close()
+
+	log, err := ReadBinaryLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := log.Recovery
+	if len(log.Samples) != 5 || rec == nil || rec.HeaderCount != 3 || rec.Samples != 5 || !rec.Unclosed() {
+		t.Fatalf("%d samples, recovery %+v; want 5 samples past a checkpoint of 3", len(log.Samples), rec)
+	}
+	if want := int64(2*w.sampleLen + 3); rec.DroppedBytes != want {
+		t.Errorf("DroppedBytes = %d, want %d", rec.DroppedBytes, want)
+	}
+	if got := log.Samples[4].Raw(17); got != 5 {
+		t.Errorf("last sample RPM = %d, want 5", got)
+	}
+	if !strings.Contains(rec.String(), "not closed") {
+		t.Errorf("String() = %q", rec.String())
+	}
+
+	// Repair to a copy, then in place
+	fixed := filepath.Join(dir, "fixed.mmcd")
+	if rec, err := RepairBinaryLog(path, fixed); err != nil || rec == nil || rec.Samples != 5 {
+		t.Fatalf("RepairBinaryLog = %+v, %v", rec, err)
+	}
+	if _, err := RepairBinaryLog(path, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{fixed, path} {
+		log, err := ReadBinaryLog(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if log.Recovery != nil || len(log.Samples) != 5 || log.SampleCount != 5 {
+			t.Errorf("%s after repair: %d samples, header %d, recovery %+v", filepath.Base(p), len(log.Samples), log.SampleCount, log.Recovery)
+		}
+	}
+	if rec, err := RepairBinaryLog(path, ""); rec != nil || err != nil {
+		t.Errorf("repairing a clean log = %+v, %v; want nothing to do", rec, err)
+	}
+
+	// Samples the header counts that did not reach the disk are missing
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-int64(w.sampleLen)); err != nil {
+		t.Fatal(err)
+	}
+	log, err = ReadBinaryLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.Recovery == nil || log.Recovery.Missing() != 1 || log.Recovery.Unclosed() {
+		t.Errorf("recovery = %+v, want 1 missing sample", log.Recovery)
+	}
+}
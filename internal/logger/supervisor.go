@@ -0,0 +1,287 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// LinkState is the connection state reported by a Supervisor.
+type LinkState string
+
+const (
+	StateConnecting   LinkState = "connecting"   // opening the port for the first time
+	StateProbing      LinkState = "probing"      // port open, checking the ECU answers
+	StatePolling      LinkState = "polling"      // logging normally
+	StateDegraded     LinkState = "degraded"     // polling, but recent polls are failing
+	StateReconnecting LinkState = "reconnecting" // link lost, reopening the port
+	StateStopped      LinkState = "stopped"
+)
+
+// errLinkLost is reported when the logger watchdog gives up on the ECU.
+var errLinkLost = errors.New("ECU stopped responding")
+
+// Link is a connection the Supervisor can reopen and verify. protocol.ECU
+// implements it.
+type Link interface {
+	SamplePoller
+	Open() error
+	Close() error
+	Probe() error
+}
+
+// StateChange describes a Supervisor state transition.
+type StateChange struct {
+	State   LinkState `json:"state"`
+	Attempt int       `json:"attempt"`         // reconnect attempt, 0 on first connect
+	Error   string    `json:"error,omitempty"` // why the link left the previous state
+	Time    time.Time `json:"time"`
+}
+
+// StateCallback is called on each Supervisor state transition.
+type StateCallback func(change StateChange)
+
+// SupervisorConfig controls reconnect timing.
+type SupervisorConfig struct {
+	RetryInterval    time.Duration // first delay between reconnect attempts
+	MaxRetryInterval time.Duration // backoff cap
+	DegradedErrors   int           // consecutive poll errors before reporting degraded
+}
+
+// DefaultSupervisorConfig returns timings suited to an ignition cycle: the
+// ECU needs a second or two after key-on before it answers.
+func DefaultSupervisorConfig() SupervisorConfig {
+	return SupervisorConfig{
+		RetryInterval:    1 * time.Second,
+		MaxRetryInterval: 10 * time.Second,
+		DegradedErrors:   3,
+	}
+}
+
+// Supervisor owns the connect/probe/poll cycle of a Logger. When the logger
+// watchdog declares the ECU lost (ignition cycle, loose connector, unplugged
+// adapter) the supervisor closes and reopens the link, probes the ECU until
+// it answers, and restarts the same Logger, so callbacks registered on it —
+// including an open CSV or .mmcd writer — carry on where they left off.
+//
+// The Supervisor takes over the Logger's OnDisconnect callback.
+type Supervisor struct {
+	link Link
+	lg   *Logger
+	cfg  SupervisorConfig
+
+	mu         sync.Mutex
+	state      LinkState
+	cbs        []StateCallback
+	cancel     context.CancelFunc
+	running    bool
+	lost       chan struct{} // signalled by the logger watchdog
+	errStreak  int
+	reconnects int
+}
+
+// NewSupervisor creates a supervisor for lg polling over link.
+func NewSupervisor(link Link, lg *Logger, cfg SupervisorConfig) *Supervisor {
+	s := &Supervisor{
+		link:  link,
+		lg:    lg,
+		cfg:   cfg,
+		state: StateStopped,
+		lost:  make(chan struct{}, 1),
+	}
+	lg.OnDisconnect(func() {
+		select {
+		case s.lost <- struct{}{}:
+		default:
+		}
+	})
+	lg.OnError(s.pollFailed)
+	lg.OnSample(s.pollSucceeded)
+	return s
+}
+
+// OnStateChange registers a callback for state transitions.
+func (s *Supervisor) OnStateChange(cb StateCallback) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cbs = append(s.cbs, cb)
+}
+
+// State returns the current link state.
+func (s *Supervisor) State() LinkState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Reconnects returns how many times the link has been re-established.
+func (s *Supervisor) Reconnects() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reconnects
+}
+
+// Start runs the supervisor in a goroutine.
+func (s *Supervisor) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.running = true
+	s.mu.Unlock()
+
+	go s.run(ctx)
+}
+
+// Stop halts polling and any reconnect attempts. The link is left as is;
+// its owner closes it.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.cancel()
+	s.running = false
+	s.mu.Unlock()
+
+	s.lg.Stop()
+	s.setState(StateStopped, 0, nil)
+}
+
+// run is the connect → probe → poll → reconnect loop.
+func (s *Supervisor) run(ctx context.Context) {
+	attempt := 0
+	delay := s.cfg.RetryInterval
+	for {
+		if attempt == 0 {
+			s.setState(StateConnecting, 0, nil)
+		}
+
+		err := s.connect(ctx, attempt)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			attempt++
+			s.setState(StateReconnecting, attempt, err)
+			if !sleepCtx(ctx, delay) {
+				return
+			}
+			delay *= 2
+			if delay > s.cfg.MaxRetryInterval {
+				delay = s.cfg.MaxRetryInterval
+			}
+			continue
+		}
+
+		if attempt > 0 {
+			s.mu.Lock()
+			s.reconnects++
+			s.mu.Unlock()
+			slog.Info("supervisor: link re-established", "attempts", attempt)
+		}
+		attempt = 0
+		delay = s.cfg.RetryInterval
+		s.mu.Lock()
+		s.errStreak = 0
+		s.mu.Unlock()
+		s.setState(StatePolling, 0, nil)
+		s.lg.Start()
+		if ctx.Err() != nil {
+			s.lg.Stop()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.lost:
+			s.lg.Stop()
+			attempt = 1
+			s.setState(StateReconnecting, attempt, errLinkLost)
+			if !sleepCtx(ctx, delay) {
+				return
+			}
+		}
+	}
+}
+
+// connect (re)opens the link and probes the ECU.
+func (s *Supervisor) connect(ctx context.Context, attempt int) error {
+	if attempt > 0 {
+		s.link.Close()
+	}
+	if err := s.link.Open(); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.setState(StateProbing, attempt, nil)
+	return s.link.Probe()
+}
+
+// pollFailed and pollSucceeded move between polling and degraded.
+func (s *Supervisor) pollFailed(err error) {
+	s.mu.Lock()
+	s.errStreak++
+	degrade := s.state == StatePolling && s.errStreak >= s.cfg.DegradedErrors
+	s.mu.Unlock()
+	if degrade {
+		s.setState(StateDegraded, 0, err)
+	}
+}
+
+func (s *Supervisor) pollSucceeded(_ sensor.Sample) {
+	s.mu.Lock()
+	s.errStreak = 0
+	recovered := s.state == StateDegraded
+	s.mu.Unlock()
+	if recovered {
+		s.setState(StatePolling, 0, nil)
+	}
+}
+
+func (s *Supervisor) setState(state LinkState, attempt int, err error) {
+	change := StateChange{State: state, Attempt: attempt, Time: time.Now()}
+	if err != nil {
+		change.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	// Ignore late transitions from the run loop once stopped
+	if (!s.running && state != StateStopped) || (s.state == state && state != StateReconnecting) {
+		s.mu.Unlock()
+		return
+	}
+	s.state = state
+	cbs := make([]StateCallback, len(s.cbs))
+	copy(cbs, s.cbs)
+	s.mu.Unlock()
+
+	slog.Debug("link state", "state", state, "attempt", attempt, "error", change.Error)
+	for _, cb := range cbs {
+		cb(change)
+	}
+}
+
+// sleepCtx waits for d or until ctx is done. It reports whether ctx is
+// still live.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
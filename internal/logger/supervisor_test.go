@@ -0,0 +1,147 @@
+package logger
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// fakeLink is a Link whose ECU can be switched off and on, like an ignition
+// cycle.
+type fakeLink struct {
+	mu    sync.Mutex
+	alive bool
+	opens int
+}
+
+func (f *fakeLink) setAlive(v bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.alive = v
+}
+
+func (f *fakeLink) Open() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opens++
+	return nil
+}
+
+func (f *fakeLink) Close() error { return nil }
+
+func (f *fakeLink) Probe() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.alive {
+		return errors.New("no answer")
+	}
+	return nil
+}
+
+func (f *fakeLink) PollSensors(indices []int) (sensor.Sample, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := sensor.Sample{Time: time.Now()}
+	if !f.alive {
+		return s, errors.New("timeout")
+	}
+	for _, idx := range indices {
+		s.SetData(idx, 1)
+	}
+	return s, nil
+}
+
+func TestSupervisor_ReconnectsAfterIgnitionCycle(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	link := &fakeLink{}
+	lg := NewWithRate(link, defs, []int{17}, sensor.UnitMetric, time.Millisecond)
+
+	var mu sync.Mutex
+	samples := 0
+	lg.OnSample(func(sensor.Sample) {
+		mu.Lock()
+		samples++
+		mu.Unlock()
+	})
+	sampleCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return samples
+	}
+
+	sup := NewSupervisor(link, lg, SupervisorConfig{
+		RetryInterval:    5 * time.Millisecond,
+		MaxRetryInterval: 20 * time.Millisecond,
+		DegradedErrors:   3,
+	})
+	var states []LinkState
+	sup.OnStateChange(func(c StateChange) {
+		mu.Lock()
+		states = append(states, c.State)
+		mu.Unlock()
+	})
+	seen := func(want LinkState) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range states {
+			if s == want {
+				return true
+			}
+		}
+		return false
+	}
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s (states %v)", what, states)
+			}
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+
+	// Key off at start: the supervisor keeps probing
+	sup.Start()
+	defer sup.Stop()
+	waitFor("reconnecting", func() bool { return seen(StateReconnecting) })
+	if sampleCount() != 0 {
+		t.Fatal("got samples with the ECU off")
+	}
+
+	// Key on: polling begins
+	link.setAlive(true)
+	waitFor("first samples", func() bool { return sampleCount() > 5 })
+	if sup.State() != StatePolling {
+		t.Errorf("state = %s, want polling", sup.State())
+	}
+
+	// Ignition cycle: degraded, then lost, then back to polling
+	link.setAlive(false)
+	waitFor("degraded", func() bool { return seen(StateDegraded) })
+	waitFor("logger stopped", func() bool { return !lg.IsRunning() })
+	before := sampleCount()
+	link.setAlive(true)
+	waitFor("resumed samples", func() bool { return sampleCount() > before+5 })
+
+	if sup.Reconnects() < 1 {
+		t.Errorf("Reconnects() = %d, want at least 1", sup.Reconnects())
+	}
+	link.mu.Lock()
+	opens := link.opens
+	link.mu.Unlock()
+	if opens < 2 {
+		t.Errorf("link opened %d times, want a reopen after the dropout", opens)
+	}
+
+	sup.Stop()
+	if sup.State() != StateStopped {
+		t.Errorf("state after Stop = %s, want stopped", sup.State())
+	}
+	if lg.IsRunning() {
+		t.Error("logger still running after Stop")
+	}
+}
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// SampleWriter is a log file that samples are appended to: a CSVWriter, a
+// BinaryWriter, or an MSLWriter or MLGWriter for MegaLogViewer.
+type SampleWriter interface {
+	WriteSample(sample sensor.Sample) error
+	Count() int // samples written
+	Close() error
+}
+
+// WriterOptions holds the options of NewLogWriter.
+type WriterOptions struct {
+	Vehicle      string // vehicle ID recorded in the log; empty records none
+	ChannelTimes bool   // CSV: add the SLUG_ms columns; .mmcd logs always store them
+	CSVComments  bool   // CSV: record Vehicle in a comment line before the header
+	Notes        string // .mmcd, .msl and .mlg: free-form notes recorded in the header
+}
+
+// NewLogWriter creates a log file for the sensors at indices, choosing the
+// format by extension: .mmcd writes the native binary format with the
+// sensor definitions embedded, .msl and .mlg the MegaLogViewer text and
+// binary formats, anything else CSV.
+func NewLogWriter(filename string, defs []sensor.Definition, indices []int, units sensor.UnitSystem, opts WriterOptions) (SampleWriter, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mmcd":
+		return NewBinaryWriterWithOptions(filename, indices, units, BinaryOptions{Vehicle: opts.Vehicle, Defs: defs, Notes: opts.Notes})
+	case ".msl":
+		return NewMSLWriter(filename, defs, indices, units, MLVOptions{Vehicle: opts.Vehicle, Notes: opts.Notes})
+	case ".mlg":
+		return NewMLGWriter(filename, defs, indices, units, MLVOptions{Vehicle: opts.Vehicle, Notes: opts.Notes})
+	}
+	return NewCSVWriterWithOptions(filename, defs, indices, units, CSVOptions{ChannelTimes: opts.ChannelTimes, Vehicle: opts.Vehicle, Comments: opts.CSVComments})
+}
+
+// CopySamples writes the remaining samples of r to w, computing the derived
+// channels of defs (INJD, expression channels) for each, and returns the
+// number written.
+func CopySamples(w SampleWriter, r SampleReader, defs []sensor.Definition) (int, error) {
+	n := 0
+	for {
+		s, err := r.Next()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		s.ComputeDerivatives(defs)
+		if err := w.WriteSample(s); err != nil {
+			return n, fmt.Errorf("failed to write sample %d: %w", n, err)
+		}
+		n++
+	}
+}
@@ -50,12 +50,19 @@ var dtcTable = [16]DTCCode{
 	{Bit: 15, Code: "36", Description: "Ignition circuit"},
 }
 
-// decodeDTCs converts a 16-bit fault bitmap into a list of DTCCode entries.
+// decodeDTCs converts a 16-bit fault bitmap into a list of DTCCode entries
+// using the default (1G DSM) table.
 func decodeDTCs(bitmap uint16) []DTCCode {
+	return DecodeDTCs(dtcTable, bitmap)
+}
+
+// DecodeDTCs converts a 16-bit fault bitmap into a list of DTCCode entries
+// using the given table. Bit meanings differ between platforms.
+func DecodeDTCs(table [16]DTCCode, bitmap uint16) []DTCCode {
 	var codes []DTCCode
 	for i := 0; i < 16; i++ {
 		if bitmap&(1<<uint(i)) != 0 {
-			codes = append(codes, dtcTable[i])
+			codes = append(codes, table[i])
 		}
 	}
 	return codes
@@ -88,7 +95,7 @@ func (e *ECU) ReadDTCs() (*DTCResult, error) {
 	}
 
 	result.ActiveRaw = uint16(activeLow) | (uint16(activeHigh) << 8)
-	result.Active = decodeDTCs(result.ActiveRaw)
+	result.Active = DecodeDTCs(e.DTCTable(), result.ActiveRaw)
 
 	// Read stored DTCs (low byte)
 	storedLow, err := e.QuerySensor(AddrStoredDTCLow)
@@ -103,7 +110,7 @@ func (e *ECU) ReadDTCs() (*DTCResult, error) {
 	}
 
 	result.StoredRaw = uint16(storedLow) | (uint16(storedHigh) << 8)
-	result.Stored = decodeDTCs(result.StoredRaw)
+	result.Stored = DecodeDTCs(e.DTCTable(), result.StoredRaw)
 
 	return result, nil
 }
@@ -129,7 +136,20 @@ func (e *ECU) EraseDTCs() error {
 	return nil
 }
 
-// GetDTCTable returns the full DTC lookup table for display purposes.
+// SetDTCTable sets the fault code table used by ReadDTCs.
+func (e *ECU) SetDTCTable(table [16]DTCCode) {
+	e.dtcs = &table
+}
+
+// DTCTable returns the fault code table used by ReadDTCs.
+func (e *ECU) DTCTable() [16]DTCCode {
+	if e.dtcs == nil {
+		return dtcTable
+	}
+	return *e.dtcs
+}
+
+// GetDTCTable returns the default (1G DSM) DTC lookup table.
 func GetDTCTable() [16]DTCCode {
 	return dtcTable
 }
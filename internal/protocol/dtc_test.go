@@ -72,3 +72,22 @@ func TestGetDTCTable(t *testing.T) {
 		t.Errorf("table[15].Code = %s, want '36'", table[15].Code)
 	}
 }
+
+func TestDecodeDTCs_CustomTable(t *testing.T) {
+	table := GetDTCTable()
+	table[7] = DTCCode{Bit: 7, Code: "23", Description: "Camshaft position sensor"}
+
+	codes := DecodeDTCs(table, 0x0081)
+	if len(codes) != 2 || codes[0].Code != "11" || codes[1].Description != "Camshaft position sensor" {
+		t.Errorf("DecodeDTCs = %+v", codes)
+	}
+
+	ecu := NewECU(nil, nil)
+	if got := ecu.DTCTable(); got != GetDTCTable() {
+		t.Error("ECU without a table should use the default")
+	}
+	ecu.SetDTCTable(table)
+	if got := ecu.DTCTable()[7].Description; got != "Camshaft position sensor" {
+		t.Errorf("ECU table bit 7 = %q", got)
+	}
+}
@@ -19,13 +19,14 @@ var validCommandAddrs = map[byte]bool{
 
 // ECU handles communication with the Mitsubishi OBDI ECU.
 type ECU struct {
-	conn  *SerialConn
+	conn  Transport
 	defs  []sensor.Definition
-	busMu sync.Mutex // held for entire send+receive cycles to prevent interleaving
+	dtcs  *[16]DTCCode // fault code table; nil for the default
+	busMu sync.Mutex   // held for entire send+receive cycles to prevent interleaving
 }
 
-// NewECU creates a new ECU communicator.
-func NewECU(conn *SerialConn, defs []sensor.Definition) *ECU {
+// NewECU creates a new ECU communicator over the given transport.
+func NewECU(conn Transport, defs []sensor.Definition) *ECU {
 	return &ECU{
 		conn: conn,
 		defs: defs,
@@ -59,7 +60,34 @@ func (e *ECU) QuerySensor(addr byte) (byte, error) {
 
 	e.busMu.Lock()
 	defer e.busMu.Unlock()
+	return e.query(addr)
+}
+
+// QueryPair reads two addresses in one bus-locked cycle, so no command or
+// other query can run between them. Two-byte sensors are read with it.
+func (e *ECU) QueryPair(first, second byte) (byte, byte, error) {
+	for _, addr := range []byte{first, second} {
+		if addr >= 0xC0 {
+			return 0, 0, fmt.Errorf("address 0x%02X is in command range (>=0xC0), refusing to poll", addr)
+		}
+	}
 
+	e.busMu.Lock()
+	defer e.busMu.Unlock()
+	b1, err := e.query(first)
+	if err != nil {
+		return 0, 0, err
+	}
+	b2, err := e.query(second)
+	if err != nil {
+		return 0, 0, err
+	}
+	return b1, b2, nil
+}
+
+// query runs one address request/echo/data exchange. Caller must hold
+// e.busMu.
+func (e *ECU) query(addr byte) (byte, error) {
 	// Send the address byte
 	_, err := e.conn.Send([]byte{addr})
 	if err != nil {
@@ -96,10 +124,14 @@ func (e *ECU) QuerySensor(addr byte) (byte, error) {
 }
 
 // PollSensors queries all sensors at the given indices and returns a complete sample.
+// Individual query failures are skipped; an error is returned only when none
+// of the queried sensors answered, so the logger watchdog can see a dead link.
 func (e *ECU) PollSensors(indices []int) (sensor.Sample, error) {
 	var sample sensor.Sample
 	sample.Time = time.Now()
 
+	queried, answered := 0, 0
+	var lastErr error
 	for _, idx := range indices {
 		if idx < 0 || idx >= len(e.defs) {
 			continue
@@ -109,13 +141,20 @@ func (e *ECU) PollSensors(indices []int) (sensor.Sample, error) {
 			continue
 		}
 
-		data, err := e.QuerySensor(def.Addr)
+		queried++
+		word, err := e.querySensor(def)
 		if err != nil {
 			slog.Debug("sensor query failed", "slug", def.Slug, "addr", fmt.Sprintf("0x%02X", def.Addr), "error", err)
+			lastErr = err
 			continue
 		}
 
-		sample.SetData(idx, data)
+		sample.SetWordAt(idx, word, time.Now())
+		answered++
+	}
+
+	if queried > 0 && answered == 0 {
+		return sample, fmt.Errorf("no sensors responded (%d queried): %w", queried, lastErr)
 	}
 
 	// Compute derived values (e.g., injector duty cycle)
@@ -124,6 +163,20 @@ func (e *ECU) PollSensors(indices []int) (sensor.Sample, error) {
 	return sample, nil
 }
 
+// querySensor reads the raw byte of a sensor, or both bytes of a two-byte
+// sensor in one cycle.
+func (e *ECU) querySensor(def sensor.Definition) (uint16, error) {
+	if !def.IsWord() {
+		data, err := e.QuerySensor(def.Addr)
+		return uint16(data), err
+	}
+	b1, b2, err := e.QueryPair(def.Addr, def.Addr2)
+	if err != nil {
+		return 0, err
+	}
+	return def.Combine(b1, b2), nil
+}
+
 // SendCommand sends a command byte to the ECU and waits for the response.
 // Used for actuator tests (0xF1-0xFC) and DTC erase (0xCA).
 // timeout is the maximum time to wait for the ECU to complete the action.
@@ -186,7 +239,17 @@ func (e *ECU) SendCommand(cmd byte, timeout time.Duration) (byte, error) {
 	return result[0], nil
 }
 
-// Conn returns the underlying serial connection.
-func (e *ECU) Conn() *SerialConn {
+// Open opens the underlying transport if it is not already open.
+func (e *ECU) Open() error {
+	return e.conn.Open()
+}
+
+// Close closes the underlying transport. It can be reopened with Open.
+func (e *ECU) Close() error {
+	return e.conn.Close()
+}
+
+// Conn returns the underlying transport.
+func (e *ECU) Conn() Transport {
 	return e.conn
 }
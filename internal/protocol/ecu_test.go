@@ -1,7 +1,12 @@
 package protocol
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
 )
 
 func TestQuerySensor_RejectsCommandRange(t *testing.T) {
@@ -92,3 +97,174 @@ func TestValidCommandAddrs_Complete(t *testing.T) {
 		}
 	}
 }
+
+// scriptedTransport is an in-memory Transport that answers each sent byte
+// from a response table, standing in for the ECU on the other end of the wire.
+type scriptedTransport struct {
+	open      bool
+	responses map[byte][]byte // sent byte -> bytes queued for Receive
+	rx        []byte
+	sent      []byte
+	flushes   int
+}
+
+func newScriptedTransport(responses map[byte][]byte) *scriptedTransport {
+	return &scriptedTransport{open: true, responses: responses}
+}
+
+func (t *scriptedTransport) Open() error                        { t.open = true; return nil }
+func (t *scriptedTransport) Close() error                       { t.open = false; return nil }
+func (t *scriptedTransport) IsOpen() bool                       { return t.open }
+func (t *scriptedTransport) SetReadTimeout(time.Duration) error { return nil }
+
+func (t *scriptedTransport) Send(data []byte) (int, error) {
+	if !t.open {
+		return 0, fmt.Errorf("transport not open")
+	}
+	for _, b := range data {
+		t.sent = append(t.sent, b)
+		t.rx = append(t.rx, t.responses[b]...)
+	}
+	return len(data), nil
+}
+
+func (t *scriptedTransport) Receive(buf []byte) (int, error) {
+	if !t.open {
+		return 0, fmt.Errorf("transport not open")
+	}
+	n := copy(buf, t.rx)
+	t.rx = t.rx[n:]
+	return n, nil
+}
+
+func (t *scriptedTransport) Flush() error {
+	t.flushes++
+	t.rx = nil
+	return nil
+}
+
+func TestQuerySensor_OverTransport(t *testing.T) {
+	tr := newScriptedTransport(map[byte][]byte{0x21: {0x21, 0x40}})
+	ecu := NewECU(tr, sensor.DefaultDefinitions())
+
+	data, err := ecu.QuerySensor(0x21)
+	if err != nil {
+		t.Fatalf("QuerySensor(0x21) failed: %v", err)
+	}
+	if data != 0x40 {
+		t.Errorf("QuerySensor(0x21) = 0x%02X, want 0x40", data)
+	}
+}
+
+func TestQuerySensor_EchoMismatchFlushes(t *testing.T) {
+	tr := newScriptedTransport(map[byte][]byte{0x21: {0x17, 0x40}})
+	ecu := NewECU(tr, nil)
+
+	if _, err := ecu.QuerySensor(0x21); err == nil {
+		t.Fatal("QuerySensor should fail on echo mismatch")
+	}
+	if tr.flushes == 0 {
+		t.Error("echo mismatch should flush the receive buffer")
+	}
+}
+
+func TestQuerySensor_Timeout(t *testing.T) {
+	tr := newScriptedTransport(map[byte][]byte{0x21: {0x21}}) // data byte never arrives
+	ecu := NewECU(tr, nil)
+
+	_, err := ecu.QuerySensor(0x21)
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("QuerySensor error = %v, want timeout", err)
+	}
+}
+
+func TestSendCommand_OverTransport(t *testing.T) {
+	tr := newScriptedTransport(map[byte][]byte{0xCA: {0xCA, 0x00}})
+	ecu := NewECU(tr, nil)
+
+	result, err := ecu.SendCommand(0xCA, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("SendCommand(0xCA) failed: %v", err)
+	}
+	if result != 0x00 {
+		t.Errorf("SendCommand(0xCA) = 0x%02X, want 0x00", result)
+	}
+}
+
+func TestPollSensors_OverTransport(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	tr := newScriptedTransport(map[byte][]byte{
+		0x21: {0x21, 0x80}, // RPM
+		0x29: {0x29, 0x32}, // INJP
+	})
+	ecu := NewECU(tr, defs)
+
+	sample, err := ecu.PollSensors([]int{17, 19})
+	if err != nil {
+		t.Fatalf("PollSensors failed: %v", err)
+	}
+	if !sample.HasData(17) || sample.Raw(17) != 0x80 {
+		t.Errorf("RPM raw = 0x%02X (present=%v), want 0x80", sample.Raw(17), sample.HasData(17))
+	}
+	if !sample.HasData(20) {
+		t.Error("INJD should be derived from RPM and INJP")
+	}
+	if sample.Offset(17) < 0 || sample.Offset(19) < sample.Offset(17) {
+		t.Errorf("channel offsets RPM=%s INJP=%s, want answer order", sample.Offset(17), sample.Offset(19))
+	}
+}
+
+func TestPollSensors_TwoByte(t *testing.T) {
+	two := sensor.Addr(0x4A)
+	kret := sensor.Addr(0x4C)
+	defs, err := sensor.ApplyProfile(sensor.DefaultDefinitions(), &sensor.Profile{Sensors: []sensor.ProfileSensor{
+		{Slug: "AFCNT", Addr: &two, Size: 2},
+		{Slug: "KRET", Addr: &kret, Signed: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	af, _ := sensor.FindBySlug(defs, "AFCNT")
+	kr, _ := sensor.FindBySlug(defs, "KRET")
+	tr := newScriptedTransport(map[byte][]byte{
+		0x4A: {0x4A, 0x12},
+		0x4B: {0x4B, 0x34},
+		0x4C: {0x4C, 0xFB},
+	})
+	ecu := NewECU(tr, defs)
+
+	sample, err := ecu.PollSensors([]int{af, kr})
+	if err != nil {
+		t.Fatalf("PollSensors failed: %v", err)
+	}
+	if sample.Word(af) != 0x1234 || sample.RawValue(defs, af) != 0x1234 {
+		t.Errorf("AFCNT word = %#x, want 0x1234", sample.Word(af))
+	}
+	if got := sample.RawValue(defs, kr); got != -5 {
+		t.Errorf("KRET = %d, want -5", got)
+	}
+	if string(tr.sent) != "\x4A\x4B\x4C" {
+		t.Errorf("sent % X, want both bytes of AFCNT, then KRET", tr.sent)
+	}
+
+	// A missing second byte loses the whole word
+	delete(tr.responses, 0x4B)
+	sample, _ = ecu.PollSensors([]int{af, kr})
+	if sample.HasData(af) || !sample.HasData(kr) {
+		t.Errorf("AFCNT present %v, KRET present %v; want only KRET", sample.HasData(af), sample.HasData(kr))
+	}
+}
+
+func TestSimulator_ChannelTimesFollowSweep(t *testing.T) {
+	defs := sensor.DefaultDefinitions()
+	sim := NewSimulator(defs)
+
+	sample, err := sim.PollSensors([]int{14, 17, 4})
+	if err != nil {
+		t.Fatalf("PollSensors failed: %v", err)
+	}
+	if !(sample.Offset(14) < sample.Offset(17) && sample.Offset(17) < sample.Offset(4)) {
+		t.Errorf("offsets TPS=%s RPM=%s COOL=%s, want increasing in poll order",
+			sample.Offset(14), sample.Offset(17), sample.Offset(4))
+	}
+}
@@ -0,0 +1,261 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// EmulatorConfig controls the timing and fault state of an Emulator.
+type EmulatorConfig struct {
+	// Latency is the delay before each response byte (echo and data).
+	// A real ECU at 1920 baud takes ~5ms per byte on the wire.
+	Latency time.Duration
+
+	// ActuatorDelay is how long an actuator test (0xF1-0xFC) runs before
+	// the ECU sends its result byte. The real ECU takes ~6 seconds.
+	ActuatorDelay time.Duration
+
+	// EraseDelay is how long the DTC erase command (0xCA) takes.
+	EraseDelay time.Duration
+
+	// EngineRunning makes solenoid/relay tests (0xF1-0xF6) answer 0xFF,
+	// as the real ECU does when the engine is running.
+	EngineRunning bool
+
+	// ActiveDTCs and StoredDTCs are the fault bitmaps served at
+	// 0x38/0x39 and 0x3B/0x3C.
+	ActiveDTCs uint16
+	StoredDTCs uint16
+
+	// Faults injects byte-level communication faults into sensor reads.
+	// DisconnectAfter silences every request, commands included.
+	Faults FaultProfile
+}
+
+// DefaultEmulatorConfig returns timings close to a real 1G DSM ECU.
+func DefaultEmulatorConfig() EmulatorConfig {
+	return EmulatorConfig{
+		Latency:       5 * time.Millisecond,
+		ActuatorDelay: 6 * time.Second,
+		EraseDelay:    200 * time.Millisecond,
+	}
+}
+
+// Emulator answers the MMCD byte protocol the way the ECU does, so the real
+// ECU code path (QuerySensor/SendCommand echo handling, timeouts, flushes)
+// can be exercised without a car. Sensor values come from a Simulator.
+//
+// The emulator can be served over any byte stream: a Linux pseudo-terminal
+// (ServePTY), a TCP listener (ServeListener) or an in-memory pipe (Serve).
+type Emulator struct {
+	sim *Simulator
+
+	mu     sync.Mutex
+	cfg    EmulatorConfig
+	faults faultInjector
+}
+
+// NewEmulator creates an emulator backed by a Simulator over defs.
+func NewEmulator(defs []sensor.Definition, cfg EmulatorConfig) *Emulator {
+	return &Emulator{
+		sim:    NewSimulator(defs),
+		cfg:    cfg,
+		faults: newFaultInjector(cfg.Faults),
+	}
+}
+
+// SetFaults installs a fault profile. The disconnect timer starts now.
+func (em *Emulator) SetFaults(fp FaultProfile) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.cfg.Faults = fp
+	em.faults = newFaultInjector(fp)
+}
+
+// Config returns the current emulator configuration.
+func (em *Emulator) Config() EmulatorConfig {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	return em.cfg
+}
+
+// SetDTCs replaces the active and stored fault bitmaps.
+func (em *Emulator) SetDTCs(active, stored uint16) {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+	em.cfg.ActiveDTCs = active
+	em.cfg.StoredDTCs = stored
+}
+
+// Serve answers requests read from rw until it returns an error or EOF.
+// EOF is not reported as an error.
+func (em *Emulator) Serve(rw io.ReadWriter) error {
+	req := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(rw, req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := em.respond(rw, req[0]); err != nil {
+			return err
+		}
+	}
+}
+
+// ServeListener accepts connections on ln and serves each one in turn.
+// It returns when the listener is closed.
+func (em *Emulator) ServeListener(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		slog.Info("emulator client connected", "remote", conn.RemoteAddr())
+		if err := em.Serve(conn); err != nil {
+			slog.Debug("emulator connection ended", "error", err)
+		}
+		conn.Close()
+	}
+}
+
+// faultPlan is the set of faults chosen for one sensor read.
+type faultPlan struct {
+	dropEcho, dropData bool
+	wrongEcho          bool
+	stale              bool
+	extraDelay         time.Duration
+}
+
+// planFaults rolls the active fault profile for one sensor read.
+func (em *Emulator) planFaults() faultPlan {
+	em.mu.Lock()
+	defer em.mu.Unlock()
+
+	fi := &em.faults
+	fp := fi.profile
+	var plan faultPlan
+	if fi.roll(fp.DropRate) {
+		if fi.rng.Intn(2) == 0 {
+			plan.dropEcho = true
+		} else {
+			plan.dropData = true
+		}
+	}
+	plan.wrongEcho = fi.roll(fp.WrongEchoRate)
+	plan.stale = fi.roll(fp.StaleRate)
+	if fi.roll(fp.SlowRate) {
+		plan.extraDelay = fp.SlowDelay
+	}
+	return plan
+}
+
+// respond writes the ECU's answer to a single request byte.
+func (em *Emulator) respond(w io.Writer, req byte) error {
+	cfg := em.Config()
+
+	em.mu.Lock()
+	silent := em.faults.disconnected()
+	em.mu.Unlock()
+	if silent {
+		return nil // cable dropout: requests go unanswered
+	}
+
+	switch {
+	case req < 0xC0:
+		// Sensor read: echo + data byte, with any injected faults
+		plan := em.planFaults()
+		if plan.stale {
+			if err := em.send(w, 0, 0x00); err != nil {
+				return err
+			}
+		}
+		echo := req
+		if plan.wrongEcho {
+			echo ^= 0x5A
+		}
+		if !plan.dropEcho {
+			if err := em.send(w, cfg.Latency+plan.extraDelay, echo); err != nil {
+				return err
+			}
+		}
+		if plan.dropData {
+			return nil
+		}
+		return em.send(w, cfg.Latency, em.readAddress(req, cfg))
+
+	case req == AddrEraseDTC:
+		if err := em.send(w, cfg.Latency, req); err != nil {
+			return err
+		}
+		time.Sleep(cfg.EraseDelay)
+		em.mu.Lock()
+		em.cfg.ActiveDTCs = 0
+		em.cfg.StoredDTCs = 0
+		em.mu.Unlock()
+		slog.Info("emulator: DTCs erased")
+		return em.send(w, 0, 0x00)
+
+	case validCommandAddrs[req]:
+		if err := em.send(w, cfg.Latency, req); err != nil {
+			return err
+		}
+		slog.Info("emulator: actuator test", "cmd", fmt.Sprintf("0x%02X", req))
+		time.Sleep(cfg.ActuatorDelay)
+		result := byte(0x00)
+		if cfg.EngineRunning && req >= 0xF1 && req <= 0xF6 {
+			result = 0xFF // solenoid tests refuse to run with the engine on
+		}
+		return em.send(w, 0, result)
+
+	default:
+		// Unknown command range byte: the ECU echoes it and stays silent.
+		return em.send(w, cfg.Latency, req)
+	}
+}
+
+// readAddress returns the data byte for a sensor-range address.
+func (em *Emulator) readAddress(addr byte, cfg EmulatorConfig) byte {
+	switch addr {
+	case AddrActiveDTCLow:
+		return byte(cfg.ActiveDTCs)
+	case AddrActiveDTCHigh:
+		return byte(cfg.ActiveDTCs >> 8)
+	case AddrStoredDTCLow:
+		return byte(cfg.StoredDTCs)
+	case AddrStoredDTCHigh:
+		return byte(cfg.StoredDTCs >> 8)
+	}
+	return em.sim.ReadAddress(addr)
+}
+
+// send writes a single byte after the given delay.
+func (em *Emulator) send(w io.Writer, delay time.Duration, b byte) error {
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	_, err := w.Write([]byte{b})
+	return err
+}
+
+// ServePTY serves the emulator on the master side of a pseudo-terminal until
+// the PTY is closed. Clients open pty.Name() like any serial port.
+func (em *Emulator) ServePTY(pty *PTY) error {
+	err := em.Serve(pty.Master())
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package protocol
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+func fastEmulatorConfig() EmulatorConfig {
+	return EmulatorConfig{
+		Latency:       time.Millisecond,
+		ActuatorDelay: 20 * time.Millisecond,
+		EraseDelay:    10 * time.Millisecond,
+	}
+}
+
+// emulatorECU starts an emulator on a loopback listener and returns an ECU
+// connected to it over the raw TCP transport.
+func emulatorECU(t *testing.T, cfg EmulatorConfig) (*ECU, *Emulator) {
+	t.Helper()
+	defs := sensor.DefaultDefinitions()
+	em := NewEmulator(defs, cfg)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go em.ServeListener(ln)
+
+	conn := NewTCPConn(ln.Addr().String(), DefaultBaudRate)
+	if err := conn.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewECU(conn, defs), em
+}
+
+func TestEmulator_PollSensors(t *testing.T) {
+	ecu, _ := emulatorECU(t, fastEmulatorConfig())
+
+	defs := sensor.DefaultDefinitions()
+	indices := sensor.AllPollableIndices(defs)
+	sample, err := ecu.PollSensors(indices)
+	if err != nil {
+		t.Fatalf("PollSensors failed: %v", err)
+	}
+	for _, idx := range indices {
+		if !sample.HasData(idx) {
+			t.Errorf("sensor %s missing from emulated sample", defs[idx].Slug)
+		}
+	}
+	rpm := defs[17].Convert(sample.Raw(17), sensor.UnitMetric)
+	if rpm < 500 || rpm > 7000 {
+		t.Errorf("emulated RPM = %.0f, want a plausible engine speed", rpm)
+	}
+}
+
+func TestEmulator_ReadAndEraseDTCs(t *testing.T) {
+	cfg := fastEmulatorConfig()
+	cfg.ActiveDTCs = 0x0022
+	cfg.StoredDTCs = 0x0406
+	ecu, em := emulatorECU(t, cfg)
+
+	result, err := ecu.ReadDTCs()
+	if err != nil {
+		t.Fatalf("ReadDTCs failed: %v", err)
+	}
+	if result.ActiveRaw != 0x0022 || result.StoredRaw != 0x0406 {
+		t.Errorf("DTCs = active 0x%04X stored 0x%04X, want 0x0022/0x0406", result.ActiveRaw, result.StoredRaw)
+	}
+
+	if err := ecu.EraseDTCs(); err != nil {
+		t.Fatalf("EraseDTCs failed: %v", err)
+	}
+	if got := em.Config().StoredDTCs; got != 0 {
+		t.Errorf("stored DTCs after erase = 0x%04X, want 0", got)
+	}
+}
+
+func TestEmulator_ActuatorCommand(t *testing.T) {
+	cfg := fastEmulatorConfig()
+	cfg.EngineRunning = true
+	ecu, _ := emulatorECU(t, cfg)
+
+	result, err := ecu.SendCommand(0xF6, time.Second)
+	if err != nil {
+		t.Fatalf("SendCommand(0xF6) failed: %v", err)
+	}
+	if result != 0xFF {
+		t.Errorf("fuel pump test with engine running = 0x%02X, want 0xFF", result)
+	}
+
+	result, err = ecu.SendCommand(0xFC, time.Second)
+	if err != nil {
+		t.Fatalf("SendCommand(0xFC) failed: %v", err)
+	}
+	if result != 0x00 {
+		t.Errorf("injector disable = 0x%02X, want 0x00", result)
+	}
+}
+
+func TestEmulator_ServePTY(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pty emulation is Linux-only")
+	}
+	pty, err := OpenPTY()
+	if err != nil {
+		t.Skipf("no pty available: %v", err)
+	}
+	defer pty.Close()
+
+	defs := sensor.DefaultDefinitions()
+	em := NewEmulator(defs, fastEmulatorConfig())
+	go em.ServePTY(pty)
+
+	conn := NewSerialConn(pty.Name(), DefaultBaudRate)
+	if err := conn.Open(); err != nil {
+		t.Fatalf("opening %s as a serial port failed: %v", pty.Name(), err)
+	}
+	defer conn.Close()
+
+	ecu := NewECU(conn, defs)
+	if err := ecu.Probe(); err != nil {
+		t.Fatalf("Probe over pty failed: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FaultProfile describes communication faults injected by the Simulator and
+// Emulator, reproducing what we see in the field: lost bytes, corrupted
+// echoes, stale bytes left in the receive buffer, slow answers, and a cable
+// that drops out altogether.
+//
+// Rates are probabilities per request (0 = never, 1 = always).
+type FaultProfile struct {
+	DropRate        float64       `json:"dropRate"`        // a response byte never arrives
+	WrongEchoRate   float64       `json:"wrongEchoRate"`   // the echo byte is corrupted
+	StaleRate       float64       `json:"staleRate"`       // a stale byte precedes the response
+	SlowRate        float64       `json:"slowRate"`        // the response is delayed by SlowDelay
+	SlowDelay       time.Duration `json:"slowDelay"`       // extra delay for slow responses
+	DisconnectAfter time.Duration `json:"disconnectAfter"` // go silent after this long (0 = never)
+}
+
+// faultPresets are the named profiles accepted by ParseFaultProfile.
+var faultPresets = map[string]FaultProfile{
+	"none":    {},
+	"flaky":   {DropRate: 0.02, WrongEchoRate: 0.01, StaleRate: 0.01},
+	"noisy":   {WrongEchoRate: 0.05, StaleRate: 0.05},
+	"slow":    {SlowRate: 0.3, SlowDelay: 400 * time.Millisecond},
+	"dropout": {DisconnectAfter: 30 * time.Second},
+}
+
+// FaultPresetNames returns the names accepted by ParseFaultProfile.
+func FaultPresetNames() []string {
+	return []string{"none", "flaky", "noisy", "slow", "dropout"}
+}
+
+// ParseFaultProfile parses a comma-separated fault spec. Each element is
+// either a preset name (none, flaky, noisy, slow, dropout) or a key=value
+// override applied on top of it:
+//
+//	drop=0.05        DropRate
+//	echo=0.02        WrongEchoRate
+//	stale=0.01       StaleRate
+//	slow=0.1         SlowRate
+//	slow-delay=600ms SlowDelay
+//	disconnect=30s   DisconnectAfter
+//
+// For example "flaky,disconnect=20s". An empty spec means no faults.
+func ParseFaultProfile(spec string) (FaultProfile, error) {
+	var fp FaultProfile
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(strings.ToLower(part))
+		if part == "" {
+			continue
+		}
+
+		key, value, isPair := strings.Cut(part, "=")
+		if !isPair {
+			preset, ok := faultPresets[part]
+			if !ok {
+				return FaultProfile{}, fmt.Errorf("unknown fault preset %q (want one of %s)", part, strings.Join(FaultPresetNames(), ", "))
+			}
+			fp = preset
+			continue
+		}
+
+		switch key {
+		case "drop", "echo", "stale", "slow":
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate < 0 || rate > 1 {
+				return FaultProfile{}, fmt.Errorf("fault %s=%s: rate must be between 0 and 1", key, value)
+			}
+			switch key {
+			case "drop":
+				fp.DropRate = rate
+			case "echo":
+				fp.WrongEchoRate = rate
+			case "stale":
+				fp.StaleRate = rate
+			case "slow":
+				fp.SlowRate = rate
+			}
+		case "slow-delay", "disconnect":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return FaultProfile{}, fmt.Errorf("fault %s=%s: invalid duration", key, value)
+			}
+			if key == "slow-delay" {
+				fp.SlowDelay = d
+			} else {
+				fp.DisconnectAfter = d
+			}
+		default:
+			return FaultProfile{}, fmt.Errorf("unknown fault setting %q", key)
+		}
+	}
+
+	if fp.SlowRate > 0 && fp.SlowDelay == 0 {
+		fp.SlowDelay = 400 * time.Millisecond
+	}
+	return fp, nil
+}
+
+// IsZero reports whether the profile injects no faults.
+func (fp FaultProfile) IsZero() bool {
+	return fp == FaultProfile{}
+}
+
+// String returns the profile in ParseFaultProfile syntax.
+func (fp FaultProfile) String() string {
+	if fp.IsZero() {
+		return "none"
+	}
+	var parts []string
+	rate := func(key string, v float64) {
+		if v > 0 {
+			parts = append(parts, key+"="+strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	rate("drop", fp.DropRate)
+	rate("echo", fp.WrongEchoRate)
+	rate("stale", fp.StaleRate)
+	rate("slow", fp.SlowRate)
+	if fp.SlowRate > 0 {
+		parts = append(parts, "slow-delay="+fp.SlowDelay.String())
+	}
+	if fp.DisconnectAfter > 0 {
+		parts = append(parts, "disconnect="+fp.DisconnectAfter.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// faultInjector rolls the dice for a FaultProfile. Not safe for concurrent
+// use; callers hold their own lock.
+type faultInjector struct {
+	profile FaultProfile
+	since   time.Time // disconnect timer origin
+	rng     *rand.Rand
+}
+
+func newFaultInjector(fp FaultProfile) faultInjector {
+	return faultInjector{
+		profile: fp,
+		since:   time.Now(),
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (fi *faultInjector) roll(rate float64) bool {
+	return rate > 0 && fi.rng.Float64() < rate
+}
+
+// disconnected reports whether the simulated cable has dropped out.
+func (fi *faultInjector) disconnected() bool {
+	return fi.profile.DisconnectAfter > 0 && time.Since(fi.since) >= fi.profile.DisconnectAfter
+}
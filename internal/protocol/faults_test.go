@@ -0,0 +1,87 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+func TestParseFaultProfile(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    FaultProfile
+		wantErr bool
+	}{
+		{spec: "", want: FaultProfile{}},
+		{spec: "none", want: FaultProfile{}},
+		{spec: "flaky", want: faultPresets["flaky"]},
+		{spec: "flaky,disconnect=20s", want: FaultProfile{DropRate: 0.02, WrongEchoRate: 0.01, StaleRate: 0.01, DisconnectAfter: 20 * time.Second}},
+		{spec: "slow=0.5", want: FaultProfile{SlowRate: 0.5, SlowDelay: 400 * time.Millisecond}},
+		{spec: "drop=0.1, echo=0.2", want: FaultProfile{DropRate: 0.1, WrongEchoRate: 0.2}},
+		{spec: "bogus", wantErr: true},
+		{spec: "drop=2", wantErr: true},
+		{spec: "disconnect=soon", wantErr: true},
+		{spec: "wobble=0.1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFaultProfile(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseFaultProfile(%q) should fail", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFaultProfile(%q) failed: %v", tt.spec, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseFaultProfile(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestFaultProfile_StringRoundTrip(t *testing.T) {
+	for _, name := range FaultPresetNames() {
+		fp := faultPresets[name]
+		back, err := ParseFaultProfile(fp.String())
+		if err != nil {
+			t.Fatalf("re-parsing %q (%s) failed: %v", fp.String(), name, err)
+		}
+		if back != fp {
+			t.Errorf("preset %s round trip = %+v, want %+v", name, back, fp)
+		}
+	}
+}
+
+func TestEmulator_WrongEchoFault(t *testing.T) {
+	cfg := fastEmulatorConfig()
+	cfg.Faults = FaultProfile{WrongEchoRate: 1}
+	ecu, _ := emulatorECU(t, cfg)
+
+	if _, err := ecu.QuerySensor(0x21); err == nil {
+		t.Error("QuerySensor should fail when every echo is corrupted")
+	}
+}
+
+func TestEmulator_DisconnectFault(t *testing.T) {
+	cfg := fastEmulatorConfig()
+	cfg.Faults = FaultProfile{DisconnectAfter: time.Nanosecond}
+	ecu, _ := emulatorECU(t, cfg)
+
+	if _, err := ecu.PollSensors([]int{17}); err == nil {
+		t.Error("PollSensors should fail once the emulated cable drops out")
+	}
+}
+
+func TestSimulator_DisconnectFault(t *testing.T) {
+	sim := NewSimulator(sensor.DefaultDefinitions())
+	sim.SetFaults(FaultProfile{DisconnectAfter: time.Nanosecond})
+	time.Sleep(time.Millisecond)
+
+	if _, err := sim.PollSensors([]int{17}); err == nil {
+		t.Error("simulator PollSensors should fail after disconnect")
+	}
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package protocol
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTY is a pseudo-terminal pair. The emulator answers on the master side;
+// clients open the slave path (/dev/pts/N) as if it were a serial port.
+type PTY struct {
+	master *os.File
+	slave  *os.File // held open so the master never sees EIO between clients
+	name   string
+}
+
+// OpenPTY allocates a new pseudo-terminal with the slave in raw mode.
+func OpenPTY() (*PTY, error) {
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open /dev/ptmx: %w", err)
+	}
+
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to unlock pty: %w", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to get pty number: %w", err)
+	}
+	// A non-blocking fd lets os.File use the runtime poller, so Close
+	// interrupts a pending Read in the serve loop.
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+	name := fmt.Sprintf("/dev/pts/%d", n)
+
+	slave, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+
+	// Raw mode: no echo, no line editing, no CR/LF translation.
+	// The client's serial library sets this again when it opens the port.
+	sfd := int(slave.Fd())
+	t, err := unix.IoctlGetTermios(sfd, unix.TCGETS)
+	if err != nil {
+		master.Close()
+		slave.Close()
+		return nil, fmt.Errorf("failed to read pty termios: %w", err)
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB
+	t.Cflag |= unix.CS8
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(sfd, unix.TCSETS, t); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, fmt.Errorf("failed to set pty raw mode: %w", err)
+	}
+
+	return &PTY{master: master, slave: slave, name: name}, nil
+}
+
+// Name returns the slave device path clients should open.
+func (p *PTY) Name() string {
+	return p.name
+}
+
+// Master returns the master side of the pseudo-terminal.
+func (p *PTY) Master() *os.File {
+	return p.master
+}
+
+// Close releases both sides of the pseudo-terminal.
+func (p *PTY) Close() error {
+	p.slave.Close()
+	return p.master.Close()
+}
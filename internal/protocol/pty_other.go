@@ -0,0 +1,26 @@
+//go:build !linux
+
+package protocol
+
+import (
+	"fmt"
+	"os"
+)
+
+// PTY is a pseudo-terminal pair. Only supported on Linux.
+type PTY struct{}
+
+// OpenPTY is not supported on this platform; use Emulator.ServeListener
+// with a tcp:// port instead.
+func OpenPTY() (*PTY, error) {
+	return nil, fmt.Errorf("pty emulation is only supported on Linux (use --listen with a tcp:// port instead)")
+}
+
+// Name returns the slave device path clients should open.
+func (p *PTY) Name() string { return "" }
+
+// Master returns the master side of the pseudo-terminal.
+func (p *PTY) Master() *os.File { return nil }
+
+// Close releases both sides of the pseudo-terminal.
+func (p *PTY) Close() error { return nil }
@@ -0,0 +1,234 @@
+package protocol
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// MaxScanAddr is the highest address a memory scan may read. Everything from
+// 0xC0 up is the command range and can trigger actuators or erase DTCs.
+const MaxScanAddr byte = 0xBF
+
+// NoResponse marks an address that did not answer in a Sweep.
+const NoResponse = -1
+
+// Sweep is one pass of QuerySensor over an address range.
+type Sweep struct {
+	State  string    `json:"state"` // engine state label, e.g. "idle" or "2500rpm"
+	Time   time.Time `json:"time"`
+	From   byte      `json:"from"`
+	Values []int     `json:"values"` // data byte per address from From, or NoResponse
+}
+
+// Value returns the byte read at addr and whether the address answered.
+func (s Sweep) Value(addr byte) (byte, bool) {
+	i := int(addr) - int(s.From)
+	if i < 0 || i >= len(s.Values) || s.Values[i] == NoResponse {
+		return 0, false
+	}
+	return byte(s.Values[i]), true
+}
+
+// Sweep reads every address from..to once. Addresses above MaxScanAddr are
+// never sent. progress, if non-nil, is called after each address.
+func (e *ECU) Sweep(from, to byte, state string, progress func(addr byte)) (Sweep, error) {
+	if to > MaxScanAddr {
+		return Sweep{}, fmt.Errorf("scan range ends at 0x%02X, above 0x%02X (command range)", to, MaxScanAddr)
+	}
+	if from > to {
+		return Sweep{}, fmt.Errorf("scan range 0x%02X-0x%02X is empty", from, to)
+	}
+
+	e.conn.Flush()
+	sw := Sweep{State: state, Time: time.Now(), From: from, Values: make([]int, int(to)-int(from)+1)}
+	answered := 0
+	for i := range sw.Values {
+		addr := from + byte(i)
+		data, err := e.QuerySensor(addr)
+		if err != nil {
+			sw.Values[i] = NoResponse
+		} else {
+			sw.Values[i] = int(data)
+			answered++
+		}
+		if progress != nil {
+			progress(addr)
+		}
+	}
+	if answered == 0 {
+		return sw, fmt.Errorf("no address answered in 0x%02X-0x%02X", from, to)
+	}
+	return sw, nil
+}
+
+// Address classifications in a ScanReport.
+const (
+	ScanSilent   = "silent"   // never answered
+	ScanConstant = "constant" // same value in every sweep
+	ScanState    = "state"    // steady within each engine state, differs between states
+	ScanLive     = "live"     // changes between sweeps in the same state
+)
+
+// ScanAddress summarises what one address returned across all sweeps.
+type ScanAddress struct {
+	Addr      byte             `json:"addr"`
+	Slug      string           `json:"slug,omitempty"` // known sensor at this address
+	Kind      string           `json:"kind"`
+	Responses int              `json:"responses"`
+	Min       int              `json:"min"`
+	Max       int              `json:"max"`
+	Distinct  int              `json:"distinct"`
+	ByState   map[string][]int `json:"byState"` // values per state, in sweep order
+}
+
+// ScanReport is the result of a memory scan: the raw sweeps plus a
+// per-address summary.
+type ScanReport struct {
+	Started   time.Time     `json:"started"`
+	Finished  time.Time     `json:"finished"`
+	From      byte          `json:"from"`
+	To        byte          `json:"to"`
+	States    []string      `json:"states"`
+	Sweeps    []Sweep       `json:"sweeps"`
+	Addresses []ScanAddress `json:"addresses"`
+}
+
+// NewScanReport analyses sweeps, which must all cover from..to. defs is used
+// to name addresses that belong to known sensors.
+func NewScanReport(sweeps []Sweep, from, to byte, defs []sensor.Definition) *ScanReport {
+	r := &ScanReport{From: from, To: to, Sweeps: sweeps}
+	if len(sweeps) > 0 {
+		r.Started = sweeps[0].Time
+		r.Finished = sweeps[len(sweeps)-1].Time
+	}
+	for _, sw := range sweeps {
+		if !slices.Contains(r.States, sw.State) {
+			r.States = append(r.States, sw.State)
+		}
+	}
+
+	for a := int(from); a <= int(to); a++ {
+		addr := byte(a)
+		sa := ScanAddress{Addr: addr, Min: NoResponse, Max: NoResponse, ByState: make(map[string][]int)}
+		if _, def := sensor.FindByAddr(defs, addr); def != nil && !def.Computed {
+			sa.Slug = def.Slug
+		}
+
+		seen := make(map[byte]bool)
+		for _, sw := range sweeps {
+			v, ok := sw.Value(addr)
+			if !ok {
+				continue
+			}
+			sa.ByState[sw.State] = append(sa.ByState[sw.State], int(v))
+			if sa.Responses == 0 || int(v) < sa.Min {
+				sa.Min = int(v)
+			}
+			if sa.Responses == 0 || int(v) > sa.Max {
+				sa.Max = int(v)
+			}
+			sa.Responses++
+			seen[v] = true
+		}
+		sa.Distinct = len(seen)
+		sa.Kind = classifyScan(sa)
+		r.Addresses = append(r.Addresses, sa)
+	}
+	return r
+}
+
+func classifyScan(sa ScanAddress) string {
+	switch {
+	case sa.Responses == 0:
+		return ScanSilent
+	case sa.Distinct == 1:
+		return ScanConstant
+	}
+	for _, vals := range sa.ByState {
+		for _, v := range vals[1:] {
+			if v != vals[0] {
+				return ScanLive
+			}
+		}
+	}
+	return ScanState
+}
+
+// Responding returns the addresses that answered at least once.
+func (r *ScanReport) Responding() []ScanAddress {
+	var out []ScanAddress
+	for _, sa := range r.Addresses {
+		if sa.Kind != ScanSilent {
+			out = append(out, sa)
+		}
+	}
+	return out
+}
+
+// Changing returns the addresses whose value changed between sweeps, which
+// are the candidates for live variables.
+func (r *ScanReport) Changing() []ScanAddress {
+	var out []ScanAddress
+	for _, sa := range r.Addresses {
+		if sa.Kind == ScanLive || sa.Kind == ScanState {
+			out = append(out, sa)
+		}
+	}
+	return out
+}
+
+// WriteText writes a human-readable report. With all false, constant and
+// silent addresses are summarised rather than listed.
+func (r *ScanReport) WriteText(w io.Writer, all bool) error {
+	fmt.Fprintf(w, "MMCD memory scan 0x%02X-0x%02X\n", r.From, r.To)
+	fmt.Fprintf(w, "Sweeps: %d (%s) from %s to %s\n", len(r.Sweeps), strings.Join(r.States, ", "),
+		r.Started.Format("2006-01-02 15:04:05"), r.Finished.Format("15:04:05"))
+
+	counts := make(map[string]int)
+	for _, sa := range r.Addresses {
+		counts[sa.Kind]++
+	}
+	fmt.Fprintf(w, "Addresses: %d live, %d state-dependent, %d constant, %d silent\n\n",
+		counts[ScanLive], counts[ScanState], counts[ScanConstant], counts[ScanSilent])
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ADDR\tSLUG\tKIND\tMIN\tMAX\tDISTINCT\tVALUES BY STATE")
+	for _, sa := range r.Addresses {
+		if !all && (sa.Kind == ScanSilent || sa.Kind == ScanConstant) {
+			continue
+		}
+		fmt.Fprintf(tw, "0x%02X\t%s\t%s\t%s\t%s\t%d\t%s\n", sa.Addr, sa.Slug, sa.Kind,
+			scanByte(sa.Min), scanByte(sa.Max), sa.Distinct, r.formatByState(sa))
+	}
+	return tw.Flush()
+}
+
+// formatByState renders "idle: 12 12 13 | rev: 80 91" in report state order.
+func (r *ScanReport) formatByState(sa ScanAddress) string {
+	parts := make([]string, 0, len(r.States))
+	for _, state := range r.States {
+		vals := sa.ByState[state]
+		if len(vals) == 0 {
+			continue
+		}
+		strs := make([]string, len(vals))
+		for i, v := range vals {
+			strs[i] = fmt.Sprintf("%d", v)
+		}
+		parts = append(parts, state+": "+strings.Join(strs, " "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func scanByte(v int) string {
+	if v == NoResponse {
+		return "-"
+	}
+	return fmt.Sprintf("%d", v)
+}
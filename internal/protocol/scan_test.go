@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+func TestECU_SweepRejectsCommandRange(t *testing.T) {
+	ecu := NewECU(NewSerialConn("/dev/null", DefaultBaudRate), nil)
+	if _, err := ecu.Sweep(0xB0, 0xC0, "idle", nil); err == nil {
+		t.Error("Sweep into 0xC0 should be refused")
+	}
+	if _, err := ecu.Sweep(0x20, 0x10, "idle", nil); err == nil {
+		t.Error("Sweep with from > to should fail")
+	}
+}
+
+func TestECU_SweepEmulator(t *testing.T) {
+	cfg := fastEmulatorConfig()
+	cfg.ActiveDTCs = 0x1234
+	ecu, _ := emulatorECU(t, cfg)
+
+	calls := 0
+	sw, err := ecu.Sweep(0x36, 0x3A, "key-on", func(byte) { calls++ })
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if calls != 5 || len(sw.Values) != 5 {
+		t.Fatalf("swept %d addresses with %d progress calls, want 5", len(sw.Values), calls)
+	}
+	if v, ok := sw.Value(AddrActiveDTCLow); !ok || v != 0x34 {
+		t.Errorf("0x38 = (0x%02X, %v), want 0x34", v, ok)
+	}
+	if v, ok := sw.Value(AddrActiveDTCHigh); !ok || v != 0x12 {
+		t.Errorf("0x39 = (0x%02X, %v), want 0x12", v, ok)
+	}
+	if _, ok := sw.Value(0x40); ok {
+		t.Error("address outside the sweep reported a value")
+	}
+}
+
+func TestNewScanReport_Classifies(t *testing.T) {
+	// Addresses 0x20-0x23: constant, state-dependent, live, silent
+	sweeps := []Sweep{
+		{State: "idle", From: 0x20, Values: []int{5, 10, 1, NoResponse}},
+		{State: "idle", From: 0x20, Values: []int{5, 10, 2, NoResponse}},
+		{State: "rev", From: 0x20, Values: []int{5, 90, 3, NoResponse}},
+		{State: "rev", From: 0x20, Values: []int{5, 90, 3, NoResponse}},
+	}
+	r := NewScanReport(sweeps, 0x20, 0x23, sensor.DefaultDefinitions())
+
+	want := []string{ScanConstant, ScanState, ScanLive, ScanSilent}
+	for i, sa := range r.Addresses {
+		if sa.Kind != want[i] {
+			t.Errorf("0x%02X kind = %s, want %s", sa.Addr, sa.Kind, want[i])
+		}
+	}
+	if r.Addresses[1].Min != 10 || r.Addresses[1].Max != 90 || r.Addresses[1].Distinct != 2 {
+		t.Errorf("0x21 summary = %+v", r.Addresses[1])
+	}
+	if r.Addresses[1].Slug != "RPM" {
+		t.Errorf("0x21 slug = %q, want RPM", r.Addresses[1].Slug)
+	}
+	if len(r.States) != 2 || len(r.Responding()) != 3 || len(r.Changing()) != 2 {
+		t.Errorf("states %v, %d responding, %d changing", r.States, len(r.Responding()), len(r.Changing()))
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "idle: 10 10 | rev: 90 90") {
+		t.Errorf("text report missing per-state values:\n%s", out)
+	}
+	if strings.Contains(out, "\n0x23") {
+		t.Errorf("silent address listed without all:\n%s", out)
+	}
+}
@@ -18,25 +18,40 @@ const (
 )
 
 // SerialConn wraps a serial port connection to the ECU.
+// It is the default Transport implementation.
 type SerialConn struct {
-	mu       sync.Mutex
-	port     serial.Port
-	portName string
-	baudRate int
-	isOpen   bool
+	mu          sync.Mutex
+	port        serial.Port
+	portName    string
+	baudRate    int
+	nominalBaud int // rate the device normally runs at; Open warns on others
+	readTimeout time.Duration
+	isOpen      bool
 }
 
+var _ Transport = (*SerialConn)(nil)
+
 // NewSerialConn creates a new serial connection (not yet opened).
 func NewSerialConn(portName string, baudRate int) *SerialConn {
 	if baudRate <= 0 {
 		baudRate = DefaultBaudRate
 	}
 	return &SerialConn{
-		portName: portName,
-		baudRate: baudRate,
+		portName:    portName,
+		baudRate:    baudRate,
+		nominalBaud: DefaultBaudRate,
+		readTimeout: DefaultReadTimeout,
 	}
 }
 
+// SetNominalBaud sets the rate the device on the port normally runs at, for
+// ports that do not talk to the ECU (e.g. a wideband controller).
+func (sc *SerialConn) SetNominalBaud(baud int) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.nominalBaud = baud
+}
+
 // Open opens the serial port with MMCD protocol settings (8N1, no flow control).
 func (sc *SerialConn) Open() error {
 	sc.mu.Lock()
@@ -58,8 +73,7 @@ func (sc *SerialConn) Open() error {
 		return fmt.Errorf("failed to open serial port %s: %w", sc.portName, err)
 	}
 
-	// Set read timeout to 500ms (matching original code's half-second timeout)
-	if err := port.SetReadTimeout(500 * time.Millisecond); err != nil {
+	if err := port.SetReadTimeout(sc.readTimeout); err != nil {
 		port.Close()
 		return fmt.Errorf("failed to set read timeout: %w", err)
 	}
@@ -67,8 +81,8 @@ func (sc *SerialConn) Open() error {
 	sc.port = port
 	sc.isOpen = true
 	slog.Info("serial port opened", "port", sc.portName, "baud", sc.baudRate)
-	if sc.baudRate != DefaultBaudRate {
-		slog.Warn("non-standard baud rate", "baud", sc.baudRate, "expected", DefaultBaudRate)
+	if sc.baudRate != sc.nominalBaud {
+		slog.Warn("non-standard baud rate", "baud", sc.baudRate, "expected", sc.nominalBaud)
 	}
 	return nil
 }
@@ -118,6 +132,19 @@ func (sc *SerialConn) Receive(buf []byte) (int, error) {
 	return sc.port.Read(buf)
 }
 
+// SetReadTimeout bounds how long a single Receive may block. If the port is
+// not open yet, the timeout is applied when it is opened.
+func (sc *SerialConn) SetReadTimeout(d time.Duration) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.readTimeout = d
+	if !sc.isOpen {
+		return nil
+	}
+	return sc.port.SetReadTimeout(d)
+}
+
 // PortName returns the configured port name.
 func (sc *SerialConn) PortName() string {
 	return sc.portName
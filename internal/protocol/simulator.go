@@ -1,6 +1,8 @@
 package protocol
 
 import (
+	"fmt"
+	"log/slog"
 	"math"
 	"math/rand"
 	"sync"
@@ -15,19 +17,37 @@ type Simulator struct {
 	mu      sync.Mutex
 	defs    []sensor.Definition
 	running bool
-	tick    float64 // simulation time in seconds
+	tick    float64   // simulation time in seconds
+	start   time.Time // wall clock origin for ReadAddress
 	rng     *rand.Rand
+	faults  faultInjector
 }
 
 // NewSimulator creates a new ECU data simulator.
 func NewSimulator(defs []sensor.Definition) *Simulator {
 	return &Simulator{
-		defs: defs,
-		rng:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		defs:  defs,
+		start: time.Now(),
+		rng:   rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// SetFaults installs a fault profile. The disconnect timer starts now.
+func (s *Simulator) SetFaults(fp FaultProfile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = newFaultInjector(fp)
+}
+
+// Faults returns the active fault profile.
+func (s *Simulator) Faults() FaultProfile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults.profile
+}
+
 // PollSensors generates a simulated sample for the given sensor indices.
+// Like ECU.PollSensors, it returns an error only when no sensor answered.
 func (s *Simulator) PollSensors(indices []int) (sensor.Sample, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -37,143 +57,230 @@ func (s *Simulator) PollSensors(indices []int) (sensor.Sample, error) {
 	var sample sensor.Sample
 	sample.Time = time.Now()
 
+	if s.faults.disconnected() {
+		return sample, fmt.Errorf("simulated disconnect: ECU not responding")
+	}
+
+	st := scenarioAt(s.tick)
+	queried, answered, sent := 0, 0, 0
+	var lastErr error
+	for _, idx := range indices {
+		if idx < 0 || idx >= len(s.defs) {
+			continue
+		}
+		def := s.defs[idx]
+		if !def.Exists || def.Computed {
+			continue
+		}
+		queried++
+		if err := s.injectFault(def.Addr); err != nil {
+			slog.Debug("sensor query failed", "slug", def.Slug, "addr", fmt.Sprintf("0x%02X", def.Addr), "error", err)
+			lastErr = err
+			continue
+		}
+		// Stamp each channel as if the sweep ran at wire speed
+		sent += max(def.Size, 1)
+		at := sample.Time.Add(time.Duration(sent) * simQueryTime)
+		sample.SetWordAt(idx, s.rawWord(def, idx, st), at)
+		answered++
+	}
+
+	if queried > 0 && answered == 0 {
+		return sample, fmt.Errorf("no sensors responded (%d queried): %w", queried, lastErr)
+	}
+
+	// Compute INJD
+	sample.ComputeDerivatives(s.defs)
+
+	return sample, nil
+}
+
+// simQueryTime is one request/echo/data exchange (3 bytes, 8N1) at 1920 baud.
+const simQueryTime = 3 * 10 * time.Second / 1920
+
+// injectFault returns the error a real ECU query for addr would produce under
+// the active fault profile, or nil if the query succeeds. Caller must hold s.mu.
+func (s *Simulator) injectFault(addr byte) error {
+	fi := &s.faults
+	fp := fi.profile
+	switch {
+	case fi.roll(fp.DropRate):
+		return fmt.Errorf("timeout reading response for 0x%02X: got 1 bytes", addr)
+	case fi.roll(fp.WrongEchoRate):
+		return fmt.Errorf("echo mismatch for 0x%02X: got 0x%02X", addr, addr^0x5A)
+	case fi.roll(fp.StaleRate):
+		return fmt.Errorf("echo mismatch for 0x%02X: got 0x00", addr)
+	}
+	if fi.roll(fp.SlowRate) {
+		if fp.SlowDelay >= DefaultReadTimeout {
+			time.Sleep(DefaultReadTimeout)
+			return fmt.Errorf("timeout reading response for 0x%02X: got 0 bytes", addr)
+		}
+		time.Sleep(fp.SlowDelay)
+	}
+	return nil
+}
+
+// ReadAddress returns the simulated raw byte for an ECU address, using wall
+// clock time since the simulator was created to drive the driving cycle.
+// Addresses with no sensor definition read back as 0x00, as on a real ECU
+// where they are plain RAM, and the addresses of a two-byte sensor each
+// hold their byte of its word. Used by the byte-level Emulator.
+func (s *Simulator) ReadAddress(addr byte) byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx, def := sensor.FindByAddr(s.defs, addr)
+	if def == nil || def.Computed {
+		return 0x00
+	}
+	w := s.rawWord(*def, idx, scenarioAt(time.Since(s.start).Seconds()))
+	if def.IsWord() && (addr == def.Addr) != def.LittleEndian {
+		return byte(w >> 8) // the high byte
+	}
+	return byte(w)
+}
+
+// scenario holds the target values for one point in the driving cycle.
+type scenario struct {
+	rpm, tps, cool, timing, injp float64
+	tick                         float64
+}
+
+// scenarioAt returns the driving-cycle targets at simulation time t (seconds).
+func scenarioAt(t float64) scenario {
 	// Driving cycle: 60-second loop
 	// 0-10s: idle
 	// 10-20s: acceleration (revving up)
 	// 20-40s: cruise
 	// 40-50s: deceleration
 	// 50-60s: idle
-	cyclePos := math.Mod(s.tick, 60.0)
-
-	var rpmTarget, tpsTarget, coolTarget float64
-	var timingTarget, injpTarget float64
+	cyclePos := math.Mod(t, 60.0)
 
+	st := scenario{tick: t}
 	switch {
 	case cyclePos < 10: // idle
-		rpmTarget = 850
-		tpsTarget = 0
-		coolTarget = 82
-		timingTarget = 10
-		injpTarget = 3.0
+		st.rpm = 850
+		st.tps = 0
+		st.cool = 82
+		st.timing = 10
+		st.injp = 3.0
 	case cyclePos < 20: // acceleration
 		progress := (cyclePos - 10) / 10.0
-		rpmTarget = 850 + progress*5150 // up to 6000
-		tpsTarget = 30 + progress*60    // up to 90%
-		coolTarget = 82 + progress*8    // warming up
-		timingTarget = 10 + progress*25
-		injpTarget = 3.0 + progress*15.0
+		st.rpm = 850 + progress*5150 // up to 6000
+		st.tps = 30 + progress*60    // up to 90%
+		st.cool = 82 + progress*8    // warming up
+		st.timing = 10 + progress*25
+		st.injp = 3.0 + progress*15.0
 	case cyclePos < 40: // cruise
-		rpmTarget = 3200
-		tpsTarget = 25
-		coolTarget = 90
-		timingTarget = 32
-		injpTarget = 8.0
+		st.rpm = 3200
+		st.tps = 25
+		st.cool = 90
+		st.timing = 32
+		st.injp = 8.0
 	case cyclePos < 50: // deceleration
 		progress := (cyclePos - 40) / 10.0
-		rpmTarget = 3200 - progress*2350 // down to 850
-		tpsTarget = 25 - progress*25     // closing
-		coolTarget = 90 - progress*8
-		timingTarget = 32 - progress*22
-		injpTarget = 8.0 - progress*5.0
+		st.rpm = 3200 - progress*2350 // down to 850
+		st.tps = 25 - progress*25     // closing
+		st.cool = 90 - progress*8
+		st.timing = 32 - progress*22
+		st.injp = 8.0 - progress*5.0
 	default: // idle again
-		rpmTarget = 850
-		tpsTarget = 0
-		coolTarget = 82
-		timingTarget = 10
-		injpTarget = 3.0
+		st.rpm = 850
+		st.tps = 0
+		st.cool = 82
+		st.timing = 10
+		st.injp = 3.0
+	}
+	return st
+}
+
+// rawWord generates the raw byte or word for one sensor at the given
+// scenario point. Two-byte and signed sensors, which only sensor files
+// define, hover around the middle of their raw range.
+// Caller must hold s.mu.
+func (s *Simulator) rawWord(def sensor.Definition, idx int, st scenario) uint16 {
+	if !def.IsWord() && !def.Signed {
+		return uint16(s.rawValue(def, idx, st))
 	}
+	lo, hi := def.RawRange()
+	mid, span := float64(lo+hi)/2, float64(hi-lo)
+	w, _ := def.RawWord(int(clamp(mid+(s.rng.Float64()-0.5)*span/25, float64(lo), float64(hi))))
+	return w
+}
 
+// rawValue generates the raw byte for one sensor at the given scenario point.
+// Caller must hold s.mu (the RNG is not safe for concurrent use).
+func (s *Simulator) rawValue(def sensor.Definition, idx int, st scenario) byte {
 	// Add noise
 	noise := func(base, amplitude float64) float64 {
 		return base + (s.rng.Float64()-0.5)*2*amplitude
 	}
 
-	for _, idx := range indices {
-		if idx < 0 || idx >= len(s.defs) {
-			continue
+	switch def.Slug {
+	case "RPM":
+		return byte(clamp(noise(st.rpm, 30)/31.25, 0, 255))
+	case "TPS":
+		return byte(clamp(noise(st.tps, 1)*255/100, 0, 255))
+	case "COOL":
+		// Reverse the coolant temp interpolation to get raw value
+		// ~82°C maps to roughly raw 100, ~90°C to raw 85
+		return byte(clamp(noise(200-st.cool*1.2, 2), 0, 255))
+	case "TIMA":
+		return byte(clamp(noise(st.timing+10, 1), 0, 255))
+	case "KNCK":
+		// Occasional knock during high RPM
+		if st.rpm > 4000 && s.rng.Float64() < 0.15 {
+			return byte(s.rng.Intn(5) + 1)
 		}
-		def := s.defs[idx]
-		if !def.Exists || def.Computed {
-			continue
+		return 0
+	case "INJP":
+		return byte(clamp(noise(st.injp/0.256, 0.5), 0, 255))
+	case "BATT":
+		// ~14.2V while running
+		return byte(clamp(noise(14.2/0.0733, 0.5), 0, 255))
+	case "O2-R", "O2-F":
+		// Oscillate between lean/rich (0.2-0.8V)
+		o2v := 0.45 + 0.35*math.Sin(st.tick*3.0+float64(idx))
+		return byte(clamp(o2v/0.0195, 0, 255))
+	case "BARO":
+		// ~1.01 bar (sea level)
+		return byte(clamp(noise(1.01/0.00486, 0.3), 0, 255))
+	case "ISC":
+		// Higher at idle, lower when driving
+		if st.rpm < 1000 {
+			return byte(clamp(noise(35, 2)*255/100, 0, 255))
 		}
-
-		var raw byte
-		switch def.Slug {
-		case "RPM":
-			raw = byte(clamp(noise(rpmTarget, 30)/31.25, 0, 255))
-		case "TPS":
-			raw = byte(clamp(noise(tpsTarget, 1)*255/100, 0, 255))
-		case "COOL":
-			// Reverse the coolant temp interpolation to get raw value
-			// ~82°C maps to roughly raw 100, ~90°C to raw 85
-			raw = byte(clamp(noise(200-coolTarget*1.2, 2), 0, 255))
-		case "TIMA":
-			raw = byte(clamp(noise(timingTarget+10, 1), 0, 255))
-		case "KNCK":
-			// Occasional knock during high RPM
-			if rpmTarget > 4000 && s.rng.Float64() < 0.15 {
-				raw = byte(s.rng.Intn(5) + 1)
-			} else {
-				raw = 0
-			}
-		case "INJP":
-			raw = byte(clamp(noise(injpTarget/0.256, 0.5), 0, 255))
-		case "BATT":
-			// ~14.2V while running
-			raw = byte(clamp(noise(14.2/0.0733, 0.5), 0, 255))
-		case "O2-R", "O2-F":
-			// Oscillate between lean/rich (0.2-0.8V)
-			o2v := 0.45 + 0.35*math.Sin(s.tick*3.0+float64(idx))
-			raw = byte(clamp(o2v/0.0195, 0, 255))
-		case "BARO":
-			// ~1.01 bar (sea level)
-			raw = byte(clamp(noise(1.01/0.00486, 0.3), 0, 255))
-		case "ISC":
-			// Higher at idle, lower when driving
-			if rpmTarget < 1000 {
-				raw = byte(clamp(noise(35, 2)*255/100, 0, 255))
-			} else {
-				raw = byte(clamp(noise(10, 1)*255/100, 0, 255))
-			}
-		case "MAFS":
-			raw = byte(clamp(noise(rpmTarget*0.08/6.29, 1), 0, 255))
-		case "AIRT":
-			// ~25°C intake air
-			raw = byte(clamp(noise(128, 2), 0, 255))
-		case "EGRT":
-			// Hotter under load
-			raw = byte(clamp(noise((314.27-150+tpsTarget*0.5)/1.5, 2), 0, 255))
-		case "FTRL", "FTRM", "FTRH":
-			// Hover around 100% (stoich)
-			raw = byte(clamp(noise(128, 3), 0, 255))
-		case "FTO2":
-			raw = byte(clamp(noise(128, 5), 0, 255))
-		case "ACLE":
-			// Spikes during throttle changes
-			if tpsTarget > 50 {
-				raw = byte(clamp(noise(tpsTarget*0.5*255/100, 3), 0, 255))
-			} else {
-				raw = byte(clamp(noise(5, 2), 0, 255))
-			}
-		case "FLG0":
-			raw = 0x20 // AC off
-		case "FLG2":
-			if rpmTarget < 1000 {
-				raw = 0x80 // idle flag set
-			} else {
-				raw = 0x00
-			}
-		default:
-			raw = byte(clamp(noise(128, 10), 0, 255))
+		return byte(clamp(noise(10, 1)*255/100, 0, 255))
+	case "MAFS":
+		return byte(clamp(noise(st.rpm*0.08/6.29, 1), 0, 255))
+	case "AIRT":
+		// ~25°C intake air
+		return byte(clamp(noise(128, 2), 0, 255))
+	case "EGRT":
+		// Hotter under load
+		return byte(clamp(noise((314.27-150+st.tps*0.5)/1.5, 2), 0, 255))
+	case "FTRL", "FTRM", "FTRH":
+		// Hover around 100% (stoich)
+		return byte(clamp(noise(128, 3), 0, 255))
+	case "FTO2":
+		return byte(clamp(noise(128, 5), 0, 255))
+	case "ACLE":
+		// Spikes during throttle changes
+		if st.tps > 50 {
+			return byte(clamp(noise(st.tps*0.5*255/100, 3), 0, 255))
 		}
-
-		sample.SetData(idx, raw)
+		return byte(clamp(noise(5, 2), 0, 255))
+	case "FLG0":
+		return 0x20 // AC off
+	case "FLG2":
+		if st.rpm < 1000 {
+			return 0x80 // idle flag set
+		}
+		return 0x00
+	default:
+		return byte(clamp(noise(128, 10), 0, 255))
 	}
-
-	// Compute INJD
-	sample.ComputeDerivatives(s.defs)
-
-	return sample, nil
 }
 
 func clamp(v, min, max float64) float64 {
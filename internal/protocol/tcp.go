@@ -0,0 +1,458 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// tcpDialTimeout bounds how long Open waits for the remote bridge.
+	tcpDialTimeout = 5 * time.Second
+
+	// tcpFlushWindow is how long Flush keeps draining after the last byte seen.
+	tcpFlushWindow = 20 * time.Millisecond
+
+	// rfc2217AckTimeout bounds how long Open waits for the baud rate acknowledgement.
+	rfc2217AckTimeout = 2 * time.Second
+)
+
+// Telnet and RFC 2217 (COM-PORT-OPTION) protocol bytes.
+const (
+	telnetSE   byte = 240
+	telnetSB   byte = 250
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255
+
+	telnetOptBinary  byte = 0
+	telnetOptSGA     byte = 3
+	telnetOptComPort byte = 44
+
+	comPortSetBaudRate byte = 1
+	comPortSetDataSize byte = 2
+	comPortSetParity   byte = 3
+	comPortSetStopSize byte = 4
+	comPortSetControl  byte = 5
+	comPortPurgeData   byte = 12
+	comPortServerBase  byte = 100 // server replies use the client code + 100
+
+	comPortParityNone   byte = 1
+	comPortStopBitsOne  byte = 1
+	comPortControlNone  byte = 1
+	comPortPurgeReceive byte = 1
+)
+
+// TCPConn is a Transport that reaches the ECU through a network serial bridge.
+// In raw mode it speaks plain TCP to a ser2net-style port where the bridge
+// owns the line settings. In RFC 2217 mode it negotiates baud rate and 8N1
+// framing with the bridge over Telnet COM-PORT-OPTION.
+type TCPConn struct {
+	mu          sync.Mutex
+	rmu         sync.Mutex // serializes Receive and Flush, which read without holding mu so Close can interrupt them
+	addr        string
+	baudRate    int
+	rfc2217     bool
+	readTimeout time.Duration
+	conn        net.Conn
+	isOpen      bool
+
+	// RFC 2217 receive state
+	telnet    telnetState
+	sub       []byte // subnegotiation payload being collected
+	cmd       byte   // pending WILL/WONT/DO/DONT awaiting its option byte
+	ackedBaud int    // baud rate confirmed by the server, 0 until acknowledged
+	pending   []byte // decoded data bytes not yet returned by Receive
+}
+
+var _ Transport = (*TCPConn)(nil)
+
+type telnetState int
+
+const (
+	telnetData telnetState = iota
+	telnetGotIAC
+	telnetGotCmd
+	telnetInSB
+	telnetInSBGotIAC
+)
+
+// NewTCPConn creates a raw TCP transport to host:port (not yet opened).
+func NewTCPConn(addr string, baudRate int) *TCPConn {
+	if baudRate <= 0 {
+		baudRate = DefaultBaudRate
+	}
+	return &TCPConn{
+		addr:        addr,
+		baudRate:    baudRate,
+		readTimeout: DefaultReadTimeout,
+	}
+}
+
+// NewRFC2217Conn creates an RFC 2217 transport to host:port (not yet opened).
+// The baud rate is negotiated with the bridge when the connection is opened.
+func NewRFC2217Conn(addr string, baudRate int) *TCPConn {
+	tc := NewTCPConn(addr, baudRate)
+	tc.rfc2217 = true
+	return tc
+}
+
+// Open dials the bridge and, in RFC 2217 mode, negotiates the line settings.
+func (tc *TCPConn) Open() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if tc.isOpen {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("tcp", tc.addr, tcpDialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", tc.addr, err)
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetNoDelay(true) // single-byte requests must not sit in Nagle's buffer
+	}
+
+	tc.conn = conn
+	tc.isOpen = true
+	tc.telnet = telnetData
+	tc.sub = nil
+	tc.pending = nil
+	tc.ackedBaud = 0
+
+	if tc.rfc2217 {
+		if err := tc.negotiate(); err != nil {
+			tc.conn.Close()
+			tc.conn = nil
+			tc.isOpen = false
+			return err
+		}
+	}
+
+	slog.Info("network port opened", "addr", tc.addr, "rfc2217", tc.rfc2217, "baud", tc.baudRate)
+	return nil
+}
+
+// negotiate sends the RFC 2217 option requests and waits for the bridge to
+// acknowledge the baud rate. Caller must hold tc.mu.
+func (tc *TCPConn) negotiate() error {
+	req := []byte{
+		telnetIAC, telnetWILL, telnetOptComPort,
+		telnetIAC, telnetWILL, telnetOptBinary,
+		telnetIAC, telnetDO, telnetOptBinary,
+		telnetIAC, telnetWILL, telnetOptSGA,
+		telnetIAC, telnetDO, telnetOptSGA,
+	}
+	baud := make([]byte, 4)
+	binary.BigEndian.PutUint32(baud, uint32(tc.baudRate))
+	req = append(req, comPortCommand(comPortSetBaudRate, baud...)...)
+	req = append(req, comPortCommand(comPortSetDataSize, DefaultDataBits)...)
+	req = append(req, comPortCommand(comPortSetParity, comPortParityNone)...)
+	req = append(req, comPortCommand(comPortSetStopSize, comPortStopBitsOne)...)
+	req = append(req, comPortCommand(comPortSetControl, comPortControlNone)...)
+
+	if _, err := tc.conn.Write(req); err != nil {
+		return fmt.Errorf("failed to send RFC 2217 negotiation to %s: %w", tc.addr, err)
+	}
+
+	deadline := time.Now().Add(rfc2217AckTimeout)
+	buf := make([]byte, 64)
+	for tc.ackedBaud == 0 && time.Now().Before(deadline) {
+		tc.conn.SetReadDeadline(deadline)
+		n, err := tc.conn.Read(buf)
+		if n > 0 {
+			tc.decode(buf[:n])
+		}
+		if err != nil {
+			if isTimeout(err) {
+				break
+			}
+			return fmt.Errorf("RFC 2217 negotiation with %s failed: %w", tc.addr, err)
+		}
+	}
+
+	switch {
+	case tc.ackedBaud == 0:
+		slog.Warn("RFC 2217 server did not acknowledge baud rate", "addr", tc.addr, "requested", tc.baudRate)
+	case tc.ackedBaud != tc.baudRate:
+		slog.Warn("RFC 2217 server set a different baud rate", "addr", tc.addr, "requested", tc.baudRate, "actual", tc.ackedBaud)
+	}
+	return nil
+}
+
+// comPortCommand builds an IAC SB COM-PORT-OPTION subnegotiation, escaping
+// any 0xFF in the payload.
+func comPortCommand(code byte, value ...byte) []byte {
+	out := []byte{telnetIAC, telnetSB, telnetOptComPort, code}
+	out = append(out, escapeIAC(value)...)
+	return append(out, telnetIAC, telnetSE)
+}
+
+// escapeIAC doubles every 0xFF so it is sent as data rather than a Telnet command.
+func escapeIAC(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for _, b := range data {
+		out = append(out, b)
+		if b == telnetIAC {
+			out = append(out, telnetIAC)
+		}
+	}
+	return out
+}
+
+// decode strips Telnet commands from received bytes, appends the data bytes
+// to tc.pending and answers option requests. Caller must hold tc.mu.
+func (tc *TCPConn) decode(in []byte) {
+	for _, b := range in {
+		switch tc.telnet {
+		case telnetData:
+			if b == telnetIAC {
+				tc.telnet = telnetGotIAC
+			} else {
+				tc.pending = append(tc.pending, b)
+			}
+		case telnetGotIAC:
+			switch b {
+			case telnetIAC:
+				tc.pending = append(tc.pending, telnetIAC)
+				tc.telnet = telnetData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				tc.cmd = b
+				tc.telnet = telnetGotCmd
+			case telnetSB:
+				tc.sub = tc.sub[:0]
+				tc.telnet = telnetInSB
+			default:
+				tc.telnet = telnetData // NOP, GA, etc.
+			}
+		case telnetGotCmd:
+			tc.answerOption(tc.cmd, b)
+			tc.telnet = telnetData
+		case telnetInSB:
+			if b == telnetIAC {
+				tc.telnet = telnetInSBGotIAC
+			} else {
+				tc.sub = append(tc.sub, b)
+			}
+		case telnetInSBGotIAC:
+			switch b {
+			case telnetIAC:
+				tc.sub = append(tc.sub, telnetIAC)
+				tc.telnet = telnetInSB
+			case telnetSE:
+				tc.handleSubnegotiation(tc.sub)
+				tc.telnet = telnetData
+			default:
+				tc.telnet = telnetData // malformed; drop it
+			}
+		}
+	}
+}
+
+// answerOption refuses any Telnet option we did not ask for.
+func (tc *TCPConn) answerOption(cmd, opt byte) {
+	switch opt {
+	case telnetOptBinary, telnetOptSGA, telnetOptComPort:
+		return
+	}
+	var reply byte
+	switch cmd {
+	case telnetDO:
+		reply = telnetWONT
+	case telnetWILL:
+		reply = telnetDONT
+	default:
+		return
+	}
+	tc.conn.Write([]byte{telnetIAC, reply, opt})
+}
+
+// handleSubnegotiation records the server's answers to COM-PORT-OPTION requests.
+func (tc *TCPConn) handleSubnegotiation(sub []byte) {
+	if len(sub) < 2 || sub[0] != telnetOptComPort {
+		return
+	}
+	code, value := sub[1], sub[2:]
+	switch code {
+	case comPortServerBase + comPortSetBaudRate:
+		if len(value) == 4 {
+			tc.ackedBaud = int(binary.BigEndian.Uint32(value))
+		}
+	case comPortServerBase + comPortSetDataSize,
+		comPortServerBase + comPortSetParity,
+		comPortServerBase + comPortSetStopSize,
+		comPortServerBase + comPortSetControl:
+		slog.Debug("RFC 2217 line setting acknowledged", "code", code-comPortServerBase, "value", value)
+	}
+}
+
+// Close closes the network connection.
+func (tc *TCPConn) Close() error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if !tc.isOpen {
+		return nil
+	}
+
+	err := tc.conn.Close()
+	tc.conn = nil
+	tc.isOpen = false
+	tc.pending = nil
+	slog.Info("network port closed", "addr", tc.addr)
+	return err
+}
+
+// IsOpen returns whether the connection is currently open.
+func (tc *TCPConn) IsOpen() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.isOpen
+}
+
+// Send writes bytes to the bridge, escaping 0xFF in RFC 2217 mode.
+func (tc *TCPConn) Send(data []byte) (int, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if !tc.isOpen {
+		return 0, fmt.Errorf("network port not open")
+	}
+	out := data
+	if tc.rfc2217 {
+		out = escapeIAC(data)
+	}
+	if _, err := tc.conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Receive reads data bytes, waiting at most the read timeout.
+// A timeout returns (0, nil), matching SerialConn. The read itself does not
+// hold tc.mu, so Close interrupts a pending Receive rather than waiting for
+// its timeout.
+func (tc *TCPConn) Receive(buf []byte) (int, error) {
+	tc.rmu.Lock()
+	defer tc.rmu.Unlock()
+
+	tc.mu.Lock()
+	if !tc.isOpen {
+		tc.mu.Unlock()
+		return 0, fmt.Errorf("network port not open")
+	}
+	conn := tc.conn
+	deadline := time.Now().Add(tc.readTimeout)
+	tc.mu.Unlock()
+
+	raw := make([]byte, len(buf))
+	timedOut := false
+	for {
+		tc.mu.Lock()
+		if tc.conn != conn {
+			tc.mu.Unlock()
+			return 0, fmt.Errorf("network port not open")
+		}
+		if len(tc.pending) > 0 || timedOut {
+			n := copy(buf, tc.pending)
+			tc.pending = tc.pending[n:]
+			tc.mu.Unlock()
+			return n, nil
+		}
+		tc.mu.Unlock()
+
+		conn.SetReadDeadline(deadline)
+		n, err := conn.Read(raw)
+		if n > 0 {
+			tc.mu.Lock()
+			if tc.conn == conn {
+				if tc.rfc2217 {
+					tc.decode(raw[:n])
+				} else {
+					tc.pending = append(tc.pending, raw[:n]...)
+				}
+			}
+			tc.mu.Unlock()
+		}
+		if err != nil {
+			if !isTimeout(err) && tc.IsOpen() {
+				return 0, err
+			}
+			timedOut = true // or closed, which the next pass reports
+		}
+	}
+}
+
+// Flush discards buffered bytes. In RFC 2217 mode it also asks the bridge
+// to purge its own receive buffer.
+func (tc *TCPConn) Flush() error {
+	tc.rmu.Lock()
+	defer tc.rmu.Unlock()
+
+	tc.mu.Lock()
+	if !tc.isOpen {
+		tc.mu.Unlock()
+		return nil
+	}
+	conn := tc.conn
+	if tc.rfc2217 {
+		if _, err := conn.Write(comPortCommand(comPortPurgeData, comPortPurgeReceive)); err != nil {
+			tc.mu.Unlock()
+			return err
+		}
+	}
+	tc.mu.Unlock()
+
+	raw := make([]byte, 256)
+	for {
+		conn.SetReadDeadline(time.Now().Add(tcpFlushWindow))
+		n, err := conn.Read(raw)
+		tc.mu.Lock()
+		if tc.conn != conn {
+			tc.mu.Unlock()
+			return nil // closed while draining
+		}
+		if n > 0 && tc.rfc2217 {
+			tc.decode(raw[:n]) // still honour option replies mixed into the stale data
+		}
+		if err != nil {
+			tc.pending = nil
+			tc.mu.Unlock()
+			if isTimeout(err) {
+				return nil
+			}
+			return err
+		}
+		tc.mu.Unlock()
+	}
+}
+
+// SetReadTimeout bounds how long a single Receive may block.
+func (tc *TCPConn) SetReadTimeout(d time.Duration) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.readTimeout = d
+	return nil
+}
+
+// Addr returns the configured host:port.
+func (tc *TCPConn) Addr() string {
+	return tc.addr
+}
+
+// BaudRate returns the configured baud rate.
+func (tc *TCPConn) BaudRate() int {
+	return tc.baudRate
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,219 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// serveOnce accepts one connection on a loopback listener and hands it to fn.
+func serveOnce(t *testing.T, fn func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fn(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestTCPConn_RawQuery(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		buf := make([]byte, 1)
+		for {
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				return
+			}
+			conn.Write([]byte{buf[0], 0x55})
+		}
+	})
+
+	tc := NewTCPConn(addr, DefaultBaudRate)
+	if err := tc.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer tc.Close()
+
+	ecu := NewECU(tc, nil)
+	data, err := ecu.QuerySensor(0x21)
+	if err != nil {
+		t.Fatalf("QuerySensor over TCP failed: %v", err)
+	}
+	if data != 0x55 {
+		t.Errorf("QuerySensor = 0x%02X, want 0x55", data)
+	}
+}
+
+func TestTCPConn_ReceiveTimeoutIsNotAnError(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+
+	tc := NewTCPConn(addr, DefaultBaudRate)
+	if err := tc.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer tc.Close()
+	tc.SetReadTimeout(20 * time.Millisecond)
+
+	n, err := tc.Receive(make([]byte, 4))
+	if n != 0 || err != nil {
+		t.Errorf("Receive on idle connection = (%d, %v), want (0, nil)", n, err)
+	}
+}
+
+func TestTCPConn_CloseInterruptsReceive(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		io.Copy(io.Discard, conn)
+	})
+
+	tc := NewTCPConn(addr, DefaultBaudRate)
+	if err := tc.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	tc.SetReadTimeout(10 * time.Second)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := tc.Receive(make([]byte, 4))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let Receive block in the read
+
+	start := time.Now()
+	tc.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Close waited %v for the pending Receive", d)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Receive on a closed connection returned no error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Receive still blocked after Close")
+	}
+}
+
+func TestRFC2217Conn_NegotiatesBaudAndUnescapes(t *testing.T) {
+	gotBaud := make(chan uint32, 1)
+	addr := serveOnce(t, func(conn net.Conn) {
+		// Read the client's negotiation until the SET-BAUDRATE subnegotiation.
+		want := []byte{telnetIAC, telnetSB, telnetOptComPort, comPortSetBaudRate}
+		var seen []byte
+		buf := make([]byte, 256)
+		for !bytes.Contains(seen, want) || len(seen) < bytes.Index(seen, want)+len(want)+4 {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			seen = append(seen, buf[:n]...)
+		}
+		i := bytes.Index(seen, want) + len(want)
+		baud := binary.BigEndian.Uint32(seen[i : i+4])
+		gotBaud <- baud
+
+		// Acknowledge the baud rate, then answer one query with a 0xFF data byte.
+		ack := []byte{telnetIAC, telnetSB, telnetOptComPort, comPortServerBase + comPortSetBaudRate}
+		ack = append(ack, seen[i:i+4]...)
+		ack = append(ack, telnetIAC, telnetSE)
+		conn.Write(ack)
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			for _, b := range buf[:n] {
+				if b == 0x21 {
+					conn.Write([]byte{0x21, telnetIAC, telnetIAC})
+				}
+			}
+		}
+	})
+
+	tc := NewRFC2217Conn(addr, 1920)
+	if err := tc.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer tc.Close()
+
+	select {
+	case baud := <-gotBaud:
+		if baud != 1920 {
+			t.Errorf("negotiated baud = %d, want 1920", baud)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("server never saw SET-BAUDRATE")
+	}
+	if tc.ackedBaud != 1920 {
+		t.Errorf("acknowledged baud = %d, want 1920", tc.ackedBaud)
+	}
+
+	ecu := NewECU(tc, nil)
+	data, err := ecu.QuerySensor(0x21)
+	if err != nil {
+		t.Fatalf("QuerySensor over RFC 2217 failed: %v", err)
+	}
+	if data != 0xFF {
+		t.Errorf("QuerySensor = 0x%02X, want 0xFF (IAC IAC unescaped)", data)
+	}
+}
+
+func TestEscapeIAC(t *testing.T) {
+	got := escapeIAC([]byte{0x01, 0xFF, 0x02})
+	want := []byte{0x01, 0xFF, 0xFF, 0x02}
+	if !bytes.Equal(got, want) {
+		t.Errorf("escapeIAC = % X, want % X", got, want)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	tests := []struct {
+		port    string
+		rfc2217 bool
+		tcp     bool
+		wantErr bool
+	}{
+		{port: "/dev/ttyUSB0"},
+		{port: "COM3"},
+		{port: "tcp://192.168.1.20:4001", tcp: true},
+		{port: "rfc2217://pi.local:2217", tcp: true, rfc2217: true},
+		{port: "tcp://missing-port", wantErr: true},
+		{port: "udp://host:1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		tr, err := NewTransport(tt.port, DefaultBaudRate)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("NewTransport(%q) should fail", tt.port)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("NewTransport(%q) failed: %v", tt.port, err)
+			continue
+		}
+		tc, isTCP := tr.(*TCPConn)
+		if isTCP != tt.tcp {
+			t.Errorf("NewTransport(%q) TCP = %v, want %v", tt.port, isTCP, tt.tcp)
+			continue
+		}
+		if isTCP && tc.rfc2217 != tt.rfc2217 {
+			t.Errorf("NewTransport(%q) rfc2217 = %v, want %v", tt.port, tc.rfc2217, tt.rfc2217)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package protocol
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultReadTimeout matches the original PalmOS code's half-second receive timeout.
+const DefaultReadTimeout = 500 * time.Millisecond
+
+// Transport is the byte stream the ECU protocol runs over.
+// SerialConn is the standard implementation; TCP bridges, in-memory pipes
+// and recorded transcripts can be plugged in without touching ECU.
+//
+// Receive follows go.bug.st/serial semantics: when no data arrives within
+// the read timeout it returns (0, nil) rather than an error, and the ECU
+// request loops retry until their own deadline expires.
+type Transport interface {
+	// Open connects the transport. Calling Open on an open transport is a no-op.
+	Open() error
+	// Close disconnects the transport. Calling Close on a closed transport is a no-op.
+	Close() error
+	// IsOpen returns whether the transport is currently connected.
+	IsOpen() bool
+	// Send writes bytes to the ECU.
+	Send(data []byte) (int, error)
+	// Receive reads available bytes, blocking at most for the read timeout.
+	Receive(buf []byte) (int, error)
+	// Flush discards any stale bytes waiting in the receive buffer.
+	Flush() error
+	// SetReadTimeout bounds how long a single Receive call may block.
+	SetReadTimeout(d time.Duration) error
+}
+
+// NewTransport returns the transport for a --port style address:
+//
+//	tcp://host:port      raw TCP to a ser2net-style bridge
+//	rfc2217://host:port  Telnet COM-PORT-OPTION bridge (baud negotiated remotely)
+//	anything else        local serial device (/dev/ttyUSB0, COM3)
+//
+// The transport is not opened.
+func NewTransport(port string, baudRate int) (Transport, error) {
+	scheme, _, ok := strings.Cut(port, "://")
+	if !ok {
+		return NewSerialConn(port, baudRate), nil
+	}
+
+	u, err := url.Parse(port)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port address %q: %w", port, err)
+	}
+	if u.Host == "" || u.Port() == "" {
+		return nil, fmt.Errorf("invalid port address %q: expected %s://host:port", port, scheme)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "tcp":
+		return NewTCPConn(u.Host, baudRate), nil
+	case "rfc2217", "telnet":
+		return NewRFC2217Conn(u.Host, baudRate), nil
+	default:
+		return nil, fmt.Errorf("unsupported port scheme %q in %q (use tcp:// or rfc2217://)", scheme, port)
+	}
+}
@@ -2,6 +2,7 @@ package sensor
 
 import (
 	"fmt"
+	"strconv"
 )
 
 // UnitSystem controls how temperature and pressure values are displayed.
@@ -25,9 +26,30 @@ func ParseUnitSystem(s string) UnitSystem {
 	}
 }
 
+// String returns the name ParseUnitSystem accepts for u.
+func (u UnitSystem) String() string {
+	switch u {
+	case UnitEnglish:
+		return "imperial"
+	case UnitRaw:
+		return "raw"
+	default:
+		return "metric"
+	}
+}
+
 // ConvertFunc takes a raw byte and unit system, returns (float64, formatted string).
 type ConvertFunc func(raw byte, units UnitSystem) (float64, string)
 
+// rawFunc converts the raw value of a two-byte or signed sensor, see
+// Definition.RawValue.
+type rawFunc func(raw int, units UnitSystem) (float64, string)
+
+// fINT returns the raw value of a two-byte or signed sensor.
+func fINT(raw int, _ UnitSystem) (float64, string) {
+	return float64(raw), strconv.Itoa(raw)
+}
+
 // --- Conversion functions ported from format.c ---
 
 // fDEC returns the raw decimal value 0..255.
@@ -42,44 +64,12 @@ func fHEX(raw byte, _ UnitSystem) (float64, string) {
 
 // fFLG0 decodes flags at address 0x00 (AC clutch relay).
 func fFLG0(raw byte, _ UnitSystem) (float64, string) {
-	s := ""
-	if raw&0x20 == 0 {
-		s = "A"
-	} else {
-		s = "-"
-	}
-	return float64(raw), s
+	return float64(raw), formatFlags(flg0Bits, raw)
 }
 
 // fFLG2 decodes flags at address 0x02 (TDC, P/S, AC, P/N, Idle).
 func fFLG2(raw byte, _ UnitSystem) (float64, string) {
-	flags := ""
-	if raw&0x04 == 0 {
-		flags += "T"
-	} else {
-		flags += "-"
-	}
-	if raw&0x08 != 0 {
-		flags += "S"
-	} else {
-		flags += "-"
-	}
-	if raw&0x10 == 0 {
-		flags += "A"
-	} else {
-		flags += "-"
-	}
-	if raw&0x20 == 0 {
-		flags += "N"
-	} else {
-		flags += "-"
-	}
-	if raw&0x80 != 0 {
-		flags += "I"
-	} else {
-		flags += "-"
-	}
-	return float64(raw), flags
+	return float64(raw), formatFlags(flg2Bits, raw)
 }
 
 // Air temperature interpolation table (from format.c)
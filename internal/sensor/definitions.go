@@ -1,38 +1,225 @@
 package sensor
 
-import "fmt"
-
-// MaxSensors is the maximum number of sensor slots (matches original SENSOR_COUNT).
+import (
+	"fmt"
+	"strconv"
+)
+
+// MaxSensors is the number of slots in the built-in sensor table (matches
+// original SENSOR_COUNT) and in the fixed sample layout of PDB and version
+// 1-3 .mmcd logs, see Sample.SetSlots.
 const MaxSensors = 32
 
+// MaxChannels is the maximum number of definitions in a table. Sensor files
+// may grow the table past MaxSensors; indices must still fit in a byte.
+const MaxChannels = 256
+
 // Definition describes a single ECU sensor: its address, name, and how to convert raw data.
+//
+// Most sensors are one unsigned byte at Addr. A two-byte sensor (Size 2)
+// combines the bytes at Addr and Addr2 into a 16-bit word, and a Signed
+// sensor reads its byte or word as two's complement; see RawValue.
 type Definition struct {
-	Addr        byte        `json:"addr"`        // ECU address byte
-	Slug        string      `json:"slug"`        // Short name (4 chars, e.g. "RPM")
-	Description string      `json:"description"` // Human-readable description
-	Unit        string      `json:"unit"`        // Display unit
-	Exists      bool        `json:"exists"`      // Whether this sensor slot is active
-	Computed    bool        `json:"computed"`    // True if derived (e.g. INJD), not directly polled
-	convertFunc ConvertFunc // conversion function
+	Addr         byte         `json:"addr"`                   // ECU address byte
+	Addr2        byte         `json:"addr2,omitempty"`        // address of the second byte of a two-byte sensor
+	Size         int          `json:"size,omitempty"`         // raw value bytes: 2 for a two-byte sensor; 0 means 1
+	LittleEndian bool         `json:"littleEndian,omitempty"` // Addr holds the low byte; by default it holds the high byte
+	Signed       bool         `json:"signed,omitempty"`       // raw value is two's complement
+	Slug         string       `json:"slug"`                   // Short name (4 chars, e.g. "RPM")
+	Description  string       `json:"description"`            // Human-readable description
+	Unit         string       `json:"unit"`                   // Display unit
+	Exists       bool         `json:"exists"`                 // Whether this sensor slot is active
+	Computed     bool         `json:"computed"`               // True if derived (e.g. INJD), not directly polled
+	Expr         string       `json:"expr,omitempty"`         // formula of an expression channel, see CompileExpr
+	Bits         []FlagBit    `json:"bits,omitempty"`         // named bits of a flags sensor, see FlagChannel
+	Limits       *Limits      `json:"limits,omitempty"`       // display range and thresholds, in the base unit
+	convertFunc  ConvertFunc  // conversion function
+	rawFunc      rawFunc      // conversion of two-byte and signed sensors; replaces convertFunc
+	conv         *Conversion  // sensor file conversion rawFunc was built from, for SchemaOf
+	builtin      string       // slug of the built-in sensor whose conversion d uses, for SchemaOf
+	expr         *Expr        // compiled Expr
+	decimals     int          // decimals shown for float channel values
+	input        bool         // float channel set by an external input, see IsInput
+	base         *DisplayUnit // unit of metric values; nil if no Quantity
+	display      *DisplayUnit // unit override, see SetDisplayUnit
+}
+
+// IsExpr reports whether d is an expression channel. Its value is a float
+// computed from other channels (Sample.Values) rather than a raw byte.
+func (d *Definition) IsExpr() bool {
+	return d.expr != nil
+}
+
+// IsInput reports whether d is a float channel set by an external input,
+// such as the wideband O2 and GPS channels. Its values are floats like
+// those of expression channels, but cannot be recomputed, so logs store them.
+func (d *Definition) IsInput() bool {
+	return d.input
+}
+
+// isRaw reports whether d's values are raw bytes, shown as such under
+// UnitRaw.
+func (d *Definition) isRaw() bool {
+	return d.expr == nil && !d.input
+}
+
+// Inputs returns the slugs of the channels a computed sensor is derived from.
+func (d *Definition) Inputs() []string {
+	switch {
+	case d.expr != nil:
+		return d.expr.Refs()
+	case d.Computed && d.Slug == "INJD":
+		return []string{"RPM", "INJP"}
+	}
+	return nil
+}
+
+// ConvertValue converts a float channel value to its display unit.
+// Expression channels follow units only through a display unit override.
+func (d *Definition) ConvertValue(v float64, units UnitSystem) float64 {
+	if u := d.targetUnit(units); u != nil {
+		return u.FromBase(d.base.ToBase(v))
+	}
+	return v
+}
+
+// FormatValue formats a float channel value with the channel's unit.
+func (d *Definition) FormatValue(v float64, units UnitSystem) string {
+	if u := d.targetUnit(units); u != nil {
+		return u.Format(d.ConvertValue(v, units))
+	}
+	return strconv.FormatFloat(v, 'f', d.decimals, 64) + d.Unit
+}
+
+// IsWord reports whether d is a two-byte sensor, read from Addr and Addr2.
+func (d *Definition) IsWord() bool {
+	return d.Size == 2
+}
+
+// Combine returns the raw word of a two-byte sensor from the bytes read at
+// Addr and Addr2.
+func (d *Definition) Combine(first, second byte) uint16 {
+	if d.LittleEndian {
+		return uint16(second)<<8 | uint16(first)
+	}
+	return uint16(first)<<8 | uint16(second)
+}
+
+// RawValue returns the raw value of a stored channel word: a byte or a
+// 16-bit word, sign-extended for signed sensors.
+func (d *Definition) RawValue(w uint16) int {
+	switch {
+	case d.IsWord() && d.Signed:
+		return int(int16(w))
+	case d.IsWord():
+		return int(w)
+	case d.Signed:
+		return int(int8(byte(w)))
+	default:
+		return int(byte(w))
+	}
+}
+
+// RawWord is the inverse of RawValue: it returns the channel word holding
+// raw value v, and false if v is out of RawRange.
+func (d *Definition) RawWord(v int) (uint16, bool) {
+	lo, hi := d.RawRange()
+	if v < lo || v > hi {
+		return 0, false
+	}
+	if !d.IsWord() {
+		return uint16(byte(v)), true
+	}
+	return uint16(v), true
+}
+
+// RawRange returns the smallest and largest raw values of d.
+func (d *Definition) RawRange() (int, int) {
+	switch {
+	case d.IsWord() && d.Signed:
+		return -32768, 32767
+	case d.IsWord():
+		return 0, 65535
+	case d.Signed:
+		return -128, 127
+	default:
+		return 0, 255
+	}
+}
+
+// Decimals returns the number of decimals the values of d are shown with
+// under units, as Sample.Formatted formats them.
+func (d *Definition) Decimals(units UnitSystem) int {
+	if !d.isRaw() {
+		return shownDecimals(d.FormatValue(0, units))
+	}
+	lo, _ := d.RawRange()
+	_, s := d.convert(lo, units)
+	return shownDecimals(s)
+}
+
+// shownDecimals counts the digits after the decimal point of the number a
+// formatted value starts with.
+func shownDecimals(s string) int {
+	i := 0
+	for i < len(s) && (s[i] == '-' || s[i] == '+') {
+		i++
+	}
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i >= len(s) || s[i] != '.' {
+		return 0
+	}
+	n := 0
+	for i++; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+		n++
+	}
+	return n
 }
 
 // Format returns a human-readable string for the raw value.
 func (d *Definition) Format(raw byte, units UnitSystem) string {
-	if d.convertFunc == nil {
-		_, s := fDEC(raw, units)
-		return s
-	}
-	_, s := d.convertFunc(raw, units)
+	_, s := d.convert(d.RawValue(uint16(raw)), units)
 	return s
 }
 
 // Convert returns a float64 for the raw value.
 func (d *Definition) Convert(raw byte, units UnitSystem) float64 {
-	if d.convertFunc == nil {
-		v, _ := fDEC(raw, units)
-		return v
+	v, _ := d.convert(d.RawValue(uint16(raw)), units)
+	return v
+}
+
+// convert runs the conversion function on a raw value (see RawValue), then
+// converts the metric value to the display unit selected by units and any
+// override.
+func (d *Definition) convert(raw int, units UnitSystem) (float64, string) {
+	u := d.targetUnit(units)
+	if u == nil {
+		return d.convertRaw(raw, units)
 	}
-	v, _ := d.convertFunc(raw, units)
+	v, _ := d.convertRaw(raw, UnitMetric)
+	v = u.FromBase(d.base.ToBase(v))
+	return v, u.Format(v)
+}
+
+// convertRaw runs rawFunc, or convertFunc on the raw byte. Two-byte and
+// signed sensors without a conversion show the raw value.
+func (d *Definition) convertRaw(raw int, units UnitSystem) (float64, string) {
+	switch {
+	case d.rawFunc != nil:
+		return d.rawFunc(raw, units)
+	case d.IsWord() || d.Signed:
+		return fINT(raw, units)
+	case d.convertFunc != nil:
+		return d.convertFunc(byte(raw), units)
+	}
+	return fDEC(byte(raw), units)
+}
+
+// metric returns the value of raw in the base unit, as expressions read it.
+func (d *Definition) metric(raw int) float64 {
+	v, _ := d.convertRaw(raw, UnitMetric)
 	return v
 }
 
@@ -45,70 +232,70 @@ func DefaultDefinitions() []Definition {
 	defs[0] = Definition{Addr: 0xFF, Slug: "", Description: "", Exists: false, convertFunc: fDEC}
 
 	// Index 1: Flags 0 (AC clutch)
-	defs[1] = Definition{Addr: 0x00, Slug: "FLG0", Description: "Flags 0 (AC clutch)", Unit: "flags", Exists: true, convertFunc: fFLG0}
+	defs[1] = Definition{Addr: 0x00, Slug: "FLG0", Description: "Flags 0 (AC clutch)", Unit: "flags", Exists: true, convertFunc: fFLG0, Bits: flg0Bits}
 
 	// Index 2: Flags 2 (TDC, P/S, AC, P/N, Idle)
-	defs[2] = Definition{Addr: 0x02, Slug: "FLG2", Description: "Flags 2 (TDC/PS/AC/PN/Idle)", Unit: "flags", Exists: true, convertFunc: fFLG2}
+	defs[2] = Definition{Addr: 0x02, Slug: "FLG2", Description: "Flags 2 (TDC/PS/AC/PN/Idle)", Unit: "flags", Exists: true, convertFunc: fFLG2, Bits: flg2Bits}
 
 	// Index 3: Timing Advance
-	defs[3] = Definition{Addr: 0x06, Slug: "TIMA", Description: "Timing advance", Unit: "deg", Exists: true, convertFunc: fTIMA}
+	defs[3] = Definition{Addr: 0x06, Slug: "TIMA", Description: "Timing advance", Unit: "deg", Exists: true, convertFunc: fTIMA, Limits: limits(-10, 60, 0)}
 
 	// Index 4: Coolant Temperature
-	defs[4] = Definition{Addr: 0x07, Slug: "COOL", Description: "Coolant temp", Unit: "deg", Exists: true, convertFunc: fCOOL}
+	defs[4] = Definition{Addr: 0x07, Slug: "COOL", Description: "Coolant temp", Unit: "deg", Exists: true, convertFunc: fCOOL, base: builtinUnit("C"), Limits: limits(-40, 120, 1).warnAbove(100).critAbove(105)}
 
 	// Index 5: Fuel Trim Low
-	defs[5] = Definition{Addr: 0x0C, Slug: "FTRL", Description: "Fuel trim low", Unit: "%", Exists: true, convertFunc: fFTxx}
+	defs[5] = Definition{Addr: 0x0C, Slug: "FTRL", Description: "Fuel trim low", Unit: "%", Exists: true, convertFunc: fFTxx, Limits: limits(0, 200, 1).warnBelow(80).warnAbove(120)}
 
 	// Index 6: Fuel Trim Middle
-	defs[6] = Definition{Addr: 0x0D, Slug: "FTRM", Description: "Fuel trim middle", Unit: "%", Exists: true, convertFunc: fFTxx}
+	defs[6] = Definition{Addr: 0x0D, Slug: "FTRM", Description: "Fuel trim middle", Unit: "%", Exists: true, convertFunc: fFTxx, Limits: limits(0, 200, 1).warnBelow(80).warnAbove(120)}
 
 	// Index 7: Fuel Trim High
-	defs[7] = Definition{Addr: 0x0E, Slug: "FTRH", Description: "Fuel trim high", Unit: "%", Exists: true, convertFunc: fFTxx}
+	defs[7] = Definition{Addr: 0x0E, Slug: "FTRH", Description: "Fuel trim high", Unit: "%", Exists: true, convertFunc: fFTxx, Limits: limits(0, 200, 1).warnBelow(80).warnAbove(120)}
 
 	// Index 8: O2 Feedback Trim
-	defs[8] = Definition{Addr: 0x0F, Slug: "FTO2", Description: "O2 feedback trim", Unit: "%", Exists: true, convertFunc: fFTxx}
+	defs[8] = Definition{Addr: 0x0F, Slug: "FTO2", Description: "O2 feedback trim", Unit: "%", Exists: true, convertFunc: fFTxx, Limits: limits(0, 200, 1)}
 
 	// Index 9: EGR Temperature
-	defs[9] = Definition{Addr: 0x12, Slug: "EGRT", Description: "EGR temp", Unit: "deg", Exists: true, convertFunc: fEGRT}
+	defs[9] = Definition{Addr: 0x12, Slug: "EGRT", Description: "EGR temp", Unit: "deg", Exists: true, convertFunc: fEGRT, base: builtinUnit("C"), Limits: limits(0, 400, 1)}
 
 	// Index 10: O2 Sensor (rear)
-	defs[10] = Definition{Addr: 0x13, Slug: "O2-R", Description: "O2 sensor (rear)", Unit: "V", Exists: true, convertFunc: fOXYG}
+	defs[10] = Definition{Addr: 0x13, Slug: "O2-R", Description: "O2 sensor (rear)", Unit: "V", Exists: true, convertFunc: fOXYG, Limits: limits(0, 5, 3)}
 
 	// Index 11: Battery Voltage
-	defs[11] = Definition{Addr: 0x14, Slug: "BATT", Description: "Battery", Unit: "V", Exists: true, convertFunc: fBATT}
+	defs[11] = Definition{Addr: 0x14, Slug: "BATT", Description: "Battery", Unit: "V", Exists: true, convertFunc: fBATT, Limits: limits(0, 18, 1).warnBelow(12).critBelow(11).warnAbove(15)}
 
 	// Index 12: Barometric Pressure
-	defs[12] = Definition{Addr: 0x15, Slug: "BARO", Description: "Barometer", Unit: "bar", Exists: true, convertFunc: fBARO}
+	defs[12] = Definition{Addr: 0x15, Slug: "BARO", Description: "Barometer", Unit: "bar", Exists: true, convertFunc: fBARO, base: builtinUnit("bar"), Limits: limits(0, 1.5, 3)}
 
 	// Index 13: ISC Steps
-	defs[13] = Definition{Addr: 0x16, Slug: "ISC", Description: "ISC position", Unit: "%", Exists: true, convertFunc: fTHRL}
+	defs[13] = Definition{Addr: 0x16, Slug: "ISC", Description: "ISC position", Unit: "%", Exists: true, convertFunc: fTHRL, Limits: limits(0, 100, 1)}
 
 	// Index 14: Throttle Position
-	defs[14] = Definition{Addr: 0x17, Slug: "TPS", Description: "Throttle position", Unit: "%", Exists: true, convertFunc: fTHRL}
+	defs[14] = Definition{Addr: 0x17, Slug: "TPS", Description: "Throttle position", Unit: "%", Exists: true, convertFunc: fTHRL, Limits: limits(0, 100, 1)}
 
 	// Index 15: Mass Air Flow Frequency
-	defs[15] = Definition{Addr: 0x1A, Slug: "MAFS", Description: "Mass air flow", Unit: "Hz", Exists: true, convertFunc: fAIRF}
+	defs[15] = Definition{Addr: 0x1A, Slug: "MAFS", Description: "Mass air flow", Unit: "Hz", Exists: true, convertFunc: fAIRF, Limits: limits(0, 1600, 1)}
 
 	// Index 16: Acceleration Enrichment
-	defs[16] = Definition{Addr: 0x1D, Slug: "ACLE", Description: "Accel enrichment", Unit: "%", Exists: true, convertFunc: fTHRL}
+	defs[16] = Definition{Addr: 0x1D, Slug: "ACLE", Description: "Accel enrichment", Unit: "%", Exists: true, convertFunc: fTHRL, Limits: limits(0, 100, 1)}
 
 	// Index 17: Engine Speed (RPM)
-	defs[17] = Definition{Addr: 0x21, Slug: "RPM", Description: "Engine speed", Unit: "rpm", Exists: true, convertFunc: fERPM}
+	defs[17] = Definition{Addr: 0x21, Slug: "RPM", Description: "Engine speed", Unit: "rpm", Exists: true, convertFunc: fERPM, Limits: limits(0, 8000, 0).warnAbove(7000)}
 
 	// Index 18: Knock Sum
-	defs[18] = Definition{Addr: 0x26, Slug: "KNCK", Description: "Knock sum", Unit: "count", Exists: true, convertFunc: fDEC}
+	defs[18] = Definition{Addr: 0x26, Slug: "KNCK", Description: "Knock sum", Unit: "count", Exists: true, convertFunc: fDEC, Limits: limits(0, 255, 0).warnAbove(3).critAbove(8)}
 
 	// Index 19: Injector Pulse Width
-	defs[19] = Definition{Addr: 0x29, Slug: "INJP", Description: "Inj pulse width", Unit: "ms", Exists: true, convertFunc: fINJP}
+	defs[19] = Definition{Addr: 0x29, Slug: "INJP", Description: "Inj pulse width", Unit: "ms", Exists: true, convertFunc: fINJP, Limits: limits(0, 65, 2)}
 
 	// Index 20: Injector Duty Cycle (computed from RPM + INJP)
-	defs[20] = Definition{Addr: 0xFF, Slug: "INJD", Description: "Inj duty cycle", Unit: "%", Exists: true, Computed: true, convertFunc: fFTxx}
+	defs[20] = Definition{Addr: 0xFF, Slug: "INJD", Description: "Inj duty cycle", Unit: "%", Exists: true, Computed: true, convertFunc: fFTxx, Limits: limits(0, 100, 1).warnAbove(85).critAbove(95)}
 
 	// Index 21: Air Intake Temperature
-	defs[21] = Definition{Addr: 0x3A, Slug: "AIRT", Description: "Air temp", Unit: "deg", Exists: true, convertFunc: fAIRT}
+	defs[21] = Definition{Addr: 0x3A, Slug: "AIRT", Description: "Air temp", Unit: "deg", Exists: true, convertFunc: fAIRT, base: builtinUnit("C"), Limits: limits(-40, 100, 1).warnAbove(60)}
 
 	// Index 22: O2 Sensor (front)
-	defs[22] = Definition{Addr: 0x3E, Slug: "O2-F", Description: "O2 sensor (front)", Unit: "V", Exists: true, convertFunc: fOXYG}
+	defs[22] = Definition{Addr: 0x3E, Slug: "O2-F", Description: "O2 sensor (front)", Unit: "V", Exists: true, convertFunc: fOXYG, Limits: limits(0, 5, 3)}
 
 	// Indices 23-31: unused / custom sensor slots
 	for i := 23; i < MaxSensors; i++ {
@@ -119,6 +306,11 @@ func DefaultDefinitions() []Definition {
 		defs[i] = Definition{Addr: 0x00, Slug: slug, Description: "", Exists: false, convertFunc: fDEC}
 	}
 
+	for i := range defs {
+		if defs[i].Exists {
+			defs[i].builtin = defs[i].Slug
+		}
+	}
 	return defs
 }
 
@@ -144,10 +336,11 @@ func FindBySlug(defs []Definition, slug string) (int, *Definition) {
 	return -1, nil
 }
 
-// FindByAddr returns the index and definition for a given ECU address, or -1 if not found.
+// FindByAddr returns the index and definition of the sensor reading a given
+// ECU address, either byte of a two-byte sensor, or -1 if not found.
 func FindByAddr(defs []Definition, addr byte) (int, *Definition) {
 	for i := range defs {
-		if defs[i].Exists && defs[i].Addr == addr {
+		if defs[i].Exists && (defs[i].Addr == addr || defs[i].IsWord() && defs[i].Addr2 == addr) {
 			return i, &defs[i]
 		}
 	}
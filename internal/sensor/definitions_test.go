@@ -2,6 +2,7 @@ package sensor
 
 import (
 	"testing"
+	"time"
 )
 
 func TestDefaultDefinitions(t *testing.T) {
@@ -103,8 +104,8 @@ func TestSampleComputeDerivatives(t *testing.T) {
 
 	// INJD = (50 * 128) / 117 = 54
 	expected := byte(50 * 128 / 117)
-	if sample.RawData[20] != expected {
-		t.Errorf("INJD raw = %d, want %d", sample.RawData[20], expected)
+	if sample.Raw(20) != expected {
+		t.Errorf("INJD raw = %d, want %d", sample.Raw(20), expected)
 	}
 }
 
@@ -118,7 +119,53 @@ func TestSampleComputeDerivativesCapped(t *testing.T) {
 	sample.ComputeDerivatives(defs)
 
 	// Should be capped at 255
-	if sample.RawData[20] != 255 {
-		t.Errorf("INJD raw = %d, want 255 (capped)", sample.RawData[20])
+	if sample.Raw(20) != 255 {
+		t.Errorf("INJD raw = %d, want 255 (capped)", sample.Raw(20))
+	}
+}
+
+func TestSampleChannelTimes(t *testing.T) {
+	defs := DefaultDefinitions()
+	start := time.Now()
+
+	sample := Sample{Time: start}
+	sample.SetDataAt(17, 128, start.Add(15*time.Millisecond))
+	sample.SetDataAt(19, 50, start.Add(40*time.Millisecond))
+	sample.ComputeDerivatives(defs)
+
+	if got := sample.ChannelTime(17); !got.Equal(start.Add(15 * time.Millisecond)) {
+		t.Errorf("RPM read at %s, want +15ms", got.Sub(start))
+	}
+	// INJD is only as fresh as its newest input (INJP)
+	if got := sample.Offset(20); got != 40*time.Millisecond {
+		t.Errorf("INJD offset = %s, want 40ms", got)
+	}
+	if !sample.HasOffsets() {
+		t.Error("HasOffsets = false, want true")
+	}
+}
+
+func TestDefinitionDecimals(t *testing.T) {
+	defs, err := AddDerived(DefaultDefinitions(), []string{"AIRF"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	airf, _ := FindBySlug(defs, "AIRF")
+	for _, tc := range []struct {
+		idx   int
+		units UnitSystem
+		want  int
+	}{
+		{4, UnitMetric, 1},  // COOL 32.8°C
+		{17, UnitMetric, 0}, // RPM
+		{11, UnitMetric, 1}, // BATT 14.1V
+		{12, UnitMetric, 3}, // BARO 1.006bar
+		{12, UnitRaw, 0},
+		{1, UnitMetric, 0}, // FLG0 flags
+		{airf, UnitMetric, defs[airf].decimals},
+	} {
+		if got := defs[tc.idx].Decimals(tc.units); got != tc.want {
+			t.Errorf("%s.Decimals(%v) = %d, want %d", defs[tc.idx].Slug, tc.units, got, tc.want)
+		}
 	}
 }
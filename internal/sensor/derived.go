@@ -0,0 +1,200 @@
+package sensor
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// derivedPresets are ready-made expression channels that --derived and sensor
+// files can add by slug. Formulas read inputs in metric units. The constants
+// assume a stock 2.0L 1G DSM and are meant as starting points; copy a preset
+// into a sensor file with its own expr to tune it. The airflow and injector
+// channels come from the fueling hardware, see Fueling.
+var derivedPresets = []ProfileSensor{
+	{
+		Slug:        "LOAD",
+		Description: "Engine load",
+		Unit:        "%",
+		// grams per revolution against 1.2 g/rev for 2.0L at 100% VE
+		Expr:   "if(RPM > 100, AIRF * 60 / RPM / 1.2 * 100, 0)",
+		Limits: limits(0, 150, 1),
+	},
+	{
+		Slug:        "EAFR",
+		Description: "Est. AFR (narrowband)",
+		// trims above 100% mean the ECU is adding fuel to a lean base mixture;
+		// the front O2 voltage around its 0.45V switch point nudges it rich/lean
+		Expr:     "clamp(14.7 * 100 / FTO2 - ({O2-F} - 0.45) * 2, 10, 20)",
+		Decimals: intPtr(2),
+		Limits:   limits(10, 20, 2),
+	},
+	{
+		Slug:        "GEAR",
+		Description: "Gear (from RPM/speed)",
+		// rpm per km/h in 1st-5th for a 5-speed with 3.933 final drive on
+		// 205/55R16; needs a SPD (km/h) sensor from a sensor file, or reads
+		// GPS speed instead (see speedPreset)
+		Expr:     "if(SPD > 5 && RPM > 500, nearest(RPM / SPD, 103.7, 56.6, 37.5, 28.0, 22.4), 0)",
+		Decimals: intPtr(0),
+		Limits:   limits(0, 5, 0),
+	},
+}
+
+func intPtr(v int) *int { return &v }
+
+// DerivedPresets returns the built-in expression channels for stock fueling.
+func DerivedPresets() []ProfileSensor {
+	return StockFueling().DerivedPresets()
+}
+
+// DerivedPresets returns the built-in expression channels for this fueling
+// hardware: AIRF first, then the fixed presets, then the injector channels.
+func (f Fueling) DerivedPresets() []ProfileSensor {
+	hw := f.presets()
+	out := make([]ProfileSensor, 0, len(derivedPresets)+len(hw))
+	out = append(out, hw[0])
+	out = append(out, derivedPresets...)
+	return append(out, hw[1:]...)
+}
+
+// derivedPreset returns the stock preset with the given slug.
+func derivedPreset(defs []Definition, slug string) (ProfileSensor, bool) {
+	return StockFueling().derivedPreset(defs, slug)
+}
+
+// derivedPreset returns the preset with the given slug, adapted to the
+// channels of defs.
+func (f Fueling) derivedPreset(defs []Definition, slug string) (ProfileSensor, bool) {
+	for _, p := range f.DerivedPresets() {
+		if p.Slug == slug {
+			return speedPreset(defs, p), true
+		}
+	}
+	return ProfileSensor{}, false
+}
+
+// speedPreset makes a preset reading the SPD sensor read GPS speed instead
+// when defs have GPS channels but no SPD, as on cars without a speed sensor.
+func speedPreset(defs []Definition, p ProfileSensor) ProfileSensor {
+	if _, d := FindBySlug(defs, "SPD"); d != nil && d.Exists {
+		return p
+	}
+	if _, d := FindBySlug(defs, GPSSpeedSlug); d == nil || !d.Exists {
+		return p
+	}
+	e, err := CompileExpr(p.Expr)
+	if err != nil || !slices.Contains(e.Refs(), "SPD") {
+		return p
+	}
+	p.Expr = strings.ReplaceAll(p.Expr, "SPD", GPSSpeedSlug)
+	return p
+}
+
+// AddDerived returns a copy of defs with the named presets added as expression
+// channels, in the free custom slots. Presets already defined are skipped.
+func AddDerived(defs []Definition, slugs []string) ([]Definition, error) {
+	return AddDerivedWithFueling(defs, slugs, StockFueling())
+}
+
+// AddDerivedWithFueling is AddDerived with the airflow and injector presets
+// worked out for the given fueling hardware.
+func AddDerivedWithFueling(defs []Definition, slugs []string, f Fueling) ([]Definition, error) {
+	if err := f.Validate(); err != nil {
+		return nil, fmt.Errorf("fueling: %w", err)
+	}
+	var p Profile
+	seen := make(map[string]bool)
+	for _, slug := range slugs {
+		slug = strings.ToUpper(strings.TrimSpace(slug))
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		if _, d := FindBySlug(defs, slug); d != nil && d.Exists {
+			continue
+		}
+		preset, ok := f.derivedPreset(defs, slug)
+		if !ok {
+			return nil, fmt.Errorf("unknown derived channel %s (have %s)", slug, strings.Join(DerivedPresetSlugs(), ", "))
+		}
+		p.Sensors = append(p.Sensors, preset)
+	}
+	if len(p.Sensors) == 0 {
+		out := make([]Definition, len(defs))
+		copy(out, defs)
+		return out, nil
+	}
+	return ApplyProfile(defs, &p)
+}
+
+// DerivedPresetSlugs lists the slugs of the built-in expression channels.
+func DerivedPresetSlugs() []string {
+	presets := DerivedPresets()
+	slugs := make([]string, len(presets))
+	for i, p := range presets {
+		slugs[i] = p.Slug
+	}
+	return slugs
+}
+
+// WithComputed completes a channel selection: the inputs of any selected
+// computed channel are added, then every computed channel whose inputs are
+// all selected. The selection keeps its order; added channels follow in
+// index order.
+func WithComputed(defs []Definition, indices []int) []int {
+	selected := make(map[int]bool, len(indices))
+	var add func(idx int)
+	add = func(idx int) {
+		if idx < 0 || idx >= len(defs) || selected[idx] {
+			return
+		}
+		selected[idx] = true
+		for _, ref := range defs[idx].Inputs() {
+			if j := channelIndex(defs, ref); j >= 0 {
+				add(j)
+			}
+		}
+	}
+	for _, idx := range indices {
+		add(idx)
+	}
+
+	// Repeat until stable so channels built on other computed channels
+	// are picked up too.
+	for changed := true; changed; {
+		changed = false
+		for i := range defs {
+			inputs := defs[i].Inputs()
+			if selected[i] || !defs[i].Exists || len(inputs) == 0 {
+				continue
+			}
+			all := true
+			for _, ref := range inputs {
+				if j := channelIndex(defs, ref); j < 0 || !selected[j] {
+					all = false
+					break
+				}
+			}
+			if all {
+				selected[i] = true
+				changed = true
+			}
+		}
+	}
+
+	out := make([]int, 0, len(selected))
+	seen := make(map[int]bool, len(selected))
+	for _, idx := range indices {
+		if selected[idx] && !seen[idx] {
+			seen[idx] = true
+			out = append(out, idx)
+		}
+	}
+	for idx := range defs {
+		if selected[idx] && !seen[idx] {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
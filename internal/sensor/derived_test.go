@@ -0,0 +1,127 @@
+package sensor
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComputeDerivatives_Expressions(t *testing.T) {
+	defs, err := AddDerived(DefaultDefinitions(), []string{"LOAD", "AIRF"})
+	if err != nil {
+		t.Fatalf("AddDerived failed: %v", err)
+	}
+	airf, _ := FindBySlug(defs, "AIRF")
+	load, _ := FindBySlug(defs, "LOAD")
+	if airf < FirstCustomSlot || load < FirstCustomSlot || !defs[airf].IsExpr() || !defs[airf].Computed {
+		t.Fatalf("AIRF at %d, LOAD at %d: want expression channels in custom slots", airf, load)
+	}
+
+	base := time.Now()
+	s := Sample{Time: base}
+	s.SetDataAt(15, 80, base.Add(10*time.Millisecond))  // MAFS 503.2 Hz
+	s.SetDataAt(12, 208, base.Add(20*time.Millisecond)) // BARO 1.011 bar
+	s.SetDataAt(21, 75, base.Add(30*time.Millisecond))  // AIRT
+	s.SetDataAt(17, 96, base.Add(40*time.Millisecond))  // RPM 3000
+	s.ComputeDerivatives(defs)
+
+	airt := defs[21].Convert(75, UnitMetric)
+	wantAIRF := 503.2 * 0.0258 * (0.00486 * 208) / 1.013 * 293 / (airt + 273)
+	if !s.HasData(airf) || math.Abs(s.Float(airf)-wantAIRF) > 1e-9 {
+		t.Errorf("AIRF = %g (present %v), want %g", s.Float(airf), s.HasData(airf), wantAIRF)
+	}
+	wantLOAD := wantAIRF * 60 / 3000 / 1.2 * 100
+	if got := s.Value(defs, load, UnitEnglish); math.Abs(got-wantLOAD) > 1e-9 {
+		t.Errorf("LOAD = %g, want %g", got, wantLOAD)
+	}
+	if s.Offset(airf) != 30*time.Millisecond || s.Offset(load) != 40*time.Millisecond {
+		t.Errorf("offsets AIRF %v LOAD %v, want newest input (30ms, 40ms)", s.Offset(airf), s.Offset(load))
+	}
+	if got := s.ConvertedValues(defs, UnitMetric)["LOAD"]; !strings.HasSuffix(got, "%") {
+		t.Errorf("LOAD formatted = %q, want a %% value", got)
+	}
+
+	// Without RPM, LOAD is absent but AIRF still computes
+	s2 := Sample{}
+	s2.SetData(15, 80)
+	s2.SetData(12, 208)
+	s2.SetData(21, 75)
+	s2.ComputeDerivatives(defs)
+	if !s2.HasData(airf) || s2.HasData(load) {
+		t.Errorf("without RPM: AIRF present %v, LOAD present %v", s2.HasData(airf), s2.HasData(load))
+	}
+}
+
+func TestApplyProfile_Expr(t *testing.T) {
+	p := &Profile{Sensors: []ProfileSensor{
+		{Slug: "RPMK", Expr: "RPM / 1000", Unit: "krpm", Decimals: intPtr(2)},
+		{Slug: "EAFR"}, // preset by slug
+	}}
+	defs, err := ApplyProfile(DefaultDefinitions(), p)
+	if err != nil {
+		t.Fatalf("ApplyProfile failed: %v", err)
+	}
+	idx, d := FindBySlug(defs, "RPMK")
+	if d == nil || !d.IsExpr() || d.Addr != 0xFF {
+		t.Fatalf("RPMK = %+v", d)
+	}
+	var s Sample
+	s.SetData(17, 97) // 3031.25 rpm
+	s.ComputeDerivatives(defs)
+	if got := s.Formatted(defs, idx, UnitMetric); got != "3.03krpm" {
+		t.Errorf("RPMK = %q, want 3.03krpm", got)
+	}
+	if _, d := FindBySlug(defs, "EAFR"); d == nil || !d.IsExpr() || d.Description == "EAFR" {
+		t.Errorf("EAFR preset not applied: %+v", d)
+	}
+
+	tests := []struct {
+		name    string
+		sensors []ProfileSensor
+		want    string
+	}{
+		{"unknown ref", []ProfileSensor{{Slug: "X", Expr: "SPD * 2"}}, "unknown channel SPD"},
+		{"cycle", []ProfileSensor{{Slug: "A", Expr: "B + 1"}, {Slug: "B", Expr: "A + 1"}}, "depends on itself"},
+		{"syntax", []ProfileSensor{{Slug: "X", Expr: "RPM +"}}, "unexpected end"},
+		{"with addr", []ProfileSensor{{Slug: "X", Expr: "RPM", Addr: new(Addr)}}, "no addr"},
+		{"over polled", []ProfileSensor{{Slug: "TPS", Expr: "RPM"}}, "polled sensor"},
+		{"preset input", []ProfileSensor{{Slug: "GEAR"}}, "unknown channel SPD"},
+	}
+	for _, tt := range tests {
+		_, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: tt.sensors})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := AddDerived(DefaultDefinitions(), []string{"NOPE"}); err == nil {
+		t.Error("AddDerived with an unknown preset should fail")
+	}
+}
+
+func TestWithComputed(t *testing.T) {
+	defs, err := AddDerived(DefaultDefinitions(), []string{"AIRF", "LOAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slugs := func(indices []int) string {
+		var s []string
+		for _, idx := range indices {
+			s = append(s, defs[idx].Slug)
+		}
+		return strings.Join(s, ",")
+	}
+
+	// INJD follows RPM and INJP; AIRF needs AIRT too
+	indices, _ := SlugsToIndices(defs, []string{"RPM", "INJP", "MAFS", "BARO"})
+	if got := slugs(WithComputed(defs, indices)); got != "RPM,INJP,MAFS,BARO,INJD" {
+		t.Errorf("WithComputed = %s", got)
+	}
+
+	// Selecting LOAD pulls in its inputs, and AIRF's
+	indices, _ = SlugsToIndices(defs, []string{"LOAD"})
+	if got := slugs(WithComputed(defs, indices)); got != "LOAD,BARO,MAFS,RPM,AIRT,AIRF" {
+		t.Errorf("WithComputed(LOAD) = %s", got)
+	}
+}
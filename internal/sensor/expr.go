@@ -0,0 +1,478 @@
+package sensor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr is a compiled channel expression such as
+//
+//	MAFS * 0.0258 * BARO / 1.013 * 293 / (AIRT + 273)
+//
+// Channels are referenced by slug, either bare (RPM, MAFS) or in braces for
+// slugs that are not identifiers ({O2-F}). Supported are + - * / % ^, the
+// comparisons < <= > >= == != and && || (1 for true, 0 for false), unary
+// - and !, and the functions abs, min, max, clamp(x, lo, hi), if(c, a, b),
+// round, sqrt and nearest(x, v1, v2, ...), which returns the 1-based
+// position of the v closest to x.
+type Expr struct {
+	src  string
+	root exprNode
+	refs []string
+}
+
+// CompileExpr parses an expression.
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	e := &Expr{src: src, root: root}
+	seen := make(map[string]bool)
+	collectRefs(root, func(slug string) {
+		if !seen[slug] {
+			seen[slug] = true
+			e.refs = append(e.refs, slug)
+		}
+	})
+	return e, nil
+}
+
+// String returns the expression source.
+func (e *Expr) String() string { return e.src }
+
+// Refs returns the channel slugs the expression reads, in order of first use.
+func (e *Expr) Refs() []string { return e.refs }
+
+// Eval evaluates the expression. lookup returns a channel's value and whether
+// it is present; Eval reports false if any referenced channel is missing or
+// the result is not a finite number (e.g. division by zero).
+func (e *Expr) Eval(lookup func(slug string) (float64, bool)) (float64, bool) {
+	v, ok := e.root.eval(lookup)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// --- AST ---
+
+type exprNode interface {
+	eval(lookup func(string) (float64, bool)) (float64, bool)
+}
+
+type numNode float64
+
+func (n numNode) eval(func(string) (float64, bool)) (float64, bool) { return float64(n), true }
+
+type refNode string
+
+func (r refNode) eval(lookup func(string) (float64, bool)) (float64, bool) { return lookup(string(r)) }
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+func (u *unaryNode) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	v, ok := u.x.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	if u.op == "!" {
+		return boolVal(v == 0), true
+	}
+	return -v, true
+}
+
+type binaryNode struct {
+	op   string
+	l, r exprNode
+}
+
+func (b *binaryNode) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	l, ok := b.l.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.r.eval(lookup)
+	if !ok {
+		return 0, false
+	}
+	switch b.op {
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	case "/":
+		return l / r, true
+	case "%":
+		return math.Mod(l, r), true
+	case "^":
+		return math.Pow(l, r), true
+	case "<":
+		return boolVal(l < r), true
+	case "<=":
+		return boolVal(l <= r), true
+	case ">":
+		return boolVal(l > r), true
+	case ">=":
+		return boolVal(l >= r), true
+	case "==":
+		return boolVal(l == r), true
+	case "!=":
+		return boolVal(l != r), true
+	case "&&":
+		return boolVal(l != 0 && r != 0), true
+	case "||":
+		return boolVal(l != 0 || r != 0), true
+	}
+	return 0, false
+}
+
+type callNode struct {
+	fn   string
+	args []exprNode
+}
+
+func (c *callNode) eval(lookup func(string) (float64, bool)) (float64, bool) {
+	// if() only needs the branch it takes
+	if c.fn == "if" {
+		cond, ok := c.args[0].eval(lookup)
+		if !ok {
+			return 0, false
+		}
+		if cond != 0 {
+			return c.args[1].eval(lookup)
+		}
+		return c.args[2].eval(lookup)
+	}
+
+	args := make([]float64, len(c.args))
+	for i, a := range c.args {
+		v, ok := a.eval(lookup)
+		if !ok {
+			return 0, false
+		}
+		args[i] = v
+	}
+	switch c.fn {
+	case "abs":
+		return math.Abs(args[0]), true
+	case "sqrt":
+		return math.Sqrt(args[0]), true
+	case "round":
+		return math.Round(args[0]), true
+	case "min":
+		m := args[0]
+		for _, v := range args[1:] {
+			m = math.Min(m, v)
+		}
+		return m, true
+	case "max":
+		m := args[0]
+		for _, v := range args[1:] {
+			m = math.Max(m, v)
+		}
+		return m, true
+	case "clamp":
+		return math.Max(args[1], math.Min(args[2], args[0])), true
+	case "nearest":
+		best, bestDist := 0, math.Inf(1)
+		for i, v := range args[1:] {
+			if d := math.Abs(args[0] - v); d < bestDist {
+				best, bestDist = i+1, d
+			}
+		}
+		return float64(best), true
+	}
+	return 0, false
+}
+
+// exprFuncs maps function names to their argument count; -1 means two or more.
+var exprFuncs = map[string]int{
+	"abs": 1, "sqrt": 1, "round": 1,
+	"min": -1, "max": -1, "nearest": -1,
+	"clamp": 3, "if": 3,
+}
+
+func boolVal(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func collectRefs(n exprNode, fn func(string)) {
+	switch n := n.(type) {
+	case refNode:
+		fn(string(n))
+	case *unaryNode:
+		collectRefs(n.x, fn)
+	case *binaryNode:
+		collectRefs(n.l, fn)
+		collectRefs(n.r, fn)
+	case *callNode:
+		for _, a := range n.args {
+			collectRefs(a, fn)
+		}
+	}
+}
+
+// --- Parser ---
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokIdent
+	tokRef // {SLUG}
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type exprParser struct {
+	src string
+	pos int
+	tok token
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expression %q at %d: %s", p.src, p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+// next advances to the next token.
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		// exponent, e.g. 1.5e-3
+		if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+			p.pos++
+			if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+				p.pos++
+			}
+			for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+				p.pos++
+			}
+		}
+		p.tok = token{kind: tokNum, text: p.src[start:p.pos], pos: start}
+
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isDigit(p.src[p.pos]) || unicode.IsLetter(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+
+	case c == '{':
+		end := strings.IndexByte(p.src[p.pos:], '}')
+		if end < 0 {
+			p.tok = token{pos: start}
+			return p.errorf("unterminated {")
+		}
+		slug := strings.TrimSpace(p.src[p.pos+1 : p.pos+end])
+		p.pos += end + 1
+		p.tok = token{kind: tokRef, text: slug, pos: start}
+
+	default:
+		for _, op := range []string{"<=", ">=", "==", "!=", "&&", "||"} {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += 2
+				p.tok = token{kind: tokOp, text: op, pos: start}
+				return nil
+			}
+		}
+		if !strings.ContainsRune("+-*/%^<>!(),", rune(c)) {
+			p.tok = token{pos: start}
+			return p.errorf("unexpected character %q", c)
+		}
+		p.pos++
+		p.tok = token{kind: tokOp, text: string(c), pos: start}
+	}
+	return nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// binaryPrec returns the precedence of a binary operator, or 0.
+func binaryPrec(op string) int {
+	switch op {
+	case "||":
+		return 1
+	case "&&":
+		return 2
+	case "<", "<=", ">", ">=", "==", "!=":
+		return 3
+	case "+", "-":
+		return 4
+	case "*", "/", "%":
+		return 5
+	case "^":
+		return 7 // above unary minus: -2^2 is -(2^2)
+	}
+	return 0
+}
+
+// parseBinary parses operators binding tighter than minPrec.
+func (p *exprParser) parseBinary(minPrec int) (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOp {
+		op := p.tok.text
+		prec := binaryPrec(op)
+		if prec == 0 || prec <= minPrec {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		next := prec
+		if op == "^" {
+			next = prec - 1 // right-associative
+		}
+		right, err := p.parseBinary(next)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, l: left, r: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.tok.kind == tokOp && (p.tok.text == "-" || p.tok.text == "!" || p.tok.text == "+") {
+		op := p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseBinary(6)
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			return x, nil
+		}
+		return &unaryNode{op: op, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokNum:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", tok.text)
+		}
+		return numNode(v), p.next()
+
+	case tokRef:
+		if tok.text == "" {
+			return nil, p.errorf("empty {}")
+		}
+		return refNode(tok.text), p.next()
+
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokOp && p.tok.text == "(" {
+			return p.parseCall(tok)
+		}
+		return refNode(tok.text), nil
+
+	case tokOp:
+		if tok.text == "(" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokOp || p.tok.text != ")" {
+				return nil, p.errorf("missing )")
+			}
+			return x, p.next()
+		}
+		return nil, p.errorf("unexpected %q", tok.text)
+	}
+	return nil, p.errorf("unexpected end of expression")
+}
+
+func (p *exprParser) parseCall(name token) (exprNode, error) {
+	fn := strings.ToLower(name.text)
+	want, ok := exprFuncs[fn]
+	if !ok {
+		p.tok = name
+		return nil, p.errorf("unknown function %s", name.text)
+	}
+	if err := p.next(); err != nil { // consume (
+		return nil, err
+	}
+	var args []exprNode
+	if !(p.tok.kind == tokOp && p.tok.text == ")") {
+		for {
+			arg, err := p.parseBinary(0)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.tok.kind == tokOp && p.tok.text == "," {
+				if err := p.next(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			break
+		}
+	}
+	if p.tok.kind != tokOp || p.tok.text != ")" {
+		return nil, p.errorf("missing ) after %s arguments", fn)
+	}
+	if (want >= 0 && len(args) != want) || (want < 0 && len(args) < 2) {
+		p.tok = name
+		return nil, p.errorf("%s takes %s arguments, got %d", fn, argCount(want), len(args))
+	}
+	return &callNode{fn: fn, args: args}, p.next()
+}
+
+func argCount(n int) string {
+	if n < 0 {
+		return "2 or more"
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,98 @@
+package sensor
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestExpr_Eval(t *testing.T) {
+	vars := map[string]float64{"RPM": 3000, "MAFS": 500, "O2-F": 0.6, "ZERO": 0}
+	lookup := func(slug string) (float64, bool) {
+		v, ok := vars[slug]
+		return v, ok
+	}
+
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"10 - 4 - 3", 3},
+		{"7 % 4", 3},
+		{"1.5e3 / 3", 500},
+		{"RPM / 1000", 3},
+		{"{O2-F} * 10", 6},
+		{"RPM > 2500 && MAFS < 600", 1},
+		{"!(RPM >= 3000) || ZERO", 0},
+		{"if(RPM > 2000, 1, 2)", 1},
+		{"if(ZERO, MISSING, 2)", 2}, // untaken branch is not evaluated
+		{"min(3, RPM, 1)", 1},
+		{"max(3, 1)", 3},
+		{"clamp(RPM, 0, 255)", 255},
+		{"abs(-4) + sqrt(16) + round(0.6)", 9},
+		{"nearest(30, 100, 50, 35, 20)", 3},
+	}
+	for _, tt := range tests {
+		e, err := CompileExpr(tt.src)
+		if err != nil {
+			t.Errorf("CompileExpr(%q) failed: %v", tt.src, err)
+			continue
+		}
+		got, ok := e.Eval(lookup)
+		if !ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%q = %g, %v; want %g", tt.src, got, ok, tt.want)
+		}
+	}
+}
+
+func TestExpr_Missing(t *testing.T) {
+	lookup := func(slug string) (float64, bool) { return 0, slug == "ZERO" }
+	for _, src := range []string{"SPD * 2", "1 / ZERO", "sqrt(-1) + ZERO"} {
+		e, err := CompileExpr(src)
+		if err != nil {
+			t.Fatalf("CompileExpr(%q) failed: %v", src, err)
+		}
+		if v, ok := e.Eval(lookup); ok {
+			t.Errorf("%q = %g, want no value", src, v)
+		}
+	}
+}
+
+func TestExpr_Refs(t *testing.T) {
+	e, err := CompileExpr("MAFS * BARO / (AIRT + 273) + MAFS + {O2-F}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(e.Refs(), ","); got != "MAFS,BARO,AIRT,O2-F" {
+		t.Errorf("Refs() = %s", got)
+	}
+}
+
+func TestExpr_Errors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "unexpected end"},
+		{"1 +", "unexpected end"},
+		{"(1 + 2", "missing )"},
+		{"1 2", "unexpected"},
+		{"RPM $ 2", "unexpected character"},
+		{"{O2-F", "unterminated"},
+		{"{}", "empty"},
+		{"foo(1)", "unknown function"},
+		{"clamp(1, 2)", "takes 3 arguments"},
+		{"min(1)", "2 or more"},
+		{"1..2", "invalid number"},
+	}
+	for _, tt := range tests {
+		_, err := CompileExpr(tt.src)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("CompileExpr(%q) err = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package sensor
+
+import "strings"
+
+// Flag bytes pack several on/off switches into one ECU address. Each named
+// bit of a flags sensor is also a boolean channel of its own (see
+// FlagChannel), so it can be graphed, logged and used in expressions by
+// name, e.g. "if(IDLE, RPM, 0)".
+
+// flg0Bits are the bits of FLG0 (address 0x00).
+var flg0Bits = []FlagBit{
+	{Bit: 5, Char: "A", ActiveLow: true, Name: "ACCL", Description: "A/C clutch"},
+}
+
+// flg2Bits are the bits of FLG2 (address 0x02), in display order.
+var flg2Bits = []FlagBit{
+	{Bit: 2, Char: "T", ActiveLow: true, Name: "TDC", Description: "TDC"},
+	{Bit: 3, Char: "S", Name: "PS", Description: "Power steering"},
+	{Bit: 4, Char: "A", ActiveLow: true, Name: "ACSW", Description: "A/C switch"},
+	{Bit: 5, Char: "N", ActiveLow: true, Name: "PN", Description: "Park/neutral"},
+	{Bit: 7, Char: "I", Name: "IDLE", Description: "Idle switch"},
+}
+
+// Active reports whether the bit is on in raw, honouring ActiveLow.
+func (b FlagBit) Active(raw byte) bool {
+	set := raw&(1<<uint(b.Bit)) != 0
+	return set != b.ActiveLow
+}
+
+// formatFlags returns one character per bit: the bit's Char when active,
+// "-" otherwise.
+func formatFlags(bits []FlagBit, raw byte) string {
+	var sb strings.Builder
+	for _, b := range bits {
+		if b.Active(raw) {
+			sb.WriteString(b.Char)
+		} else {
+			sb.WriteByte('-')
+		}
+	}
+	return sb.String()
+}
+
+// namedBits returns the bits of bits that have a Name, i.e. that are
+// channels of their own.
+func namedBits(bits []FlagBit) []FlagBit {
+	var out []FlagBit
+	for _, b := range bits {
+		if b.Name != "" {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// FlagChannel is a named bit of a flags sensor, read as a boolean channel:
+// 1 when active, 0 when not.
+type FlagChannel struct {
+	FlagBit
+	Index int // definition index of the flags sensor holding the bit
+}
+
+// FlagChannels returns the bit channels of the existing sensors in defs,
+// in table order.
+func FlagChannels(defs []Definition) []FlagChannel {
+	return FlagChannelsOf(defs, nil)
+}
+
+// FlagChannelsOf returns the bit channels of the sensors at indices, in
+// indices order. nil indices means every sensor in defs.
+func FlagChannelsOf(defs []Definition, indices []int) []FlagChannel {
+	if indices == nil {
+		indices = make([]int, len(defs))
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+	var out []FlagChannel
+	for _, idx := range indices {
+		if idx < 0 || idx >= len(defs) || !defs[idx].Exists {
+			continue
+		}
+		for _, b := range defs[idx].Bits {
+			out = append(out, FlagChannel{FlagBit: b, Index: idx})
+		}
+	}
+	return out
+}
+
+// FindFlag returns the bit channel named name.
+func FindFlag(defs []Definition, name string) (FlagChannel, bool) {
+	for _, ch := range FlagChannels(defs) {
+		if ch.Name == name {
+			return ch, true
+		}
+	}
+	return FlagChannel{}, false
+}
+
+// channelIndex returns the index of the sensor providing the channel slug:
+// the sensor itself, or the flags sensor of a bit channel. It returns -1 if
+// no existing sensor provides it.
+func channelIndex(defs []Definition, slug string) int {
+	if idx, d := FindBySlug(defs, slug); d != nil && d.Exists {
+		return idx
+	}
+	if ch, ok := FindFlag(defs, slug); ok {
+		return ch.Index
+	}
+	return -1
+}
+
+// Flag reports whether the bit channel ch is active in s. ok is false when
+// the flags sensor has no data in s.
+func (s *Sample) Flag(ch FlagChannel) (active, ok bool) {
+	if !s.HasData(ch.Index) {
+		return false, false
+	}
+	return ch.Active(s.Raw(ch.Index)), true
+}
+
+// FlagValue returns the bit channel ch of s as 1 or 0.
+func (s *Sample) FlagValue(ch FlagChannel) float64 {
+	if active, _ := s.Flag(ch); active {
+		return 1
+	}
+	return 0
+}
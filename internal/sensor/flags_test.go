@@ -0,0 +1,126 @@
+package sensor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlagChannels_Builtin(t *testing.T) {
+	defs := DefaultDefinitions()
+	var names []string
+	for _, ch := range FlagChannels(defs) {
+		names = append(names, ch.Name)
+	}
+	if got := strings.Join(names, ","); got != "ACCL,TDC,PS,ACSW,PN,IDLE" {
+		t.Fatalf("FlagChannels = %s", got)
+	}
+
+	var s Sample
+	s.SetData(2, 0x88) // P/S and idle set; TDC, A/C and P/N active low
+	s.SetData(17, 40)
+	floats := s.ConvertedFloats(defs, UnitMetric)
+	want := map[string]float64{"TDC": 1, "PS": 1, "ACSW": 1, "PN": 1, "IDLE": 1}
+	s.SetData(2, 0x34)
+	floats2 := s.ConvertedFloats(defs, UnitMetric)
+	for name, v := range want {
+		if floats[name] != v {
+			t.Errorf("%s(0x88) = %g, want %g", name, floats[name], v)
+		}
+		if floats2[name] != 0 {
+			t.Errorf("%s(0x34) = %g, want 0", name, floats2[name])
+		}
+	}
+	if _, ok := floats["ACCL"]; ok {
+		t.Error("ACCL present without FLG0 data")
+	}
+	if got := s.ConvertedValues(defs, UnitMetric)["IDLE"]; got != "off" {
+		t.Errorf("IDLE formatted = %q, want off", got)
+	}
+}
+
+func TestFlagChannels_Expr(t *testing.T) {
+	defs, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{
+		{Slug: "IRPM", Expr: "if(IDLE, RPM, 0)", Decimals: intPtr(0)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, _ := FindBySlug(defs, "IRPM")
+	if got := WithComputed(defs, []int{2, 17}); !containsInt(got, idx) {
+		t.Errorf("WithComputed(FLG2, RPM) = %v, want IRPM (%d) included", got, idx)
+	}
+
+	var s Sample
+	s.SetData(2, 0x80)
+	s.SetData(17, 40)
+	s.ComputeDerivatives(defs)
+	if !s.HasData(idx) || s.Float(idx) != 1250 {
+		t.Errorf("IRPM at idle = %g (present %v), want 1250", s.Float(idx), s.HasData(idx))
+	}
+	s.SetData(2, 0x00)
+	s.ComputeDerivatives(defs)
+	if s.Float(idx) != 0 {
+		t.Errorf("IRPM off idle = %g, want 0", s.Float(idx))
+	}
+}
+
+func TestFlagChannels_Profile(t *testing.T) {
+	path := writeProfile(t, "flags.yaml", `
+sensors:
+  - slug: SW
+    addr: 0x47
+    convert:
+      kind: flags
+      bits: [{bit: 0, name: CLUTCH}, {bit: 7, char: B, activeLow: true}]
+  - slug: FLG0
+    convert:
+      kind: flags
+      bits: [{bit: 5, name: ACON, description: A/C on, activeLow: true}]
+`)
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sw := FindBySlug(defs, "SW")
+	if s := sw.Format(0x01, UnitMetric); s != "CB" {
+		t.Errorf("SW(0x01) = %q, want CB", s)
+	}
+	ch, ok := FindFlag(defs, "CLUTCH")
+	if !ok || ch.Bit != 0 || ch.Description != "CLUTCH" {
+		t.Errorf("CLUTCH = %+v, %v", ch, ok)
+	}
+	if _, ok := FindFlag(defs, "ACCL"); ok {
+		t.Error("redefined FLG0 should drop ACCL")
+	}
+	if ch, ok := FindFlag(defs, "ACON"); !ok || ch.Description != "A/C on" {
+		t.Errorf("ACON = %+v, %v", ch, ok)
+	}
+
+	errs := []struct {
+		bits []FlagBit
+		want string
+	}{
+		{[]FlagBit{{Bit: 0, Name: "RPM"}}, "already used"},
+		{[]FlagBit{{Bit: 0, Name: "A"}, {Bit: 1, Name: "A"}}, "already used"},
+		{[]FlagBit{{Bit: 0, Name: "X_raw"}}, "may not"},
+		{[]FlagBit{{Bit: 0}}, "single character"},
+	}
+	addr := Addr(0x47)
+	for _, tt := range errs {
+		_, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{
+			{Slug: "SW", Addr: &addr, Convert: &Conversion{Kind: KindFlags, Bits: tt.bits}},
+		}})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("bits %+v: err = %v, want %q", tt.bits, err, tt.want)
+		}
+	}
+}
+
+func containsInt(s []int, v int) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
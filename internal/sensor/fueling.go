@@ -0,0 +1,197 @@
+package sensor
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MAF setups for Fueling.MAF.
+const (
+	MAFStock  = "stock"  // stock Karman vortex MAF, the ECU sees the real airflow
+	MAFScaled = "scaled" // stock MAF, signal scaled down for bigger injectors (SAFC/AFC)
+	MAFGM     = "gm"     // GM hot-wire MAF through a translator scaled for the injectors
+)
+
+// MAFTypes lists the supported Fueling.MAF values.
+var MAFTypes = []string{MAFStock, MAFScaled, MAFGM}
+
+// FuelingChannels are the presets worked out from the fueling hardware.
+// Injector duty itself is the built-in INJD channel.
+var FuelingChannels = []string{"AIRF", "HEAD", "FFLW"}
+
+// RatedPressure is the fuel pressure injector sizes are quoted at: 3 bar
+// (43.5 psi).
+const RatedPressure = 3.0
+
+// StockFuelPressure is the base fuel pressure over manifold of the stock
+// regulator: 2.55 bar (37 psi).
+const StockFuelPressure = 2.55
+
+// Fueling describes the fuel and air metering hardware. The ECU calibration
+// assumes StockCC injectors; when bigger ones are fitted the MAF signal is
+// scaled down by StockCC/InjectorCC so the pulse widths still come out
+// right, which makes the airflow the ECU reports too low by the same ratio.
+type Fueling struct {
+	Cylinders    int     `json:"cylinders"`
+	StockCC      float64 `json:"stockCC"`      // injector size the ECU is calibrated for, cc/min
+	InjectorCC   float64 `json:"injectorCC"`   // installed injector size, cc/min at RatedPressure
+	FuelPressure float64 `json:"fuelPressure"` // fuel pressure over manifold, bar
+	MAF          string  `json:"maf"`          // MAFStock, MAFScaled or MAFGM
+}
+
+// StockFueling returns stock 450cc injectors and MAF on a four cylinder.
+func StockFueling() Fueling {
+	return Fueling{
+		Cylinders:    4,
+		StockCC:      450,
+		InjectorCC:   450,
+		FuelPressure: StockFuelPressure,
+		MAF:          MAFStock,
+	}
+}
+
+// FuelingOptions are changes to stock fueling hardware as the user gives
+// them: zero values keep the stock part.
+type FuelingOptions struct {
+	InjectorCC   float64 `json:"injectorCC"`   // cc/min at RatedPressure
+	FuelPressure string  `json:"fuelPressure"` // see ParsePressure
+	MAF          string  `json:"maf"`          // one of MAFTypes
+}
+
+// IsZero reports whether no changes are set.
+func (o FuelingOptions) IsZero() bool {
+	return o == FuelingOptions{}
+}
+
+// Apply returns f with the options applied, validated.
+func (f Fueling) Apply(o FuelingOptions) (Fueling, error) {
+	if o.InjectorCC != 0 {
+		f.InjectorCC = o.InjectorCC
+	}
+	if o.FuelPressure != "" {
+		p, err := ParsePressure(o.FuelPressure)
+		if err != nil {
+			return f, err
+		}
+		f.FuelPressure = p
+	}
+	if o.MAF != "" {
+		f.MAF = strings.ToLower(strings.TrimSpace(o.MAF))
+	}
+	return f, f.Validate()
+}
+
+// Validate checks the hardware parameters.
+func (f Fueling) Validate() error {
+	switch {
+	case f.Cylinders <= 0:
+		return fmt.Errorf("cylinders must be positive")
+	case f.StockCC <= 0 || f.InjectorCC <= 0:
+		return fmt.Errorf("injector size must be positive")
+	case f.FuelPressure <= 0:
+		return fmt.Errorf("fuel pressure must be positive")
+	}
+	for _, m := range MAFTypes {
+		if f.MAF == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown MAF type %q (have %s)", f.MAF, strings.Join(MAFTypes, ", "))
+}
+
+// EffectiveCC is the flow of one injector at the configured fuel pressure.
+// Flow goes with the square root of the pressure across the injector.
+func (f Fueling) EffectiveCC() float64 {
+	return f.InjectorCC * math.Sqrt(f.FuelPressure/RatedPressure)
+}
+
+// String describes the setup, e.g. "660cc @ 3.00 bar, gm MAF".
+func (f Fueling) String() string {
+	return fmt.Sprintf("%gcc @ %.2f bar, %s MAF", f.InjectorCC, f.FuelPressure, f.MAF)
+}
+
+// dutyExpr is injector duty in percent. Each injector fires once per two
+// revolutions, so duty is pulse (ms) * rpm / 120000 ms. It holds whatever
+// the injector size: only the pulse width changes with bigger injectors.
+const dutyExpr = "INJP * RPM / 1200"
+
+// injectorDuty is dutyExpr for a pulse width in ms and engine speed in rpm;
+// INJD is computed with it.
+func injectorDuty(pulse, rpm float64) float64 {
+	return pulse * rpm / 1200
+}
+
+// airflowExpr is the stock airflow formula: the Karman vortex frequency is
+// volume flow, corrected to mass with air density.
+const airflowExpr = "MAFS * 0.0258 * BARO / 1.013 * 293 / (AIRT + 273)"
+
+// presets returns the expression channels that depend on the hardware.
+func (f Fueling) presets() []ProfileSensor {
+	// Scaled MAF signals under-report airflow by the injector ratio
+	ratio := f.InjectorCC / f.StockCC
+	airf := airflowExpr
+	switch f.MAF {
+	case MAFScaled:
+		if ratio != 1 {
+			airf = fmt.Sprintf("(%s) * %s", airflowExpr, fmtConst(ratio))
+		}
+	case MAFGM:
+		// the translator outputs mass flow already, no density correction
+		airf = "MAFS * 0.0258"
+		if ratio != 1 {
+			airf += " * " + fmtConst(ratio)
+		}
+	}
+
+	return []ProfileSensor{
+		{
+			Slug:        "AIRF",
+			Description: "Air flow",
+			Unit:        "g/s",
+			Expr:        airf,
+			Limits:      limits(0, 250, 1),
+		},
+		{
+			Slug:        "HEAD",
+			Description: "Injector headroom",
+			Unit:        "%",
+			Expr:        "clamp(100 - " + dutyExpr + ", 0, 100)",
+			Limits:      limits(0, 100, 1).warnBelow(15).critBelow(5),
+		},
+		{
+			Slug:        "FFLW",
+			Description: "Fuel flow",
+			Unit:        "cc/min",
+			Expr:        fmt.Sprintf("%s / 100 * %s", dutyExpr, fmtConst(f.EffectiveCC()*float64(f.Cylinders))),
+			Decimals:    intPtr(0),
+			Limits:      limits(0, math.Round(f.EffectiveCC()*float64(f.Cylinders)), 0),
+		},
+	}
+}
+
+// fmtConst formats a constant for an expression, to 3 decimals.
+func fmtConst(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+// ParsePressure parses a fuel pressure in bar: "3", "3bar", "43.5psi" or
+// "300kPa".
+func ParsePressure(s string) (float64, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(t, "psi"):
+		t, scale = strings.TrimSuffix(t, "psi"), 1/14.50326
+	case strings.HasSuffix(t, "kpa"):
+		t, scale = strings.TrimSuffix(t, "kpa"), 0.01
+	case strings.HasSuffix(t, "bar"):
+		t = strings.TrimSuffix(t, "bar")
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid fuel pressure %q", s)
+	}
+	return v * scale, nil
+}
@@ -0,0 +1,110 @@
+package sensor
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParsePressure(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+	}{
+		{"3", 3},
+		{"2.55bar", 2.55},
+		{"43.5 psi", 43.5 / 14.50326},
+		{"300kPa", 3},
+	}
+	for _, tt := range tests {
+		got, err := ParsePressure(tt.in)
+		if err != nil || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("ParsePressure(%q) = %g, %v; want %g", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "psi", "-1", "three"} {
+		if _, err := ParsePressure(in); err == nil {
+			t.Errorf("ParsePressure(%q) should fail", in)
+		}
+	}
+}
+
+func TestFuelingApply(t *testing.T) {
+	f, err := StockFueling().Apply(FuelingOptions{InjectorCC: 660, FuelPressure: "3bar", MAF: "GM"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.InjectorCC != 660 || f.StockCC != 450 || f.FuelPressure != 3 || f.MAF != MAFGM {
+		t.Errorf("Apply = %+v", f)
+	}
+	if got := f.String(); got != "660cc @ 3.00 bar, gm MAF" {
+		t.Errorf("String = %q", got)
+	}
+	if math.Abs(f.EffectiveCC()-660) > 1e-9 {
+		t.Errorf("EffectiveCC at rated pressure = %g, want 660", f.EffectiveCC())
+	}
+
+	if _, err := StockFueling().Apply(FuelingOptions{MAF: "vaf"}); err == nil || !strings.Contains(err.Error(), "scaled") {
+		t.Errorf("unknown MAF err = %v, want the list of types", err)
+	}
+	if _, err := StockFueling().Apply(FuelingOptions{InjectorCC: -1}); err == nil {
+		t.Error("negative injector size should fail")
+	}
+	if !(FuelingOptions{}).IsZero() || (FuelingOptions{MAF: MAFStock}).IsZero() {
+		t.Error("IsZero")
+	}
+}
+
+func TestAddDerivedWithFueling(t *testing.T) {
+	f, err := StockFueling().Apply(FuelingOptions{InjectorCC: 900, MAF: MAFScaled})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Duplicates are added once
+	defs, err := AddDerivedWithFueling(DefaultDefinitions(), append([]string{"AIRF"}, FuelingChannels...), f)
+	if err != nil {
+		t.Fatalf("AddDerivedWithFueling failed: %v", err)
+	}
+	idx := make(map[string]int)
+	for _, slug := range FuelingChannels {
+		i, d := FindBySlug(defs, slug)
+		if d == nil || !d.IsExpr() {
+			t.Fatalf("%s missing: %+v", slug, d)
+		}
+		idx[slug] = i
+	}
+
+	var s Sample
+	s.SetData(15, 80)  // MAFS 503.2 Hz
+	s.SetData(12, 208) // BARO 1.011 bar
+	s.SetData(21, 75)  // AIRT
+	s.SetData(17, 96)  // RPM 3000
+	s.SetData(19, 100) // INJP 25.6 ms
+	s.ComputeDerivatives(defs)
+
+	airt := defs[21].Convert(75, UnitMetric)
+	stockAIRF := 503.2 * 0.0258 * (0.00486 * 208) / 1.013 * 293 / (airt + 273)
+	if got := s.Float(idx["AIRF"]); math.Abs(got-stockAIRF*2) > 1e-9 {
+		t.Errorf("AIRF with 900cc on a scaled MAF = %g, want twice stock %g", got, stockAIRF)
+	}
+	// INJD and HEAD come from the same duty formula, INJD in 100/128 % steps
+	wantDuty := 25.6 * 3000 / 1200
+	if got := s.Value(defs, 20, UnitMetric); math.Abs(got-wantDuty) > 100.0/128 {
+		t.Errorf("INJD = %g, want %g", got, wantDuty)
+	}
+	if got := s.Float(idx["HEAD"]); math.Abs(got-(100-wantDuty)) > 1e-9 {
+		t.Errorf("HEAD = %g, want %g", got, 100-wantDuty)
+	}
+	wantFFLW := 25.6 * 3000 / 120000 * math.Round(900*math.Sqrt(2.55/3)*4*1000) / 1000
+	if got := s.Float(idx["FFLW"]); math.Abs(got-wantFFLW) > 1e-9 {
+		t.Errorf("FFLW = %g, want %g", got, wantFFLW)
+	}
+
+	// A GM translator reports mass flow; no density correction
+	gm, _ := StockFueling().Apply(FuelingOptions{MAF: MAFGM})
+	for _, p := range gm.DerivedPresets() {
+		if p.Slug == "AIRF" && p.Expr != "MAFS * 0.0258" {
+			t.Errorf("GM AIRF = %q", p.Expr)
+		}
+	}
+}
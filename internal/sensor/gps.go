@@ -0,0 +1,77 @@
+package sensor
+
+// GPS channel slugs. A GPS receiver (see package gps) sets them in each
+// sample as float values; the 1G DSM has no vehicle speed sensor, so GSPD
+// is the only speed it logs.
+const (
+	GPSSpeedSlug   = "GSPD" // ground speed, km/h
+	GPSLatSlug     = "GLAT" // latitude, degrees north
+	GPSLonSlug     = "GLON" // longitude, degrees east
+	GPSHeadingSlug = "GHDG" // course over ground, degrees true
+	GPSFixSlug     = "GFIX" // NMEA fix quality: 0 = no fix, 1 = GPS, 2 = DGPS, ...
+)
+
+// GPSChannels holds the definition indices of the GPS channels.
+type GPSChannels struct {
+	Speed, Lat, Lon, Heading, Fix int
+}
+
+// Indices returns the channel indices, speed first.
+func (c GPSChannels) Indices() []int {
+	return []int{c.Speed, c.Lat, c.Lon, c.Heading, c.Fix}
+}
+
+// gpsDefinitions are the GPS channels in Indices order. GSPD is in the
+// speed family, so the imperial system shows it in mph.
+func gpsDefinitions() []Definition {
+	input := func(slug, desc, unit string, decimals int, l *Limits) Definition {
+		return Definition{
+			Addr:        0xFF,
+			Slug:        slug,
+			Description: desc,
+			Unit:        unit,
+			Exists:      true,
+			Computed:    true,
+			Limits:      l,
+			convertFunc: fDEC,
+			decimals:    decimals,
+			input:       true,
+			builtin:     slug,
+			base:        builtinUnit(unit),
+		}
+	}
+	return []Definition{
+		input(GPSSpeedSlug, "GPS speed", "km/h", 1, limits(0, 250, 1)),
+		input(GPSLatSlug, "GPS latitude", "°", 6, limits(-90, 90, 6)),
+		input(GPSLonSlug, "GPS longitude", "°", 6, limits(-180, 180, 6)),
+		input(GPSHeadingSlug, "GPS heading", "°", 0, limits(0, 360, 0)),
+		input(GPSFixSlug, "GPS fix quality", "", 0, limits(0, 8, 0).warnBelow(1)),
+	}
+}
+
+// AddGPS returns a copy of defs with the GPS channels in free custom slots,
+// and their indices. GPS channels already in defs are kept.
+func AddGPS(defs []Definition) ([]Definition, GPSChannels, error) {
+	var idx [5]int
+	for i, def := range gpsDefinitions() {
+		var err error
+		if defs, idx[i], err = addInput(defs, def, "a GPS"); err != nil {
+			return nil, GPSChannels{}, err
+		}
+	}
+	return defs, GPSChannels{Speed: idx[0], Lat: idx[1], Lon: idx[2], Heading: idx[3], Fix: idx[4]}, nil
+}
+
+// FindGPS returns the GPS channels of defs; ok is false unless all of them
+// are GPS input channels.
+func FindGPS(defs []Definition) (c GPSChannels, ok bool) {
+	var idx [5]int
+	for i, def := range gpsDefinitions() {
+		j, d := FindBySlug(defs, def.Slug)
+		if d == nil || !d.Exists || !d.IsInput() {
+			return GPSChannels{}, false
+		}
+		idx[i] = j
+	}
+	return GPSChannels{Speed: idx[0], Lat: idx[1], Lon: idx[2], Heading: idx[3], Fix: idx[4]}, true
+}
@@ -0,0 +1,67 @@
+package sensor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAddGPS(t *testing.T) {
+	defs, ch, err := AddGPS(DefaultDefinitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, ok := FindGPS(defs); !ok || found != ch {
+		t.Fatalf("FindGPS = %+v, %v; want %+v", found, ok, ch)
+	}
+	for _, idx := range ch.Indices() {
+		if idx < FirstCustomSlot || !defs[idx].IsInput() || containsInt(AllPollableIndices(defs), idx) {
+			t.Errorf("%s at %d = %+v", defs[idx].Slug, idx, defs[idx])
+		}
+	}
+
+	var s Sample
+	s.SetValue(ch.Speed, 100)
+	s.SetValue(ch.Lat, 47.2545123)
+	s.SetValue(ch.Fix, 1)
+	tests := []struct {
+		idx   int
+		units UnitSystem
+		want  string
+	}{
+		{ch.Speed, UnitMetric, "100.0km/h"},
+		{ch.Speed, UnitEnglish, "62.1mph"},
+		{ch.Speed, UnitRaw, "100.0km/h"}, // no raw byte to show
+		{ch.Lat, UnitEnglish, "47.254512°"},
+		{ch.Fix, UnitMetric, "1"},
+	}
+	for _, tt := range tests {
+		if got := s.Formatted(defs, tt.idx, tt.units); got != tt.want {
+			t.Errorf("%s in %v = %q, want %q", defs[tt.idx].Slug, tt.units, got, tt.want)
+		}
+	}
+	if got := defs[ch.Speed].UnitLabel(UnitRaw); got != "km/h" {
+		t.Errorf("GSPD raw unit label = %q", got)
+	}
+	var lost Sample
+	lost.SetValue(ch.Fix, 0)
+	if s.Level(defs, ch.Fix) != LevelNormal || lost.Level(defs, ch.Fix) != LevelWarn {
+		t.Error("want a warning without a fix only")
+	}
+
+	// Without a speed sensor GEAR reads GPS speed
+	geared, err := AddDerived(defs, []string{"GEAR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gear, _ := FindBySlug(geared, "GEAR")
+	s.SetData(17, 90) // 2812 rpm
+	s.ComputeDerivatives(geared)
+	if got := s.Float(gear); math.Abs(got-4) > 1e-9 {
+		t.Errorf("GEAR at 100 km/h, 2812 rpm = %g, want 4", got)
+	}
+
+	// Adding them again keeps the channels
+	if again, ch2, err := AddGPS(defs); err != nil || ch2 != ch || len(again) != len(defs) {
+		t.Errorf("AddGPS twice = %+v, %v", ch2, err)
+	}
+}
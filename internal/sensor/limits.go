@@ -0,0 +1,141 @@
+package sensor
+
+import "fmt"
+
+// Limits are the display hints of a channel: the range a gauge or graph
+// spans, the decimals to show, and the thresholds past which a value is
+// flagged. Values are in the channel's base unit (metric for the built-in
+// sensors, the sensor's own unit for user sensors); see ForDisplay for the
+// unit a GUI shows. Nil thresholds are not checked.
+type Limits struct {
+	Min      float64  `json:"min" yaml:"min"`
+	Max      float64  `json:"max" yaml:"max"`
+	Decimals int      `json:"decimals" yaml:"decimals"`
+	WarnLow  *float64 `json:"warnLow,omitempty" yaml:"warnLow,omitempty"`   // warn below
+	WarnHigh *float64 `json:"warnHigh,omitempty" yaml:"warnHigh,omitempty"` // warn above
+	CritLow  *float64 `json:"critLow,omitempty" yaml:"critLow,omitempty"`   // critical below
+	CritHigh *float64 `json:"critHigh,omitempty" yaml:"critHigh,omitempty"` // critical above
+}
+
+// Level is how far a value is outside its thresholds.
+type Level int
+
+const (
+	LevelNormal Level = iota
+	LevelWarn
+	LevelCritical
+)
+
+// String returns "ok", "warn" or "critical".
+func (l Level) String() string {
+	switch l {
+	case LevelWarn:
+		return "warn"
+	case LevelCritical:
+		return "critical"
+	default:
+		return "ok"
+	}
+}
+
+// limits returns display limits without thresholds; the builders below
+// add them, e.g. limits(0, 18, 1).warnBelow(12).
+func limits(min, max float64, decimals int) *Limits {
+	return &Limits{Min: min, Max: max, Decimals: decimals}
+}
+
+func (l *Limits) warnBelow(v float64) *Limits { l.WarnLow = &v; return l }
+func (l *Limits) warnAbove(v float64) *Limits { l.WarnHigh = &v; return l }
+func (l *Limits) critBelow(v float64) *Limits { l.CritLow = &v; return l }
+func (l *Limits) critAbove(v float64) *Limits { l.CritHigh = &v; return l }
+
+// Level returns the level of v. A nil l is always LevelNormal.
+func (l *Limits) Level(v float64) Level {
+	switch {
+	case l == nil:
+		return LevelNormal
+	case l.CritLow != nil && v < *l.CritLow, l.CritHigh != nil && v > *l.CritHigh:
+		return LevelCritical
+	case l.WarnLow != nil && v < *l.WarnLow, l.WarnHigh != nil && v > *l.WarnHigh:
+		return LevelWarn
+	}
+	return LevelNormal
+}
+
+// Validate checks that the range is not empty and the decimals are sane.
+func (l *Limits) Validate() error {
+	if l.Max <= l.Min {
+		return fmt.Errorf("limits: max %g must be above min %g", l.Max, l.Min)
+	}
+	if l.Decimals < 0 || l.Decimals > 6 {
+		return fmt.Errorf("limits: decimals %d out of range 0-6", l.Decimals)
+	}
+	return nil
+}
+
+// clone returns a deep copy of l, so definitions never share thresholds.
+func (l *Limits) clone() *Limits {
+	if l == nil {
+		return nil
+	}
+	c := *l
+	for _, p := range []**float64{&c.WarnLow, &c.WarnHigh, &c.CritLow, &c.CritHigh} {
+		if *p != nil {
+			v := **p
+			*p = &v
+		}
+	}
+	return &c
+}
+
+// mapValues returns a copy of l with every value passed through fn, which
+// must be increasing.
+func (l *Limits) mapValues(fn func(float64) float64) *Limits {
+	c := l.clone()
+	c.Min, c.Max = fn(c.Min), fn(c.Max)
+	for _, p := range []*float64{c.WarnLow, c.WarnHigh, c.CritLow, c.CritHigh} {
+		if p != nil {
+			*p = fn(*p)
+		}
+	}
+	return c
+}
+
+// LimitsIn returns the limits of d in the unit its values are shown in
+// under units. Raw values span their RawRange without thresholds.
+func (d *Definition) LimitsIn(units UnitSystem) *Limits {
+	if d.Limits == nil {
+		return nil
+	}
+	if units == UnitRaw && d.isRaw() {
+		lo, hi := d.RawRange()
+		return limits(float64(lo), float64(hi), 0)
+	}
+	u := d.targetUnit(units)
+	if u == nil {
+		return d.Limits.clone()
+	}
+	l := d.Limits.mapValues(func(v float64) float64 { return u.FromBase(d.base.ToBase(v)) })
+	l.Decimals = u.Decimals
+	return l
+}
+
+// ForDisplay returns a copy of defs with Limits converted to the units
+// values are shown in, for a GUI that compares them with converted values.
+func ForDisplay(defs []Definition, units UnitSystem) []Definition {
+	out := make([]Definition, len(defs))
+	copy(out, defs)
+	for i := range out {
+		out[i].Limits = out[i].LimitsIn(units)
+	}
+	return out
+}
+
+// Level returns the level of the channel at idx against its limits. Values
+// are compared in the base unit, so display units do not matter.
+func (s *Sample) Level(defs []Definition, idx int) Level {
+	if !s.HasData(idx) {
+		return LevelNormal
+	}
+	return defs[idx].Limits.Level(s.metricValue(defs, idx))
+}
@@ -0,0 +1,118 @@
+package sensor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLimits_Defaults(t *testing.T) {
+	defs := DefaultDefinitions()
+	tests := []struct {
+		idx  int
+		raw  byte
+		want Level
+	}{
+		{4, 0x40, LevelNormal},   // COOL ~ 72°C
+		{4, 0x14, LevelWarn},     // COOL ~ 102°C
+		{4, 0x10, LevelCritical}, // COOL ~ 110°C
+		{18, 3, LevelNormal},     // KNCK
+		{18, 4, LevelWarn},
+		{11, 170, LevelNormal},   // BATT 12.5V
+		{11, 160, LevelWarn},     // BATT 11.7V
+		{11, 140, LevelCritical}, // BATT 10.3V
+	}
+	for _, tt := range tests {
+		var s Sample
+		s.SetData(tt.idx, tt.raw)
+		v := defs[tt.idx].Convert(tt.raw, UnitMetric)
+		if got := s.Level(defs, tt.idx); got != tt.want {
+			t.Errorf("%s(%g) level = %v, want %v", defs[tt.idx].Slug, v, got, tt.want)
+		}
+	}
+	for _, d := range defs {
+		if d.Exists && d.Limits != nil {
+			if err := d.Limits.Validate(); err != nil {
+				t.Errorf("%s: %v", d.Slug, err)
+			}
+		}
+	}
+}
+
+func TestLimits_Units(t *testing.T) {
+	defs := DefaultDefinitions()
+	cool := defs[4].LimitsIn(UnitEnglish)
+	if !approxEqual(cool.Min, -40, 1e-9) || !approxEqual(*cool.WarnHigh, 212, 1e-9) || !approxEqual(*cool.CritHigh, 221, 1e-9) {
+		t.Errorf("COOL imperial limits = %+v", cool)
+	}
+	if *defs[4].Limits.CritHigh != 105 {
+		t.Error("LimitsIn modified the definition")
+	}
+	if raw := defs[4].LimitsIn(UnitRaw); raw.Min != 0 || raw.Max != 255 || raw.CritHigh != nil {
+		t.Errorf("COOL raw limits = %+v", raw)
+	}
+
+	defs, err := ApplyUnits(defs, map[string]string{"BARO": "kPa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shown := ForDisplay(defs, UnitMetric)
+	if l := shown[12].Limits; !approxEqual(l.Max, 150, 1e-9) || l.Decimals != 1 {
+		t.Errorf("BARO kPa limits = %+v", l)
+	}
+
+	// Levels are checked in the base unit whatever is displayed
+	var s Sample
+	s.SetData(4, 0x10)
+	if got := s.Level(shown, 4); got != LevelCritical {
+		t.Errorf("COOL level with display defs = %v", got)
+	}
+}
+
+func TestLimits_Profile(t *testing.T) {
+	path := writeProfile(t, "limits.yaml", `
+sensors:
+  - slug: BOOST
+    addr: 0x45
+    unit: psi
+    convert: {kind: linear, scale: 0.25, offset: -14.7}
+    limits: {min: -15, max: 25, decimals: 1, warnHigh: 18, critHigh: 21}
+  - slug: COOL
+    limits: {min: 0, max: 130, critHigh: 110}
+  - slug: HEAD
+    limits: {min: 0, max: 100, warnLow: 20}
+`)
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, boost := FindBySlug(defs, "BOOST")
+	var s Sample
+	s.SetData(idx, 140) // 20.3 psi
+	if boost.Limits == nil || s.Level(defs, idx) != LevelWarn {
+		t.Errorf("BOOST limits = %+v, level %v", boost.Limits, s.Level(defs, idx))
+	}
+	if _, cool := FindBySlug(defs, "COOL"); cool.Limits.WarnHigh != nil || *cool.Limits.CritHigh != 110 {
+		t.Errorf("COOL limits = %+v, want replaced", cool.Limits)
+	}
+	if _, head := FindBySlug(defs, "HEAD"); head == nil || *head.Limits.WarnLow != 20 || head.Limits.CritLow != nil {
+		t.Errorf("HEAD limits = %+v, want the file's", head)
+	}
+
+	// A new conversion drops the built-in limits
+	defs, err = ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{
+		{Slug: "COOL", Convert: &Conversion{Kind: KindLinear}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if defs[4].Limits != nil {
+		t.Errorf("COOL limits after new conversion = %+v", defs[4].Limits)
+	}
+
+	_, err = ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{
+		{Slug: "COOL", Limits: &Limits{Min: 10, Max: 10}},
+	}})
+	if err == nil || !strings.Contains(err.Error(), "must be above") {
+		t.Errorf("empty range err = %v", err)
+	}
+}
@@ -0,0 +1,688 @@
+package sensor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CommandRangeStart is the first ECU address that is a command rather than a
+// readable variable. Sensor definitions must stay below it.
+const CommandRangeStart byte = 0xC0
+
+// FirstCustomSlot is the first definition index free for user sensors.
+const FirstCustomSlot = 23
+
+// Conversion kinds for user-defined sensors.
+const (
+	KindRaw    = "raw"    // value is the raw byte
+	KindLinear = "linear" // value = raw*scale + offset
+	KindTable  = "table"  // piecewise-linear interpolation between points
+	KindFlags  = "flags"  // one character per bit, "-" when the bit is off; named bits are channels
+)
+
+// Profile is a user sensor file: definitions that override built-in sensors
+// (matched by slug or slot index) or fill the free custom slots. It can be
+// written in YAML or JSON:
+//
+//	name: 2G swap
+//	sensors:
+//	  - slug: BOOST
+//	    addr: 0x45
+//	    description: Boost (MDP)
+//	    unit: psi
+//	    convert: {kind: linear, scale: 0.125, offset: -14.7, decimals: 1}
+//	    limits: {min: -15, max: 25, decimals: 1, warnHigh: 18, critHigh: 21}
+//	  - slug: COOL
+//	    convert:
+//	      kind: table
+//	      points: [[0, 140], [128, 60], [255, -40]]
+//	  - slug: BOOSTB
+//	    expr: BOOST / 14.5
+//	    unit: bar
+//	    decimals: 2
+//	  - slug: SW
+//	    addr: 0x47
+//	    convert:
+//	      kind: flags
+//	      bits: [{bit: 0, name: CLUTCH}, {bit: 7, char: B, activeLow: true}]
+//	  - slug: AIRF # built-in derived channel, see DerivedPresets
+//	  - slug: AFCNT
+//	    addr: 0x4A # high byte; the low byte is at addr2, default addr+1
+//	    size: 2
+//	    convert: {kind: linear, scale: 0.1, decimals: 1}
+//	  - slug: KRET
+//	    addr: 0x4C
+//	    signed: true
+type Profile struct {
+	Name    string          `json:"name,omitempty" yaml:"name,omitempty"`
+	Sensors []ProfileSensor `json:"sensors" yaml:"sensors"`
+}
+
+// ProfileSensor is one entry of a Profile. Fields left empty keep the value
+// of the built-in sensor being overridden.
+type ProfileSensor struct {
+	Index       *int        `json:"index,omitempty" yaml:"index,omitempty"` // definition slot; default: match slug, else next free custom slot
+	Slug        string      `json:"slug" yaml:"slug"`
+	Addr        *Addr       `json:"addr,omitempty" yaml:"addr,omitempty"`
+	Size        int         `json:"size,omitempty" yaml:"size,omitempty"`     // 2 for a two-byte sensor; default 1
+	Addr2       *Addr       `json:"addr2,omitempty" yaml:"addr2,omitempty"`   // second byte of a two-byte sensor; default addr+1
+	Endian      string      `json:"endian,omitempty" yaml:"endian,omitempty"` // byte order of a two-byte sensor: big (default) or little
+	Signed      bool        `json:"signed,omitempty" yaml:"signed,omitempty"` // raw value is two's complement
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Unit        string      `json:"unit,omitempty" yaml:"unit,omitempty"`
+	Disabled    bool        `json:"disabled,omitempty" yaml:"disabled,omitempty"` // hide a built-in sensor
+	Convert     *Conversion `json:"convert,omitempty" yaml:"convert,omitempty"`
+	Expr        string      `json:"expr,omitempty" yaml:"expr,omitempty"`         // computed channel formula, see CompileExpr
+	Decimals    *int        `json:"decimals,omitempty" yaml:"decimals,omitempty"` // expr channels; default 1
+	Limits      *Limits     `json:"limits,omitempty" yaml:"limits,omitempty"`     // range and thresholds, in the sensor's unit
+}
+
+// Addr is an ECU address that unmarshals from a number or a string such as
+// "0x45", so JSON profiles can use hex too.
+type Addr byte
+
+func parseAddr(s string) (Addr, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 0, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return Addr(v), nil
+}
+
+// UnmarshalJSON accepts 69 or "0x45".
+func (a *Addr) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	v, err := parseAddr(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// UnmarshalYAML accepts 69, 0x45 or "0x45".
+func (a *Addr) UnmarshalYAML(node *yaml.Node) error {
+	v, err := parseAddr(node.Value)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// MarshalJSON writes the address as a hex string.
+func (a Addr) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"0x%02X"`, byte(a))), nil
+}
+
+// Byte orders of two-byte sensors.
+const (
+	EndianBig    = "big"    // high byte at addr, as the ECU's 6801-family CPU stores words
+	EndianLittle = "little" // low byte at addr
+)
+
+// Conversion selects one of the built-in conversion kinds. Raw values are
+// those of Definition.RawValue: signed and 16 bits wide where the sensor is.
+type Conversion struct {
+	Kind     string       `json:"kind" yaml:"kind"`
+	Scale    *float64     `json:"scale,omitempty" yaml:"scale,omitempty"` // linear; default 1
+	Offset   float64      `json:"offset,omitempty" yaml:"offset,omitempty"`
+	Points   [][2]float64 `json:"points,omitempty" yaml:"points,omitempty"` // table: [raw, value] pairs
+	Bits     []FlagBit    `json:"bits,omitempty" yaml:"bits,omitempty"`     // flags
+	Decimals *int         `json:"decimals,omitempty" yaml:"decimals,omitempty"`
+}
+
+// FlagBit names one bit of a flags sensor. A bit with a Name is also a
+// boolean channel of that name, see FlagChannel.
+type FlagBit struct {
+	Bit         int    `json:"bit" yaml:"bit"`
+	Char        string `json:"char,omitempty" yaml:"char,omitempty"`               // shown when the bit is set; default: first letter of Name
+	ActiveLow   bool   `json:"activeLow,omitempty" yaml:"activeLow,omitempty"`     // bit reads 0 when active
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`               // channel slug
+	Description string `json:"description,omitempty" yaml:"description,omitempty"` // channel description; default: Name
+}
+
+// LoadProfile reads a YAML or JSON sensor profile. Files ending in .json are
+// parsed as JSON; anything else as YAML.
+func LoadProfile(path string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sensor file: %w", err)
+	}
+	var p Profile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &p)
+	} else {
+		err = yaml.Unmarshal(data, &p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse sensor file %s: %w", path, err)
+	}
+	if len(p.Sensors) == 0 {
+		return nil, fmt.Errorf("sensor file %s defines no sensors", path)
+	}
+	return &p, nil
+}
+
+// LoadDefinitions returns DefaultDefinitions with the profile at path applied.
+// An empty path returns the defaults unchanged.
+func LoadDefinitions(path string) ([]Definition, error) {
+	return ApplyProfileFile(DefaultDefinitions(), path)
+}
+
+// ApplyProfileFile returns defs with the profile at path applied. An empty
+// path returns defs unchanged.
+func ApplyProfileFile(defs []Definition, path string) ([]Definition, error) {
+	if path == "" {
+		return defs, nil
+	}
+	p, err := LoadProfile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyProfile(defs, p)
+}
+
+// ApplyProfile returns a copy of defs with the profile's sensors applied.
+// It fails if a sensor would sit in the command range, the profile needs
+// more than MaxChannels slots, or two sensors end up with the same slug or
+// address. Sensors that do not fit in the free custom slots are appended
+// to the table.
+func ApplyProfile(defs []Definition, p *Profile) ([]Definition, error) {
+	out := make([]Definition, len(defs))
+	copy(out, defs)
+
+	for n, ps := range p.Sensors {
+		where := fmt.Sprintf("sensor %d", n+1)
+		if ps.Slug != "" {
+			where = fmt.Sprintf("sensor %d (%s)", n+1, ps.Slug)
+		}
+		if err := validateSlug(ps.Slug); err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+
+		idx, err := profileSlot(out, ps)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		if idx == len(out) {
+			out = append(out, Definition{Addr: 0x00, convertFunc: fDEC})
+		}
+		def := out[idx]
+		builtin := def.Exists
+		if def.Computed && !def.IsExpr() {
+			return nil, fmt.Errorf("%s: %s is computed and cannot be redefined", where, def.Slug)
+		}
+
+		if ps.Disabled {
+			def.Exists = false
+			out[idx] = def
+			continue
+		}
+
+		// A bare new slug naming a derived preset adds that preset
+		if !builtin && ps.Addr == nil && ps.Expr == "" && ps.Convert == nil {
+			if preset, ok := derivedPreset(out, ps.Slug); ok {
+				preset.Index = ps.Index
+				if ps.Description != "" {
+					preset.Description = ps.Description
+				}
+				if ps.Unit != "" {
+					preset.Unit = ps.Unit
+				}
+				if ps.Decimals != nil {
+					preset.Decimals = ps.Decimals
+				}
+				if ps.Limits != nil {
+					preset.Limits = ps.Limits
+				}
+				ps = preset
+			}
+		}
+		if ps.Expr != "" || def.IsExpr() {
+			def, err = applyExpr(def, ps)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			out[idx] = def
+			continue
+		}
+
+		def.Slug = ps.Slug
+		if ps.Addr != nil {
+			def.Addr = byte(*ps.Addr)
+		} else if !builtin {
+			return nil, fmt.Errorf("%s: addr is required for a new sensor", where)
+		}
+		if def.Addr >= CommandRangeStart {
+			return nil, fmt.Errorf("%s: address 0x%02X is in the command range (>=0x%02X)", where, def.Addr, CommandRangeStart)
+		}
+		if err := applyLayout(&def, ps, builtin); err != nil {
+			return nil, fmt.Errorf("%s: %w", where, err)
+		}
+		if ps.Description != "" {
+			def.Description = ps.Description
+		} else if !builtin {
+			def.Description = ps.Slug
+		}
+		if ps.Unit != "" || !builtin {
+			def.Unit = ps.Unit
+		}
+		if def.Unit == "" && ps.Convert != nil && strings.EqualFold(ps.Convert.Kind, KindFlags) {
+			def.Unit = "flags"
+		}
+		if ps.Convert != nil {
+			lo, hi := def.RawRange()
+			fn, err := ps.Convert.build(def.Unit, lo, hi)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			def.convertFunc, def.rawFunc = fDEC, fn
+			def.conv, def.builtin = ps.Convert.clone(), ""
+			def.Bits = nil
+			if strings.EqualFold(ps.Convert.Kind, KindFlags) {
+				if def.IsWord() || def.Signed {
+					return nil, fmt.Errorf("%s: a flags sensor is one unsigned byte", where)
+				}
+				def.Bits = namedBits(ps.Convert.flagBits())
+			}
+		} else if !builtin {
+			def.convertFunc, def.rawFunc = fDEC, nil
+			def.conv, def.builtin = nil, ""
+			def.Bits = nil
+		}
+		if ps.Convert != nil || !builtin {
+			// A new conversion reads in its own unit; known ones stay convertible
+			def.base, def.display = nil, nil
+			if ps.Convert == nil || !strings.EqualFold(ps.Convert.Kind, KindFlags) {
+				def.base = builtinUnit(def.Unit)
+			}
+			def.Limits = nil
+		}
+		if ps.Limits != nil {
+			if err := ps.Limits.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: %w", where, err)
+			}
+			def.Limits = ps.Limits.clone()
+		}
+		def.Exists = true
+		out[idx] = def
+	}
+
+	if err := ValidateDefinitions(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// applyLayout sets the size, second address, byte order and signedness of
+// a polled sensor from ps. A new sensor takes them from ps alone; a
+// built-in one keeps its own unless ps changes them, which needs a convert
+// since the built-in conversions read one unsigned byte.
+func applyLayout(def *Definition, ps ProfileSensor, builtin bool) error {
+	changed := ps.Size != 0 || ps.Addr2 != nil || ps.Endian != "" || ps.Signed
+	if builtin && !changed {
+		return nil
+	}
+	if builtin && ps.Convert == nil {
+		return fmt.Errorf("size, addr2, endian or signed on built-in sensor %s need a convert", ps.Slug)
+	}
+	def.Size, def.Addr2, def.LittleEndian, def.Signed = 0, 0, false, ps.Signed
+	switch ps.Size {
+	case 0, 1:
+		if ps.Addr2 != nil || ps.Endian != "" {
+			return fmt.Errorf("addr2 and endian are for two-byte sensors (size: 2)")
+		}
+		return nil
+	case 2:
+	default:
+		return fmt.Errorf("size %d not supported (1 or 2 bytes)", ps.Size)
+	}
+	def.Size = 2
+	switch strings.ToLower(ps.Endian) {
+	case "", EndianBig:
+	case EndianLittle:
+		def.LittleEndian = true
+	default:
+		return fmt.Errorf("unknown endian %q (want big or little)", ps.Endian)
+	}
+	if ps.Addr2 != nil {
+		def.Addr2 = byte(*ps.Addr2)
+	} else if def.Addr+1 < CommandRangeStart {
+		def.Addr2 = def.Addr + 1
+	} else {
+		return fmt.Errorf("addr2 is required: 0x%02X is the last readable address", def.Addr)
+	}
+	if def.Addr2 >= CommandRangeStart {
+		return fmt.Errorf("addr2 0x%02X is in the command range (>=0x%02X)", def.Addr2, CommandRangeStart)
+	}
+	if def.Addr2 == def.Addr {
+		return fmt.Errorf("addr2 0x%02X is the same as addr", def.Addr2)
+	}
+	return nil
+}
+
+// applyExpr makes def the expression channel described by ps.
+func applyExpr(def Definition, ps ProfileSensor) (Definition, error) {
+	if def.Exists && !def.IsExpr() {
+		return def, fmt.Errorf("%s is a polled sensor; give the expression channel its own slug", def.Slug)
+	}
+	if ps.Addr != nil || ps.Convert != nil {
+		return def, fmt.Errorf("an expr channel has no addr or convert")
+	}
+	if ps.Size != 0 || ps.Addr2 != nil || ps.Endian != "" || ps.Signed {
+		return def, fmt.Errorf("an expr channel has no size, addr2, endian or signed")
+	}
+	if ps.Expr != "" {
+		e, err := CompileExpr(ps.Expr)
+		if err != nil {
+			return def, err
+		}
+		def.Expr, def.expr = ps.Expr, e
+	}
+	if !def.Exists {
+		def.Description, def.Unit, def.decimals, def.Limits = ps.Slug, "", 1, nil
+	}
+	if ps.Description != "" {
+		def.Description = ps.Description
+	}
+	if ps.Unit != "" {
+		def.Unit = ps.Unit
+	}
+	if ps.Decimals != nil {
+		if *ps.Decimals < 0 || *ps.Decimals > 6 {
+			return def, fmt.Errorf("decimals %d out of range 0-6", *ps.Decimals)
+		}
+		def.decimals = *ps.Decimals
+	}
+	if ps.Limits != nil {
+		if err := ps.Limits.Validate(); err != nil {
+			return def, err
+		}
+		def.Limits = ps.Limits.clone()
+	}
+	def.base, def.display = builtinUnit(def.Unit), nil
+	def.Slug = ps.Slug
+	def.Addr = 0xFF
+	def.Bits = nil
+	def.Size, def.Addr2, def.LittleEndian, def.Signed = 0, 0, false, false
+	def.Computed = true
+	def.Exists = true
+	def.convertFunc, def.rawFunc = fDEC, nil
+	def.conv, def.builtin = nil, ""
+	return def, nil
+}
+
+// profileSlot picks the definition index a profile sensor goes into;
+// len(defs) means a new slot at the end.
+func profileSlot(defs []Definition, ps ProfileSensor) (int, error) {
+	if ps.Index != nil {
+		idx := *ps.Index
+		if idx < 1 || idx >= len(defs) {
+			return 0, fmt.Errorf("index %d out of range 1-%d", idx, len(defs)-1)
+		}
+		return idx, nil
+	}
+	for i := range defs {
+		if defs[i].Slug == ps.Slug && (defs[i].Exists || i < FirstCustomSlot) {
+			return i, nil
+		}
+	}
+	if ps.Disabled {
+		return 0, fmt.Errorf("no built-in sensor %s to disable", ps.Slug)
+	}
+	for i := FirstCustomSlot; i < len(defs); i++ {
+		if !defs[i].Exists {
+			return i, nil
+		}
+	}
+	if len(defs) >= MaxChannels {
+		return 0, fmt.Errorf("no free sensor slot: all %d slots are in use (MaxChannels)", MaxChannels)
+	}
+	return len(defs), nil
+}
+
+func validateSlug(slug string) error {
+	switch {
+	case slug == "":
+		return fmt.Errorf("slug is required")
+	case len(slug) > 8:
+		return fmt.Errorf("slug %q is longer than 8 characters", slug)
+	case strings.ContainsAny(slug, " ,\t\"") || strings.HasSuffix(slug, "_raw") || strings.HasSuffix(slug, "_ms"):
+		return fmt.Errorf("slug %q may not contain spaces, commas or quotes, or end in _raw/_ms", slug)
+	}
+	return nil
+}
+
+// ValidateDefinitions checks that a definition table fits in MaxChannels, keeps
+// polled sensors out of the command range, has no duplicate slugs or
+// addresses (either byte of a two-byte sensor) among the sensors that exist, that flag bit channels do not
+// reuse a slug, and that expression channels only reference existing
+// channels and do not depend on themselves.
+func ValidateDefinitions(defs []Definition) error {
+	if len(defs) > MaxChannels {
+		return fmt.Errorf("%d sensor definitions, at most %d supported", len(defs), MaxChannels)
+	}
+	slugs := make(map[string]int)
+	addrs := make(map[byte]int)
+	for i, d := range defs {
+		if !d.Exists {
+			continue
+		}
+		if j, dup := slugs[d.Slug]; dup {
+			return fmt.Errorf("sensors %d and %d share slug %s", j, i, d.Slug)
+		}
+		slugs[d.Slug] = i
+		if d.Computed {
+			continue
+		}
+		if d.Addr >= CommandRangeStart {
+			return fmt.Errorf("sensor %s: address 0x%02X is in the command range", d.Slug, d.Addr)
+		}
+		if j, dup := addrs[d.Addr]; dup {
+			return fmt.Errorf("sensors %s and %s share address 0x%02X", defs[j].Slug, d.Slug, d.Addr)
+		}
+		addrs[d.Addr] = i
+		if !d.IsWord() {
+			continue
+		}
+		if d.Addr2 >= CommandRangeStart {
+			return fmt.Errorf("sensor %s: address 0x%02X is in the command range", d.Slug, d.Addr2)
+		}
+		if j, dup := addrs[d.Addr2]; dup {
+			return fmt.Errorf("sensors %s and %s share address 0x%02X", defs[j].Slug, d.Slug, d.Addr2)
+		}
+		addrs[d.Addr2] = i
+	}
+	// Bit channels share the slug namespace and resolve to their sensor
+	channels := make(map[string]int, len(slugs))
+	for slug, i := range slugs {
+		channels[slug] = i
+	}
+	for _, ch := range FlagChannels(defs) {
+		if _, dup := channels[ch.Name]; dup {
+			return fmt.Errorf("flag bit %s of %s: name already used by another channel", ch.Name, defs[ch.Index].Slug)
+		}
+		channels[ch.Name] = ch.Index
+	}
+	return validateExprs(defs, channels)
+}
+
+// validateExprs checks the references of expression channels. slugs maps
+// each existing channel slug to the index of the sensor providing it.
+func validateExprs(defs []Definition, slugs map[string]int) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(defs))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("expression channel %s depends on itself", defs[i].Slug)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, ref := range defs[i].Inputs() {
+			j, ok := slugs[ref]
+			if !ok {
+				return fmt.Errorf("expression channel %s: unknown channel %s", defs[i].Slug, ref)
+			}
+			if defs[j].IsExpr() {
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+	for i, d := range defs {
+		if d.Exists && d.IsExpr() {
+			if err := visit(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// build returns the conversion for c of raw values from lo to hi. unit is
+// appended to formatted values.
+func (c *Conversion) build(unit string, lo, hi int) (rawFunc, error) {
+	decimals := 1
+	if c.Decimals != nil {
+		if *c.Decimals < 0 || *c.Decimals > 6 {
+			return nil, fmt.Errorf("decimals %d out of range 0-6", *c.Decimals)
+		}
+		decimals = *c.Decimals
+	}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', decimals, 64) + unit
+	}
+
+	switch strings.ToLower(c.Kind) {
+	case KindRaw, "":
+		return fINT, nil
+
+	case KindLinear:
+		scale := 1.0
+		if c.Scale != nil {
+			scale = *c.Scale
+		}
+		offset := c.Offset
+		return func(raw int, units UnitSystem) (float64, string) {
+			if units == UnitRaw {
+				return fINT(raw, units)
+			}
+			v := float64(raw)*scale + offset
+			return v, format(v)
+		}, nil
+
+	case KindTable:
+		if len(c.Points) < 2 {
+			return nil, fmt.Errorf("table needs at least 2 points")
+		}
+		points := make([][2]float64, len(c.Points))
+		copy(points, c.Points)
+		sort.Slice(points, func(i, j int) bool { return points[i][0] < points[j][0] })
+		for i, pt := range points {
+			if pt[0] < float64(lo) || pt[0] > float64(hi) {
+				return nil, fmt.Errorf("table point raw value %g out of range %d-%d", pt[0], lo, hi)
+			}
+			if i > 0 && pt[0] == points[i-1][0] {
+				return nil, fmt.Errorf("table has two points at raw %g", pt[0])
+			}
+		}
+		return func(raw int, units UnitSystem) (float64, string) {
+			if units == UnitRaw {
+				return fINT(raw, units)
+			}
+			v := interpolate(points, float64(raw))
+			return v, format(v)
+		}, nil
+
+	case KindFlags:
+		if len(c.Bits) == 0 {
+			return nil, fmt.Errorf("flags needs at least one bit")
+		}
+		bits := c.flagBits()
+		for _, b := range bits {
+			if b.Bit < 0 || b.Bit > 7 {
+				return nil, fmt.Errorf("flag bit %d out of range 0-7", b.Bit)
+			}
+			if len([]rune(b.Char)) != 1 {
+				return nil, fmt.Errorf("flag bit %d: char must be a single character", b.Bit)
+			}
+			if b.Name != "" {
+				if err := validateSlug(b.Name); err != nil {
+					return nil, fmt.Errorf("flag bit %d: %w", b.Bit, err)
+				}
+			}
+		}
+		return func(raw int, _ UnitSystem) (float64, string) {
+			return float64(raw), formatFlags(bits, byte(raw))
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown conversion kind %q (want raw, linear, table or flags)", c.Kind)
+}
+
+// clone returns a deep copy of c.
+func (c *Conversion) clone() *Conversion {
+	out := *c
+	if c.Scale != nil {
+		scale := *c.Scale
+		out.Scale = &scale
+	}
+	if c.Decimals != nil {
+		decimals := *c.Decimals
+		out.Decimals = &decimals
+	}
+	out.Points = append([][2]float64(nil), c.Points...)
+	out.Bits = append([]FlagBit(nil), c.Bits...)
+	return &out
+}
+
+// flagBits returns a copy of c.Bits with the defaults filled in.
+func (c *Conversion) flagBits() []FlagBit {
+	bits := make([]FlagBit, len(c.Bits))
+	copy(bits, c.Bits)
+	for i := range bits {
+		if bits[i].Char == "" && bits[i].Name != "" {
+			bits[i].Char = bits[i].Name[:1]
+		}
+		if bits[i].Description == "" {
+			bits[i].Description = bits[i].Name
+		}
+	}
+	return bits
+}
+
+// interpolate evaluates a piecewise-linear table sorted by raw value,
+// clamping outside the first and last points.
+func interpolate(points [][2]float64, x float64) float64 {
+	if x <= points[0][0] {
+		return points[0][1]
+	}
+	last := points[len(points)-1]
+	if x >= last[0] {
+		return last[1]
+	}
+	i := sort.Search(len(points), func(i int) bool { return points[i][0] >= x })
+	p0, p1 := points[i-1], points[i]
+	if p1[0] == x {
+		return p1[1]
+	}
+	t := (x - p0[0]) / (p1[0] - p0[0])
+	return p0[1] + t*(p1[1]-p0[1])
+}
@@ -0,0 +1,236 @@
+package sensor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeProfile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefinitions_YAML(t *testing.T) {
+	path := writeProfile(t, "car.yaml", `
+name: test car
+sensors:
+  - slug: BOOST
+    addr: 0x45
+    description: Boost (MDP)
+    unit: psi
+    convert: {kind: linear, scale: 0.5, offset: -10, decimals: 1}
+  - slug: FUEL
+    addr: 0x46
+    convert:
+      kind: table
+      points: [[255, 0], [0, 100], [128, 60]]
+  - slug: SW
+    addr: "0x47"
+    convert:
+      kind: flags
+      bits: [{bit: 0, char: A}, {bit: 7, char: B, activeLow: true}]
+  - slug: KNCK
+    description: Knock retard
+  - slug: EGRT
+    disabled: true
+`)
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		t.Fatalf("LoadDefinitions failed: %v", err)
+	}
+
+	idx, boost := FindBySlug(defs, "BOOST")
+	if boost == nil || idx < FirstCustomSlot || boost.Addr != 0x45 || !boost.Exists {
+		t.Fatalf("BOOST = %d %+v, want a custom slot at 0x45", idx, boost)
+	}
+	if v := boost.Convert(40, UnitMetric); v != 10 {
+		t.Errorf("BOOST(40) = %g, want 10", v)
+	}
+	if s := boost.Format(40, UnitMetric); s != "10.0psi" {
+		t.Errorf("BOOST format = %q, want 10.0psi", s)
+	}
+	if v := boost.Convert(40, UnitRaw); v != 40 {
+		t.Errorf("BOOST raw = %g, want 40", v)
+	}
+
+	_, fuel := FindBySlug(defs, "FUEL")
+	for raw, want := range map[byte]float64{0: 100, 64: 80, 128: 60, 255: 0} {
+		if v := fuel.Convert(raw, UnitMetric); v != want {
+			t.Errorf("FUEL(%d) = %g, want %g", raw, v, want)
+		}
+	}
+
+	_, sw := FindBySlug(defs, "SW")
+	if s := sw.Format(0x01, UnitMetric); s != "AB" {
+		t.Errorf("SW(0x01) = %q, want AB", s)
+	}
+	if s := sw.Format(0x80, UnitMetric); s != "--" {
+		t.Errorf("SW(0x80) = %q, want --", s)
+	}
+
+	// Override keeps the built-in address and conversion
+	_, knck := FindBySlug(defs, "KNCK")
+	if knck.Description != "Knock retard" || knck.Addr != 0x26 || knck.Unit != "count" {
+		t.Errorf("KNCK override = %+v", knck)
+	}
+	if _, egrt := FindBySlug(defs, "EGRT"); egrt == nil || egrt.Exists {
+		t.Error("EGRT should be disabled")
+	}
+}
+
+func TestLoadDefinitions_JSON(t *testing.T) {
+	path := writeProfile(t, "car.json", `{"sensors": [
+		{"slug": "BOOST", "addr": "0x45", "convert": {"kind": "linear", "scale": 2}},
+		{"slug": "ALT", "addr": 70, "index": 30}
+	]}`)
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		t.Fatalf("LoadDefinitions failed: %v", err)
+	}
+	if _, d := FindBySlug(defs, "BOOST"); d == nil || d.Convert(3, UnitMetric) != 6 {
+		t.Errorf("BOOST = %+v", d)
+	}
+	if defs[30].Slug != "ALT" || defs[30].Addr != 70 {
+		t.Errorf("slot 30 = %+v, want ALT at 70", defs[30])
+	}
+}
+
+func TestApplyProfile_TwoByteAndSigned(t *testing.T) {
+	path := writeProfile(t, "wide.yaml", `
+sensors:
+  - slug: AFCNT
+    addr: 0x4A
+    size: 2
+    convert: {kind: linear, scale: 0.1, decimals: 1}
+    unit: g
+  - slug: LE16
+    addr: 0x50
+    addr2: 0x60
+    size: 2
+    endian: little
+    signed: true
+  - slug: KRET
+    addr: 0x4C
+    signed: true
+    convert: {kind: table, points: [[-128, -64], [127, 63.5]]}
+`)
+	defs, err := LoadDefinitions(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	af, afcnt := FindBySlug(defs, "AFCNT")
+	if !afcnt.IsWord() || afcnt.Addr2 != 0x4B || afcnt.LittleEndian || afcnt.Signed {
+		t.Fatalf("AFCNT = %+v, want a big-endian word at 0x4A/0x4B", afcnt)
+	}
+	var s Sample
+	s.SetWord(af, afcnt.Combine(0x12, 0x34))
+	if got := s.Formatted(defs, af, UnitMetric); got != "466.0g" {
+		t.Errorf("AFCNT 0x1234 = %q, want 466.0g", got)
+	}
+	if got := s.Formatted(defs, af, UnitRaw); got != "4660" {
+		t.Errorf("AFCNT raw = %q, want 4660", got)
+	}
+	if l := afcnt.LimitsIn(UnitRaw); l != nil && (l.Min != 0 || l.Max != 65535) {
+		t.Errorf("AFCNT raw limits = %+v", l)
+	}
+
+	le, le16 := FindBySlug(defs, "LE16")
+	if w := le16.Combine(0x18, 0xFC); w != 0xFC18 || le16.RawValue(w) != -1000 {
+		t.Errorf("LE16 bytes 18 FC = %#x (%d), want -1000", w, le16.RawValue(w))
+	}
+	s.SetWord(le, 0xFC18)
+	if got := s.Value(defs, le, UnitMetric); got != -1000 {
+		t.Errorf("LE16 value = %g, want -1000", got)
+	}
+	if i, _ := FindByAddr(defs, 0x60); i != le {
+		t.Errorf("FindByAddr(0x60) = %d, want LE16's second byte", i)
+	}
+
+	_, kret := FindBySlug(defs, "KRET")
+	if got := kret.Format(0xFB, UnitMetric); got != "-2.5" {
+		t.Errorf("KRET(0xFB) = %q, want -2.5", got)
+	}
+	if w, ok := kret.RawWord(-5); !ok || w != 0xFB {
+		t.Errorf("KRET RawWord(-5) = %#x, %v", w, ok)
+	}
+	if _, ok := kret.RawWord(200); ok {
+		t.Error("KRET RawWord(200) should be out of range")
+	}
+
+	addr := func(a byte) *Addr { v := Addr(a); return &v }
+	for _, tt := range []struct {
+		name   string
+		sensor ProfileSensor
+		want   string
+	}{
+		{"size", ProfileSensor{Slug: "X", Addr: addr(0x40), Size: 4}, "not supported"},
+		{"addr2 on a byte", ProfileSensor{Slug: "X", Addr: addr(0x40), Addr2: addr(0x41)}, "two-byte"},
+		{"endian", ProfileSensor{Slug: "X", Addr: addr(0x40), Size: 2, Endian: "middle"}, "unknown endian"},
+		{"addr2 in use", ProfileSensor{Slug: "X", Addr: addr(0x20), Size: 2}, "share address"},
+		{"last address", ProfileSensor{Slug: "X", Addr: addr(0xBF), Size: 2}, "addr2 is required"},
+		{"wide flags", ProfileSensor{Slug: "X", Addr: addr(0x40), Size: 2, Convert: &Conversion{Kind: KindFlags, Bits: []FlagBit{{Bit: 0, Char: "A"}}}}, "one unsigned byte"},
+		{"built-in", ProfileSensor{Slug: "RPM", Size: 2}, "need a convert"},
+		{"table range", ProfileSensor{Slug: "X", Addr: addr(0x40), Signed: true, Convert: &Conversion{Kind: KindTable, Points: [][2]float64{{0, 0}, {200, 1}}}}, "-128-127"},
+	} {
+		_, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{tt.sensor}})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestApplyProfile_Validation(t *testing.T) {
+	addr := func(a byte) *Addr { v := Addr(a); return &v }
+	idx := func(i int) *int { return &i }
+
+	tests := []struct {
+		name   string
+		sensor ProfileSensor
+		want   string
+	}{
+		{"command range", ProfileSensor{Slug: "BAD", Addr: addr(0xC0)}, "command range"},
+		{"no address", ProfileSensor{Slug: "NEW"}, "addr is required"},
+		{"duplicate address", ProfileSensor{Slug: "DUP", Addr: addr(0x21)}, "share address"},
+		{"computed", ProfileSensor{Slug: "INJD", Addr: addr(0x40)}, "computed"},
+		{"index range", ProfileSensor{Slug: "X", Addr: addr(0x40), Index: idx(MaxSensors)}, "out of range"},
+		{"long slug", ProfileSensor{Slug: "TOOLONGSLUG", Addr: addr(0x40)}, "longer than"},
+		{"bad kind", ProfileSensor{Slug: "X", Addr: addr(0x40), Convert: &Conversion{Kind: "cubic"}}, "unknown conversion"},
+		{"short table", ProfileSensor{Slug: "X", Addr: addr(0x40), Convert: &Conversion{Kind: KindTable, Points: [][2]float64{{0, 1}}}}, "at least 2"},
+		{"flag bit", ProfileSensor{Slug: "X", Addr: addr(0x40), Convert: &Conversion{Kind: KindFlags, Bits: []FlagBit{{Bit: 8, Char: "Z"}}}}, "out of range"},
+	}
+	for _, tt := range tests {
+		_, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{tt.sensor}})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// More sensors than free slots grow the table
+	var many []ProfileSensor
+	for i := 0; i <= MaxSensors-FirstCustomSlot; i++ {
+		many = append(many, ProfileSensor{Slug: "C" + string(rune('A'+i)), Addr: addr(byte(0x80 + i))})
+	}
+	defs, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: many})
+	if err != nil {
+		t.Fatalf("profile past MaxSensors: %v", err)
+	}
+	if len(defs) != MaxSensors+1 || defs[MaxSensors].Slug != many[len(many)-1].Slug || defs[MaxSensors].Addr != 0x80+MaxSensors-FirstCustomSlot {
+		t.Errorf("slot %d = %+v, want the last profile sensor", MaxSensors, defs[len(defs)-1])
+	}
+
+	// ... up to MaxChannels
+	many = nil
+	for i := 0; i <= MaxChannels-FirstCustomSlot; i++ {
+		many = append(many, ProfileSensor{Slug: fmt.Sprintf("E%03d", i), Expr: "RPM / 2"})
+	}
+	if _, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: many}); err == nil || !strings.Contains(err.Error(), "MaxChannels") {
+		t.Errorf("overfull profile err = %v, want a MaxChannels error", err)
+	}
+}
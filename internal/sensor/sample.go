@@ -1,52 +1,304 @@
 package sensor
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
-// Sample represents a single snapshot of all polled sensor values.
+// Sample represents a single snapshot of the polled and computed channels.
+// Channels are keyed by definition index and the set is open-ended: a
+// sample holds however many channels were set, not a fixed 32. A channel
+// holds either a raw ECU byte (SetData), the word of a two-byte sensor
+// (SetWord) or a float value (SetValue), as expression channels and
+// external inputs do.
+//
+// Time is when the poll sweep started. A sweep over 1920 baud can take
+// hundreds of milliseconds, so each channel also records when it was
+// actually answered, relative to Time (see Offset). A zero offset means
+// "at Time".
+//
+// Copies of a Sample share channel storage; use Clone for an independent
+// copy. The logger hands every holder its own clone (see logger.Logger), so
+// a sample passed by value can be changed by whoever received it.
 type Sample struct {
-	Time        time.Time        `json:"time"`
-	DataPresent uint32           `json:"dataPresent"` // bitmask of which sensors have data
-	RawData     [MaxSensors]byte `json:"rawData"`     // raw byte values from ECU
+	Time     time.Time `json:"time"`
+	channels []channel // by definition index; grown as channels are set
+}
+
+// channel is one entry of a Sample.
+type channel struct {
+	present bool
+	isFloat bool          // value holds the channel; raw is unused
+	raw     uint16        // raw byte or word from the ECU, see Definition.RawValue
+	value   float64       // value of a float channel
+	offset  time.Duration // answer time relative to Sample.Time
+}
+
+// at returns the channel at idx, growing the sample to hold it.
+func (s *Sample) at(idx int) *channel {
+	if idx >= len(s.channels) {
+		grown := make([]channel, idx+1, max(idx+1, 2*len(s.channels)))
+		copy(grown, s.channels)
+		s.channels = grown
+	}
+	return &s.channels[idx]
+}
+
+// get returns the channel at idx, or a zero channel if idx was never set.
+func (s *Sample) get(idx int) channel {
+	if idx < 0 || idx >= len(s.channels) {
+		return channel{}
+	}
+	return s.channels[idx]
 }
 
 // HasData returns true if the sensor at the given index has data in this sample.
 func (s *Sample) HasData(idx int) bool {
-	return s.DataPresent&(1<<uint(idx)) != 0
+	return s.get(idx).present
 }
 
 // SetData sets the raw value for a sensor index and marks it present.
 func (s *Sample) SetData(idx int, value byte) {
-	s.RawData[idx] = value
-	s.DataPresent |= 1 << uint(idx)
+	s.SetWord(idx, uint16(value))
+}
+
+// SetWord sets the raw word of a two-byte sensor (see Definition.Combine)
+// and marks it present.
+func (s *Sample) SetWord(idx int, w uint16) {
+	c := s.at(idx)
+	c.present, c.isFloat, c.raw, c.value = true, false, w, 0
+}
+
+// SetWordAt sets the raw word for a sensor index along with the time the
+// ECU answered it.
+func (s *Sample) SetWordAt(idx int, w uint16, at time.Time) {
+	s.SetWord(idx, w)
+	s.SetOffset(idx, at.Sub(s.Time))
+}
+
+// SetDataAt sets the raw value for a sensor index along with the time the
+// ECU answered it.
+func (s *Sample) SetDataAt(idx int, value byte, at time.Time) {
+	s.SetData(idx, value)
+	s.SetOffset(idx, at.Sub(s.Time))
+}
+
+// SetValue sets the float value of a computed or external channel and marks
+// it present.
+func (s *Sample) SetValue(idx int, v float64) {
+	c := s.at(idx)
+	c.present, c.isFloat, c.raw, c.value = true, true, 0, v
+}
+
+// Clear marks the channel at idx absent.
+func (s *Sample) Clear(idx int) {
+	if idx >= 0 && idx < len(s.channels) {
+		s.channels[idx] = channel{}
+	}
+}
+
+// Raw returns the raw byte of the channel at idx, the low byte of a word;
+// 0 if it is absent or a float channel.
+func (s *Sample) Raw(idx int) byte {
+	return byte(s.get(idx).raw)
+}
+
+// Word returns the raw byte or word of the channel at idx; 0 if it is
+// absent or a float channel.
+func (s *Sample) Word(idx int) uint16 {
+	return s.get(idx).raw
+}
+
+// RawValue returns the raw value of the channel at idx as its definition
+// reads it: sign-extended, and 16 bits wide for two-byte sensors.
+func (s *Sample) RawValue(defs []Definition, idx int) int {
+	return defs[idx].RawValue(s.Word(idx))
 }
 
-// ConvertedValues returns a map of slug -> formatted string for all present sensors.
+// IsFloat reports whether the channel at idx holds a float value (see
+// SetValue) rather than a raw byte.
+func (s *Sample) IsFloat(idx int) bool {
+	return s.get(idx).isFloat
+}
+
+// Float returns the value of a float channel; 0 if it is absent or a raw
+// channel.
+func (s *Sample) Float(idx int) float64 {
+	return s.get(idx).value
+}
+
+// Offset returns when the channel at idx was read, relative to Time.
+func (s *Sample) Offset(idx int) time.Duration {
+	return s.get(idx).offset
+}
+
+// SetOffset sets when the channel at idx was read, relative to Time.
+func (s *Sample) SetOffset(idx int, d time.Duration) {
+	s.at(idx).offset = d
+}
+
+// ChannelTime returns when the sensor at idx was read.
+func (s *Sample) ChannelTime(idx int) time.Time {
+	return s.Time.Add(s.Offset(idx))
+}
+
+// HasOffsets reports whether any channel carries its own timestamp.
+func (s *Sample) HasOffsets() bool {
+	for _, c := range s.channels {
+		if c.offset != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Indices returns the indices of the channels present, in ascending order.
+func (s *Sample) Indices() []int {
+	var indices []int
+	for i, c := range s.channels {
+		if c.present {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// Clone returns a copy of s that does not share channel storage.
+func (s Sample) Clone() Sample {
+	s.channels = append([]channel(nil), s.channels...)
+	return s
+}
+
+// CopyChannel copies the channel at idx, if present in src, into s. The
+// channel keeps its read time; an empty s takes src's Time.
+func (s *Sample) CopyChannel(src *Sample, idx int) {
+	if !src.HasData(idx) {
+		return
+	}
+	if s.Time.IsZero() {
+		s.Time = src.Time
+	}
+	c := src.get(idx)
+	c.offset = src.ChannelTime(idx).Sub(s.Time)
+	*s.at(idx) = c
+}
+
+// SetSlots sets channels 0-31 from the fixed layout of the original mmcd
+// GraphSample, which PDB and version 1-3 .mmcd logs store: a presence
+// bitmask and one raw byte per slot. Nothing writes that layout any more;
+// it holds no float channels.
+func (s *Sample) SetSlots(present uint32, raw [MaxSensors]byte) {
+	for i := 0; i < MaxSensors; i++ {
+		if present&(1<<uint(i)) != 0 {
+			s.SetData(i, raw[i])
+		}
+	}
+}
+
+// PresentIndices returns every channel index present in any of samples, in
+// ascending order.
+func PresentIndices(samples []Sample) []int {
+	var seen []bool
+	for i := range samples {
+		for idx, c := range samples[i].channels {
+			if c.present {
+				if idx >= len(seen) {
+					seen = append(seen, make([]bool, idx+1-len(seen))...)
+				}
+				seen[idx] = true
+			}
+		}
+	}
+	var indices []int
+	for idx, ok := range seen {
+		if ok {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+// Value returns the converted value of the channel at idx. Float channels
+// (expression channels, external inputs) have no raw form: under UnitRaw
+// they return their value too.
+func (s *Sample) Value(defs []Definition, idx int, units UnitSystem) float64 {
+	if c := s.get(idx); c.isFloat {
+		return defs[idx].ConvertValue(c.value, units)
+	}
+	v, _ := defs[idx].convert(s.RawValue(defs, idx), units)
+	return v
+}
+
+// metricValue returns the channel at idx in its base unit, ignoring display
+// unit overrides.
+func (s *Sample) metricValue(defs []Definition, idx int) float64 {
+	if c := s.get(idx); c.isFloat {
+		return c.value
+	}
+	return defs[idx].metric(s.RawValue(defs, idx))
+}
+
+// Formatted returns the display string of the channel at idx.
+func (s *Sample) Formatted(defs []Definition, idx int, units UnitSystem) string {
+	if c := s.get(idx); c.isFloat {
+		return defs[idx].FormatValue(c.value, units)
+	}
+	_, str := defs[idx].convert(s.RawValue(defs, idx), units)
+	return str
+}
+
+// ConvertedValues returns a map of slug -> formatted string for all present
+// sensors and their flag bit channels ("on" or "off").
 func (s *Sample) ConvertedValues(defs []Definition, units UnitSystem) map[string]string {
 	result := make(map[string]string, len(defs))
 	for i, def := range defs {
 		if !def.Exists || !s.HasData(i) {
 			continue
 		}
-		result[def.Slug] = def.Format(s.RawData[i], units)
+		result[def.Slug] = s.Formatted(defs, i, units)
+	}
+	for _, ch := range FlagChannels(defs) {
+		if active, ok := s.Flag(ch); ok {
+			result[ch.Name] = "off"
+			if active {
+				result[ch.Name] = "on"
+			}
+		}
 	}
 	return result
 }
 
-// ConvertedFloats returns a map of slug -> float64 for all present sensors.
+// ConvertedFloats returns a map of slug -> float64 for all present sensors
+// and their flag bit channels (1 or 0).
 func (s *Sample) ConvertedFloats(defs []Definition, units UnitSystem) map[string]float64 {
 	result := make(map[string]float64, len(defs))
 	for i, def := range defs {
 		if !def.Exists || !s.HasData(i) {
 			continue
 		}
-		result[def.Slug] = def.Convert(s.RawData[i], units)
+		result[def.Slug] = s.Value(defs, i, units)
+	}
+	for _, ch := range FlagChannels(defs) {
+		if s.HasData(ch.Index) {
+			result[ch.Name] = s.FlagValue(ch)
+		}
 	}
 	return result
 }
 
-// ComputeDerivatives calculates derived values like injector duty cycle.
-// Must be called after all raw sensor data is collected for this sample.
+// ComputeDerivatives calculates computed channels: the injector duty cycle
+// and any expression channels. Must be called after all raw sensor data is
+// collected for this sample.
 func (s *Sample) ComputeDerivatives(defs []Definition) {
+	s.computeINJD(defs)
+	s.computeExprs(defs)
+}
+
+// computeINJD derives the injector duty cycle from the pulse width and
+// RPM with the same formula as the HEAD preset (see injectorDuty). INJD
+// stays a raw channel in logs as in the original mmcd: the duty in 100/128 %
+// steps, truncated and capped at 255.
+func (s *Sample) computeINJD(defs []Definition) {
 	rpmIdx := -1
 	injpIdx := -1
 	injdIdx := -1
@@ -62,16 +314,95 @@ func (s *Sample) ComputeDerivatives(defs []Definition) {
 		}
 	}
 
-	if rpmIdx < 0 || injpIdx < 0 || injdIdx < 0 {
+	if rpmIdx < 0 || injpIdx < 0 || injdIdx < 0 || defs[injdIdx].IsExpr() {
 		return
 	}
 
 	if s.HasData(rpmIdx) && s.HasData(injpIdx) {
-		// Injector duty cycle = (IPW_raw * RPM_raw) / 117, capped at 255
-		v := int32(s.RawData[injpIdx]) * int32(s.RawData[rpmIdx]) / 117
-		if v > 255 {
-			v = 255
-		}
+		duty := injectorDuty(s.metricValue(defs, injpIdx), s.metricValue(defs, rpmIdx))
+		v := math.Min(math.Max(math.Floor(duty*128/100), 0), 255)
 		s.SetData(injdIdx, byte(v))
+		// A derived value is only as fresh as its newest input
+		s.SetOffset(injdIdx, max(s.Offset(rpmIdx), s.Offset(injpIdx)))
+	}
+}
+
+// computeExprs evaluates the expression channels. Inputs are read in metric
+// units, ignoring unit overrides, so a formula gives the same result
+// whatever the display units are.
+// Channels built on other expression channels are evaluated after them;
+// a channel whose inputs are missing from this sample is left absent.
+func (s *Sample) computeExprs(defs []Definition) {
+	var pending []int
+	for i := range defs {
+		if defs[i].Exists && defs[i].IsExpr() {
+			pending = append(pending, i)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	slugs := make(map[string]int, len(defs))
+	for i := range defs {
+		if defs[i].Exists {
+			slugs[defs[i].Slug] = i
+		}
+	}
+	flags := make(map[string]FlagChannel)
+	for _, ch := range FlagChannels(defs) {
+		flags[ch.Name] = ch
+	}
+
+	// done holds the expression channels already evaluated (or given up on)
+	done := make(map[int]bool, len(pending))
+	for len(pending) > 0 {
+		progress := false
+		rest := pending[:0]
+		for _, idx := range pending {
+			ready := true
+			for _, ref := range defs[idx].Inputs() {
+				if j, ok := slugs[ref]; ok && defs[j].IsExpr() && !done[j] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				rest = append(rest, idx)
+				continue
+			}
+			s.evalExpr(defs, slugs, flags, idx)
+			done[idx] = true
+			progress = true
+		}
+		pending = rest
+		if !progress {
+			return // dependency cycle; ValidateDefinitions rejects these
+		}
+	}
+}
+
+func (s *Sample) evalExpr(defs []Definition, slugs map[string]int, flags map[string]FlagChannel, idx int) {
+	var newest time.Duration
+	v, ok := defs[idx].expr.Eval(func(slug string) (float64, bool) {
+		j, ok := slugs[slug]
+		ch, isFlag := flags[slug]
+		if isFlag && !ok {
+			j, ok = ch.Index, true
+		}
+		if !ok || !s.HasData(j) {
+			return 0, false
+		}
+		newest = max(newest, s.Offset(j))
+		if isFlag {
+			return s.FlagValue(ch), true
+		}
+		return s.metricValue(defs, j), true
+	})
+	if !ok {
+		s.Clear(idx)
+		return
 	}
+	s.SetValue(idx, v)
+	s.SetOffset(idx, newest)
 }
@@ -0,0 +1,47 @@
+package sensor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSample_ManyChannels(t *testing.T) {
+	var s Sample
+	s.SetData(4, 0x40)
+	s.SetValue(40, 12.5)
+	s.Time = time.Unix(100, 0)
+	s.SetDataAt(70, 0x11, s.Time.Add(3*time.Millisecond))
+
+	if !s.HasData(40) || s.Float(40) != 12.5 || !s.IsFloat(40) {
+		t.Errorf("channel 40 = %g (present %v, float %v)", s.Float(40), s.HasData(40), s.IsFloat(40))
+	}
+	if s.Raw(70) != 0x11 || s.Offset(70) != 3*time.Millisecond || s.IsFloat(70) {
+		t.Errorf("channel 70 = %#x at %v", s.Raw(70), s.Offset(70))
+	}
+	if s.HasData(39) || s.HasData(1000) || s.HasData(-1) {
+		t.Error("unset channels report data")
+	}
+	if got := s.Indices(); len(got) != 3 || got[0] != 4 || got[1] != 40 || got[2] != 70 {
+		t.Errorf("Indices = %v", got)
+	}
+
+	c := s.Clone()
+	c.Clear(40)
+	c.SetData(4, 0x50)
+	if !s.HasData(40) || s.Raw(4) != 0x40 {
+		t.Error("Clone shares channels with the original")
+	}
+	if got := PresentIndices([]Sample{s, c}); len(got) != 3 || got[1] != 40 {
+		t.Errorf("PresentIndices = %v", got)
+	}
+}
+
+func TestSample_SetSlots(t *testing.T) {
+	var raw [MaxSensors]byte
+	raw[0], raw[1], raw[31] = 0x01, 0x02, 0xFF
+	var r Sample
+	r.SetSlots(1|1<<31, raw)
+	if !r.HasData(0) || !r.HasData(31) || r.HasData(1) || r.Raw(31) != 0xFF {
+		t.Errorf("SetSlots = %v", r.Indices())
+	}
+}
@@ -0,0 +1,151 @@
+package sensor
+
+import "fmt"
+
+// Channel describes a logged channel as it was defined when the log was
+// written, so a log can be read back with the same slugs, units and
+// conversions after the sensor table has changed. It is a profile sensor
+// with its Index set, plus the name of the built-in conversion it uses.
+type Channel struct {
+	ProfileSensor
+
+	// Builtin is the slug of the built-in sensor or input channel whose
+	// conversion the channel uses; Convert is then empty.
+	Builtin string `json:"builtin,omitempty"`
+	Input   bool   `json:"input,omitempty"` // float channel set by an external input, see Definition.IsInput
+}
+
+// SchemaOf returns the channels of defs at indices, in order. Indices out of
+// range or of sensors that do not exist are left out.
+func SchemaOf(defs []Definition, indices []int) []Channel {
+	out := make([]Channel, 0, len(indices))
+	for _, idx := range indices {
+		if idx < 0 || idx >= len(defs) || !defs[idx].Exists {
+			continue
+		}
+		d := &defs[idx]
+		i := idx
+		ch := Channel{
+			ProfileSensor: ProfileSensor{
+				Index:       &i,
+				Slug:        d.Slug,
+				Description: d.Description,
+				Unit:        d.Unit,
+			},
+			Input: d.IsInput(),
+		}
+		if d.Limits != nil {
+			ch.Limits = d.Limits.clone()
+		}
+		switch {
+		case d.IsExpr():
+			decimals := d.decimals
+			ch.Expr, ch.Decimals = d.Expr, &decimals
+			out = append(out, ch)
+			continue
+		case d.conv == nil && d.builtin != "":
+			ch.Builtin = d.builtin
+		case d.conv != nil:
+			ch.Convert = d.conv.clone()
+		}
+		if !d.Computed {
+			addr := Addr(d.Addr)
+			ch.Addr, ch.Signed = &addr, d.Signed
+			if d.IsWord() {
+				addr2 := Addr(d.Addr2)
+				ch.Size, ch.Addr2, ch.Endian = 2, &addr2, EndianBig
+				if d.LittleEndian {
+					ch.Endian = EndianLittle
+				}
+			}
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
+// ApplySchema returns a copy of defs with each channel of chans defined as
+// recorded, at its index. Sensors of defs that share a slug or an address
+// with a recorded channel are disabled, so the recorded definition wins.
+func ApplySchema(defs []Definition, chans []Channel) ([]Definition, error) {
+	out := make([]Definition, len(defs))
+	copy(out, defs)
+
+	var sensors []ProfileSensor
+	for n, ch := range chans {
+		if ch.Index == nil || *ch.Index < 1 || *ch.Index >= MaxChannels {
+			return nil, fmt.Errorf("channel %d (%s): index missing or out of range 1-%d", n+1, ch.Slug, MaxChannels-1)
+		}
+		idx := *ch.Index
+		for len(out) <= idx {
+			out = append(out, Definition{Addr: 0x00, convertFunc: fDEC})
+		}
+		for i := range out {
+			if i != idx && out[i].Exists && (out[i].Slug == ch.Slug || overlaps(&out[i], ch)) {
+				out[i].Exists = false
+			}
+		}
+
+		def := Definition{Addr: 0x00, convertFunc: fDEC}
+		if ch.Builtin != "" {
+			b, ok := builtinDefinition(ch.Builtin)
+			if !ok {
+				return nil, fmt.Errorf("channel %d (%s): unknown built-in conversion %s", n+1, ch.Slug, ch.Builtin)
+			}
+			def = b
+		}
+		if def.Computed && !def.IsExpr() {
+			// Inputs and INJD cannot be redefined; only their presentation is recorded
+			def.Slug = ch.Slug
+			if ch.Description != "" {
+				def.Description = ch.Description
+			}
+			if ch.Unit != "" {
+				def.Unit = ch.Unit
+			}
+			if ch.Limits != nil {
+				def.Limits = ch.Limits.clone()
+			}
+			out[idx] = def
+			continue
+		}
+		out[idx] = def
+		ps := ch.ProfileSensor
+		ps.Index = &idx
+		sensors = append(sensors, ps)
+	}
+	return ApplyProfile(out, &Profile{Sensors: sensors})
+}
+
+// overlaps reports whether d is a polled sensor reading an address of the
+// polled channel ch.
+func overlaps(d *Definition, ch Channel) bool {
+	if d.Computed || ch.Addr == nil || ch.Expr != "" {
+		return false
+	}
+	addrs := []byte{byte(*ch.Addr)}
+	if ch.Size == 2 && ch.Addr2 != nil {
+		addrs = append(addrs, byte(*ch.Addr2))
+	} else if ch.Size == 2 {
+		addrs = append(addrs, byte(*ch.Addr)+1)
+	}
+	for _, a := range addrs {
+		if d.Addr == a || (d.IsWord() && d.Addr2 == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinDefinition returns the built-in sensor or input channel with the
+// given slug.
+func builtinDefinition(slug string) (Definition, bool) {
+	builtins := append(DefaultDefinitions(), widebandDefinition())
+	builtins = append(builtins, gpsDefinitions()...)
+	for _, d := range builtins {
+		if d.Exists && d.builtin == slug {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
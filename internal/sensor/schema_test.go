@@ -0,0 +1,83 @@
+package sensor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSchema_RoundTrip(t *testing.T) {
+	addr, warm, scale := Addr(0x4A), 90.0, 0.1
+	recorded, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{
+		{Slug: "AFCNT", Addr: &addr, Size: 2, Unit: "g", Convert: &Conversion{Kind: KindLinear, Scale: &scale}},
+		{Slug: "RPMK", Expr: "RPM / 1000", Decimals: intPtr(2)},
+		{Slug: "COOL", Limits: &Limits{Min: 0, Max: 130, Decimals: 1, WarnHigh: &warm}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, gps, err := AddGPS(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, wbo2, err := AddWideband(recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	af, _ := FindBySlug(recorded, "AFCNT")
+	rpmk, _ := FindBySlug(recorded, "RPMK")
+	indices := []int{4, 17, af, rpmk, gps.Speed, wbo2}
+
+	// The schema survives JSON, as logs store it
+	b, err := json.Marshal(SchemaOf(recorded, indices))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chans []Channel
+	if err := json.Unmarshal(b, &chans); err != nil {
+		t.Fatal(err)
+	}
+	if len(chans) != len(indices) || chans[0].Builtin != "COOL" || chans[2].Convert == nil || !chans[4].Input {
+		t.Fatalf("schema = %s", b)
+	}
+
+	// The current table has another sensor at AFCNT's second byte
+	other := Addr(0x4B)
+	current, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{{Slug: "OTHR", Addr: &other}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := ApplySchema(current, chans)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, d := FindBySlug(restored, "OTHR"); d != nil && d.Exists {
+		t.Error("OTHR overlaps AFCNT and should be disabled")
+	}
+
+	var s Sample
+	s.SetData(4, 150)
+	s.SetData(17, 100)
+	s.SetWord(af, 0x1234)
+	s.SetValue(gps.Speed, 88.5)
+	s.SetValue(wbo2, 0.9*StoichAFR)
+	s.ComputeDerivatives(recorded)
+	for _, idx := range indices {
+		for _, units := range []UnitSystem{UnitMetric, UnitEnglish, UnitRaw} {
+			want := s.Formatted(recorded, idx, units)
+			if got := s.Formatted(restored, idx, units); got != want {
+				t.Errorf("%s in %v = %q, want %q as recorded", recorded[idx].Slug, units, got, want)
+			}
+		}
+	}
+	if l := restored[4].Limits; l == nil || l.Max != 130 {
+		t.Errorf("COOL limits = %+v, want the recorded ones", l)
+	}
+	if !restored[gps.Speed].IsInput() || restored[rpmk].Expr != "RPM / 1000" {
+		t.Errorf("GSPD input %v, RPMK expr %q", restored[gps.Speed].IsInput(), restored[rpmk].Expr)
+	}
+
+	bad := []Channel{{Builtin: "NOPE", ProfileSensor: ProfileSensor{Index: intPtr(30), Slug: "NOPE"}}}
+	if _, err := ApplySchema(current, bad); err == nil {
+		t.Error("ApplySchema with an unknown built-in should fail")
+	}
+}
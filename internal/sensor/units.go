@@ -0,0 +1,288 @@
+package sensor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Quantity is what a sensor measures, which decides the units it can be
+// shown in.
+type Quantity int
+
+const (
+	QuantityNone Quantity = iota
+	QuantityTemperature
+	QuantityPressure
+	QuantityAirflow
+	QuantityMixture
+	QuantitySpeed
+)
+
+// String returns the quantity name used in error messages.
+func (q Quantity) String() string {
+	switch q {
+	case QuantityTemperature:
+		return "temperature"
+	case QuantityPressure:
+		return "pressure"
+	case QuantityAirflow:
+		return "airflow"
+	case QuantityMixture:
+		return "mixture"
+	case QuantitySpeed:
+		return "speed"
+	}
+	return "none"
+}
+
+// DisplayUnit is a unit a sensor value can be shown in. Each quantity has a
+// base unit (°C, bar, g/s, AFR, km/h) that values are converted through.
+type DisplayUnit struct {
+	Code     byte   // stored in .mmcd unit tables; never 0
+	Name     string // label appended to formatted values, e.g. "kPa"
+	Quantity Quantity
+	Decimals int      // decimals of formatted values
+	aliases  []string // other spellings accepted by LookupUnit
+	scale    float64  // value in base unit = value*scale + offset
+	offset   float64
+}
+
+// ToBase converts a value in u to the base unit of its quantity.
+func (u *DisplayUnit) ToBase(v float64) float64 {
+	return v*u.scale + u.offset
+}
+
+// FromBase converts a value in the base unit of u's quantity to u.
+func (u *DisplayUnit) FromBase(v float64) float64 {
+	return (v - u.offset) / u.scale
+}
+
+// Format formats a value already in u.
+func (u *DisplayUnit) Format(v float64) string {
+	return strconv.FormatFloat(v, 'f', u.Decimals, 64) + u.Name
+}
+
+// displayUnits are the selectable units. Codes are stored in log files and
+// must not be reused; code 8 was Hz, dropped since the MAF frequency only
+// becomes airflow through the fueling-aware AIRF channel.
+var displayUnits = []*DisplayUnit{
+	{Code: 1, Name: "°C", Quantity: QuantityTemperature, Decimals: 1, aliases: []string{"c", "degc", "celsius"}, scale: 1},
+	{Code: 2, Name: "°F", Quantity: QuantityTemperature, Decimals: 1, aliases: []string{"f", "degf", "fahrenheit"}, scale: 5.0 / 9.0, offset: -32 * 5.0 / 9.0},
+	{Code: 3, Name: "K", Quantity: QuantityTemperature, Decimals: 1, aliases: []string{"kelvin"}, scale: 1, offset: -273.15},
+	{Code: 4, Name: "bar", Quantity: QuantityPressure, Decimals: 3, scale: 1},
+	{Code: 5, Name: "kPa", Quantity: QuantityPressure, Decimals: 1, scale: 0.01},
+	{Code: 6, Name: "psi", Quantity: QuantityPressure, Decimals: 2, scale: 1 / 14.50326},
+	{Code: 7, Name: "inHg", Quantity: QuantityPressure, Decimals: 2, scale: 0.0338639},
+	{Code: 9, Name: "g/s", Quantity: QuantityAirflow, Decimals: 1, scale: 1},
+	{Code: 10, Name: "lb/min", Quantity: QuantityAirflow, Decimals: 2, scale: 453.59237 / 60},
+	{Code: 11, Name: "AFR", Quantity: QuantityMixture, Decimals: 2, scale: 1},
+	{Code: 12, Name: "λ", Quantity: QuantityMixture, Decimals: 3, aliases: []string{"lambda"}, scale: StoichAFR},
+	{Code: 13, Name: "km/h", Quantity: QuantitySpeed, Decimals: 1, aliases: []string{"kph", "kmh"}, scale: 1},
+	{Code: 14, Name: "mph", Quantity: QuantitySpeed, Decimals: 1, scale: 1.609344},
+}
+
+// LookupUnit finds a display unit by name or alias, ignoring case and a
+// leading degree sign.
+func LookupUnit(name string) (*DisplayUnit, bool) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	n = strings.TrimPrefix(n, "°")
+	for _, u := range displayUnits {
+		if strings.ToLower(strings.TrimPrefix(u.Name, "°")) == n {
+			return u, true
+		}
+		for _, a := range u.aliases {
+			if a == n {
+				return u, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// UnitByCode returns the display unit with the given .mmcd code.
+func UnitByCode(code byte) (*DisplayUnit, bool) {
+	for _, u := range displayUnits {
+		if u.Code == code {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// UnitsOf lists the unit names available for a quantity.
+func UnitsOf(q Quantity) []string {
+	var names []string
+	for _, u := range displayUnits {
+		if u.Quantity == q {
+			names = append(names, u.Name)
+		}
+	}
+	return names
+}
+
+// ParseUnits parses a --units value: an optional unit system followed by
+// per-sensor overrides, e.g. "imperial,BARO=kPa,MAFS=g/s". Overrides map
+// slug to unit name and are applied with ApplyUnits.
+func ParseUnits(s string) (UnitSystem, map[string]string, error) {
+	system := UnitMetric
+	var overrides map[string]string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		slug, unit, ok := strings.Cut(part, "=")
+		if !ok {
+			switch strings.ToLower(part) {
+			case "metric", "imperial", "english", "raw", "numeric":
+				system = ParseUnitSystem(strings.ToLower(part))
+			default:
+				return system, nil, fmt.Errorf("unknown unit system %q (want metric, imperial or raw)", part)
+			}
+			continue
+		}
+		slug, unit = strings.TrimSpace(slug), strings.TrimSpace(unit)
+		if slug == "" || unit == "" {
+			return system, nil, fmt.Errorf("invalid unit override %q (want SLUG=unit)", part)
+		}
+		if overrides == nil {
+			overrides = make(map[string]string)
+		}
+		overrides[slug] = unit
+	}
+	return system, overrides, nil
+}
+
+// ApplyUnits returns a copy of defs with the display unit of each slug in
+// overrides set. A sensor can only be shown in units of its quantity.
+func ApplyUnits(defs []Definition, overrides map[string]string) ([]Definition, error) {
+	out := make([]Definition, len(defs))
+	copy(out, defs)
+
+	slugs := make([]string, 0, len(overrides))
+	for slug := range overrides {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	for _, slug := range slugs {
+		_, d := FindBySlug(out, slug)
+		if d == nil || !d.Exists {
+			return nil, fmt.Errorf("unknown sensor %s", slug)
+		}
+		if err := d.SetDisplayUnit(overrides[slug]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Quantity returns what the sensor measures, from its base unit.
+func (d *Definition) Quantity() Quantity {
+	if d.base == nil {
+		return QuantityNone
+	}
+	return d.base.Quantity
+}
+
+// UnitChoices lists the units the sensor can be shown in; nil if it has no
+// quantity.
+func (d *Definition) UnitChoices() []string {
+	if d.base == nil {
+		return nil
+	}
+	return UnitsOf(d.base.Quantity)
+}
+
+// SetDisplayUnit selects the unit d is shown in, overriding the unit
+// system. An empty name clears the override.
+func (d *Definition) SetDisplayUnit(name string) error {
+	if name == "" {
+		d.display = nil
+		return nil
+	}
+	u, ok := LookupUnit(name)
+	if !ok {
+		return fmt.Errorf("%s: unknown unit %q", d.Slug, name)
+	}
+	if d.base == nil || u.Quantity != d.base.Quantity {
+		if choices := d.UnitChoices(); len(choices) > 0 {
+			return fmt.Errorf("%s: cannot show in %s (have %s)", d.Slug, u.Name, strings.Join(choices, ", "))
+		}
+		return fmt.Errorf("%s has no selectable units", d.Slug)
+	}
+	d.display = u
+	return nil
+}
+
+// DisplayUnit returns the unit override of d, or "" if it follows the unit
+// system.
+func (d *Definition) DisplayUnit() string {
+	if d.display == nil {
+		return ""
+	}
+	return d.display.Name
+}
+
+// targetUnit returns the unit d is converted to under units, or nil when
+// the conversion function's own output is shown. The imperial system shows
+// temperatures in °F, pressures in psi and speeds in mph unless overridden.
+func (d *Definition) targetUnit(units UnitSystem) *DisplayUnit {
+	if d.base == nil || (units == UnitRaw && d.isRaw()) {
+		return nil
+	}
+	if d.display != nil {
+		return d.display
+	}
+	// Expression channels are unit-independent unless overridden
+	if units == UnitEnglish && !d.IsExpr() {
+		switch d.base.Quantity {
+		case QuantityTemperature:
+			return builtinUnit("F")
+		case QuantityPressure:
+			return builtinUnit("psi")
+		case QuantitySpeed:
+			return builtinUnit("mph")
+		}
+	}
+	return nil
+}
+
+// UnitLabel returns the unit values of d are shown in under units: "raw"
+// for raw bytes, else the display unit or d.Unit.
+func (d *Definition) UnitLabel(units UnitSystem) string {
+	if units == UnitRaw && d.isRaw() {
+		return "raw"
+	}
+	if u := d.targetUnit(units); u != nil {
+		return u.Name
+	}
+	if d.base != nil {
+		return d.base.Name
+	}
+	return d.Unit
+}
+
+// UnitCode returns the .mmcd code of the unit d is shown in under units, or
+// 0 if d has no quantity.
+func (d *Definition) UnitCode(units UnitSystem) byte {
+	if units == UnitRaw && d.isRaw() {
+		return 0
+	}
+	if u := d.targetUnit(units); u != nil {
+		return u.Code
+	}
+	if d.base != nil {
+		return d.base.Code
+	}
+	return 0
+}
+
+// builtinUnit returns a display unit by name, or nil for an unknown one;
+// user sensors and expression channels in a known unit get it as their base
+// so they can be converted too.
+func builtinUnit(name string) *DisplayUnit {
+	u, _ := LookupUnit(name)
+	return u
+}
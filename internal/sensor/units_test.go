@@ -0,0 +1,119 @@
+package sensor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	system, overrides, err := ParseUnits("imperial, BARO=kPa,COOL=K")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if system != UnitEnglish || overrides["BARO"] != "kPa" || overrides["COOL"] != "K" {
+		t.Errorf("ParseUnits = %v, %v", system, overrides)
+	}
+	if system, overrides, err := ParseUnits(""); err != nil || system != UnitMetric || overrides != nil {
+		t.Errorf("ParseUnits(\"\") = %v, %v, %v", system, overrides, err)
+	}
+	for _, s := range []string{"furlongs", "BARO=", "=kPa"} {
+		if _, _, err := ParseUnits(s); err == nil {
+			t.Errorf("ParseUnits(%q) should fail", s)
+		}
+	}
+}
+
+func TestApplyUnits(t *testing.T) {
+	defs, err := ApplyUnits(DefaultDefinitions(), map[string]string{
+		"BARO": "kPa",
+		"COOL": "degF",
+		"AIRT": "K",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		idx   int
+		raw   byte
+		units UnitSystem
+		want  string
+	}{
+		{12, 208, UnitMetric, "101.1kPa"},
+		{12, 208, UnitEnglish, "101.1kPa"}, // the override wins over the system
+		{12, 208, UnitRaw, "208"},
+		{4, 0x80, UnitMetric, "69.8°F"},
+		{21, 0x80, UnitMetric, "296.1K"},
+	}
+	for _, tt := range tests {
+		if got := defs[tt.idx].Format(tt.raw, tt.units); got != tt.want {
+			t.Errorf("%s Format(%d, %v) = %q, want %q", defs[tt.idx].Slug, tt.raw, tt.units, got, tt.want)
+		}
+	}
+	if got := defs[12].UnitLabel(UnitEnglish); got != "kPa" {
+		t.Errorf("BARO label = %q, want kPa", got)
+	}
+
+	// Without an override the system decides, as before
+	base := DefaultDefinitions()
+	if got := base[12].Format(208, UnitEnglish); got != "14.66psi" {
+		t.Errorf("BARO imperial = %q, want 14.66psi", got)
+	}
+	if base[4].UnitLabel(UnitEnglish) != "°F" || base[17].UnitLabel(UnitEnglish) != "rpm" || base[17].UnitLabel(UnitRaw) != "raw" {
+		t.Errorf("labels: COOL %q RPM %q", base[4].UnitLabel(UnitEnglish), base[17].UnitLabel(UnitEnglish))
+	}
+
+	errs := []struct {
+		overrides map[string]string
+		want      string
+	}{
+		{map[string]string{"RPM": "kPa"}, "no selectable units"},
+		{map[string]string{"MAFS": "g/s"}, "no selectable units"}, // airflow is AIRF's, with the fueling corrections
+		{map[string]string{"BARO": "K"}, "have bar, kPa, psi, inHg"},
+		{map[string]string{"BARO": "furlongs"}, "unknown unit"},
+		{map[string]string{"BOOST": "psi"}, "unknown sensor BOOST"},
+	}
+	for _, tt := range errs {
+		if _, err := ApplyUnits(DefaultDefinitions(), tt.overrides); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ApplyUnits(%v) err = %v, want %q", tt.overrides, err, tt.want)
+		}
+	}
+}
+
+func TestUnits_ExprChannels(t *testing.T) {
+	defs, err := AddDerived(DefaultDefinitions(), []string{"AIRF", "LOAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Display overrides do not change what formulas read
+	defs, err = ApplyUnits(defs, map[string]string{"AIRF": "lb/min", "BARO": "psi", "AIRT": "F"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	airf, _ := FindBySlug(defs, "AIRF")
+	load, _ := FindBySlug(defs, "LOAD")
+
+	var s Sample
+	s.SetData(15, 80)
+	s.SetData(12, 208)
+	s.SetData(21, 75)
+	s.SetData(17, 96)
+	s.ComputeDerivatives(defs)
+
+	stock, _ := AddDerived(DefaultDefinitions(), []string{"AIRF", "LOAD"})
+	var want Sample
+	want.SetData(15, 80)
+	want.SetData(12, 208)
+	want.SetData(21, 75)
+	want.SetData(17, 96)
+	want.ComputeDerivatives(stock)
+	if s.Float(airf) != want.Float(airf) || s.Float(load) != want.Float(load) {
+		t.Errorf("AIRF/LOAD = %g/%g with overrides, want %g/%g", s.Float(airf), s.Float(load), want.Float(airf), want.Float(load))
+	}
+	if got, want := s.Value(defs, airf, UnitMetric), want.Float(airf)*60/453.59237; !approxEqual(got, want, 1e-9) {
+		t.Errorf("AIRF shown = %g lb/min, want %g", got, want)
+	}
+	if got := s.Formatted(defs, airf, UnitRaw); !strings.HasSuffix(got, "lb/min") {
+		t.Errorf("AIRF formatted = %q, want lb/min", got)
+	}
+}
@@ -0,0 +1,65 @@
+package sensor
+
+import "fmt"
+
+// WidebandSlug is the channel wideband O2 controller readings are logged in.
+const WidebandSlug = "WBO2"
+
+// StoichAFR is the stoichiometric air/fuel ratio of gasoline, used to show
+// lambda as AFR.
+const StoichAFR = 14.7
+
+// widebandDefinition is the WBO2 channel. It is not polled from the ECU: a
+// wideband input sets it in each sample as a float value in gasoline AFR
+// (see package wideband), so readings keep the controller's resolution and
+// range. It is shown in AFR by default; its unit can be switched to lambda
+// like any display unit.
+func widebandDefinition() Definition {
+	return Definition{
+		Addr:        0xFF,
+		Slug:        WidebandSlug,
+		Description: "Wideband O2",
+		Unit:        "AFR",
+		Exists:      true,
+		Computed:    true,
+		convertFunc: fDEC,
+		decimals:    2,
+		input:       true,
+		builtin:     WidebandSlug,
+		base:        builtinUnit("AFR"),
+		Limits:      limits(10, 20, 2),
+	}
+}
+
+// AddWideband returns a copy of defs with the WBO2 channel in the first free
+// custom slot, and its index. A WBO2 channel already in defs is kept.
+func AddWideband(defs []Definition) ([]Definition, int, error) {
+	return addInput(defs, widebandDefinition(), "a wideband")
+}
+
+// addInput returns a copy of defs with def, a channel set by an external
+// input, in the first free custom slot, and its index. A channel of the same
+// slug added before is kept; a sensor of that slug is an error, as the input
+// would overwrite it. what names the input in that error.
+func addInput(defs []Definition, def Definition, what string) ([]Definition, int, error) {
+	out := make([]Definition, len(defs))
+	copy(out, defs)
+	if idx, d := FindBySlug(out, def.Slug); d != nil && d.Exists {
+		if !d.Computed || d.IsExpr() {
+			return nil, -1, fmt.Errorf("%s is already a sensor in this table; rename it to use %s input", def.Slug, what)
+		}
+		return out, idx, nil
+	}
+	idx, err := profileSlot(out, ProfileSensor{Slug: def.Slug})
+	if err != nil {
+		return nil, -1, err
+	}
+	if idx == len(out) {
+		out = append(out, Definition{})
+	}
+	out[idx] = def
+	if err := ValidateDefinitions(out); err != nil {
+		return nil, -1, err
+	}
+	return out, idx, nil
+}
@@ -0,0 +1,51 @@
+package sensor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddWideband(t *testing.T) {
+	defs, idx, err := AddWideband(DefaultDefinitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := defs[idx]
+	if idx < FirstCustomSlot || d.Slug != WidebandSlug || !d.IsInput() || d.IsExpr() {
+		t.Fatalf("WBO2 at %d = %+v", idx, d)
+	}
+	if got := AllPollableIndices(defs); containsInt(got, idx) {
+		t.Error("WBO2 is polled from the ECU")
+	}
+
+	// Readings are stored as they come, past the old byte's 0.5-1.775 range
+	var s Sample
+	s.SetValue(idx, 2.1*StoichAFR)
+	for _, units := range []UnitSystem{UnitMetric, UnitEnglish, UnitRaw} {
+		if got := s.Formatted(defs, idx, units); got != "30.87AFR" {
+			t.Errorf("Formatted(lambda 2.1, %v) = %q, want 30.87AFR", units, got)
+		}
+	}
+
+	lambda, err := ApplyUnits(defs, map[string]string{WidebandSlug: "lambda"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetValue(idx, 0.853*StoichAFR)
+	if got := s.Formatted(lambda, idx, UnitMetric); got != "0.853λ" {
+		t.Errorf("WBO2 in lambda = %q", got)
+	}
+
+	// Adding it again keeps the channel; a sensor of that name is an error
+	if again, idx2, err := AddWideband(defs); err != nil || idx2 != idx || len(again) != len(defs) {
+		t.Errorf("AddWideband twice = %d, %v", idx2, err)
+	}
+	addr := Addr(0x47)
+	taken, err := ApplyProfile(DefaultDefinitions(), &Profile{Sensors: []ProfileSensor{{Slug: WidebandSlug, Addr: &addr}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := AddWideband(taken); err == nil || !strings.Contains(err.Error(), "already a sensor") {
+		t.Errorf("AddWideband over a polled WBO2: err = %v", err)
+	}
+}
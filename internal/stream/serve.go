@@ -0,0 +1,44 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+)
+
+// ServeFunc writes a simulated device's stream to w until a write fails.
+type ServeFunc func(w io.Writer) error
+
+// ServePTY streams on the master side of a pseudo-terminal until the PTY
+// is closed.
+func ServePTY(pty *protocol.PTY, serve ServeFunc) error {
+	err := serve(pty.Master())
+	if errors.Is(err, os.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// ServeListener streams to each connection on ln in turn. It returns when
+// the listener is closed. name is the input in log messages.
+func ServeListener(ln net.Listener, name string, serve ServeFunc) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		slog.Info(fmt.Sprintf("%s simulator client connected", name), "remote", conn.RemoteAddr())
+		if err := serve(conn); err != nil {
+			slog.Debug(fmt.Sprintf("%s simulator connection ended", name), "error", err)
+		}
+		conn.Close()
+	}
+}
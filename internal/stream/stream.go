@@ -0,0 +1,203 @@
+// Package stream reads the byte stream of an external input on its own
+// serial port (a wideband O2 controller, a GPS receiver) in the background,
+// and keeps its recent decoded items so each ECU sample can take the one
+// closest to when it was polled. Packages wideband and gps build on it.
+package stream
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// Timed is a decoded item that knows when it was received.
+type Timed interface {
+	Received() time.Time
+}
+
+// Decoder turns the bytes of a stream into items. Decode is given the time
+// the bytes arrived and keeps any partial message for the next call.
+type Decoder[T Timed] interface {
+	Decode(p []byte, at time.Time) []T
+}
+
+// Options describe an input to a Source.
+type Options struct {
+	Name    string        // input name in log messages, e.g. "wideband"
+	History time.Duration // how long items are kept for At
+	MaxSkew time.Duration // how far an item may be from the time asked for in At
+	BufSize int           // bytes read at a time
+}
+
+// Source reads a stream in the background and keeps its recent items.
+type Source[T Timed] struct {
+	conn protocol.Transport
+	dec  Decoder[T]
+	opts Options
+
+	mu    sync.Mutex
+	items []T // oldest first, at most opts.History old
+	count uint64
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Dial opens port, a serial device or a network bridge address as accepted
+// by protocol.NewTransport, at baud. nominal is the speed the device is
+// specified for, which a serial port reports timing against.
+func Dial(port string, baud, nominal int) (protocol.Transport, error) {
+	conn, err := protocol.NewTransport(port, baud)
+	if err != nil {
+		return nil, err
+	}
+	if sc, ok := conn.(*protocol.SerialConn); ok {
+		sc.SetNominalBaud(nominal)
+	}
+	if err := conn.Open(); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// NewSource starts reading from an open transport, decoding with dec.
+// Close closes the transport.
+func NewSource[T Timed](conn protocol.Transport, dec Decoder[T], opts Options) *Source[T] {
+	if opts.BufSize <= 0 {
+		opts.BufSize = 256
+	}
+	s := &Source[T]{
+		conn: conn,
+		dec:  dec,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+// Close stops reading and closes the transport.
+func (s *Source[T]) Close() error {
+	select {
+	case <-s.stop:
+		return nil
+	default:
+	}
+	close(s.stop)
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+func (s *Source[T]) readLoop() {
+	defer close(s.done)
+	buf := make([]byte, s.opts.BufSize)
+	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		n, err := s.conn.Receive(buf)
+		if err != nil {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			slog.Debug(fmt.Sprintf("%s read error", s.opts.Name), "error", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if n > 0 {
+			s.add(s.dec.Decode(buf[:n], time.Now()))
+		}
+	}
+}
+
+// add records new items and drops those older than the history.
+func (s *Source[T]) add(items []T) {
+	if len(items) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, items...)
+	s.count += uint64(len(items))
+	cutoff := items[len(items)-1].Received().Add(-s.opts.History)
+	i := 0
+	for i < len(s.items) && s.items[i].Received().Before(cutoff) {
+		i++
+	}
+	s.items = append(s.items[:0], s.items[i:]...)
+}
+
+// Latest returns the newest item.
+func (s *Source[T]) Latest() (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return s.items[len(s.items)-1], true
+}
+
+// At returns the item closest to t, if one is within the maximum skew.
+func (s *Source[T]) At(t time.Time) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Nearest(s.items, t, s.opts.MaxSkew)
+}
+
+// Count returns the number of items received.
+func (s *Source[T]) Count() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Nearest returns the item in items (oldest first) closest to t, if one is
+// within maxSkew. Of items equally close the newest wins: items received
+// together, like the sentences of one GPS update, get more complete.
+func Nearest[T Timed](items []T, t time.Time, maxSkew time.Duration) (T, bool) {
+	var best T
+	bestSkew := maxSkew + 1
+	for _, it := range items {
+		skew := it.Received().Sub(t)
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew <= bestSkew {
+			best, bestSkew = it, skew
+		}
+	}
+	return best, bestSkew <= maxSkew
+}
+
+// List is a fixed list of items (oldest first) standing in for a Source,
+// as tests do.
+type List[T Timed] struct {
+	Items   []T
+	MaxSkew time.Duration
+}
+
+// At returns the item closest to t, if one is within MaxSkew.
+func (l List[T]) At(t time.Time) (T, bool) {
+	return Nearest(l.Items, t, l.MaxSkew)
+}
+
+// SweepMiddle returns the middle of the poll sweep s was read in, the time
+// an input item is merged into it for: the sweep starts at s.Time and ends
+// with the last channel answered.
+func SweepMiddle(s *sensor.Sample) time.Time {
+	var sweep time.Duration
+	for _, i := range s.Indices() {
+		sweep = max(sweep, s.Offset(i))
+	}
+	return s.Time.Add(sweep / 2)
+}
@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+type item struct {
+	at time.Time
+	n  int
+}
+
+func (i item) Received() time.Time { return i.at }
+
+func TestNearest(t *testing.T) {
+	start := time.Now()
+	items := []item{
+		{start, 1},
+		{start.Add(100 * time.Millisecond), 2},
+		{start.Add(100 * time.Millisecond), 3},
+		{start.Add(300 * time.Millisecond), 4},
+	}
+	tests := []struct {
+		at   time.Duration
+		want int // 0 for none
+	}{
+		{-50 * time.Millisecond, 1},
+		{90 * time.Millisecond, 3}, // the newest of equally close items
+		{250 * time.Millisecond, 4},
+		{900 * time.Millisecond, 0},
+	}
+	for _, tt := range tests {
+		got, ok := Nearest(items, start.Add(tt.at), 500*time.Millisecond)
+		if !ok {
+			got.n = 0
+		}
+		if got.n != tt.want {
+			t.Errorf("Nearest(%v) = item %d, want %d", tt.at, got.n, tt.want)
+		}
+	}
+}
+
+func TestSource_History(t *testing.T) {
+	s := &Source[item]{opts: Options{History: time.Second, MaxSkew: 100 * time.Millisecond}}
+	start := time.Now()
+	s.add([]item{{start, 1}, {start.Add(500 * time.Millisecond), 2}})
+	s.add([]item{{start.Add(1200 * time.Millisecond), 3}})
+	if s.Count() != 3 || len(s.items) != 2 {
+		t.Errorf("count %d with %d kept, want 3 with 2", s.Count(), len(s.items))
+	}
+	if latest, _ := s.Latest(); latest.n != 3 {
+		t.Errorf("Latest = item %d, want 3", latest.n)
+	}
+	if _, ok := s.At(start); ok {
+		t.Error("At found an item dropped from the history")
+	}
+}
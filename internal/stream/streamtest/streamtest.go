@@ -0,0 +1,120 @@
+// Package streamtest has the test scaffolding shared by the inputs built on
+// package stream: definition fixtures, a loopback listener for their
+// simulators, and a check of their Merge functions.
+package streamtest
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/stream"
+)
+
+// Defs returns the default definitions with an input's channels added by
+// add, such as sensor.AddWideband or sensor.AddGPS.
+func Defs[C any](t testing.TB, add func([]sensor.Definition) ([]sensor.Definition, C, error)) ([]sensor.Definition, C) {
+	t.Helper()
+	defs, ch, err := add(sensor.DefaultDefinitions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return defs, ch
+}
+
+// Listen returns a loopback listener, closed when the test ends, and its
+// address as a tcp:// port for Open.
+func Listen(t testing.TB) (net.Listener, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return ln, "tcp://" + ln.Addr().String()
+}
+
+// WaitCount waits up to 2s for src to have received n items.
+func WaitCount(src interface{ Count() uint64 }, n uint64) {
+	deadline := time.Now().Add(2 * time.Second)
+	for src.Count() < n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Sweep is the poll sweep Merge is checked against: RPM read 10ms and TPS
+// 180ms after it starts, so its middle is 90ms in.
+const Sweep = 180 * time.Millisecond
+
+// MergeTest checks an input's Merge function.
+type MergeTest[T stream.Timed] struct {
+	// Merge merges the item of src closest to the middle of the sweep
+	// into s, as the input's Merge does.
+	Merge func(s *sensor.Sample, src stream.List[T]) bool
+
+	// Items are given the sweep start. The first must be received before
+	// it, and Items()[Want] must be the one closest to the middle.
+	Items   func(start time.Time) []T
+	Want    int
+	MaxSkew time.Duration
+
+	// Check checks the channels merged from want.
+	Check func(t *testing.T, s *sensor.Sample, want T)
+}
+
+// Run checks that Merge takes the item nearest the middle of the sweep at
+// its own time, stamps an item received before the sweep at its start, and
+// leaves the sample alone once the stream has stopped.
+func (m MergeTest[T]) Run(t *testing.T) {
+	t.Helper()
+	start := time.Now()
+	items := m.Items(start)
+	src := stream.List[T]{Items: items, MaxSkew: m.MaxSkew}
+
+	var s sensor.Sample
+	s.Time = start
+	s.SetDataAt(17, 40, start.Add(10*time.Millisecond))
+	s.SetDataAt(14, 50, start.Add(Sweep))
+	if !m.Merge(&s, src) {
+		t.Fatal("Merge found no item")
+	}
+	m.Check(t, &s, items[m.Want])
+	want := items[m.Want].Received().Sub(start)
+	for _, idx := range merged(&s) {
+		if s.Offset(idx) != want {
+			t.Errorf("channel %d offset = %v, want the item's time %v", idx, s.Offset(idx), want)
+		}
+	}
+
+	// Items just before the sweep are stamped at its start
+	var early sensor.Sample
+	early.Time = start
+	early.SetDataAt(17, 40, start)
+	if !m.Merge(&early, stream.List[T]{Items: items[:1], MaxSkew: m.MaxSkew}) {
+		t.Fatal("Merge found no item before the sweep")
+	}
+	for _, idx := range merged(&early) {
+		if early.Offset(idx) != 0 {
+			t.Errorf("early item: channel %d offset = %v, want 0", idx, early.Offset(idx))
+		}
+	}
+
+	// A stopped stream leaves the channels absent
+	var stale sensor.Sample
+	stale.Time = start.Add(m.MaxSkew + 10*time.Second)
+	if m.Merge(&stale, src) || len(stale.Indices()) != 0 {
+		t.Error("merged an item older than MaxSkew")
+	}
+}
+
+// merged returns the channels of s other than those of the sweep.
+func merged(s *sensor.Sample) []int {
+	var out []int
+	for _, idx := range s.Indices() {
+		if idx != 17 && idx != 14 {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
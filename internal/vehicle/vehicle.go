@@ -0,0 +1,213 @@
+// Package vehicle describes the ECU platforms mmcd can talk to. A vehicle
+// bundles the sensor table, the meaning of the DTC bits and the actuator
+// commands that are legal on that platform.
+package vehicle
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// DefaultID is the vehicle used when none is selected.
+const DefaultID = "1g-dsm"
+
+// Vehicle is one ECU platform.
+type Vehicle struct {
+	ID         string     `json:"id"`   // --vehicle value, e.g. "3000gt"
+	Code       byte       `json:"code"` // stored in .mmcd headers; 0 means not recorded
+	Name       string     `json:"name"`
+	Engine     string     `json:"engine"`
+	Cylinders  int        `json:"cylinders"`
+	InjectorCC float64    `json:"injectorCC"` // stock injector size, cc/min
+	Actuators  []Actuator `json:"actuators"`
+
+	DTCs [16]protocol.DTCCode `json:"dtcs"`
+
+	// sensors overrides the built-in (1G DSM) sensor table
+	sensors []sensor.ProfileSensor
+}
+
+// Actuator is an actuator test command.
+type Actuator struct {
+	Name        string `json:"name"` // command name, e.g. "fuel-pump"
+	Addr        byte   `json:"addr"`
+	Description string `json:"description"`
+	Injector    bool   `json:"injector"` // injector cut, run with the engine idling; others need the engine off
+}
+
+// Definitions returns the vehicle's sensor table.
+func (v *Vehicle) Definitions() ([]sensor.Definition, error) {
+	defs := sensor.DefaultDefinitions()
+	if len(v.sensors) == 0 {
+		return defs, nil
+	}
+	defs, err := sensor.ApplyProfile(defs, &sensor.Profile{Name: v.Name, Sensors: v.sensors})
+	if err != nil {
+		return nil, fmt.Errorf("vehicle %s: %w", v.ID, err)
+	}
+	return defs, nil
+}
+
+// Fueling returns the stock fueling hardware of the vehicle.
+func (v *Vehicle) Fueling() sensor.Fueling {
+	f := sensor.StockFueling()
+	f.Cylinders = v.Cylinders
+	f.StockCC = v.InjectorCC
+	f.InjectorCC = v.InjectorCC
+	return f
+}
+
+// Actuator looks up an actuator command by name.
+func (v *Vehicle) Actuator(name string) (Actuator, bool) {
+	for _, a := range v.Actuators {
+		if a.Name == strings.ToLower(name) {
+			return a, true
+		}
+	}
+	return Actuator{}, false
+}
+
+// All returns every known vehicle, the default first.
+func All() []*Vehicle {
+	return vehicles
+}
+
+// Get returns the vehicle with the given ID. An empty ID returns the default.
+func Get(id string) (*Vehicle, error) {
+	if id == "" {
+		id = DefaultID
+	}
+	for _, v := range vehicles {
+		if v.ID == strings.ToLower(id) {
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown vehicle %q (have %s)", id, strings.Join(IDs(), ", "))
+}
+
+// ByCode returns the vehicle recorded with the given .mmcd header code, or nil.
+func ByCode(code byte) *Vehicle {
+	for _, v := range vehicles {
+		if v.Code == code {
+			return v
+		}
+	}
+	return nil
+}
+
+// IDs lists the vehicle IDs.
+func IDs() []string {
+	ids := make([]string, len(vehicles))
+	for i, v := range vehicles {
+		ids[i] = v.ID
+	}
+	return ids
+}
+
+// solenoids are the relay/solenoid tests common to all platforms.
+var solenoids = []Actuator{
+	{Name: "fuel-pump", Addr: 0xF6, Description: "Fuel pump relay"},
+	{Name: "purge", Addr: 0xF5, Description: "Canister purge solenoid"},
+	{Name: "pressure", Addr: 0xF4, Description: "Fuel pressure solenoid"},
+	{Name: "egr", Addr: 0xF3, Description: "EGR solenoid"},
+	{Name: "boost", Addr: 0xF1, Description: "Boost (wastegate) solenoid"},
+}
+
+// mvic is the variable induction control motor of the 6G72.
+var mvic = Actuator{Name: "mvic", Addr: 0xF2, Description: "MVIC motor"}
+
+// injectors returns the injector cut commands for n cylinders. Injector 1 is
+// 0xFC and each following injector one address lower.
+func injectors(n int) []Actuator {
+	out := make([]Actuator, n)
+	for i := range out {
+		out[i] = Actuator{
+			Name:        fmt.Sprintf("inj%d", i+1),
+			Addr:        0xFC - byte(i),
+			Description: fmt.Sprintf("Disable injector #%d", i+1),
+			Injector:    true,
+		}
+	}
+	return out
+}
+
+func actuators(groups ...[]Actuator) []Actuator {
+	var out []Actuator
+	for _, g := range groups {
+		out = append(out, g...)
+	}
+	return out
+}
+
+// dtcs returns the default fault table with some bits redefined.
+func dtcs(changes ...protocol.DTCCode) [16]protocol.DTCCode {
+	table := protocol.GetDTCTable()
+	for _, c := range changes {
+		table[c.Bit] = c
+	}
+	return table
+}
+
+var vehicles = []*Vehicle{
+	{
+		ID:         "1g-dsm",
+		Code:       1,
+		Name:       "1G DSM (1990-94 Eclipse/Talon/Laser)",
+		Engine:     "4G63 / 4G63T / 4G37",
+		Cylinders:  4,
+		InjectorCC: 450,
+		Actuators:  actuators(solenoids, injectors(4)),
+		DTCs:       dtcs(),
+	},
+	{
+		ID:         "2g-dsm",
+		Code:       2,
+		Name:       "2G DSM (1995-99 Eclipse/Talon)",
+		Engine:     "4G63T / 420A",
+		Cylinders:  4,
+		InjectorCC: 450,
+		Actuators:  actuators(solenoids, injectors(4)),
+		DTCs: dtcs(
+			protocol.DTCCode{Bit: 7, Code: "23", Description: "Camshaft position sensor"},
+		),
+		sensors: []sensor.ProfileSensor{
+			{Slug: "SPD", Addr: addr(0x2F), Description: "Vehicle speed", Unit: "km/h",
+				Convert: &sensor.Conversion{Kind: sensor.KindLinear, Scale: float(2), Decimals: intp(0)}},
+		},
+	},
+	{
+		ID:         "3000gt",
+		Code:       3,
+		Name:       "3000GT / Stealth (1991-96)",
+		Engine:     "6G72 / 6G72TT",
+		Cylinders:  6,
+		InjectorCC: 360,
+		Actuators:  actuators(solenoids, []Actuator{mvic}, injectors(6)),
+		DTCs: dtcs(
+			protocol.DTCCode{Bit: 0, Code: "11", Description: "Oxygen sensor (front bank)"},
+			protocol.DTCCode{Bit: 14, Code: "44", Description: "Ignition coil (cyl 1/4)"},
+			protocol.DTCCode{Bit: 15, Code: "52", Description: "Ignition coil (cyl 2/5, 3/6)"},
+		),
+		sensors: []sensor.ProfileSensor{
+			{Slug: "O2-R", Description: "O2 sensor (rear bank)"},
+			{Slug: "O2-F", Description: "O2 sensor (front bank)"},
+		},
+	},
+	{
+		ID:         "galant-vr4",
+		Code:       4,
+		Name:       "Galant VR-4 (1991-92)",
+		Engine:     "4G63T",
+		Cylinders:  4,
+		InjectorCC: 450,
+		Actuators:  actuators(solenoids, injectors(4)),
+		DTCs:       dtcs(),
+	},
+}
+
+func addr(a byte) *sensor.Addr { v := sensor.Addr(a); return &v }
+func float(f float64) *float64 { return &f }
+func intp(i int) *int          { return &i }
@@ -0,0 +1,94 @@
+package vehicle
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+func TestGet(t *testing.T) {
+	v, err := Get("")
+	if err != nil || v.ID != DefaultID {
+		t.Fatalf("Get(\"\") = %v, %v; want the default", v, err)
+	}
+	if v, err := Get("3000GT"); err != nil || v.Cylinders != 6 {
+		t.Errorf("Get(3000GT) = %v, %v", v, err)
+	}
+	if _, err := Get("evo"); err == nil || !strings.Contains(err.Error(), "galant-vr4") {
+		t.Errorf("Get(evo) err = %v, want the list of IDs", err)
+	}
+}
+
+func TestVehicles(t *testing.T) {
+	codes := make(map[byte]string)
+	for _, v := range All() {
+		if v.Code == 0 {
+			t.Errorf("%s: code 0 is reserved for 'not recorded'", v.ID)
+		}
+		if other, ok := codes[v.Code]; ok {
+			t.Errorf("%s and %s share code %d", v.ID, other, v.Code)
+		}
+		codes[v.Code] = v.ID
+		if ByCode(v.Code) != v {
+			t.Errorf("ByCode(%d) != %s", v.Code, v.ID)
+		}
+
+		injectors := 0
+		for _, a := range v.Actuators {
+			if a.Injector {
+				injectors++
+			}
+		}
+		if injectors != v.Cylinders {
+			t.Errorf("%s: %d injector tests for %d cylinders", v.ID, injectors, v.Cylinders)
+		}
+		if _, err := v.Definitions(); err != nil {
+			t.Errorf("%s: %v", v.ID, err)
+		}
+		if f := v.Fueling(); f.Cylinders != v.Cylinders || f.Validate() != nil {
+			t.Errorf("%s: stock fueling %+v", v.ID, f)
+		}
+	}
+}
+
+func TestActuators(t *testing.T) {
+	dsm, _ := Get("1g-dsm")
+	gt, _ := Get("3000gt")
+
+	for _, name := range []string{"inj5", "inj6", "mvic"} {
+		if _, ok := dsm.Actuator(name); ok {
+			t.Errorf("1G DSM should not have %s", name)
+		}
+		if _, ok := gt.Actuator(name); !ok {
+			t.Errorf("3000GT is missing %s", name)
+		}
+	}
+	if a, ok := gt.Actuator("INJ6"); !ok || a.Addr != 0xF7 {
+		t.Errorf("3000GT inj6 = %+v, want 0xF7", a)
+	}
+	if a, _ := dsm.Actuator("fuel-pump"); a.Addr != 0xF6 || a.Injector {
+		t.Errorf("fuel-pump = %+v", a)
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	v, _ := Get("2g-dsm")
+	defs, err := v.Definitions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, spd := sensor.FindBySlug(defs, "SPD")
+	if spd == nil || spd.Addr != 0x2F {
+		t.Errorf("2G DSM SPD = %+v", spd)
+	}
+	if v.DTCs[7].Description != "Camshaft position sensor" {
+		t.Errorf("2G DSM bit 7 = %+v", v.DTCs[7])
+	}
+
+	dsm, _ := Get("1g-dsm")
+	defs, _ = dsm.Definitions()
+	if _, d := sensor.FindBySlug(defs, "SPD"); d != nil {
+		t.Error("1G DSM should not have SPD")
+	}
+}
@@ -0,0 +1,212 @@
+package wideband
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// Decoder turns a controller's byte stream into readings. Bytes may arrive
+// in any chunks; a decoder keeps partial packets until they complete.
+type Decoder interface {
+	// Decode consumes bytes received at time at and returns the readings
+	// they complete, stamped with at.
+	Decode(p []byte, at time.Time) []Reading
+}
+
+// NewDecoder returns a decoder for format f.
+func NewDecoder(f Format) Decoder {
+	switch f {
+	case FormatAEM:
+		return &lineDecoder{parse: aemLambda}
+	case FormatVolts:
+		return &lineDecoder{parse: voltsLambda}
+	default:
+		return &isp2Decoder{}
+	}
+}
+
+// ISP2 packets are 16-bit big-endian words: a header giving the number of
+// words that follow, then the sub-packets of each device in the chain. An
+// LC-1 sub-packet is two words:
+//
+//	header  1 R 1 S x x x L7  1 L6 L5 L4 L3 L2 L1 L0     (L = payload words)
+//	word 1  0 1 0 F2 F1 F0 1 A7  0 A6 A5 A4 A3 A2 A1 A0  (F = function, A = AFR x10)
+//	word 2  0 0 L12 ... L7       0 L6 ... L0             (lambda x1000 - 500)
+//
+// Aux channels of other devices start with three zero bits and are skipped.
+const (
+	isp2HeaderMask = 0xA080
+	isp2HeaderBits = 0xA080
+	isp2LC1Mask    = 0xE280
+	isp2LC1Bits    = 0x4200
+)
+
+// ISP2 function codes of an LC-1 sub-packet.
+const (
+	isp2Lambda      = 0 // lambda valid
+	isp2O2Level     = 1 // lambda field is O2 level in 0.1%
+	isp2FreeAirCal  = 2 // free-air calibration in progress
+	isp2NeedFreeAir = 3 // free-air calibration needed
+	isp2Warmup      = 4 // lambda field is warm-up progress in 0.1%
+	isp2HeaterCal   = 5 // heater calibration
+	isp2ErrorCode   = 6 // lambda field is an error code
+)
+
+type isp2Decoder struct {
+	buf []byte
+}
+
+func (d *isp2Decoder) Decode(p []byte, at time.Time) []Reading {
+	d.buf = append(d.buf, p...)
+	var out []Reading
+	for len(d.buf) >= 2 {
+		h := word(d.buf)
+		if h&isp2HeaderMask != isp2HeaderBits {
+			d.buf = d.buf[1:] // resync on the next header
+			continue
+		}
+		n := 2 + 2*int((h>>1)&0x80|h&0x7F)
+		if len(d.buf) < n {
+			break
+		}
+		if r, ok := decodeISP2(d.buf[2:n]); ok {
+			r.Time = at
+			out = append(out, r)
+		}
+		d.buf = d.buf[n:]
+	}
+	d.buf = append([]byte(nil), d.buf...) // don't pin consumed bytes
+	return out
+}
+
+func word(b []byte) uint16 {
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+// decodeISP2 returns the reading of the first LC-1 sub-packet in payload.
+func decodeISP2(payload []byte) (Reading, bool) {
+	for i := 0; i+4 <= len(payload); i += 2 {
+		w1 := word(payload[i:])
+		if w1&isp2LC1Mask != isp2LC1Bits {
+			continue
+		}
+		w2 := word(payload[i+2:])
+		l := (w2>>1)&0x1F80 | w2&0x7F
+		r := Reading{Lambda: float64(l+500) / 1000}
+		switch (w1 >> 10) & 0x07 {
+		case isp2Lambda:
+			r.Status = StatusOK
+		case isp2O2Level:
+			r.Status = StatusLean
+		case isp2FreeAirCal, isp2NeedFreeAir, isp2HeaterCal:
+			r.Status = StatusCalibrating
+		case isp2Warmup:
+			r.Status = StatusWarmup
+		default:
+			r.Status = StatusError
+		}
+		return r, true
+	}
+	return Reading{}, false
+}
+
+// encodeISP2 builds the ISP2 packet of a single LC-1 reporting r.
+func encodeISP2(r Reading) []byte {
+	var fn uint16
+	switch r.Status {
+	case StatusOK:
+		fn = isp2Lambda
+	case StatusLean:
+		fn = isp2O2Level
+	case StatusWarmup:
+		fn = isp2Warmup
+	case StatusCalibrating:
+		fn = isp2FreeAirCal
+	default:
+		fn = isp2ErrorCode
+	}
+	afr := uint16(sensor.StoichAFR * 10)
+	l := uint16(clampInt(int(r.Lambda*1000+0.5)-500, 0, 0x1FFF))
+	words := []uint16{
+		0xB280 | 2, // recording off, sensor data, 2 words
+		isp2LC1Bits | fn<<10 | (afr&0x80)<<1 | afr&0x7F,
+		(l&0x1F80)<<1 | l&0x7F,
+	}
+	out := make([]byte, 0, 2*len(words))
+	for _, w := range words {
+		out = append(out, byte(w>>8), byte(w))
+	}
+	return out
+}
+
+func clampInt(v, lo, hi int) int {
+	return min(max(v, lo), hi)
+}
+
+// lineDecoder reads one ASCII value per line, as AEM controllers send.
+type lineDecoder struct {
+	line     []byte
+	overflow bool // line ran past maxLineLen; skip to its end
+	parse    func(v float64) (lambda float64, ok bool)
+}
+
+// maxLineLen bounds a line; longer ones are noise and dropped.
+const maxLineLen = 32
+
+func (d *lineDecoder) Decode(p []byte, at time.Time) []Reading {
+	var out []Reading
+	for _, b := range p {
+		if b != '\r' && b != '\n' {
+			if len(d.line) < maxLineLen {
+				d.line = append(d.line, b)
+			} else {
+				d.overflow = true
+			}
+			continue
+		}
+		if r, ok := d.reading(string(d.line)); ok && !d.overflow {
+			r.Time = at
+			out = append(out, r)
+		}
+		d.line, d.overflow = d.line[:0], false
+	}
+	return out
+}
+
+// reading parses the first number on a line.
+func (d *lineDecoder) reading(line string) (Reading, bool) {
+	for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			continue
+		}
+		lambda, ok := d.parse(v)
+		if !ok {
+			return Reading{Status: StatusError}, true
+		}
+		return Reading{Lambda: lambda, Status: StatusOK}, true
+	}
+	return Reading{}, false
+}
+
+// aemLambda reads an AEM serial value: lambda when below 3, else AFR.
+func aemLambda(v float64) (float64, bool) {
+	switch {
+	case v <= 0:
+		return 0, false
+	case v < 3:
+		return v, true
+	}
+	return v / sensor.StoichAFR, true
+}
+
+// voltsLambda reads a 0-5V analog output on the AEM scale.
+func voltsLambda(v float64) (float64, bool) {
+	if v < 0 || v > 5 {
+		return 0, false
+	}
+	return (7.3125 + 2.375*v) / sensor.StoichAFR, true
+}
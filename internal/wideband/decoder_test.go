@@ -0,0 +1,121 @@
+package wideband
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestISP2_RoundTrip(t *testing.T) {
+	dec := NewDecoder(FormatISP2)
+	now := time.Now()
+	for _, want := range []Reading{
+		{Lambda: 1.0, Status: StatusOK},
+		{Lambda: 0.78, Status: StatusOK},
+		{Lambda: 1.523, Status: StatusOK},
+		{Status: StatusWarmup},
+	} {
+		got := dec.Decode(encodeISP2(want), now)
+		if len(got) != 1 {
+			t.Fatalf("%+v: decoded %d readings", want, len(got))
+		}
+		if got[0].Status != want.Status || (want.Status == StatusOK && math.Abs(got[0].Lambda-want.Lambda) > 0.0005) {
+			t.Errorf("decoded %+v, want %+v", got[0], want)
+		}
+		if !got[0].Time.Equal(now) {
+			t.Errorf("time = %v, want %v", got[0].Time, now)
+		}
+	}
+}
+
+func TestISP2_Stream(t *testing.T) {
+	dec := NewDecoder(FormatISP2)
+	var stream []byte
+	stream = append(stream, 0x13, 0x00, 0x7F) // line noise before the first header
+	stream = append(stream, encodeISP2(Reading{Lambda: 0.9})...)
+	// An LM-1 style packet: two aux words before the LC-1 sub-packet
+	pkt := encodeISP2(Reading{Lambda: 1.1})
+	stream = append(stream, 0xB2, 0x84, 0x01, 0x23, 0x00, 0x45)
+	stream = append(stream, pkt[2:]...)
+
+	// Fed a byte at a time, readings complete with their last byte
+	var got []Reading
+	for _, b := range stream {
+		got = append(got, dec.Decode([]byte{b}, time.Now())...)
+	}
+	if len(got) != 2 || math.Abs(got[0].Lambda-0.9) > 0.0005 || math.Abs(got[1].Lambda-1.1) > 0.0005 {
+		t.Errorf("stream readings = %+v, want 0.9 and 1.1", got)
+	}
+}
+
+func TestISP2_Status(t *testing.T) {
+	tests := []struct {
+		fn   uint16
+		want Status
+	}{
+		{isp2Lambda, StatusOK},
+		{isp2O2Level, StatusLean},
+		{isp2FreeAirCal, StatusCalibrating},
+		{isp2NeedFreeAir, StatusCalibrating},
+		{isp2Warmup, StatusWarmup},
+		{isp2HeaterCal, StatusCalibrating},
+		{isp2ErrorCode, StatusError},
+	}
+	for _, tt := range tests {
+		w1 := isp2LC1Bits | tt.fn<<10 | 0x0100 | 0x13 // AFR 14.7
+		pkt := []byte{0xB2, 0x82, byte(w1 >> 8), byte(w1), 0x03, 0x74}
+		got := NewDecoder(FormatISP2).Decode(pkt, time.Now())
+		if len(got) != 1 || got[0].Status != tt.want {
+			t.Errorf("function %d: %+v, want %v", tt.fn, got, tt.want)
+		}
+	}
+}
+
+func TestLineDecoders(t *testing.T) {
+	tests := []struct {
+		format Format
+		input  string
+		want   []float64 // lambda; NaN for an error reading
+	}{
+		{FormatAEM, "14.7\r\n", []float64{1}},
+		{FormatAEM, "11.76\r\n0.85\r\n", []float64{0.8, 0.85}},
+		{FormatAEM, "AFR 16.17\n", []float64{1.1}},
+		{FormatAEM, "\r\nnoise\r\n-1\r\n", []float64{math.NaN()}},
+		{FormatVolts, "3.1105\r\n", []float64{1}},
+		{FormatVolts, "7.2\r\n", []float64{math.NaN()}},
+		{FormatAEM, "123456789012345678901234567890123456789\r\n14.7\r\n", []float64{1}},
+	}
+	for _, tt := range tests {
+		dec := NewDecoder(tt.format)
+		var got []Reading
+		for _, chunk := range []string{tt.input[:len(tt.input)/2], tt.input[len(tt.input)/2:]} {
+			got = append(got, dec.Decode([]byte(chunk), time.Now())...)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s %q: %d readings %+v, want %d", tt.format, tt.input, len(got), got, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if math.IsNaN(want) {
+				if got[i].Status != StatusError {
+					t.Errorf("%s %q: reading %d = %+v, want an error", tt.format, tt.input, i, got[i])
+				}
+				continue
+			}
+			if got[i].Status != StatusOK || math.Abs(got[i].Lambda-want) > 0.001 {
+				t.Errorf("%s %q: reading %d = %+v, want lambda %g", tt.format, tt.input, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"isp2": FormatISP2, "LC-1": FormatISP2, "aem": FormatAEM, "volts": FormatVolts} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseFormat("zeitronix"); err == nil {
+		t.Error("ParseFormat(zeitronix) should fail")
+	}
+}
@@ -0,0 +1,60 @@
+package wideband
+
+import (
+	"slices"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/logger"
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/stream"
+)
+
+// ReadingSource is where a Poller gets readings; Source implements it.
+type ReadingSource interface {
+	At(t time.Time) (Reading, bool)
+}
+
+// Poller merges wideband readings into the samples of another poller (the
+// ECU, the simulator or a replay), so the logger and its callbacks see WBO2
+// as one more channel.
+type Poller struct {
+	inner logger.SamplePoller
+	src   ReadingSource
+	defs  []sensor.Definition
+	idx   int // WBO2 index in defs
+}
+
+var _ logger.SamplePoller = (*Poller)(nil)
+
+// NewPoller wraps inner. idx is the WBO2 channel in defs, see
+// sensor.AddWideband.
+func NewPoller(inner logger.SamplePoller, src ReadingSource, defs []sensor.Definition, idx int) *Poller {
+	return &Poller{inner: inner, src: src, defs: defs, idx: idx}
+}
+
+// PollSensors polls inner, then sets WBO2 from the reading closest to the
+// middle of the poll sweep when WBO2 is among indices. Expression channels
+// are computed again so they can use WBO2.
+func (p *Poller) PollSensors(indices []int) (sensor.Sample, error) {
+	sample, err := p.inner.PollSensors(indices)
+	if err != nil || !slices.Contains(indices, p.idx) {
+		return sample, err
+	}
+	if Merge(&sample, p.src, p.idx) {
+		sample.ComputeDerivatives(p.defs)
+	}
+	return sample, nil
+}
+
+// Merge sets channel idx of s from the reading closest to the middle of its
+// poll sweep and reports whether there was a valid one. The channel time is
+// the reading's, or the sweep start for a reading taken just before it.
+func Merge(s *sensor.Sample, src ReadingSource, idx int) bool {
+	r, ok := src.At(stream.SweepMiddle(s))
+	if !ok || r.Status != StatusOK {
+		return false
+	}
+	s.SetValue(idx, r.Lambda*sensor.StoichAFR)
+	s.SetOffset(idx, max(0, r.Time.Sub(s.Time)))
+	return true
+}
@@ -0,0 +1,103 @@
+package wideband
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/logger"
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/sensor"
+	"github.com/kbuckham/mmcd/internal/stream"
+	"github.com/kbuckham/mmcd/internal/stream/streamtest"
+)
+
+// fixedSource returns readings from a fixed list.
+func fixedSource(rs ...Reading) stream.List[Reading] {
+	return stream.List[Reading]{Items: rs, MaxSkew: MaxSkew}
+}
+
+func TestMerge_TimeAligned(t *testing.T) {
+	defs, idx := streamtest.Defs(t, sensor.AddWideband)
+	streamtest.MergeTest[Reading]{
+		Merge: func(s *sensor.Sample, src stream.List[Reading]) bool { return Merge(s, src, idx) },
+		Items: func(start time.Time) []Reading {
+			return []Reading{
+				{Time: start.Add(-40 * time.Millisecond), Lambda: 0.80},
+				{Time: start.Add(88 * time.Millisecond), Lambda: 1.00},
+				{Time: start.Add(170 * time.Millisecond), Lambda: 1.20},
+			}
+		},
+		Want:    1,
+		MaxSkew: MaxSkew,
+		Check: func(t *testing.T, s *sensor.Sample, _ Reading) {
+			if got := s.Value(defs, idx, sensor.UnitMetric); math.Abs(got-14.7) > 0.01 {
+				t.Errorf("WBO2 = %g AFR, want the reading nearest mid-sweep (14.7)", got)
+			}
+		},
+	}.Run(t)
+
+	// Warm-up readings leave WBO2 absent
+	var s sensor.Sample
+	s.Time = time.Now()
+	if Merge(&s, fixedSource(Reading{Time: s.Time, Status: StatusWarmup}), idx) || s.HasData(idx) {
+		t.Error("merged a warm-up reading")
+	}
+}
+
+func TestPoller_Expressions(t *testing.T) {
+	defs, idx := streamtest.Defs(t, sensor.AddWideband)
+	defs, err := sensor.ApplyProfile(defs, &sensor.Profile{Sensors: []sensor.ProfileSensor{
+		{Slug: "LMBD", Expr: "WBO2 / 14.7", Decimals: intPtr(3)},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lmbd, _ := sensor.FindBySlug(defs, "LMBD")
+	sim := protocol.NewSimulator(defs)
+	src := fixedSource(Reading{Time: time.Now(), Lambda: 0.85})
+	indices := sensor.WithComputed(defs, []int{17, 14, idx})
+
+	var p logger.SamplePoller = NewPoller(sim, src, defs, idx)
+	s, err := p.PollSensors(indices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.HasData(idx) || !s.HasData(lmbd) {
+		t.Fatalf("WBO2 present %v, LMBD present %v", s.HasData(idx), s.HasData(lmbd))
+	}
+	if got := s.Value(defs, lmbd, sensor.UnitMetric); math.Abs(got-0.85) > 0.005 {
+		t.Errorf("LMBD = %g, want 0.85", got)
+	}
+
+	// Not selected, not merged
+	s, _ = p.PollSensors([]int{17})
+	if s.HasData(idx) {
+		t.Error("WBO2 merged although not selected")
+	}
+}
+
+func TestSource_Simulator(t *testing.T) {
+	ln, port := streamtest.Listen(t)
+	sim := NewSimulator(FormatAEM)
+	sim.warmup = 0
+	sim.interval = 10 * time.Millisecond
+	go sim.ServeListener(ln)
+
+	src, err := Open(port, 0, FormatAEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	streamtest.WaitCount(src, 3)
+	r, ok := src.At(time.Now())
+	if !ok || r.Status != StatusOK || r.Lambda < 0.9 || r.Lambda > 1.1 {
+		t.Fatalf("At(now) = %+v, %v after %d readings; want idle lambda near 1", r, ok, src.Count())
+	}
+	if latest, _ := src.Latest(); latest.Time.Before(r.Time) {
+		t.Errorf("Latest %v older than At %v", latest.Time, r.Time)
+	}
+}
+
+func intPtr(v int) *int { return &v }
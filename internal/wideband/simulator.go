@@ -0,0 +1,127 @@
+package wideband
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/stream"
+)
+
+// Simulator streams fake controller output in a given format, for testing
+// the wideband input without a controller. Lambda follows the same 60-second
+// driving cycle as protocol.Simulator: around stoich at idle and cruise,
+// rich under acceleration and lean on the overrun. The first readings report
+// the sensor warming up.
+type Simulator struct {
+	format   Format
+	interval time.Duration // time between readings
+	warmup   time.Duration
+	start    time.Time
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewSimulator returns a simulator sending f at the controller's rate: 12
+// readings a second for ISP2 (an LC-1's 81.92 ms packets), 10 for ASCII.
+func NewSimulator(f Format) *Simulator {
+	interval := 100 * time.Millisecond
+	if f == FormatISP2 {
+		interval = 81920 * time.Microsecond
+	}
+	return &Simulator{
+		format:   f,
+		interval: interval,
+		warmup:   2 * time.Second,
+		start:    time.Now(),
+		rng:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// ReadingAt returns the simulated reading at time t.
+func (s *Simulator) ReadingAt(t time.Time) Reading {
+	elapsed := t.Sub(s.start)
+	if elapsed < s.warmup {
+		return Reading{Time: t, Status: StatusWarmup}
+	}
+	return Reading{Time: t, Lambda: s.lambdaAt(elapsed.Seconds()), Status: StatusOK}
+}
+
+// At implements ReadingSource, so the simulator can feed a Poller directly
+// in demo mode without a byte stream.
+func (s *Simulator) At(t time.Time) (Reading, bool) {
+	return s.ReadingAt(t), true
+}
+
+// lambdaAt returns the lambda target at simulation time t (seconds), with
+// the same cycle phases as the ECU simulator.
+func (s *Simulator) lambdaAt(t float64) float64 {
+	cyclePos := math.Mod(t, 60.0)
+	var lambda float64
+	switch {
+	case cyclePos < 10 || cyclePos >= 50: // idle: closed loop swings about stoich
+		lambda = 1.0 + 0.03*math.Sin(t*3.0)
+	case cyclePos < 20: // acceleration: power enrichment
+		lambda = 0.95 - (cyclePos-10)/10.0*0.17 // down to 0.78
+	case cyclePos < 40: // cruise
+		lambda = 1.0 + 0.02*math.Sin(t*3.0)
+	default: // deceleration: fuel cut
+		lambda = 1.2 + (cyclePos-40)/10.0*0.4
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return lambda + (s.rng.Float64()-0.5)*0.01
+}
+
+// encode returns the bytes the controller sends for r.
+func (s *Simulator) encode(r Reading) []byte {
+	switch s.format {
+	case FormatAEM:
+		return []byte(strconv.FormatFloat(r.AFR(), 'f', 1, 64) + "\r\n")
+	case FormatVolts:
+		v := (r.AFR() - 7.3125) / 2.375
+		return []byte(strconv.FormatFloat(math.Min(math.Max(v, 0), 5), 'f', 3, 64) + "\r\n")
+	default:
+		return encodeISP2(r)
+	}
+}
+
+// Serve writes readings to w at the controller's rate until a write fails.
+func (s *Simulator) Serve(w io.Writer) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		r := s.ReadingAt(now)
+		if s.format != FormatISP2 && r.Status != StatusOK {
+			continue // ASCII controllers send nothing until warmed up
+		}
+		if _, err := w.Write(s.encode(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServePTY streams on the master side of a pseudo-terminal until the PTY
+// is closed.
+func (s *Simulator) ServePTY(pty *protocol.PTY) error {
+	return stream.ServePTY(pty, s.Serve)
+}
+
+// ServeListener streams to each connection on ln in turn. It returns when
+// the listener is closed.
+func (s *Simulator) ServeListener(ln net.Listener) error {
+	return stream.ServeListener(ln, "wideband", s.Serve)
+}
+
+// String describes the simulated controller.
+func (s *Simulator) String() string {
+	return fmt.Sprintf("%s at %d baud, %.1f readings/s", s.format, s.format.BaudRate(), float64(time.Second)/float64(s.interval))
+}
@@ -0,0 +1,60 @@
+package wideband
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/protocol"
+	"github.com/kbuckham/mmcd/internal/stream"
+)
+
+// history is how long a Source keeps readings for At.
+const history = 2 * time.Second
+
+// MaxSkew is how far a reading may be from the time asked for in At.
+// Controllers send 10-20 readings a second, so an older one means the
+// stream has stopped.
+const MaxSkew = 500 * time.Millisecond
+
+// Source reads a controller's stream in the background and keeps its recent
+// readings.
+type Source struct {
+	*stream.Source[Reading]
+	format Format
+}
+
+// Open connects to a controller on port, a serial device or a network
+// bridge address as accepted by protocol.NewTransport, and starts reading.
+// baud 0 uses the format's speed.
+func Open(port string, baud int, f Format) (*Source, error) {
+	if baud <= 0 {
+		baud = f.BaudRate()
+	}
+	conn, err := stream.Dial(port, baud, f.BaudRate())
+	if err != nil {
+		return nil, fmt.Errorf("wideband: %w", err)
+	}
+	return NewSource(conn, f), nil
+}
+
+// NewSource starts reading format f from an open transport. Close closes
+// the transport.
+func NewSource(conn protocol.Transport, f Format) *Source {
+	s := &Source{
+		Source: stream.NewSource(conn, NewDecoder(f), stream.Options{
+			Name:    "wideband",
+			History: history,
+			MaxSkew: MaxSkew,
+			BufSize: 256,
+		}),
+		format: f,
+	}
+	slog.Info("wideband input started", "format", f)
+	return s
+}
+
+// Format returns the stream format being read.
+func (s *Source) Format() Format {
+	return s.format
+}
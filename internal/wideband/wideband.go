@@ -0,0 +1,98 @@
+// Package wideband reads a wideband O2 controller on a second serial port and
+// merges its readings into ECU samples as the WBO2 channel.
+//
+// Two stream formats are supported: Innovate's ISP2 serial protocol (LC-1,
+// LC-2 and other MTS devices) and AEM-style ASCII lines, either AFR/lambda
+// values or the voltage of a 0-5V analog output.
+package wideband
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kbuckham/mmcd/internal/sensor"
+)
+
+// Format is the byte stream a controller sends.
+type Format string
+
+const (
+	// FormatISP2 is Innovate Serial Protocol 2 (LC-1, LC-2), 19200 baud.
+	FormatISP2 Format = "isp2"
+	// FormatAEM is one ASCII AFR or lambda value per line (AEM UEGO
+	// serial output), 9600 baud.
+	FormatAEM Format = "aem"
+	// FormatVolts is one ASCII voltage per line, read on the AEM 0-5V
+	// scale (AFR = 7.3125 + 2.375 V), 9600 baud.
+	FormatVolts Format = "volts"
+)
+
+// Formats lists the format names ParseFormat accepts.
+var Formats = []string{string(FormatISP2), string(FormatAEM), string(FormatVolts)}
+
+// ParseFormat returns the format named s. "lc1", "lc2" and "innovate" are
+// accepted for ISP2.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "isp2", "lc1", "lc-1", "lc2", "lc-2", "innovate":
+		return FormatISP2, nil
+	case "aem":
+		return FormatAEM, nil
+	case "volts", "voltage", "0-5v":
+		return FormatVolts, nil
+	}
+	return "", fmt.Errorf("unknown wideband format %q (have %s)", s, strings.Join(Formats, ", "))
+}
+
+// BaudRate returns the serial speed the format's controllers use.
+func (f Format) BaudRate() int {
+	if f == FormatISP2 {
+		return 19200
+	}
+	return 9600
+}
+
+// Status is the state a controller reports with a reading.
+type Status int
+
+const (
+	StatusOK          Status = iota // Lambda is valid
+	StatusLean                      // leaner than the sensor can measure (free air)
+	StatusWarmup                    // heater warming up
+	StatusCalibrating               // free-air or heater calibration
+	StatusError                     // sensor or controller error
+)
+
+// String returns a short lower-case name for s.
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusLean:
+		return "lean"
+	case StatusWarmup:
+		return "warmup"
+	case StatusCalibrating:
+		return "calibrating"
+	default:
+		return "error"
+	}
+}
+
+// Reading is one value from the controller.
+type Reading struct {
+	Time   time.Time
+	Lambda float64 // only meaningful when Status is StatusOK
+	Status Status
+}
+
+// Received returns when the reading arrived.
+func (r Reading) Received() time.Time {
+	return r.Time
+}
+
+// AFR returns the reading as gasoline air/fuel ratio.
+func (r Reading) AFR() float64 {
+	return r.Lambda * sensor.StoichAFR
+}